@@ -17,6 +17,7 @@ import (
 
 func main() {
 	url := flag.String("url", "https://localhost:4443", "URL of Website (root)")
+	recipient := flag.String("recipient", "", "Address the emails are sent to, which decides the queue of new tickets")
 	flag.Parse()
 
 	reader := bufio.NewReader(os.Stdin)
@@ -47,7 +48,7 @@ func main() {
 		subject := readInput(reader, "subject", hasText)
 		message := readInput(reader, "message", hasText)
 
-		if email, err := pushEmail(*url, emailAddress, subject, message); err == nil {
+		if email, err := pushEmail(*url, *recipient, emailAddress, subject, message); err == nil {
 			fmt.Println("Successfully pushed the email with the following content:")
 			fmt.Printf("\tE-Mail: %s\n", email.EMailAddress)
 			fmt.Printf("\tSubject: %s\n", email.Subject)
@@ -76,8 +77,8 @@ func readInput(reader *bufio.Reader, name string, checkInput func(string) bool)
 	}
 }
 
-func pushEmail(url, emailAddress, subject, message string) (utils.MailData, error) {
-	req := utils.Request{Mail: utils.MailData{EMailAddress: emailAddress, Subject: subject, Message: message}}
+func pushEmail(url, recipient, emailAddress, subject, message string) (utils.MailData, error) {
+	req := utils.Request{Mail: utils.MailData{EMailAddress: emailAddress, Subject: subject, Message: message, Recipient: recipient}}
 	buf, err := xml.Marshal(req)
 	if err != nil {
 		return utils.MailData{}, err
@@ -34,7 +34,7 @@ func TestPushEmail(t *testing.T) {
 	done := make(chan bool)
 	go webserver.StartServer(done, shutdown)
 
-	email, err := pushEmail("https://localhost:"+strconv.Itoa(config.Port), "test@gmail.com", "Test Subject", "Test Message")
+	email, err := pushEmail("https://localhost:"+strconv.Itoa(config.Port), "", "test@gmail.com", "Test Subject", "Test Message")
 	assert.Nil(t, err)
 	assert.NotNil(t, email)
 
@@ -4,6 +4,7 @@ package main
 
 import (
 	"TicketSystem/config"
+	"TicketSystem/utils"
 	"TicketSystem/webserver"
 	"bufio"
 	"flag"
@@ -14,8 +15,19 @@ import (
 	"strings"
 )
 
+// Commands for the data folder which are run instead of starting the server
+type dataCommand struct {
+	backupPath  string
+	restorePath string
+	migrate     bool
+}
+
 func main() {
-	handleFlags()
+	command := handleFlags()
+	if command.isSet() {
+		command.run()
+		return
+	}
 
 	shutdown := make(chan bool)
 	done := make(chan bool)
@@ -41,25 +53,161 @@ func main() {
 	<-shutdown
 }
 
-func handleFlags() {
-	flag.String("data", config.DataPath, "Path to data folder")
+// Applies the flags to the configuration and returns the command for the data folder, which is empty if the server should be started
+func handleFlags() dataCommand {
+	dataPath := flag.String("data", config.DataPath, "Path to data folder")
 	serverCertPath := flag.String("cert", config.ServerCertPath, "Path to server certificate")
 	serverKeyPath := flag.String("key", config.ServerKeyPath, "Path to server key")
 	templatePath := flag.String("templates", config.TemplatePath, "Path to templates folder")
+	mailTemplatePath := flag.String("mailtemplates", config.MailTemplatePath, "Path to mail templates folder")
+	defaultLanguage := flag.String("language", config.DefaultLanguage, "Language of the mails if the language of the customer is unknown")
+	mailSignature := flag.String("signature", config.MailSignature, "Signature of the mails to the customers (a default one of the templates if empty)")
 	port := flag.Int("port", config.Port, "Port on which the server should run")
 	debugMode := flag.Bool("debug", config.DebugMode, "Decides the mode the server should run on")
+	ackWeb := flag.Bool("ackweb", config.AcknowledgeWebTickets, "Send an acknowledgement for tickets created on the website")
+	ackMail := flag.Bool("ackmail", config.AcknowledgeMailTickets, "Send an acknowledgement for tickets created by mail")
+	closureNotices := flag.Bool("closurenotice", config.SendClosureNotices, "Send a notice to the customer when a ticket is closed")
+	admins := flag.String("admins", strings.Join(config.Admins, ","), "Comma separated list of usernames with administrator rights")
+	baseURL := flag.String("baseurl", config.BaseURL, "URL under which the customers reach the server, used for the links in the mails (https://localhost:<port> if empty)")
+	portalSecret := flag.String("portalsecret", config.PortalSecret, "Secret used to sign the access links of the customer portal (random if empty)")
+	webhookURLs := flag.String("webhooks", strings.Join(config.WebhookURLs, ","), "Comma separated list of URLs which receive the ticket events")
+	webhookSecret := flag.String("webhooksecret", config.WebhookSecret, "Secret used to sign the webhook payloads, required if webhooks are configured")
+	webhookHistory := flag.Int("webhookhistory", config.WebhookHistory, "Number of webhook deliveries kept in the delivery log (0 keeps all of them)")
+	slaWarningAfter := flag.Duration("slawarning", config.SLAWarningAfter, "Time after which editors are warned about unanswered customer messages (0 disables the warnings)")
+	digestInterval := flag.Duration("digest", config.DigestInterval, "Interval in which the notification digests are sent")
+	reminderAfter := flag.Duration("remindafter", config.ReminderAfter, "Time without an answer of the customer until a reminder is sent (0 disables the reminders)")
+	autoCloseAfter := flag.Duration("autocloseafter", config.AutoCloseAfter, "Time after the reminder until a ticket without an answer is closed (0 disables the auto-close)")
+	escalationAfter := flag.Duration("escalateafter", config.EscalationAfter, "Time without activity until an in process ticket is assigned to the fallback editor (0 disables the escalation)")
+	fallbackEditor := flag.String("fallbackeditor", config.FallbackEditor, "Username of the editor who receives escalated tickets (no escalation if empty)")
+	autoAssignment := flag.String("autoassign", config.AutoAssignment, "Strategy to assign new tickets automatically: roundrobin, load, skill (assigns tickets once they got tags by a rule or an editor) or empty to assign them manually")
+	editorCapacity := flag.Int("capacity", config.EditorCapacity, "Default maximum number of unfinished tickets per editor for the automatic assignment (0 means no limit)")
+	backupPath := flag.String("backup", "", "Write a snapshot of the data folder to this archive and exit instead of starting the server, "+
+		"refuses to run while a server uses the data folder (download /data/backup from the running server instead)")
+	restorePath := flag.String("restore", "", "Replace the data folder with the snapshot of this archive and exit, refuses to run while a server uses the data folder")
+	storageBackend := flag.String("storage", config.StorageBackend, "Storage of the tickets: xml for one file per ticket or log for a single append-only file")
+	migrate := flag.Bool("migrate", false, "Copy the tickets of the other storage backend into the one of -storage and exit, refuses to run while a server uses the data folder")
 	flag.Parse()
 
 	if !checkPortBoundaries(*port) {
 		log.Fatalf("Invalid port %d", *port)
 	}
-	handlePaths(*serverCertPath, *serverKeyPath, *templatePath)
+	if *baseURL != "" && !strings.HasPrefix(*baseURL, "https://") {
+		log.Fatalf("Invalid base URL %s, the server is only reachable through HTTPS", *baseURL)
+	}
+	if len(splitList(*webhookURLs)) > 0 && *webhookSecret == "" {
+		log.Fatal("The webhooks need a secret to sign their payloads, set it with -webhooksecret")
+	}
+	if !utils.IsStorageBackend(*storageBackend) {
+		log.Fatalf("Invalid storage backend %s", *storageBackend)
+	}
+	if !utils.IsAssignmentStrategy(*autoAssignment) {
+		log.Fatalf("Invalid assignment strategy %s", *autoAssignment)
+	}
+	handlePaths(*serverCertPath, *serverKeyPath, *templatePath, *mailTemplatePath)
 
+	config.DataPath = *dataPath
 	config.ServerCertPath = *serverCertPath
 	config.ServerKeyPath = *serverKeyPath
 	config.TemplatePath = *templatePath
+	config.MailTemplatePath = *mailTemplatePath
+	config.DefaultLanguage = *defaultLanguage
+	config.MailSignature = *mailSignature
 	config.Port = *port
 	config.DebugMode = *debugMode
+	config.StorageBackend = *storageBackend
+	config.AcknowledgeWebTickets = *ackWeb
+	config.AcknowledgeMailTickets = *ackMail
+	config.SendClosureNotices = *closureNotices
+	config.Admins = splitList(*admins)
+	config.BaseURL = *baseURL
+	config.PortalSecret = *portalSecret
+	config.WebhookURLs = splitList(*webhookURLs)
+	config.WebhookSecret = *webhookSecret
+	config.WebhookHistory = *webhookHistory
+	config.SLAWarningAfter = *slaWarningAfter
+	config.DigestInterval = *digestInterval
+	config.ReminderAfter = *reminderAfter
+	config.AutoCloseAfter = *autoCloseAfter
+	config.EscalationAfter = *escalationAfter
+	config.FallbackEditor = *fallbackEditor
+	config.AutoAssignment = *autoAssignment
+	config.EditorCapacity = *editorCapacity
+
+	command := dataCommand{backupPath: *backupPath, restorePath: *restorePath, migrate: *migrate}
+	if (command.backupPath != "" && command.restorePath != "") || (command.migrate && (command.backupPath != "" || command.restorePath != "")) {
+		log.Fatal("Only one of -backup, -restore and -migrate can be used")
+	}
+	return command
+}
+
+func (command dataCommand) isSet() bool {
+	return command.backupPath != "" || command.restorePath != "" || command.migrate
+}
+
+// Writes or restores a snapshot of the data folder or migrates the tickets to the configured storage backend. The
+// commands run in their own process, so they can't pause the writes of a running server and refuse to run beside it
+func (command dataCommand) run() {
+	err := utils.CheckDataFolderUnlocked()
+	if err != nil {
+		log.Fatalf("Cannot run the command: %v", err)
+	}
+
+	if command.migrate {
+		source := utils.StorageXML
+		if config.StorageBackend == utils.StorageXML {
+			source = utils.StorageLog
+		}
+		count, err := utils.MigrateTicketStorage(source)
+		if err != nil {
+			log.Fatalf("Cannot migrate the tickets after %d of them: %v", count, err)
+		}
+		log.Printf("Copied %d tickets from the %s storage to the %s storage, start the server with -storage %s to use them",
+			count, source, config.StorageBackend, config.StorageBackend)
+		return
+	}
+
+	if command.backupPath != "" {
+		file, err := os.Create(command.backupPath)
+		if err != nil {
+			log.Fatalf("Cannot create the backup %s: %v", command.backupPath, err)
+		}
+		manifest, err := utils.WriteBackup(file)
+		if err == nil {
+			err = file.Close()
+		}
+		if err != nil {
+			log.Fatalf("Cannot write the backup %s: %v", command.backupPath, err)
+		}
+		log.Printf("Wrote %d files of %s to %s", len(manifest.Files), config.DataPath, command.backupPath)
+		return
+	}
+
+	file, err := os.Open(command.restorePath)
+	if err != nil {
+		log.Fatalf("Cannot open the backup %s: %v", command.restorePath, err)
+	}
+	defer file.Close()
+	manifest, previousPath, err := utils.RestoreBackup(file)
+	if err != nil {
+		log.Fatalf("Cannot restore the backup %s: %v", command.restorePath, err)
+	}
+	log.Printf("Restored %d files of the snapshot from %s", len(manifest.Files), manifest.CreationDate.Format("2006-01-02 15:04:05"))
+	if previousPath != "" {
+		log.Printf("The previous data was moved to %s", previousPath)
+	}
+}
+
+// Splits a comma separated flag value into its trimmed, non empty elements
+func splitList(list string) []string {
+	var elements []string
+	for _, element := range strings.Split(list, ",") {
+		element = strings.TrimSpace(element)
+		if element != "" {
+			elements = append(elements, element)
+		}
+	}
+
+	return elements
 }
 
 func checkPortBoundaries(port int) bool {
@@ -36,3 +36,17 @@ func TestExistsPath(t *testing.T) {
 		assert.Equal(t, d.expected, existsPath(d.path))
 	}
 }
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		list     string
+		expected []string
+	}{
+		{"", nil},
+		{"https://a.example", []string{"https://a.example"}},
+		{" https://a.example , ,https://b.example", []string{"https://a.example", "https://b.example"}},
+	}
+	for _, d := range tests {
+		assert.Equal(t, d.expected, splitList(d.list))
+	}
+}
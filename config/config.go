@@ -5,17 +5,60 @@ package config
 import (
 	"path"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var (
-	DataPath       = "data"
-	ServerCertPath = path.Join("etc", "server.crt")
-	ServerKeyPath  = path.Join("etc", "server.key")
-	TemplatePath   = "templates"
-	Port           = 4443
-	DebugMode      = true
+	DataPath         = "data"
+	ServerCertPath   = path.Join("etc", "server.crt")
+	ServerKeyPath    = path.Join("etc", "server.key")
+	TemplatePath     = "templates"
+	MailTemplatePath = "mailtemplates"
+	DefaultLanguage  = "en"
+	MailSignature    = ""
+	Port             = 4443
+	DebugMode        = true
+	StorageBackend   = "xml" // Storage of the tickets, "xml" or "log"
+	Admins           []string
+
+	AcknowledgeWebTickets  = true
+	AcknowledgeMailTickets = true
+	SendClosureNotices     = true
+
+	SLAWarningAfter      = 24 * time.Hour
+	NotificationInterval = time.Minute
+	DigestInterval       = time.Hour
+
+	ReminderAfter     = 7 * 24 * time.Hour // Time without an answer of the customer until a reminder is sent
+	AutoCloseAfter    = 7 * 24 * time.Hour // Time after the reminder until the ticket is closed
+	EscalationAfter   = 3 * 24 * time.Hour // Time without any activity of the editor until the ticket is escalated
+	FallbackEditor    = ""
+	SchedulerInterval = time.Minute
+
+	AutoAssignment = ""
+	EditorCapacity = 0
+
+	BaseURL               = "" // URL of the server in the links of the mails to the customers
+	PortalSecret          = ""
+	PortalLinkValidity    = 15 * time.Minute
+	PortalSessionValidity = time.Hour
+
+	WebhookURLs        []string
+	WebhookSecret      = ""
+	WebhookMaxAttempts = 3
+	WebhookRetryDelay  = 5 * time.Second
+	WebhookHistory     = 1000 // Number of deliveries kept in the delivery log, the oldest ones are removed first
 )
 
+// Returns the configured base URL without a trailing slash or the local address of the server if it is empty
+func ServerURL() string {
+	if BaseURL != "" {
+		return strings.TrimRight(BaseURL, "/")
+	}
+	return "https://localhost:" + strconv.Itoa(Port)
+}
+
 func UsersPath() string {
 	return path.Join(DataPath, "users")
 }
@@ -32,6 +75,10 @@ func TicketXMLPath(id int) string {
 	return path.Join(TicketsPath(), "ticket"+strconv.Itoa(id)+".xml")
 }
 
+func TicketLogFilePath() string {
+	return path.Join(DataPath, "tickets.log")
+}
+
 func DefinitionsFilePath() string {
 	return path.Join(DataPath, "definitions.xml")
 }
@@ -39,3 +86,60 @@ func DefinitionsFilePath() string {
 func MailFilePath() string {
 	return path.Join(DataPath, "mails.xml")
 }
+
+func WebhooksFilePath() string {
+	return path.Join(DataPath, "webhooks.xml")
+}
+
+func AuditLogFilePath() string {
+	return path.Join(DataPath, "audit.log")
+}
+
+func NotificationsFilePath() string {
+	return path.Join(DataPath, "notifications.xml")
+}
+
+func CannedResponsesFilePath() string {
+	return path.Join(DataPath, "cannedresponses.xml")
+}
+
+func MacrosFilePath() string {
+	return path.Join(DataPath, "macros.xml")
+}
+
+func RulesFilePath() string {
+	return path.Join(DataPath, "rules.xml")
+}
+
+func CustomersFilePath() string {
+	return path.Join(DataPath, "customers.xml")
+}
+
+func PortalLinksFilePath() string {
+	return path.Join(DataPath, "portallinks.xml")
+}
+
+func QueuesFilePath() string {
+	return path.Join(DataPath, "queues.xml")
+}
+
+func SchedulerFilePath() string {
+	return path.Join(DataPath, "scheduler.xml")
+}
+
+func FieldsFilePath() string {
+	return path.Join(DataPath, "fields.xml")
+}
+
+func ViewsFilePath() string {
+	return path.Join(DataPath, "views.xml")
+}
+
+func AssignmentFilePath() string {
+	return path.Join(DataPath, "assignment.xml")
+}
+
+// Exists while a server uses the data folder
+func LockFilePath() string {
+	return path.Join(DataPath, "server.lock")
+}
@@ -0,0 +1,118 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"fmt"
+	"time"
+)
+
+// Layout of the dates of absences in the forms
+const AbsenceDateLayout = "2006-01-02"
+
+// Scheduled absence of an editor. When it starts, the tickets of the editor are handed over to the delegate
+// or released if there is no available delegate
+type Absence struct {
+	From            time.Time `xml:"From"`
+	To              time.Time `xml:"To"` // Last day of the absence
+	Delegate        string    `xml:"Delegate"`
+	NotifyCustomers bool      `xml:"NotifyCustomers"` // Informs the customers that another editor handles their ticket
+}
+
+func (absence Absence) IsScheduled() bool {
+	return !absence.From.IsZero()
+}
+
+// Describes the absence, e.g. for the audit log. Absences which are not scheduled are empty
+func (absence Absence) String() string {
+	if !absence.IsScheduled() {
+		return ""
+	}
+
+	text := absence.From.Format(AbsenceDateLayout) + " to " + absence.To.Format(AbsenceDateLayout)
+	if absence.Delegate != "" {
+		text += ", delegate " + absence.Delegate
+	}
+	if absence.NotifyCustomers {
+		text += ", customers are notified"
+	}
+	return text
+}
+
+// Checks if the absence includes the point in time, the whole last day belongs to the absence
+func (absence Absence) Covers(now time.Time) bool {
+	return absence.IsScheduled() && !now.Before(absence.From) && now.Before(absence.To.AddDate(0, 0, 1))
+}
+
+// Checks if the user is in the holiday mode or their scheduled absence includes the point in time
+func (user User) IsAbsent(now time.Time) bool {
+	return user.HolidayMode || user.Absence.Covers(now)
+}
+
+// Checks if tickets can be assigned to the user at the moment
+func (user User) IsAvailable() bool {
+	return !user.IsAbsent(schedulerClock.Now())
+}
+
+// Schedules the absence of the user, an absence without a start removes the scheduled one
+func SetUserAbsence(name string, absence Absence) error {
+	if absence.IsScheduled() {
+		if absence.To.Before(absence.From) {
+			return fmt.Errorf("the absence must not end before it starts")
+		}
+		if absence.Delegate == name {
+			return fmt.Errorf("users can't delegate their tickets to themselves")
+		}
+	} else {
+		absence = Absence{}
+	}
+
+	if absence.Delegate != "" {
+		users, err := ReadUsers()
+		if err != nil {
+			return err
+		}
+		if _, ok := users[absence.Delegate]; !ok {
+			return fmt.Errorf("the delegate %s does not exist", absence.Delegate)
+		}
+	}
+
+	return updateUser(name, func(user *User) {
+		user.Absence = absence
+	})
+}
+
+// Returns the editor of the ticket if their scheduled absence has started
+func absentEditor(users map[string]User, ticket Ticket, now time.Time) (User, bool) {
+	if ticket.Status != TicketStatusInProcess {
+		return User{}, false
+	}
+
+	editor, ok := users[ticket.Editor]
+	return editor, ok && editor.Absence.Covers(now)
+}
+
+// Hands the ticket of the absent editor over to their delegate. The ticket is released if the delegate is absent
+// as well or can't access the queue of the ticket
+func handOverTicket(ticket Ticket, absent User, users map[string]User) (Ticket, EventType, error) {
+	until := absent.Absence.To.Format(AbsenceDateLayout)
+	delegate, ok := users[absent.Absence.Delegate]
+	if ok && delegate.IsAvailable() && CanAccessTicket(delegate, ticket) {
+		ticket, err := AddSystemMessage(ticket, fmt.Sprintf("Handed over from %s to %s, because %s is absent until %s", absent.Username, delegate.Username, absent.Username, until))
+		if err != nil {
+			return ticket, "", err
+		}
+
+		ticket.Editor = delegate.Username
+		return ticket, EventTicketAssigned, StoreTicket(ticket)
+	}
+
+	ticket, err := AddSystemMessage(ticket, fmt.Sprintf("Released, because %s is absent until %s and there is no available delegate", absent.Username, until))
+	if err != nil {
+		return ticket, "", err
+	}
+
+	ticket.Editor = ""
+	ticket.Status = TicketStatusOpen
+	return ticket, EventTicketReleased, StoreTicket(ticket)
+}
@@ -0,0 +1,112 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Returns the start of the day which is the specified number of days away from today
+func day(offset int) time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day()+offset, 0, 0, 0, 0, time.Local)
+}
+
+func TestAbsenceCovers(t *testing.T) {
+	absence := Absence{From: day(1), To: day(2)}
+	assert.False(t, absence.Covers(day(1).Add(-time.Minute)))
+	assert.True(t, absence.Covers(day(1)))
+	assert.True(t, absence.Covers(day(3).Add(-time.Minute)))
+	assert.False(t, absence.Covers(day(3)))
+	assert.False(t, Absence{}.Covers(time.Now()))
+
+	assert.True(t, User{HolidayMode: true}.IsAbsent(time.Now()))
+	assert.False(t, User{Absence: absence}.IsAbsent(time.Now()))
+}
+
+func TestSetUserAbsence(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna", "Bert")
+
+	assert.NotNil(t, SetUserAbsence("Anna", Absence{From: day(2), To: day(1)}))
+	assert.NotNil(t, SetUserAbsence("Anna", Absence{From: day(1), To: day(2), Delegate: "Anna"}))
+	assert.NotNil(t, SetUserAbsence("Anna", Absence{From: day(1), To: day(2), Delegate: "Carl"}))
+	assert.NotNil(t, SetUserAbsence("Carl", Absence{}))
+
+	assert.Nil(t, SetUserAbsence("Anna", Absence{From: day(0), To: day(1), Delegate: "Bert"}))
+	users, err := ReadUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, "Bert", users["Anna"].Absence.Delegate)
+	assert.False(t, users["Anna"].IsAvailable())
+
+	// Absent editors don't receive tickets automatically
+	loads, err := GetEditorLoads()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(loads))
+	assert.Equal(t, "Bert", loads[0].Username)
+
+	// Without a start the absence is removed completely
+	assert.Nil(t, SetUserAbsence("Anna", Absence{Delegate: "Bert"}))
+	users, err = ReadUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, Absence{}, users["Anna"].Absence)
+}
+
+func TestSchedulerHandover(t *testing.T) {
+	setup()
+	defer teardown()
+
+	clock, reset := useFakeClock()
+	defer reset()
+
+	createEditors(t, "Anna", "Bert", "Carl")
+	assert.Nil(t, SetUserAbsence("Anna", Absence{From: day(1), To: day(3), Delegate: "Bert", NotifyCustomers: true}))
+	assert.Nil(t, SetUserAbsence("Carl", Absence{From: day(1), To: day(3), Delegate: "Anna"}))
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeEditor(ticket.ID, "Anna"))
+	assert.Nil(t, ChangeStatus(ticket.ID, TicketStatusInProcess))
+	other, err := CreateTicket("other@dhbw.de", "Printer problem", "Help")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeEditor(other.ID, "Carl"))
+	assert.Nil(t, ChangeStatus(other.ID, TicketStatusInProcess))
+
+	var received []Event
+	SubscribeEvents(func(event Event) {
+		if event.Actor == SystemActor && event.Details["job"] == JobHandover {
+			received = append(received, event)
+		}
+	})
+
+	// Nothing happens before the absence starts
+	mails := countMails(t)
+	assert.Nil(t, RunScheduledJobs())
+	assert.Equal(t, 0, len(received))
+
+	clock.Advance(day(1).Sub(clock.Now()) + time.Minute)
+	assert.Nil(t, RunScheduledJobs())
+
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Bert", ticket.Editor)
+	assert.Equal(t, TicketStatusInProcess, ticket.Status)
+	assert.Contains(t, ticket.MessageList[len(ticket.MessageList)-1].Text, "Handed over from Anna to Bert")
+
+	// The delegate of Carl is absent as well, so the ticket is released
+	other, err = ReadTicket(other.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "", other.Editor)
+	assert.Equal(t, TicketStatusOpen, other.Status)
+
+	// Only the customers of Anna are informed
+	assert.Equal(t, mails+1, countMails(t))
+	assert.Equal(t, 2, len(received))
+
+	assert.Nil(t, RunScheduledJobs())
+	assert.Equal(t, 2, len(received))
+}
@@ -0,0 +1,114 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ticketReferenceRegExp = regexp.MustCompile(`\[Ticket #(\d+)\]`)
+
+// Subjects which are typical for automatically generated mails. The markers have to start the subject, only preceded by
+// reply or forward prefixes, so customers mentioning e.g. an "auto" in their subject are not taken for an auto reply
+var autoReplySubjectRegExp = regexp.MustCompile(`^((re|aw|fw|fwd|wg)\s*:\s*)*(auto:|auto[- ]?reply\b|automatic reply\b|` +
+	`automatische antwort\b|out of (the )?office\b|abwesenheit(snotiz)?\b|delivery status notification\b|` +
+	`undeliver(able|ed)\b|unzustellbar\b|mail delivery failed\b)`)
+
+// Sender names which are typical for automatically generated mails
+var autoReplySenders = []string{"mailer-daemon", "postmaster", "noreply", "no-reply", "donotreply", "do-not-reply"}
+
+// Returns the token which identifies the ticket in the subject of mails
+func TicketReferenceToken(id int) string {
+	return "[Ticket #" + strconv.Itoa(id) + "]"
+}
+
+// Returns the ticket ID of the reference token in the subject
+func ParseTicketReference(subject string) (int, bool) {
+	match := ticketReferenceRegExp.FindStringSubmatch(subject)
+	if match == nil {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(match[1])
+	return id, err == nil
+}
+
+// Checks if the mail was most likely sent automatically, e.g. by an out of office assistant
+func IsAutoReply(mail string, subject string) bool {
+	if autoReplySubjectRegExp.MatchString(strings.ToLower(strings.TrimSpace(subject))) {
+		return true
+	}
+
+	sender := strings.ToLower(strings.Split(mail, "@")[0])
+	for _, autoReplySender := range autoReplySenders {
+		if sender == autoReplySender {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Queues the acknowledgement for a newly created ticket if it is enabled for the source and the ticket wasn't created by an
+// auto reply. The ticket has to be read after the automation rules ran, because tickets which were already closed,
+// e.g. as spam, are not acknowledged
+func SendAcknowledgement(ticket Ticket, source string) error {
+	if !acknowledgementEnabled(source) || IsAutoReply(ticket.Client, ticket.Reference) || ticket.Status == TicketStatusClosed {
+		return nil
+	}
+
+	_, err := sendTicketMail(acknowledgementTemplate, NewMailTemplateData(ticket, "", ""))
+	return err
+}
+
+// Queues the notice that the ticket was closed if closure notices are enabled
+func SendClosureNotice(ticket Ticket, editor string) error {
+	if !config.SendClosureNotices {
+		return nil
+	}
+
+	_, err := sendTicketMail(closureTemplate, NewMailTemplateData(ticket, editor, ""))
+	return err
+}
+
+// Queues the notice that another editor handles the ticket, editor is empty if the ticket was released
+func SendHandoverNotice(ticket Ticket, editor string) error {
+	_, err := sendTicketMail(handoverTemplate, NewMailTemplateData(ticket, editor, ""))
+	return err
+}
+
+// Queues the notice that the ticket is a duplicate and the request is handled in the canonical ticket
+func SendDuplicateNotice(duplicate Ticket, canonical Ticket, editor string) error {
+	data := NewMailTemplateData(duplicate, editor, "")
+	data.Related = canonical
+	_, err := sendTicketMail(duplicateTemplate, data)
+	return err
+}
+
+// Queues the notice that a part of the request is handled in the new ticket which was split from the original one
+func SendSplitNotice(ticket Ticket, original Ticket, editor string) error {
+	data := NewMailTemplateData(ticket, editor, "")
+	data.Related = original
+	_, err := sendTicketMail(splitTemplate, data)
+	return err
+}
+
+// Queues a reminder that the ticket is still waiting for an answer of the client
+func SendReminder(ticket Ticket) error {
+	_, err := sendTicketMail(reminderTemplate, NewMailTemplateData(ticket, "", ""))
+	return err
+}
+
+func acknowledgementEnabled(source string) bool {
+	switch source {
+	case SourceWeb:
+		return config.AcknowledgeWebTickets
+	case SourceMail, SourceAPI:
+		return config.AcknowledgeMailTickets
+	default:
+		return false
+	}
+}
@@ -0,0 +1,152 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTicketReference(t *testing.T) {
+	assert.Equal(t, "[Ticket #42]", TicketReferenceToken(42))
+
+	tests := []struct {
+		subject    string
+		expectedID int
+		expectedOk bool
+	}{
+		{"Re: [Ticket #42] PC problem", 42, true},
+		{"[Ticket #7]", 7, true},
+		{"Ticket #42", 0, false},
+		{"[Ticket #abc] PC problem", 0, false},
+		{"PC problem", 0, false},
+	}
+	for _, d := range tests {
+		id, ok := ParseTicketReference(d.subject)
+		assert.Equal(t, d.expectedID, id)
+		assert.Equal(t, d.expectedOk, ok)
+	}
+}
+
+func TestIsAutoReply(t *testing.T) {
+	tests := []struct {
+		mail     string
+		subject  string
+		expected bool
+	}{
+		{"client@dhbw.de", "PC problem", false},
+		{"client@dhbw.de", "Out of Office: PC problem", true},
+		{"client@dhbw.de", "Automatic reply: PC problem", true},
+		{"client@dhbw.de", "AW: Abwesenheitsnotiz", true},
+		{"mailer-daemon@dhbw.de", "PC problem", true},
+		{"No-Reply@dhbw.de", "PC problem", true},
+		{"noreplyclient@dhbw.de", "PC problem", false},
+		{"client@dhbw.de", "Auto: PC problem", true},
+		{"client@dhbw.de", "Undeliverable: PC problem", true},
+		{"client@dhbw.de", "  RE: Out of the office", true},
+		{"client@dhbw.de", "Problem with the auto-reply of my mail client", false},
+		{"client@dhbw.de", "Car: auto parts order", false},
+		{"client@dhbw.de", "Returned from my absence, automatic reply still active", false},
+		{"client@dhbw.de", "Autocad license", false},
+	}
+	for _, d := range tests {
+		assert.Equal(t, d.expected, IsAutoReply(d.mail, d.subject))
+	}
+}
+
+func TestSendAcknowledgement(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "PC does not start anymore")
+	assert.Nil(t, err)
+	ticket, err = SetTicketLanguage(ticket, "de")
+	assert.Nil(t, err)
+
+	assert.Nil(t, SendAcknowledgement(ticket, SourceWeb))
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Equal(t, "client@dhbw.de", mailList.MailList[0].Mail)
+	assert.Equal(t, "[Ticket #1] Wir haben Ihre Anfrage erhalten: PC problem", mailList.MailList[0].Subject)
+	assert.Contains(t, mailList.MailList[0].Message, "PC does not start anymore")
+
+	// Disabled channel
+	config.AcknowledgeWebTickets = false
+	assert.Nil(t, SendAcknowledgement(ticket, SourceWeb))
+	config.AcknowledgeWebTickets = true
+
+	// Auto replies
+	autoTicket, err := CreateTicket("client@dhbw.de", "Out of office", "I am on vacation")
+	assert.Nil(t, err)
+	assert.Nil(t, SendAcknowledgement(autoTicket, SourceMail))
+
+	mailList, err = ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+}
+
+func TestCreateTicketFromMailAcknowledgement(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket, err := CreateTicketFromMail("client@dhbw.de", "PC problem", "PC does not start")
+	assert.Nil(t, err)
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Contains(t, mailList.MailList[0].Subject, TicketReferenceToken(ticket.ID))
+
+	// The reply keeps the reference token, hence it belongs to the ticket even with a different subject
+	replyTicket, err := CreateTicketFromMail("client@dhbw.de", "Re: "+mailList.MailList[0].Subject, "Still broken")
+	assert.Nil(t, err)
+	assert.Equal(t, ticket.ID, replyTicket.ID)
+	assert.Equal(t, 2, len(replyTicket.MessageList))
+
+	// Other clients cannot add messages to the ticket by using its token
+	otherTicket, err := CreateTicketFromMail("other@dhbw.de", "Re: "+mailList.MailList[0].Subject, "Hello")
+	assert.Nil(t, err)
+	assert.NotEqual(t, ticket.ID, otherTicket.ID)
+}
+
+func TestSendClosureNotice(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "PC does not start anymore")
+	assert.Nil(t, err)
+
+	assert.Nil(t, SendClosureNotice(ticket, "Test123"))
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Equal(t, "[Ticket #1] Your request was closed: PC problem", mailList.MailList[0].Subject)
+	assert.Contains(t, mailList.MailList[0].Message, "was closed by Test123")
+
+	config.SendClosureNotices = false
+	assert.Nil(t, SendClosureNotice(ticket, "Test123"))
+	config.SendClosureNotices = true
+
+	mailList, err = ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+}
+
+func TestSendReminder(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "PC does not start anymore")
+	assert.Nil(t, err)
+	ticket, err = AddReply(ticket, "Test123", "Did you plug it in?")
+	assert.Nil(t, err)
+
+	assert.Nil(t, SendReminder(ticket))
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(mailList.MailList))
+	assert.Equal(t, "[Ticket #1] We are waiting for your answer: PC problem", mailList.MailList[1].Subject)
+	assert.Contains(t, mailList.MailList[1].Message, "> Did you plug it in?")
+	assert.NotContains(t, mailList.MailList[1].Message, "PC does not start anymore")
+}
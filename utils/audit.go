@@ -0,0 +1,302 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AuditUserCreated            = "user.created"
+	AuditUserHolidayModeChanged = "user.holidaymode"
+	AuditUserSettingsChanged    = "user.settings"
+)
+
+type AuditEntry struct {
+	XMLName   xml.Name  `xml:"AuditEntry"`
+	Timestamp time.Time `xml:"Timestamp"`
+	Actor     string    `xml:"Actor"`
+	Source    string    `xml:"Source"`
+	Action    string    `xml:"Action"`
+	TicketID  int       `xml:"TicketID,omitempty"`
+	Username  string    `xml:"Username,omitempty"`
+	Field     string    `xml:"Field,omitempty"`
+	Before    string    `xml:"Before,omitempty"`
+	After     string    `xml:"After,omitempty"`
+}
+
+// Zero values of the filter are ignored
+type AuditFilter struct {
+	TicketID int
+	Username string
+	Actor    string
+	Action   string
+	Source   string
+	From     time.Time
+	To       time.Time
+}
+
+var mutexAuditLog = &sync.Mutex{}
+
+// Positions of the entries of every ticket in the audit log, so the history of a ticket is read without decoding
+// the whole log. Only the entries appended since the last lookup are scanned
+type auditIndex struct {
+	path    string
+	size    int64 // End of the last indexed entry
+	tickets map[int][]auditPosition
+}
+
+type auditPosition struct {
+	offset int64
+	length int
+}
+
+var ticketAuditIndex = auditIndex{}
+
+var registerAuditLogOnce = &sync.Once{}
+
+// Subscribes the audit log to the ticket events. Calling it more than once has no effect
+func RegisterAuditLog() {
+	registerAuditLogOnce.Do(func() {
+		SubscribeEvents(recordTicketEvent)
+	})
+}
+
+// Writes one audit entry for every changed field of the event
+func recordTicketEvent(event Event) {
+	entry := AuditEntry{Timestamp: event.Timestamp, Actor: event.Actor, Source: event.Source, Action: string(event.Type), TicketID: event.TicketID}
+
+	if event.Type == EventTicketMerged || event.Type == EventTicketUnmerged {
+		// The history of the merged ticket is kept apart, hence its ID is recorded on both sides of the merge
+		mergedID, err := strconv.Atoi(event.Details["mergedTicketId"])
+		if err == nil {
+			mergedEntry := entry
+			mergedEntry.TicketID = mergedID
+			mergedEntry.Field = "mergedInto"
+			entry.Field = "mergedTicket"
+			if event.Type == EventTicketMerged {
+				mergedEntry.After = strconv.Itoa(event.TicketID)
+				entry.After = strconv.Itoa(mergedID)
+			} else {
+				mergedEntry.Before = strconv.Itoa(event.TicketID)
+				entry.Before = strconv.Itoa(mergedID)
+			}
+			_ = RecordAuditEntry(mergedEntry)
+		}
+	}
+
+	if len(event.Changes) == 0 {
+		_ = RecordAuditEntry(entry)
+		return
+	}
+
+	for _, change := range event.Changes {
+		changeEntry := entry
+		changeEntry.Field = change.Field
+		changeEntry.Before = change.Before
+		changeEntry.After = change.After
+		_ = RecordAuditEntry(changeEntry)
+	}
+}
+
+// Returns the settings which differ between two states of the same user
+func UserChanges(before User, after User) []FieldChange {
+	var changes []FieldChange
+	if before.Email != after.Email {
+		changes = append(changes, FieldChange{Field: "email", Before: before.Email, After: after.Email})
+	}
+	if before.Notifications.String() != after.Notifications.String() {
+		changes = append(changes, FieldChange{Field: "notifications", Before: before.Notifications.String(), After: after.Notifications.String()})
+	}
+	if before.Capacity != after.Capacity {
+		changes = append(changes, FieldChange{Field: "capacity", Before: strconv.Itoa(before.Capacity), After: strconv.Itoa(after.Capacity)})
+	}
+	if strings.Join(before.Skills, ", ") != strings.Join(after.Skills, ", ") {
+		changes = append(changes, FieldChange{Field: "skills", Before: strings.Join(before.Skills, ", "), After: strings.Join(after.Skills, ", ")})
+	}
+	if before.Absence.String() != after.Absence.String() {
+		changes = append(changes, FieldChange{Field: "absence", Before: before.Absence.String(), After: after.Absence.String()})
+	}
+
+	return changes
+}
+
+// Records an entry for every setting which differs between the two states of the user
+func RecordUserChanges(before User, after User, actor string, source string) error {
+	for _, change := range UserChanges(before, after) {
+		err := RecordAuditEntry(AuditEntry{Actor: actor, Source: source, Action: AuditUserSettingsChanged, Username: after.Username,
+			Field: change.Field, Before: change.Before, After: change.After})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Appends an entry to the audit log. Existing entries are never rewritten
+func RecordAuditEntry(entry AuditEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	content, err := xml.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	mutexAuditLog.Lock()
+	defer mutexAuditLog.Unlock()
+	mutexStorage.RLock()
+	defer mutexStorage.RUnlock()
+
+	file, err := os.OpenFile(config.AuditLogFilePath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(content, '\n'))
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Returns all audit entries matching the filter in chronological order
+func QueryAuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	mutexAuditLog.Lock()
+	defer mutexAuditLog.Unlock()
+
+	file, err := os.Open(config.AuditLogFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	decoder := xml.NewDecoder(file)
+	for {
+		var entry AuditEntry
+		err = decoder.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entries, err
+		}
+
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// Returns the complete history of a ticket
+func GetTicketAuditLog(ticketID int) ([]AuditEntry, error) {
+	mutexAuditLog.Lock()
+	defer mutexAuditLog.Unlock()
+
+	file, err := os.Open(config.AuditLogFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	err = ticketAuditIndex.update(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AuditEntry
+	for _, position := range ticketAuditIndex.tickets[ticketID] {
+		content := make([]byte, position.length)
+		_, err = file.ReadAt(content, position.offset)
+		if err != nil {
+			return entries, err
+		}
+
+		var entry AuditEntry
+		err = xml.Unmarshal(content, &entry)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Forgets the positions of the entries, the audit log is indexed again on the next lookup
+func resetAuditIndex() {
+	mutexAuditLog.Lock()
+	defer mutexAuditLog.Unlock()
+
+	ticketAuditIndex = auditIndex{}
+}
+
+// Adds the entries which were appended since the last update. The index is built anew for another data folder or if
+// the log got shorter, e.g. because a backup was restored
+func (index *auditIndex) update(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if index.path != config.AuditLogFilePath() || info.Size() < index.size {
+		*index = auditIndex{path: config.AuditLogFilePath(), tickets: make(map[int][]auditPosition)}
+	}
+
+	_, err = file.Seek(index.size, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	// Every entry is written as one line, an entry without its line break is still being written
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry AuditEntry
+		err = xml.Unmarshal(line, &entry)
+		if err != nil {
+			return err
+		}
+		if entry.TicketID != 0 {
+			index.tickets[entry.TicketID] = append(index.tickets[entry.TicketID], auditPosition{offset: index.size, length: len(line)})
+		}
+		index.size += int64(len(line))
+	}
+}
+
+func (filter AuditFilter) matches(entry AuditEntry) bool {
+	return (filter.TicketID == 0 || filter.TicketID == entry.TicketID) &&
+		(filter.Username == "" || filter.Username == entry.Username) &&
+		(filter.Actor == "" || filter.Actor == entry.Actor) &&
+		(filter.Action == "" || filter.Action == entry.Action) &&
+		(filter.Source == "" || filter.Source == entry.Source) &&
+		(filter.From.IsZero() || !entry.Timestamp.Before(filter.From)) &&
+		(filter.To.IsZero() || !entry.Timestamp.After(filter.To))
+}
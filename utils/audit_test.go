@@ -0,0 +1,119 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRecordAuditEntry(t *testing.T) {
+	setup()
+	defer teardown()
+
+	entries, err := QueryAuditLog(AuditFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(entries))
+
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Actor: "Test123", Source: SourceWeb, Action: AuditUserCreated, Username: "Test123"}))
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Actor: "Test123", Source: SourceWeb, Action: AuditUserHolidayModeChanged,
+		Username: "Test123", Field: "holidayMode", Before: "false", After: "true"}))
+
+	entries, err = QueryAuditLog(AuditFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, AuditUserCreated, entries[0].Action)
+	assert.False(t, entries[0].Timestamp.IsZero())
+	assert.Equal(t, "false", entries[1].Before)
+	assert.Equal(t, "true", entries[1].After)
+}
+
+func TestQueryAuditLog(t *testing.T) {
+	setup()
+	defer teardown()
+
+	yesterday := time.Now().Add(-24 * time.Hour)
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Timestamp: yesterday, Actor: "client@dhbw.de", Source: SourceMail, Action: string(EventTicketCreated), TicketID: 1}))
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Actor: "Test123", Source: SourceWeb, Action: string(EventTicketClosed), TicketID: 1}))
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Actor: "Test123", Source: SourceWeb, Action: string(EventTicketClosed), TicketID: 2}))
+
+	tests := []struct {
+		filter   AuditFilter
+		expected int
+	}{
+		{AuditFilter{}, 3},
+		{AuditFilter{TicketID: 1}, 2},
+		{AuditFilter{Actor: "Test123"}, 2},
+		{AuditFilter{Source: SourceMail}, 1},
+		{AuditFilter{Action: string(EventTicketClosed), TicketID: 2}, 1},
+		{AuditFilter{From: time.Now().Add(-time.Hour)}, 2},
+		{AuditFilter{To: time.Now().Add(-time.Hour)}, 1},
+		{AuditFilter{Actor: "unknown"}, 0},
+	}
+	for _, d := range tests {
+		entries, err := QueryAuditLog(d.filter)
+		assert.Nil(t, err)
+		assert.Equal(t, d.expected, len(entries))
+	}
+}
+
+func TestRecordTicketEvent(t *testing.T) {
+	setup()
+	defer teardown()
+
+	before := Ticket{ID: 1, Status: TicketStatusOpen}
+	after := Ticket{ID: 1, Status: TicketStatusInProcess, Editor: "Test123"}
+	recordTicketEvent(Event{Type: EventTicketAssigned, TicketID: 1, Actor: "Test123", Source: SourceWeb, Timestamp: time.Now(), Ticket: after,
+		Changes: TicketChanges(before, after)})
+
+	entries, err := GetTicketAuditLog(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "status", entries[0].Field)
+	assert.Equal(t, "open", entries[0].Before)
+	assert.Equal(t, "in process", entries[0].After)
+	assert.Equal(t, "editor", entries[1].Field)
+	assert.Equal(t, "Test123", entries[1].After)
+
+	recordTicketEvent(Event{Type: EventTicketMerged, TicketID: 1, Actor: "Test123", Source: SourceWeb, Timestamp: time.Now(), Ticket: after,
+		Details: map[string]string{"mergedTicketId": strconv.Itoa(2)}})
+	entries, err = GetTicketAuditLog(2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "mergedInto", entries[0].Field)
+	assert.Equal(t, "1", entries[0].After)
+}
+
+func TestGetTicketAuditLogIndex(t *testing.T) {
+	setup()
+	defer teardown()
+
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Actor: "Test123", Source: SourceWeb, Action: string(EventTicketClosed), TicketID: 1, Before: "line\nbreak"}))
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Actor: "Test123", Source: SourceWeb, Action: AuditUserCreated, Username: "Test123"}))
+	entries, err := GetTicketAuditLog(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "line\nbreak", entries[0].Before)
+
+	// Entries appended after the first lookup are indexed as well
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Actor: "Test123", Source: SourceAPI, Action: string(EventTicketReopened), TicketID: 1}))
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Actor: "Test123", Source: SourceWeb, Action: string(EventTicketClosed), TicketID: 2}))
+	entries, err = GetTicketAuditLog(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, SourceAPI, entries[1].Source)
+
+	// A new data folder is indexed anew
+	teardown()
+	setup()
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Actor: "Anna", Source: SourceWeb, Action: string(EventTicketAssigned), TicketID: 2}))
+	entries, err = GetTicketAuditLog(2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "Anna", entries[0].Actor)
+	entries, err = GetTicketAuditLog(1)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,251 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"sync"
+)
+
+// Strategies of the automatic assignment of new tickets
+const (
+	AssignmentOff        = ""
+	AssignmentRoundRobin = "roundrobin"
+	AssignmentLoad       = "load"
+	AssignmentSkill      = "skill"
+)
+
+// Current number of unfinished tickets of an editor
+type EditorLoad struct {
+	Username string
+	Tickets  int
+	Capacity int // 0 if the editor has no limit
+}
+
+var registerAutoAssignmentOnce = &sync.Once{}
+
+// Guards the round robin position, so two concurrently created tickets are not assigned to the same editor
+var mutexAutoAssignment = &sync.Mutex{}
+
+// State of the automatic assignment, it is stored so the round robin continues where it stopped after a restart
+type AssignmentState struct {
+	XMLName              xml.Name `xml:"Assignment"`
+	LastRoundRobinEditor string   `xml:"LastRoundRobinEditor"` // Editor who received the last ticket of the round robin
+}
+
+func IsAssignmentStrategy(strategy string) bool {
+	switch strategy {
+	case AssignmentOff, AssignmentRoundRobin, AssignmentLoad, AssignmentSkill:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the maximum number of unfinished tickets of the user, 0 means no limit
+func (user User) TicketCapacity() int {
+	if user.Capacity > 0 {
+		return user.Capacity
+	}
+	return config.EditorCapacity
+}
+
+func (load EditorLoad) IsFull() bool {
+	return load.Capacity > 0 && load.Tickets >= load.Capacity
+}
+
+// Subscribes the automatic assignment to the creation of tickets. Calling it more than once has no effect
+func RegisterAutoAssignment() {
+	registerAutoAssignmentOnce.Do(func() {
+		SubscribeEvents(assignNewTicket)
+	})
+}
+
+// Assigns new tickets. The skills are matched against the tags, which new tickets only have if an automation rule added
+// them, hence with the skill strategy tickets are assigned once they got tags, either by a rule or by an editor
+func assignNewTicket(event Event) {
+	switch {
+	case config.AutoAssignment == AssignmentOff:
+		return
+	case config.AutoAssignment == AssignmentSkill:
+		if !tagsGiven(event) {
+			return
+		}
+	case event.Type != EventTicketCreated:
+		return
+	}
+
+	err := AutoAssignTicket(event.Ticket.ID, config.AutoAssignment)
+	if err != nil {
+		log.Printf("Couldn't assign ticket %d automatically: %v\n", event.Ticket.ID, err)
+	}
+}
+
+// Checks if the ticket has tags after it was created or after its tags were changed
+func tagsGiven(event Event) bool {
+	switch event.Type {
+	case EventTicketCreated:
+		return len(event.Ticket.Tags) > 0
+	case EventTicketUpdated:
+		for _, change := range event.Changes {
+			if change.Field == "tags" {
+				return change.After != ""
+			}
+		}
+	}
+	return false
+}
+
+// Assigns the ticket to an available editor selected by the strategy. Tickets which already have an editor,
+// e.g. by an automation rule, or which were closed are left alone
+func AutoAssignTicket(id int, strategy string) error {
+	mutexAutoAssignment.Lock()
+	defer mutexAutoAssignment.Unlock()
+
+	ticket, err := ReadTicket(id)
+	if err != nil {
+		return err
+	}
+	if ticket.Editor != "" || ticket.Status == TicketStatusClosed {
+		return nil
+	}
+
+	available, err := availableEditors(ticket)
+	if err != nil {
+		return err
+	}
+	if len(available) == 0 {
+		return fmt.Errorf("all editors are in the holidays, at their capacity or no members of the queue")
+	}
+
+	state, err := ReadAssignmentState()
+	if err != nil {
+		return err
+	}
+
+	var editor EditorLoad
+	var reason string
+	switch strategy {
+	case AssignmentRoundRobin:
+		editor = nextRoundRobinEditor(available, state.LastRoundRobinEditor)
+		reason = fmt.Sprintf("Assigned automatically to %s by round robin (%d unfinished tickets)", editor.Username, editor.Tickets)
+	case AssignmentLoad:
+		editor = available[0]
+		for _, load := range available[1:] {
+			if load.Tickets < editor.Tickets {
+				editor = load
+			}
+		}
+		reason = fmt.Sprintf("Assigned automatically to %s with the lowest load (%d unfinished tickets)", editor.Username, editor.Tickets)
+	case AssignmentSkill:
+		matches, err := ProposeEditors(ticket)
+		if err != nil {
+			return err
+		}
+		editor = matches[0].EditorLoad
+		reason = fmt.Sprintf("Assigned automatically to %s by skills: %s", editor.Username, matches[0].Explanation)
+	default:
+		return fmt.Errorf("unknown assignment strategy %q", strategy)
+	}
+	if editor.Capacity > 0 && strategy != AssignmentSkill {
+		reason += fmt.Sprintf(", capacity %d", editor.Capacity)
+	}
+
+	before := ticket
+	ticket, err = AddSystemMessage(ticket, reason)
+	if err != nil {
+		return err
+	}
+	ticket.Editor = editor.Username
+	ticket.Status = TicketStatusInProcess
+	err = StoreTicket(ticket)
+	if err != nil {
+		return err
+	}
+
+	state.LastRoundRobinEditor = editor.Username
+	err = WriteToXML(state, config.AssignmentFilePath())
+	if err != nil {
+		return err
+	}
+	log.Printf("Ticket %d: %s\n", ticket.ID, reason)
+	PublishEvent(Event{Type: EventTicketAssigned, Ticket: ticket, Actor: SystemActor, Source: SourceSystem,
+		Changes: TicketChanges(before, ticket), Details: map[string]string{"reason": reason}})
+	return nil
+}
+
+// Returns the editors who can receive the ticket. They must not be at their capacity and need access to the queue of the ticket
+func availableEditors(ticket Ticket) ([]EditorLoad, error) {
+	users, err := ReadUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	loads, err := GetEditorLoads()
+	if err != nil {
+		return nil, err
+	}
+
+	var available []EditorLoad
+	for _, load := range loads {
+		if !load.IsFull() && CanAccessTicket(users[load.Username], ticket) {
+			available = append(available, load)
+		}
+	}
+	return available, nil
+}
+
+// Returns the editor after the one who received the last ticket in the alphabetical order
+func nextRoundRobinEditor(available []EditorLoad, last string) EditorLoad {
+	for _, load := range available {
+		if load.Username > last {
+			return load
+		}
+	}
+	return available[0]
+}
+
+// Returns the number of unfinished tickets of all editors who are not absent, ordered by their name
+func GetEditorLoads() ([]EditorLoad, error) {
+	users, err := ReadUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	var loads []EditorLoad
+	for _, user := range users {
+		if !user.IsAvailable() {
+			continue
+		}
+
+		load := EditorLoad{Username: user.Username, Capacity: user.TicketCapacity()}
+		for _, ticket := range GetTicketsByEditor(user.Username) {
+			if ticket.Status != TicketStatusClosed {
+				load.Tickets++
+			}
+		}
+		loads = append(loads, load)
+	}
+
+	sort.Slice(loads, func(i, j int) bool {
+		return loads[i].Username < loads[j].Username
+	})
+	return loads, nil
+}
+
+// Returns the stored state of the automatic assignment
+func ReadAssignmentState() (AssignmentState, error) {
+	file, err := ioutil.ReadFile(config.AssignmentFilePath())
+	if err != nil {
+		return AssignmentState{}, err
+	}
+
+	var state AssignmentState
+	err = xml.Unmarshal(file, &state)
+	return state, err
+}
@@ -0,0 +1,184 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func createEditors(t *testing.T, names ...string) {
+	for _, name := range names {
+		_, err := CreateUser(name, "Aa!123456")
+		assert.Nil(t, err)
+	}
+}
+
+func TestAutoAssignRoundRobin(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna", "Bert", "Carl")
+	assert.Nil(t, SetUserHolidayMode("Bert", true))
+
+	var editors []string
+	for i := 0; i < 3; i++ {
+		ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+		assert.Nil(t, err)
+		assert.Nil(t, AutoAssignTicket(ticket.ID, AssignmentRoundRobin))
+
+		ticket, err = ReadTicket(ticket.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, TicketStatusInProcess, ticket.Status)
+		assert.Equal(t, MessageTypeSystem, ticket.MessageList[len(ticket.MessageList)-1].Type)
+		assert.Contains(t, ticket.MessageList[len(ticket.MessageList)-1].Text, "round robin")
+		editors = append(editors, ticket.Editor)
+	}
+
+	// Editors in the holidays are skipped
+	assert.Equal(t, []string{"Anna", "Carl", "Anna"}, editors)
+
+	// The round robin continues with the next editor after a restart
+	state, err := ReadAssignmentState()
+	assert.Nil(t, err)
+	assert.Equal(t, "Anna", state.LastRoundRobinEditor)
+	assert.Nil(t, InitDataStorage())
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	assert.Nil(t, AutoAssignTicket(ticket.ID, AssignmentRoundRobin))
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Carl", ticket.Editor)
+}
+
+func TestAutoAssignLoad(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna", "Bert")
+	for i := 0; i < 2; i++ {
+		ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+		assert.Nil(t, err)
+		assert.Nil(t, ChangeEditor(ticket.ID, "Anna"))
+	}
+	// Closed tickets don't count to the load
+	closed, err := CreateTicket("client@dhbw.de", "Old problem", "Help")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeEditor(closed.ID, "Bert"))
+	assert.Nil(t, ChangeStatus(closed.ID, TicketStatusClosed))
+
+	var received []Event
+	SubscribeEvents(func(event Event) {
+		if event.Type == EventTicketAssigned && event.Actor == SystemActor && event.Details["reason"] != "" {
+			received = append(received, event)
+		}
+	})
+
+	ticket, err := CreateTicket("client@dhbw.de", "New problem", "Help")
+	assert.Nil(t, err)
+	assert.Nil(t, AutoAssignTicket(ticket.ID, AssignmentLoad))
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Bert", ticket.Editor)
+	assert.Equal(t, 1, len(received))
+	assert.Contains(t, received[0].Details["reason"], "lowest load")
+
+	// Tickets with an editor are not reassigned
+	assert.Nil(t, AutoAssignTicket(ticket.ID, AssignmentLoad))
+	assert.Equal(t, 1, len(received))
+
+	assert.NotNil(t, AutoAssignTicket(ticket.ID+1, AssignmentLoad))
+	other, err := CreateTicket("client@dhbw.de", "Another problem", "Help")
+	assert.Nil(t, err)
+	assert.NotNil(t, AutoAssignTicket(other.ID, "random"))
+}
+
+func TestAutoAssignCapacity(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna", "Bert")
+	assert.Nil(t, SetUserCapacity("Anna", 1))
+	assert.NotNil(t, SetUserCapacity("Anna", -1))
+	config.EditorCapacity = 2
+	defer func() { config.EditorCapacity = 0 }()
+
+	var editors []string
+	for i := 0; i < 4; i++ {
+		ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+		assert.Nil(t, err)
+		err = AutoAssignTicket(ticket.ID, AssignmentLoad)
+
+		ticket, _ = ReadTicket(ticket.ID)
+		editors = append(editors, ticket.Editor)
+		if i < 3 {
+			assert.Nil(t, err)
+		} else {
+			// Every editor reached the capacity, so the ticket stays open
+			assert.NotNil(t, err)
+			assert.Equal(t, TicketStatusOpen, ticket.Status)
+		}
+	}
+	assert.Equal(t, []string{"Anna", "Bert", "Bert", ""}, editors)
+
+	loads, err := GetEditorLoads()
+	assert.Nil(t, err)
+	assert.Equal(t, []EditorLoad{{"Anna", 1, 1}, {"Bert", 2, 2}}, loads)
+}
+
+func TestAssignNewTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna")
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+
+	// Nothing happens if the automatic assignment is disabled
+	assignNewTicket(Event{Type: EventTicketCreated, Ticket: ticket})
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "", ticket.Editor)
+
+	config.AutoAssignment = AssignmentLoad
+	defer func() { config.AutoAssignment = AssignmentOff }()
+	assignNewTicket(Event{Type: EventTicketCommented, Ticket: ticket})
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "", ticket.Editor)
+
+	assignNewTicket(Event{Type: EventTicketCreated, Ticket: ticket})
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Anna", ticket.Editor)
+}
+
+func TestAssignNewTicketBySkills(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.AutoAssignment = AssignmentSkill
+	defer func() { config.AutoAssignment = AssignmentOff }()
+
+	createEditors(t, "Anna", "Bert")
+	assert.Nil(t, SetUserSkills("Bert", []string{"billing"}))
+	ticket, err := CreateTicket("client@dhbw.de", "Invoice", "The wrong amount was charged")
+	assert.Nil(t, err)
+
+	// Tickets without tags wait until they are tagged
+	assignNewTicket(Event{Type: EventTicketCreated, Ticket: ticket})
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "", ticket.Editor)
+
+	before := ticket
+	assert.Nil(t, ChangeTags(ticket.ID, []string{"billing"}))
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assignNewTicket(Event{Type: EventTicketUpdated, Ticket: ticket, Changes: TicketChanges(before, ticket)})
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Bert", ticket.Editor)
+	assert.Contains(t, ticket.MessageList[len(ticket.MessageList)-1].Text, "skills billing match 1 of 1 tags")
+}
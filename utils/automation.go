@@ -0,0 +1,394 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Situations in which the automation rules are evaluated
+const (
+	RuleTriggerCreate        = "create"
+	RuleTriggerCustomerReply = "customerReply"
+)
+
+// Empty conditions match every ticket
+type RuleConditions struct {
+	SenderDomain   string `xml:"SenderDomain"`
+	SubjectPattern string `xml:"SubjectPattern"` // Regular expression
+	BodyPattern    string `xml:"BodyPattern"`    // Regular expression which is matched against the latest customer message
+	FromTime       string `xml:"FromTime"`       // Time of day in the format 15:04, the range may span midnight
+	ToTime         string `xml:"ToTime"`
+	Channel        string `xml:"Channel"` // Source of the ticket or reply, e.g. web or mail
+}
+
+type Rule struct {
+	ID              int            `xml:"ID"`
+	Name            string         `xml:"Name"`
+	Enabled         bool           `xml:"Enabled"`
+	OnCreate        bool           `xml:"OnCreate"`
+	OnCustomerReply bool           `xml:"OnCustomerReply"`
+	Conditions      RuleConditions `xml:"Conditions"`
+	Actions         []MacroAction  `xml:"Actions>Action"`
+	StopProcessing  bool           `xml:"StopProcessing"` // No further rules are evaluated if this rule fires
+	FireCount       int            `xml:"FireCount"`
+}
+
+type RuleList struct {
+	RuleIDCounter int    `xml:"RuleIDCounter"`
+	Rules         []Rule `xml:"rules>rule"`
+}
+
+// Result of the evaluation of a rule for a ticket
+type RuleMatch struct {
+	Rule    Rule
+	Matched bool
+	Reason  string // Condition which did not match
+}
+
+// Situation the rules are evaluated in
+type ruleContext struct {
+	trigger string
+	channel string
+	time    time.Time
+	ticket  Ticket
+	text    string
+}
+
+var mutexRules = &sync.Mutex{}
+
+var registerAutomationOnce = &sync.Once{}
+
+var timeOfDayRegExp = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// Returns the actions of the rule in the format which is parsed by ParseMacroActions
+func (rule Rule) ActionsText() string {
+	return Macro{Actions: rule.Actions}.ActionsText()
+}
+
+// Checks the conditions and actions of the rule before it is stored
+func ValidateRule(rule Rule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("a rule needs a name")
+	}
+	if len(rule.Actions) == 0 {
+		return fmt.Errorf("a rule needs at least one action")
+	}
+
+	for _, pattern := range []string{rule.Conditions.SubjectPattern, rule.Conditions.BodyPattern} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return err
+		}
+	}
+
+	from, to := rule.Conditions.FromTime, rule.Conditions.ToTime
+	if (from == "") != (to == "") {
+		return fmt.Errorf("the time of day needs a start and an end")
+	}
+	if from != "" && (!timeOfDayRegExp.MatchString(from) || !timeOfDayRegExp.MatchString(to)) {
+		return fmt.Errorf("the time of day must have the format HH:MM")
+	}
+
+	for _, action := range rule.Actions {
+		err := validateMacroAction(action)
+		if err != nil {
+			return err
+		}
+		// Rules are run by the ticket system itself, hence there is nobody the ticket could be assigned to by default
+		if (action.Type == MacroActionAssign && action.Value == "") || action.Type == MacroActionRelease {
+			return fmt.Errorf("the %s action needs an editor in rules", action.Type)
+		}
+	}
+
+	return nil
+}
+
+// Subscribes the automation rules to the ticket events. Calling it more than once has no effect
+func RegisterAutomation() {
+	registerAutomationOnce.Do(func() {
+		SubscribeEvents(applyRulesOnEvent)
+	})
+}
+
+// Runs the rules on new tickets and on replies of the customer
+func applyRulesOnEvent(event Event) {
+	ticket := event.Ticket
+	if len(ticket.MessageList) == 0 {
+		return
+	}
+
+	ctx := ruleContext{channel: event.Source, time: event.Timestamp, ticket: ticket, text: ticket.MessageList[len(ticket.MessageList)-1].Text}
+	switch {
+	case event.Type == EventTicketCreated:
+		ctx.trigger = RuleTriggerCreate
+	case event.Type == EventTicketCommented && event.Actor == ticket.Client:
+		ctx.trigger = RuleTriggerCustomerReply
+	default:
+		return
+	}
+
+	err := applyRules(ctx)
+	if err != nil {
+		log.Printf("Couldn't apply the automation rules to ticket %d: %v\n", ticket.ID, err)
+	}
+}
+
+// Runs the actions of all matching rules in their order
+func applyRules(ctx ruleContext) error {
+	ruleList, err := ReadRules()
+	if err != nil {
+		return err
+	}
+
+	wasClosed := ctx.ticket.Status == TicketStatusClosed
+	for i, rule := range ruleList.Rules {
+		// The actions of earlier rules may have changed the ticket, hence every rule is evaluated on its current state
+		if i > 0 {
+			ctx.ticket, err = ReadTicket(ctx.ticket.ID)
+			if err != nil {
+				return err
+			}
+		}
+		// Tickets which an earlier rule closed, e.g. as spam, are left alone
+		if !wasClosed && ctx.ticket.Status == TicketStatusClosed {
+			break
+		}
+		if !evaluateRule(rule, ctx).Matched {
+			continue
+		}
+
+		_, err = runActions(rule.Actions, ctx.ticket.ID, User{Username: SystemActor}, SourceSystem, map[string]string{"rule": rule.Name}, true)
+		if err != nil {
+			log.Printf("The automation rule %q failed on ticket %d: %v\n", rule.Name, ctx.ticket.ID, err)
+			continue
+		}
+
+		_ = changeRules(func(rules []Rule) ([]Rule, error) {
+			if i, err := findRule(rules, rule.ID); err == nil {
+				rules[i].FireCount++
+			}
+			return rules, nil
+		})
+
+		if rule.StopProcessing {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Checks all conditions of the rule and returns the first one which does not match
+func evaluateRule(rule Rule, ctx ruleContext) RuleMatch {
+	conditions := rule.Conditions
+	noMatch := func(reason string) RuleMatch {
+		return RuleMatch{Rule: rule, Reason: reason}
+	}
+
+	if !rule.Enabled {
+		return noMatch("the rule is disabled")
+	}
+	if (ctx.trigger == RuleTriggerCreate && !rule.OnCreate) || (ctx.trigger == RuleTriggerCustomerReply && !rule.OnCustomerReply) {
+		return noMatch("the rule is not evaluated on " + ctx.trigger)
+	}
+	if conditions.SenderDomain != "" && !strings.EqualFold(senderDomain(ctx.ticket.Client), strings.TrimPrefix(conditions.SenderDomain, "@")) {
+		return noMatch("the sender domain does not match")
+	}
+	if conditions.SubjectPattern != "" && !matchesPattern(conditions.SubjectPattern, ctx.ticket.Reference) {
+		return noMatch("the subject does not match")
+	}
+	if conditions.BodyPattern != "" && !matchesPattern(conditions.BodyPattern, ctx.text) {
+		return noMatch("the message does not match")
+	}
+	if conditions.FromTime != "" && !isInTimeOfDay(ctx.time, conditions.FromTime, conditions.ToTime) {
+		return noMatch("the time of day does not match")
+	}
+	if conditions.Channel != "" && conditions.Channel != ctx.channel {
+		return noMatch("the channel does not match")
+	}
+
+	return RuleMatch{Rule: rule, Matched: true}
+}
+
+func senderDomain(mail string) string {
+	parts := strings.Split(mail, "@")
+	return parts[len(parts)-1]
+}
+
+// Patterns are case insensitive, invalid patterns never match
+func matchesPattern(pattern string, text string) bool {
+	regExp, err := regexp.Compile("(?i)" + pattern)
+	return err == nil && regExp.MatchString(text)
+}
+
+// Checks if the time is in the range of the day. Ranges where the start is after the end span midnight
+func isInTimeOfDay(t time.Time, from string, to string) bool {
+	current := t.Format("15:04")
+	if from <= to {
+		return current >= from && current < to
+	}
+	return current >= from || current < to
+}
+
+// Evaluates all rules for a past ticket as if it was created right now, without running any action.
+// The channel is taken from the audit log if it was recorded
+func DryRunRules(ticket Ticket, trigger string) ([]RuleMatch, error) {
+	ruleList, err := ReadRules()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ticket.MessageList) == 0 {
+		return nil, fmt.Errorf("the ticket has no messages")
+	}
+	ctx := ruleContext{trigger: trigger, time: ticket.MessageList[0].CreationDate, ticket: ticket, text: ticket.MessageList[0].Text}
+
+	auditEntries, err := QueryAuditLog(AuditFilter{TicketID: ticket.ID, Action: string(EventTicketCreated)})
+	if err == nil && len(auditEntries) > 0 {
+		ctx.channel = auditEntries[0].Source
+	}
+
+	if trigger == RuleTriggerCustomerReply {
+		for i := len(ticket.MessageList) - 1; i > 0; i-- {
+			if ticket.MessageList[i].Type == MessageTypeCustomer {
+				ctx.time = ticket.MessageList[i].CreationDate
+				ctx.text = ticket.MessageList[i].Text
+				break
+			}
+		}
+	}
+
+	var matches []RuleMatch
+	for _, rule := range ruleList.Rules {
+		match := evaluateRule(rule, ctx)
+		matches = append(matches, match)
+		if match.Matched && rule.StopProcessing {
+			break
+		}
+	}
+
+	return matches, nil
+}
+
+// Stores a new rule at the end of the rule list
+func CreateRule(rule Rule) (Rule, error) {
+	err := ValidateRule(rule)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	mutexRules.Lock()
+	defer mutexRules.Unlock()
+
+	ruleList, err := ReadRules()
+	if err != nil {
+		return Rule{}, err
+	}
+
+	ruleList.RuleIDCounter++
+	rule.ID = ruleList.RuleIDCounter
+	rule.FireCount = 0
+	ruleList.Rules = append(ruleList.Rules, rule)
+
+	return rule, WriteToXML(ruleList, config.RulesFilePath())
+}
+
+// Replaces the rule with the same ID. The fire count is kept
+func UpdateRule(rule Rule) (Rule, error) {
+	err := ValidateRule(rule)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	err = changeRules(func(rules []Rule) ([]Rule, error) {
+		i, err := findRule(rules, rule.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		rule.FireCount = rules[i].FireCount
+		rules[i] = rule
+		return rules, nil
+	})
+
+	return rule, err
+}
+
+// Removes a rule
+func DeleteRule(id int) error {
+	return changeRules(func(rules []Rule) ([]Rule, error) {
+		i, err := findRule(rules, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(rules[:i], rules[i+1:]...), nil
+	})
+}
+
+// Applies the change to the stored rules while holding the lock
+func changeRules(change func(rules []Rule) ([]Rule, error)) error {
+	mutexRules.Lock()
+	defer mutexRules.Unlock()
+
+	ruleList, err := ReadRules()
+	if err != nil {
+		return err
+	}
+
+	ruleList.Rules, err = change(ruleList.Rules)
+	if err != nil {
+		return err
+	}
+
+	return WriteToXML(ruleList, config.RulesFilePath())
+}
+
+func findRule(rules []Rule, id int) (int, error) {
+	for i, rule := range rules {
+		if rule.ID == id {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("couldn't find the rule")
+}
+
+// Returns the rule with the specified ID
+func GetRule(id int) (Rule, error) {
+	ruleList, err := ReadRules()
+	if err != nil {
+		return Rule{}, err
+	}
+
+	i, err := findRule(ruleList.Rules, id)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	return ruleList.Rules[i], nil
+}
+
+// Returns all rules in the order they are evaluated
+func ReadRules() (RuleList, error) {
+	file, err := ioutil.ReadFile(config.RulesFilePath())
+	if err != nil {
+		return RuleList{}, err
+	}
+
+	var ruleList RuleList
+	err = xml.Unmarshal(file, &ruleList)
+	if err != nil {
+		return RuleList{}, err
+	}
+
+	return ruleList, nil
+}
@@ -0,0 +1,215 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestValidateRule(t *testing.T) {
+	valid := Rule{Name: "Spam", Actions: []MacroAction{{MacroActionSpam, ""}}}
+	assert.Nil(t, ValidateRule(valid))
+
+	tests := []Rule{
+		{Name: "", Actions: valid.Actions},
+		{Name: "No actions"},
+		{Name: "Pattern", Actions: valid.Actions, Conditions: RuleConditions{SubjectPattern: "("}},
+		{Name: "Only start", Actions: valid.Actions, Conditions: RuleConditions{FromTime: "18:00"}},
+		{Name: "Time format", Actions: valid.Actions, Conditions: RuleConditions{FromTime: "25:00", ToTime: "08:00"}},
+		{Name: "Assign", Actions: []MacroAction{{MacroActionAssign, ""}}},
+		{Name: "Release", Actions: []MacroAction{{MacroActionRelease, ""}}},
+	}
+	for _, rule := range tests {
+		assert.NotNil(t, ValidateRule(rule), rule.Name)
+	}
+}
+
+func TestEvaluateRule(t *testing.T) {
+	evening := time.Date(2021, 1, 4, 22, 30, 0, 0, time.Local)
+	ctx := ruleContext{trigger: RuleTriggerCreate, channel: SourceMail, time: evening,
+		ticket: Ticket{Client: "max@spam.com", Reference: "You WON a prize"}, text: "Click here"}
+
+	tests := []struct {
+		rule    Rule
+		matched bool
+	}{
+		{Rule{Enabled: true, OnCreate: true}, true},
+		{Rule{Enabled: false, OnCreate: true}, false},
+		{Rule{Enabled: true, OnCustomerReply: true}, false},
+		{Rule{Enabled: true, OnCreate: true, Conditions: RuleConditions{SenderDomain: "@SPAM.com"}}, true},
+		{Rule{Enabled: true, OnCreate: true, Conditions: RuleConditions{SenderDomain: "dhbw.de"}}, false},
+		{Rule{Enabled: true, OnCreate: true, Conditions: RuleConditions{SubjectPattern: "won .* prize"}}, true},
+		{Rule{Enabled: true, OnCreate: true, Conditions: RuleConditions{BodyPattern: "^unsubscribe"}}, false},
+		{Rule{Enabled: true, OnCreate: true, Conditions: RuleConditions{FromTime: "18:00", ToTime: "08:00"}}, true},
+		{Rule{Enabled: true, OnCreate: true, Conditions: RuleConditions{FromTime: "08:00", ToTime: "18:00"}}, false},
+		{Rule{Enabled: true, OnCreate: true, Conditions: RuleConditions{Channel: SourceWeb}}, false},
+	}
+	for i, test := range tests {
+		match := evaluateRule(test.rule, ctx)
+		assert.Equal(t, test.matched, match.Matched, i)
+		assert.Equal(t, test.matched, match.Reason == "", i)
+	}
+}
+
+func TestIsInTimeOfDay(t *testing.T) {
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2021, 1, 4, hour, minute, 0, 0, time.Local)
+	}
+
+	assert.True(t, isInTimeOfDay(at(9, 0), "09:00", "17:00"))
+	assert.False(t, isInTimeOfDay(at(17, 0), "09:00", "17:00"))
+	assert.True(t, isInTimeOfDay(at(23, 59), "22:00", "06:00"))
+	assert.True(t, isInTimeOfDay(at(5, 59), "22:00", "06:00"))
+	assert.False(t, isInTimeOfDay(at(12, 0), "22:00", "06:00"))
+}
+
+func TestRuleStorage(t *testing.T) {
+	setup()
+	defer teardown()
+
+	rule, err := CreateRule(Rule{Name: "Spam", Enabled: true, OnCreate: true, Actions: []MacroAction{{MacroActionSpam, ""}}, FireCount: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, rule.ID)
+	assert.Equal(t, 0, rule.FireCount)
+	_, err = CreateRule(Rule{Name: "Invalid"})
+	assert.NotNil(t, err)
+
+	rule.Conditions.SenderDomain = "spam.com"
+	_, err = UpdateRule(rule)
+	assert.Nil(t, err)
+	rule, err = GetRule(rule.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "spam.com", rule.Conditions.SenderDomain)
+	_, err = UpdateRule(Rule{ID: 99, Name: "Unknown", Actions: rule.Actions})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, DeleteRule(rule.ID))
+	_, err = GetRule(rule.ID)
+	assert.NotNil(t, err)
+	assert.NotNil(t, DeleteRule(rule.ID))
+}
+
+func TestApplyRulesOnEvent(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateUser("Test123", "Aa!123456")
+	assert.Nil(t, err)
+
+	_, err = CreateRule(Rule{Name: "Spam", Enabled: true, OnCreate: true, StopProcessing: true,
+		Conditions: RuleConditions{SenderDomain: "spam.com"}, Actions: []MacroAction{{MacroActionSpam, ""}}})
+	assert.Nil(t, err)
+	_, err = CreateRule(Rule{Name: "Urgent", Enabled: true, OnCreate: true, OnCustomerReply: true,
+		Conditions: RuleConditions{BodyPattern: "urgent"}, Actions: []MacroAction{{MacroActionPriority, "urgent"}, {MacroActionAssign, "Test123"}}})
+	assert.Nil(t, err)
+
+	var received []Event
+	SubscribeEvents(func(event Event) {
+		if event.Actor == SystemActor {
+			received = append(received, event)
+		}
+	})
+
+	// The spam rule stops the processing, so the urgent rule is not applied
+	spam, err := CreateTicket("max@spam.com", "Offer", "Urgent offer")
+	assert.Nil(t, err)
+	applyRulesOnEvent(Event{Type: EventTicketCreated, Ticket: spam, Actor: spam.Client, Source: SourceMail, Timestamp: time.Now()})
+	spam, err = ReadTicket(spam.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusClosed, spam.Status)
+	assert.Equal(t, TicketPriorityNormal, spam.Priority)
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, EventTicketClosed, received[0].Type)
+	assert.Equal(t, "Spam", received[0].Details["rule"])
+	assert.Equal(t, SourceSystem, received[0].Source)
+
+	// Acknowledgements are not sent for tickets which were closed as spam
+	assert.Nil(t, SendAcknowledgement(spam, SourceMail))
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mailList.MailList))
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	applyRulesOnEvent(Event{Type: EventTicketCreated, Ticket: ticket, Actor: ticket.Client, Source: SourceWeb, Timestamp: time.Now()})
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketPriorityNormal, ticket.Priority)
+
+	// Replies of editors don't trigger the rules, only replies of the customer
+	ticket, err = AddMessage(ticket, ticket.Client, "This is urgent now")
+	assert.Nil(t, err)
+	applyRulesOnEvent(Event{Type: EventTicketCommented, Ticket: ticket, Actor: "Test123", Source: SourceWeb, Timestamp: time.Now()})
+	assert.Equal(t, TicketPriorityNormal, ticket.Priority)
+	applyRulesOnEvent(Event{Type: EventTicketCommented, Ticket: ticket, Actor: ticket.Client, Source: SourceMail, Timestamp: time.Now()})
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketPriorityUrgent, ticket.Priority)
+	assert.Equal(t, "Test123", ticket.Editor)
+
+	ruleList, err := ReadRules()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, ruleList.Rules[0].FireCount)
+	assert.Equal(t, 1, ruleList.Rules[1].FireCount)
+}
+
+func TestApplyRulesOnCurrentTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateRule(Rule{Name: "Spam", Enabled: true, OnCreate: true, Conditions: RuleConditions{SenderDomain: "spam.com"},
+		Actions: []MacroAction{{MacroActionSpam, ""}}})
+	assert.Nil(t, err)
+	_, err = CreateRule(Rule{Name: "Thanks", Enabled: true, OnCreate: true, Actions: []MacroAction{{MacroActionReply, "Thank you"}}})
+	assert.Nil(t, err)
+
+	// The second rule sees that the first one closed the ticket, hence the spammer doesn't get a reply
+	spam, err := CreateTicket("max@spam.com", "Offer", "Cheap offer")
+	assert.Nil(t, err)
+	applyRulesOnEvent(Event{Type: EventTicketCreated, Ticket: spam, Actor: spam.Client, Source: SourceMail, Timestamp: time.Now()})
+	spam, err = ReadTicket(spam.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusClosed, spam.Status)
+	assert.Equal(t, 2, len(spam.MessageList))
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mailList.MailList))
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	applyRulesOnEvent(Event{Type: EventTicketCreated, Ticket: ticket, Actor: ticket.Client, Source: SourceMail, Timestamp: time.Now()})
+	mailList, err = ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+}
+
+func TestDryRunRules(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateRule(Rule{Name: "Mail", Enabled: true, OnCreate: true, Conditions: RuleConditions{Channel: SourceMail}, Actions: []MacroAction{{MacroActionSpam, ""}}})
+	assert.Nil(t, err)
+	_, err = CreateRule(Rule{Name: "Reply", Enabled: true, OnCustomerReply: true, Actions: []MacroAction{{MacroActionPriority, "high"}}})
+	assert.Nil(t, err)
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	matches, err := DryRunRules(ticket, RuleTriggerCreate)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(matches))
+	assert.False(t, matches[0].Matched)
+	assert.Equal(t, "the channel does not match", matches[0].Reason)
+	assert.False(t, matches[1].Matched)
+
+	matches, err = DryRunRules(ticket, RuleTriggerCustomerReply)
+	assert.Nil(t, err)
+	assert.True(t, matches[1].Matched)
+
+	// Nothing was changed by the dry run
+	stored, err := ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusOpen, stored.Status)
+	assert.Equal(t, TicketPriorityNormal, stored.Priority)
+}
@@ -0,0 +1,409 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name of the manifest in the backup archives, it is always their first entry
+const backupManifestName = "manifest.xml"
+
+const backupVersion = 1
+
+// Pauses the writes to the data folder while a snapshot is taken or restored, so no file is captured half written.
+// Writes only hold it for reading, because they don't exclude each other
+var mutexStorage = &sync.RWMutex{}
+
+// Describes the files of a backup archive, so the archive can be validated before it is restored
+type BackupManifest struct {
+	XMLName      xml.Name     `xml:"Manifest"`
+	Version      int          `xml:"Version"`
+	CreationDate time.Time    `xml:"CreationDate"`
+	Files        []BackupFile `xml:"Files>File"`
+}
+
+type BackupFile struct {
+	Path   string `xml:"Path"` // Relative to the data folder with slashes as separators
+	Size   int64  `xml:"Size"`
+	SHA256 string `xml:"SHA256"`
+}
+
+// Writes a consistent snapshot of the data folder as gzip compressed tar archive while the ticket system is running.
+// The writes are only paused while the archive is written into a temporary file, it is copied to the writer afterwards,
+// so a slow download doesn't hold them up. The manifest with the checksums of the files is the first entry of the archive.
+// Only the server pauses its own writes, hence the command line must not take a snapshot while a server uses the data folder
+func WriteBackup(w io.Writer) (BackupManifest, error) {
+	archive, err := ioutil.TempFile("", "ticketsystem-backup-*.tar.gz")
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	manifest, err := snapshotDataFolder(archive)
+	if err != nil {
+		return manifest, err
+	}
+
+	_, err = archive.Seek(0, io.SeekStart)
+	if err != nil {
+		return manifest, err
+	}
+	_, err = io.Copy(w, archive)
+	return manifest, err
+}
+
+// Writes the archive of the data folder while its writes are paused
+func snapshotDataFolder(w io.Writer) (BackupManifest, error) {
+	mutexStorage.Lock()
+	defer mutexStorage.Unlock()
+
+	manifest, err := dataFolderManifest(time.Now())
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, writeBackupArchive(w, manifest, func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(config.DataPath, filepath.FromSlash(name)))
+	})
+}
+
+// Lists the files of the data folder with their checksums, the lock file of the server is left out
+func dataFolderManifest(creationDate time.Time) (BackupManifest, error) {
+	manifest := BackupManifest{Version: backupVersion, CreationDate: creationDate}
+	err := filepath.Walk(config.DataPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() || filePath == filepath.Clean(config.LockFilePath()) {
+			return err
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		hash := sha256.New()
+		size, err := io.Copy(hash, file)
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(config.DataPath, filePath)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, BackupFile{Path: filepath.ToSlash(relative), Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+		return nil
+	})
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+	return manifest, err
+}
+
+// Writes the manifest and then the content of its files, which is opened one file after another
+func writeBackupArchive(w io.Writer, manifest BackupManifest, open func(name string) (io.ReadCloser, error)) error {
+	manifestContent, err := xml.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	manifestContent = append([]byte(xml.Header), manifestContent...)
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	err = writeTarFile(tarWriter, backupManifestName, int64(len(manifestContent)), bytes.NewReader(manifestContent), manifest.CreationDate)
+	if err != nil {
+		return err
+	}
+	for _, file := range manifest.Files {
+		content, err := open(file.Path)
+		if err != nil {
+			return err
+		}
+		err = writeTarFile(tarWriter, file.Path, file.Size, content, manifest.CreationDate)
+		_ = content.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func writeTarFile(tarWriter *tar.Writer, name string, size int64, content io.Reader, modTime time.Time) error {
+	err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: modTime, Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tarWriter, content)
+	return err
+}
+
+// Marks the data folder as used by the running server. The commands for the data folder refuse to run while the lock
+// file exists, because the server only pauses the writes of its own process
+func LockDataFolder() error {
+	file, err := os.OpenFile(config.LockFilePath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("the data folder %s is already used by a server, remove %s if no server is running",
+			config.DataPath, config.LockFilePath())
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(strconv.Itoa(os.Getpid()))
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Releases the data folder when the server shuts down
+func UnlockDataFolder() error {
+	return os.Remove(config.LockFilePath())
+}
+
+// Returns an error while a server uses the data folder. Snapshots of a running server can be downloaded from /data/backup
+func CheckDataFolderUnlocked() error {
+	_, err := os.Stat(config.LockFilePath())
+	if err == nil {
+		return fmt.Errorf("the data folder %s is used by a running server, download the backup from /data/backup instead "+
+			"or remove %s if no server is running", config.DataPath, config.LockFilePath())
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Reads the backup archive and checks it against its manifest. Every file needs a safe path, the size and the checksum
+// of the manifest and has to be listed exactly once. The users and the ticket IDs of the configured storage backend
+// are required and the XML files have to be well-formed
+func ReadBackup(r io.Reader) (BackupManifest, map[string][]byte, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return BackupManifest{}, nil, fmt.Errorf("the backup is no gzip archive: %v", err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	header, err := tarReader.Next()
+	if err != nil || header.Name != backupManifestName {
+		return BackupManifest{}, nil, fmt.Errorf("the backup doesn't start with the manifest")
+	}
+	manifestContent, err := ioutil.ReadAll(tarReader)
+	if err != nil {
+		return BackupManifest{}, nil, err
+	}
+	var manifest BackupManifest
+	err = xml.Unmarshal(manifestContent, &manifest)
+	if err != nil {
+		return BackupManifest{}, nil, fmt.Errorf("the manifest can't be read: %v", err)
+	}
+	if manifest.Version != backupVersion {
+		return manifest, nil, fmt.Errorf("the backup has the unsupported version %d", manifest.Version)
+	}
+
+	expected := make(map[string]BackupFile)
+	for _, file := range manifest.Files {
+		expected[file.Path] = file
+	}
+
+	files := make(map[string][]byte)
+	for {
+		header, err = tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, err
+		}
+
+		file, listed := expected[header.Name]
+		if header.Typeflag != tar.TypeReg || !isSafeBackupPath(header.Name) {
+			return manifest, nil, fmt.Errorf("the backup contains the invalid entry %q", header.Name)
+		}
+		if !listed {
+			return manifest, nil, fmt.Errorf("the file %s is not listed in the manifest", header.Name)
+		}
+		if _, ok := files[header.Name]; ok {
+			return manifest, nil, fmt.Errorf("the file %s is contained twice", header.Name)
+		}
+
+		content, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return manifest, nil, err
+		}
+		checksum := sha256.Sum256(content)
+		if int64(len(content)) != file.Size || hex.EncodeToString(checksum[:]) != file.SHA256 {
+			return manifest, nil, fmt.Errorf("the checksum of the file %s doesn't match", header.Name)
+		}
+		if strings.HasSuffix(header.Name, ".xml") && !isWellFormedXML(content) {
+			return manifest, nil, fmt.Errorf("the file %s is no valid XML", header.Name)
+		}
+		files[header.Name] = content
+	}
+
+	for _, file := range manifest.Files {
+		if _, ok := files[file.Path]; !ok {
+			return manifest, nil, fmt.Errorf("the file %s of the manifest is missing", file.Path)
+		}
+	}
+	for _, required := range []string{config.UsersFilePath(), ticketStoreFilePath()} {
+		relative, err := filepath.Rel(config.DataPath, required)
+		if err != nil {
+			return manifest, nil, err
+		}
+		if _, ok := files[filepath.ToSlash(relative)]; !ok {
+			return manifest, nil, fmt.Errorf("the backup contains no %s", filepath.ToSlash(relative))
+		}
+	}
+
+	return manifest, files, nil
+}
+
+// Returns the file with the ticket IDs of the configured storage backend
+func ticketStoreFilePath() string {
+	if config.StorageBackend == StorageLog {
+		return config.TicketLogFilePath()
+	}
+	return config.DefinitionsFilePath()
+}
+
+// Only relative paths inside the data folder can be restored
+func isSafeBackupPath(name string) bool {
+	return name != "" && name != backupManifestName && !path.IsAbs(name) && path.Clean(name) == name && name != ".." &&
+		!strings.HasPrefix(name, "../")
+}
+
+// Empty files are accepted, because the users are stored in an empty file until the first user signs up
+func isWellFormedXML(content []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// Replaces the data folder with the validated backup. The ticket system must not be running, because the stores are
+// replaced as a whole. The previous data folder is kept next to it and its path is returned. Afterwards the ticket store
+// is opened again, missing stores of older backups are created and the ID counters are rebuilt from the restored files
+func RestoreBackup(r io.Reader) (BackupManifest, string, error) {
+	manifest, files, err := ReadBackup(r)
+	if err != nil {
+		return manifest, "", err
+	}
+
+	err = ticketStore.Close()
+	if err != nil {
+		return manifest, "", err
+	}
+	previousPath, err := replaceDataFolder(files)
+	if err != nil {
+		_ = InitDataStorage()
+		return manifest, "", err
+	}
+
+	err = InitDataStorage()
+	if err != nil {
+		return manifest, previousPath, err
+	}
+	return manifest, previousPath, rebuildIDCounters()
+}
+
+// Writes the files into a new folder which then replaces the data folder
+func replaceDataFolder(files map[string][]byte) (string, error) {
+	mutexStorage.Lock()
+	defer mutexStorage.Unlock()
+
+	restorePath := filepath.Clean(config.DataPath) + ".restore"
+	err := os.RemoveAll(restorePath)
+	if err != nil {
+		return "", err
+	}
+	for name, content := range files {
+		filePath := filepath.Join(restorePath, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(filePath), 0777)
+		if err != nil {
+			return "", err
+		}
+		err = ioutil.WriteFile(filePath, content, 0644)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var previousPath string
+	_, err = os.Stat(config.DataPath)
+	if err == nil {
+		previousPath = filepath.Clean(config.DataPath) + ".before-restore-" + time.Now().Format("20060102-150405")
+		err = os.Rename(config.DataPath, previousPath)
+		if err != nil {
+			return "", err
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	return previousPath, os.Rename(restorePath, config.DataPath)
+}
+
+// Raises the counters of the ticket and mail IDs to the highest restored ID, so new tickets and mails don't overwrite
+// restored ones if the counters of the backup were behind
+func rebuildIDCounters() error {
+	mutexTicketID.Lock()
+	defer mutexTicketID.Unlock()
+
+	ids, err := ticketStore.TicketIDs()
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 && ids[len(ids)-1] > getTicketIDCounter() {
+		err = ticketStore.SetLastTicketID(ids[len(ids)-1])
+		if err != nil {
+			return err
+		}
+	}
+
+	mutexMailID.Lock()
+	defer mutexMailID.Unlock()
+
+	mailList, err := ReadMailsFile()
+	if err != nil {
+		return err
+	}
+	highestMailID := mailList.MailIDCounter
+	for _, mail := range mailList.MailList {
+		highestMailID = maxInt(highestMailID, mail.ID)
+	}
+	if highestMailID > mailList.MailIDCounter {
+		mailList.MailIDCounter = highestMailID
+		return WriteToXML(mailList, config.MailFilePath())
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Removes the data folders which were kept by restores
+func removePreviousDataFolders(t *testing.T) {
+	folders, err := filepath.Glob(config.DataPath + ".before-restore-*")
+	assert.Nil(t, err)
+	for _, folder := range folders {
+		assert.Nil(t, os.RemoveAll(folder))
+	}
+}
+
+// Reads the files of the data folder, so tests can change them before they are written into an archive
+func readDataFiles() (map[string][]byte, error) {
+	manifest, err := dataFolderManifest(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	for _, file := range manifest.Files {
+		files[file.Path], err = ioutil.ReadFile(filepath.Join(config.DataPath, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Writes the files as backup archive with a matching manifest
+func writeBackupFiles(w io.Writer, files map[string][]byte, creationDate time.Time) (BackupManifest, error) {
+	manifest := BackupManifest{Version: backupVersion, CreationDate: creationDate}
+	for name, content := range files {
+		checksum := sha256.Sum256(content)
+		manifest.Files = append(manifest.Files, BackupFile{Path: name, Size: int64(len(content)), SHA256: hex.EncodeToString(checksum[:])})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+
+	return manifest, writeBackupArchive(w, manifest, func(name string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(files[name])), nil
+	})
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	setup()
+	defer teardown()
+	defer removePreviousDataFolders(t)
+
+	createEditors(t, "Anna")
+	createTickets(t, "Outage", "Printer broken")
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Actor: "Anna", Action: "ticket.closed", TicketID: 1}))
+
+	var backup bytes.Buffer
+	manifest, err := WriteBackup(&backup)
+	assert.Nil(t, err)
+	var paths []string
+	for _, file := range manifest.Files {
+		paths = append(paths, file.Path)
+	}
+	assert.Contains(t, paths, "tickets/ticket1.xml")
+	assert.Contains(t, paths, "users/users.xml")
+	assert.Contains(t, paths, "definitions.xml")
+	assert.Contains(t, paths, "mails.xml")
+	assert.Contains(t, paths, "audit.log")
+
+	// Changes after the snapshot are undone by the restore
+	createTickets(t, "No internet")
+	assert.Nil(t, ChangeStatus(1, TicketStatusClosed))
+	_, err = ReadTicket(1)
+	assert.Nil(t, err)
+
+	restored, previousPath, err := RestoreBackup(bytes.NewReader(backup.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, len(manifest.Files), len(restored.Files))
+	assert.True(t, manifest.CreationDate.Equal(restored.CreationDate))
+	assert.Equal(t, 2, getTicketIDCounter())
+	ticket, err := ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusOpen, ticket.Status)
+	_, err = ReadTicket(3)
+	assert.NotNil(t, err)
+	users, err := ReadUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, "Anna", users["Anna"].Username)
+	entries, err := QueryAuditLog(AuditFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	// The previous data folder is kept
+	_, err = os.Stat(filepath.Join(previousPath, "tickets", "ticket3.xml"))
+	assert.Nil(t, err)
+}
+
+// Stores a ticket when the backup is written to it, which only succeeds once the writes aren't paused anymore
+type storingWriter struct {
+	t      *testing.T
+	stored bool
+}
+
+func (writer *storingWriter) Write(p []byte) (int, error) {
+	if !writer.stored {
+		writer.stored = true
+		done := make(chan error)
+		go func() {
+			_, err := CreateTicket("client@dhbw.de", "Written during the download", "Help")
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			assert.Nil(writer.t, err)
+		case <-time.After(5 * time.Second):
+			writer.t.Error("the writes are paused while the backup is downloaded")
+		}
+	}
+	return len(p), nil
+}
+
+func TestWriteBackupDoesNotPauseWritesWhileStreaming(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createTickets(t, "Outage")
+	writer := &storingWriter{t: t}
+	manifest, err := WriteBackup(writer)
+	assert.Nil(t, err)
+	assert.True(t, writer.stored)
+	assert.Equal(t, 2, getTicketIDCounter())
+
+	// The snapshot was taken before the ticket was stored
+	for _, file := range manifest.Files {
+		assert.NotEqual(t, "tickets/ticket2.xml", file.Path)
+	}
+}
+
+func TestLockDataFolder(t *testing.T) {
+	setup()
+	defer teardown()
+
+	assert.Nil(t, CheckDataFolderUnlocked())
+	assert.Nil(t, LockDataFolder())
+	assert.NotNil(t, LockDataFolder())
+	assert.NotNil(t, CheckDataFolderUnlocked())
+
+	// The lock file of the running server is not part of its snapshots
+	var backup bytes.Buffer
+	manifest, err := WriteBackup(&backup)
+	assert.Nil(t, err)
+	for _, file := range manifest.Files {
+		assert.NotEqual(t, "server.lock", file.Path)
+	}
+	_, files, err := ReadBackup(&backup)
+	assert.Nil(t, err)
+	assert.Equal(t, len(manifest.Files), len(files))
+
+	assert.Nil(t, UnlockDataFolder())
+	assert.Nil(t, CheckDataFolderUnlocked())
+}
+
+func TestRestoreBackupRebuildsIDCounters(t *testing.T) {
+	setup()
+	defer teardown()
+	defer removePreviousDataFolders(t)
+
+	createTickets(t, "Outage", "Printer broken")
+	_, err := QueueMail("client@dhbw.de", "Reply", "Restart it")
+	assert.Nil(t, err)
+	files, err := readDataFiles()
+	assert.Nil(t, err)
+
+	// The counters of the backup are behind the stored tickets and mails
+	files["definitions.xml"] = []byte("<int>1</int>")
+	files["mails.xml"] = bytes.Replace(files["mails.xml"], []byte("<MailIDCounter>1</MailIDCounter>"), []byte("<MailIDCounter>0</MailIDCounter>"), 1)
+	delete(files, "queues.xml")
+	var backup bytes.Buffer
+	_, err = writeBackupFiles(&backup, files, time.Now())
+	assert.Nil(t, err)
+
+	_, _, err = RestoreBackup(&backup)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, getTicketIDCounter())
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, mailList.MailIDCounter)
+	_, err = os.Stat(config.QueuesFilePath())
+	assert.Nil(t, err)
+}
+
+func TestReadBackupRejectsInvalidArchives(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createTickets(t, "Outage")
+	files, err := readDataFiles()
+	assert.Nil(t, err)
+	var valid bytes.Buffer
+	manifest, err := writeBackupFiles(&valid, files, time.Now())
+	assert.Nil(t, err)
+
+	archive := func(entries ...tar.Header) []byte {
+		var buffer bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buffer)
+		tarWriter := tar.NewWriter(gzipWriter)
+		for _, entry := range entries {
+			content := files[entry.Name]
+			if entry.Name == backupManifestName {
+				var manifestBuffer bytes.Buffer
+				_, err := writeBackupFiles(&manifestBuffer, files, manifest.CreationDate)
+				assert.Nil(t, err)
+				content = firstTarEntry(t, manifestBuffer.Bytes())
+			}
+			if entry.Size == 0 {
+				entry.Size = int64(len(content))
+			} else {
+				content = bytes.Repeat([]byte(" "), int(entry.Size))
+			}
+			if entry.Typeflag == 0 {
+				entry.Typeflag = tar.TypeReg
+			}
+			entry.Mode = 0644
+			assert.Nil(t, tarWriter.WriteHeader(&entry))
+			if entry.Typeflag == tar.TypeReg {
+				_, err := tarWriter.Write(content)
+				assert.Nil(t, err)
+			}
+		}
+		assert.Nil(t, tarWriter.Close())
+		assert.Nil(t, gzipWriter.Close())
+		return buffer.Bytes()
+	}
+	var allFiles []tar.Header
+	for _, file := range manifest.Files {
+		allFiles = append(allFiles, tar.Header{Name: file.Path})
+	}
+	without := func(name string) []tar.Header {
+		var entries []tar.Header
+		for _, entry := range allFiles {
+			if entry.Name != name {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+
+	_, _, err = ReadBackup(bytes.NewReader(valid.Bytes()))
+	assert.Nil(t, err)
+	_, _, err = ReadBackup(bytes.NewReader(archive(append([]tar.Header{{Name: backupManifestName}}, allFiles...)...)))
+	assert.Nil(t, err)
+
+	tests := [][]byte{
+		[]byte("no archive"),
+		archive(allFiles...),
+		archive(tar.Header{Name: backupManifestName}),
+		archive(append([]tar.Header{{Name: backupManifestName}, {Name: "../evil.xml"}}, allFiles...)...),
+		archive(append([]tar.Header{{Name: backupManifestName}, {Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}}, allFiles...)...),
+		archive(append([]tar.Header{{Name: backupManifestName}, {Name: "unlisted.xml"}}, allFiles...)...),
+		archive(append([]tar.Header{{Name: backupManifestName}, {Name: "definitions.xml"}}, allFiles...)...),
+		archive(append([]tar.Header{{Name: backupManifestName}, {Name: "tickets/ticket1.xml", Size: 3}}, without("tickets/ticket1.xml")...)...),
+		archive(append([]tar.Header{{Name: backupManifestName}}, without("mails.xml")...)...),
+	}
+	for _, backup := range tests {
+		_, _, err = RestoreBackup(bytes.NewReader(backup))
+		assert.NotNil(t, err)
+	}
+
+	// Failed restores leave the data untouched
+	ticket, err := ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "Outage", ticket.Reference)
+
+	assert.True(t, isSafeBackupPath("tickets/ticket1.xml"))
+	assert.False(t, isSafeBackupPath("/etc/passwd"))
+	assert.False(t, isSafeBackupPath("tickets/../../evil"))
+	assert.False(t, isWellFormedXML([]byte("<Ticket><ID>1</Ticket>")))
+	assert.True(t, isWellFormedXML(nil))
+}
+
+func firstTarEntry(t *testing.T, archive []byte) []byte {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(archive))
+	assert.Nil(t, err)
+	tarReader := tar.NewReader(gzipReader)
+	_, err = tarReader.Next()
+	assert.Nil(t, err)
+	var content bytes.Buffer
+	_, err = content.ReadFrom(tarReader)
+	assert.Nil(t, err)
+	return content.Bytes()
+}
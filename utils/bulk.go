@@ -0,0 +1,171 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Operations which can be run on several tickets of the overview at once
+const (
+	BulkAssign       = "assign"       // Assigns the tickets to the editor of the value or to the one running the operation if it is empty
+	BulkRelease      = "release"      // Releases the tickets of the one running the operation
+	BulkClose        = "close"        // Closes the tickets and sends the closure notices
+	BulkCloseQuietly = "closeQuietly" // Closes the tickets without closure notices, e.g. to clear a wave of spam
+	BulkTag          = "tag"          // Adds the comma separated tags of the value to the tickets
+	BulkPriority     = "priority"     // Sets the priority with the name of the value
+	BulkMerge        = "merge"        // Merges the tickets into the one with the lowest ID
+)
+
+// Outcome of a bulk operation for a single ticket, the error is empty if the operation succeeded
+type BulkResult struct {
+	TicketID int
+	Error    string
+}
+
+func (result BulkResult) Succeeded() bool {
+	return result.Error == ""
+}
+
+// Runs the operation on every ticket and reports the outcome per ticket. The tickets are changed one after another
+// with the same checks as the single actions, hence a failing ticket doesn't stop the others. An error is only
+// returned if the operation itself is invalid
+func RunBulkOperation(operation string, value string, ids []int, actor User) ([]BulkResult, error) {
+	ids = uniqueSortedIDs(ids)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("at least one ticket has to be selected")
+	}
+	if operation == BulkMerge {
+		if len(ids) < 2 {
+			return nil, fmt.Errorf("at least two tickets have to be selected for merging")
+		}
+		return bulkMerge(ids, actor), nil
+	}
+
+	action, err := bulkMacroAction(operation, value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only editors who may access a ticket can be assigned to it
+	var assignee User
+	if operation == BulkAssign {
+		users, err := ReadUsers()
+		if err != nil {
+			return nil, err
+		}
+		name := value
+		if name == "" {
+			name = actor.Username
+		}
+		var ok bool
+		if assignee, ok = users[name]; !ok {
+			return nil, fmt.Errorf("the editor %s does not exist", name)
+		}
+	}
+
+	var results []BulkResult
+	for _, id := range ids {
+		ticket, err := readBulkTicket(id, actor)
+		if err == nil && operation == BulkAssign && !CanAccessTicket(assignee, ticket) {
+			err = fmt.Errorf("%s can't access the queue of the ticket", assignee.Username)
+		}
+		if err == nil {
+			_, err = runActions([]MacroAction{action}, id, actor, SourceWeb, map[string]string{"bulk": operation}, operation != BulkCloseQuietly)
+		}
+		results = append(results, newBulkResult(id, err))
+	}
+
+	return results, nil
+}
+
+// Returns the macro action which performs the operation on a single ticket
+func bulkMacroAction(operation string, value string) (MacroAction, error) {
+	var action MacroAction
+	switch operation {
+	case BulkAssign:
+		action = MacroAction{Type: MacroActionAssign, Value: value}
+	case BulkRelease:
+		action = MacroAction{Type: MacroActionRelease}
+	case BulkClose, BulkCloseQuietly:
+		action = MacroAction{Type: MacroActionStatus, Value: "closed"}
+	case BulkTag:
+		action = MacroAction{Type: MacroActionTag, Value: value}
+	case BulkPriority:
+		action = MacroAction{Type: MacroActionPriority, Value: value}
+	default:
+		return action, fmt.Errorf("unknown bulk operation %q", operation)
+	}
+
+	return action, validateMacroAction(action)
+}
+
+// Merges the tickets one after another into the first one, which has to be accessible for the whole operation
+func bulkMerge(ids []int, actor User) []BulkResult {
+	target, err := readBulkTicket(ids[0], actor)
+	if err != nil {
+		var results []BulkResult
+		for _, id := range ids {
+			results = append(results, newBulkResult(id, fmt.Errorf("ticket %d can't be merged into: %v", ids[0], err)))
+		}
+		return results
+	}
+
+	results := []BulkResult{{TicketID: target.ID}}
+	for _, id := range ids[1:] {
+		_, err := readBulkTicket(id, actor)
+		if err == nil {
+			err = MergeTickets(target.ID, id, actor.Username)
+		}
+		if err == nil {
+			before := target
+			target, err = ReadTicket(target.ID)
+			if err == nil {
+				PublishEvent(Event{Type: EventTicketMerged, Ticket: target, Actor: actor.Username, Source: SourceWeb,
+					Changes: TicketChanges(before, target), Details: map[string]string{"mergedTicketId": strconv.Itoa(id), "bulk": BulkMerge}})
+			}
+		}
+		results = append(results, newBulkResult(id, err))
+	}
+
+	return results
+}
+
+// Reads the ticket if the actor may change it
+func readBulkTicket(id int, actor User) (Ticket, error) {
+	ticket, err := ReadTicket(id)
+	if err != nil {
+		return Ticket{}, err
+	}
+	if !CanAccessTicket(actor, ticket) {
+		return Ticket{}, fmt.Errorf("%s can't access the queue of the ticket", actor.Username)
+	}
+	if ticket.IsMerged() {
+		return Ticket{}, fmt.Errorf("the ticket was merged into ticket %d", ticket.MergedInto)
+	}
+
+	return ticket, nil
+}
+
+func newBulkResult(id int, err error) BulkResult {
+	result := BulkResult{TicketID: id}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func uniqueSortedIDs(ids []int) []int {
+	seen := make(map[int]bool)
+	var unique []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	sort.Ints(unique)
+	return unique
+}
@@ -0,0 +1,143 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRunBulkOperation(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna", "Bert", "Carl")
+	users, err := ReadUsers()
+	assert.Nil(t, err)
+	anna := users["Anna"]
+	assert.Nil(t, SetUserHolidayMode("Carl", true))
+
+	ids := createTickets(t, "Outage", "No internet", "Printer broken")
+	queue, err := CreateQueue(Queue{Name: "Billing", Members: []string{"Anna"}})
+	assert.Nil(t, err)
+	ticket, err := ReadTicket(ids[2])
+	assert.Nil(t, err)
+	_, err = MoveTicket(ticket, queue.ID, "Anna")
+	assert.Nil(t, err)
+
+	var events []Event
+	SubscribeEvents(func(event Event) {
+		if event.Details["bulk"] != "" {
+			events = append(events, event)
+		}
+	})
+
+	// Invalid operations are rejected as a whole
+	_, err = RunBulkOperation("delete", "", ids, anna)
+	assert.NotNil(t, err)
+	_, err = RunBulkOperation(BulkPriority, "highest", ids, anna)
+	assert.NotNil(t, err)
+	_, err = RunBulkOperation(BulkAssign, "Dora", ids, anna)
+	assert.NotNil(t, err)
+	_, err = RunBulkOperation(BulkTag, "vip", nil, anna)
+	assert.NotNil(t, err)
+
+	// Bert can't be assigned to the ticket in the queue, Carl is in the holidays
+	results, err := RunBulkOperation(BulkAssign, "Bert", []int{ids[2], ids[0], ids[1], ids[0], 99}, anna)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(results))
+	assert.True(t, results[0].Succeeded())
+	assert.True(t, results[1].Succeeded())
+	assert.False(t, results[2].Succeeded())
+	assert.Equal(t, 99, results[3].TicketID)
+	assert.False(t, results[3].Succeeded())
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, EventTicketAssigned, events[0].Type)
+
+	results, err = RunBulkOperation(BulkAssign, "Carl", ids[:1], anna)
+	assert.Nil(t, err)
+	assert.Contains(t, results[0].Error, "absent")
+
+	// Bert can change his tickets but not the one in the queue
+	results, err = RunBulkOperation(BulkRelease, "", ids, users["Bert"])
+	assert.Nil(t, err)
+	assert.True(t, results[0].Succeeded())
+	assert.True(t, results[1].Succeeded())
+	assert.Contains(t, results[2].Error, "access")
+
+	// Only the tickets which were not closed quietly get a closure notice
+	results, err = RunBulkOperation(BulkCloseQuietly, "", ids[:2], anna)
+	assert.Nil(t, err)
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mailList.MailList))
+	closed, err := RunBulkOperation(BulkClose, "", ids[2:], anna)
+	assert.Nil(t, err)
+	for _, result := range append(results, closed...) {
+		assert.True(t, result.Succeeded())
+		ticket, err := ReadTicket(result.TicketID)
+		assert.Nil(t, err)
+		assert.Equal(t, TicketStatusClosed, ticket.Status)
+	}
+	assert.Equal(t, EventTicketClosed, events[len(events)-1].Type)
+	mailList, err = ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+
+	results, err = RunBulkOperation(BulkTag, "vip, network", ids[:2], anna)
+	assert.Nil(t, err)
+	ticket, err = ReadTicket(ids[1])
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"network", "vip"}, ticket.Tags)
+
+	results, err = RunBulkOperation(BulkPriority, "urgent", ids[:1], anna)
+	assert.Nil(t, err)
+	assert.True(t, results[0].Succeeded())
+	ticket, err = ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "urgent", ticket.PriorityName())
+}
+
+func TestRunBulkMerge(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna")
+	users, err := ReadUsers()
+	assert.Nil(t, err)
+
+	ids := createTickets(t, "Outage", "Outage again", "Still an outage", "Printer broken")
+	assert.Nil(t, ChangeEditor(ids[3], "Anna"))
+
+	var merged []string
+	SubscribeEvents(func(event Event) {
+		if event.Type == EventTicketMerged {
+			merged = append(merged, event.Details["mergedTicketId"])
+		}
+	})
+
+	_, err = RunBulkOperation(BulkMerge, "", ids[:1], users["Anna"])
+	assert.NotNil(t, err)
+
+	// The ticket with another editor can't be merged, the others end up in the ticket with the lowest ID
+	results, err := RunBulkOperation(BulkMerge, "", []int{ids[3], ids[2], ids[1], ids[0]}, users["Anna"])
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(results))
+	assert.Equal(t, ids[0], results[0].TicketID)
+	assert.True(t, results[0].Succeeded())
+	assert.True(t, results[1].Succeeded())
+	assert.True(t, results[2].Succeeded())
+	assert.False(t, results[3].Succeeded())
+	assert.Equal(t, []string{"2", "3"}, merged)
+
+	for _, id := range ids[1:3] {
+		ticket, err := ReadTicket(id)
+		assert.Nil(t, err)
+		assert.Equal(t, ids[0], ticket.MergedInto)
+	}
+
+	// Tombstones can't be changed in bulk anymore
+	results, err = RunBulkOperation(BulkTag, "vip", ids[1:2], users["Anna"])
+	assert.Nil(t, err)
+	assert.Contains(t, results[0].Error, "merged")
+}
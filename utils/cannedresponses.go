@@ -0,0 +1,209 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Placeholders which are replaced with the values of the ticket when a canned response is inserted
+const (
+	PlaceholderCustomer = "{customer}"
+	PlaceholderTicketID = "{ticketId}"
+	PlaceholderSubject  = "{subject}"
+	PlaceholderEditor   = "{editor}"
+)
+
+type CannedResponse struct {
+	ID           int       `xml:"ID"`
+	Name         string    `xml:"Name"`
+	Text         string    `xml:"Text"`
+	Owner        string    `xml:"Owner"`
+	Shared       bool      `xml:"Shared"` // Shared responses are visible to all editors, others only to their owner
+	UsageCount   int       `xml:"UsageCount"`
+	CreationDate time.Time `xml:"CreationDate"`
+}
+
+type CannedResponseList struct {
+	CannedResponseIDCounter int              `xml:"CannedResponseIDCounter"`
+	CannedResponses         []CannedResponse `xml:"cannedResponses>cannedResponse"`
+}
+
+var mutexCannedResponses = &sync.Mutex{}
+
+// Checks if the user is allowed to see and insert the canned response
+func (response CannedResponse) IsVisibleTo(user User) bool {
+	return response.Shared || response.Owner == user.Username
+}
+
+// Checks if the user is allowed to change and delete the canned response
+func (response CannedResponse) IsEditableBy(user User) bool {
+	return response.Owner == user.Username || user.IsAdmin()
+}
+
+// Creates a new canned response owned by the specified user
+func CreateCannedResponse(name string, text string, owner string, shared bool) (CannedResponse, error) {
+	if strings.TrimSpace(name) == "" || strings.TrimSpace(text) == "" {
+		return CannedResponse{}, fmt.Errorf("the name and the text of a canned response must not be empty")
+	}
+
+	mutexCannedResponses.Lock()
+	defer mutexCannedResponses.Unlock()
+
+	responseList, err := ReadCannedResponses()
+	if err != nil {
+		return CannedResponse{}, err
+	}
+
+	responseList.CannedResponseIDCounter++
+	response := CannedResponse{ID: responseList.CannedResponseIDCounter, Name: name, Text: text, Owner: owner, Shared: shared, CreationDate: time.Now()}
+	responseList.CannedResponses = append(responseList.CannedResponses, response)
+
+	return response, WriteToXML(responseList, config.CannedResponsesFilePath())
+}
+
+// Changes the name, text and visibility of a canned response. The usage count is kept
+func UpdateCannedResponse(id int, name string, text string, shared bool) (CannedResponse, error) {
+	if strings.TrimSpace(name) == "" || strings.TrimSpace(text) == "" {
+		return CannedResponse{}, fmt.Errorf("the name and the text of a canned response must not be empty")
+	}
+
+	var updated CannedResponse
+	err := changeCannedResponses(func(responses []CannedResponse) ([]CannedResponse, error) {
+		i, err := findCannedResponse(responses, id)
+		if err != nil {
+			return nil, err
+		}
+
+		responses[i].Name = name
+		responses[i].Text = text
+		responses[i].Shared = shared
+		updated = responses[i]
+		return responses, nil
+	})
+
+	return updated, err
+}
+
+// Removes a canned response
+func DeleteCannedResponse(id int) error {
+	return changeCannedResponses(func(responses []CannedResponse) ([]CannedResponse, error) {
+		i, err := findCannedResponse(responses, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(responses[:i], responses[i+1:]...), nil
+	})
+}
+
+// Counts the usage of a canned response, so the most important ones can be identified
+func IncrementCannedResponseUsage(id int) error {
+	return changeCannedResponses(func(responses []CannedResponse) ([]CannedResponse, error) {
+		i, err := findCannedResponse(responses, id)
+		if err != nil {
+			return nil, err
+		}
+
+		responses[i].UsageCount++
+		return responses, nil
+	})
+}
+
+// Applies the change to the stored canned responses while holding the lock
+func changeCannedResponses(change func(responses []CannedResponse) ([]CannedResponse, error)) error {
+	mutexCannedResponses.Lock()
+	defer mutexCannedResponses.Unlock()
+
+	responseList, err := ReadCannedResponses()
+	if err != nil {
+		return err
+	}
+
+	responseList.CannedResponses, err = change(responseList.CannedResponses)
+	if err != nil {
+		return err
+	}
+
+	return WriteToXML(responseList, config.CannedResponsesFilePath())
+}
+
+func findCannedResponse(responses []CannedResponse, id int) (int, error) {
+	for i, response := range responses {
+		if response.ID == id {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("couldn't find the canned response")
+}
+
+// Returns the canned response with the specified ID
+func GetCannedResponse(id int) (CannedResponse, error) {
+	responseList, err := ReadCannedResponses()
+	if err != nil {
+		return CannedResponse{}, err
+	}
+
+	i, err := findCannedResponse(responseList.CannedResponses, id)
+	if err != nil {
+		return CannedResponse{}, err
+	}
+
+	return responseList.CannedResponses[i], nil
+}
+
+// Returns the shared canned responses and the personal ones of the user ordered by their name
+func GetCannedResponsesForUser(user User) ([]CannedResponse, error) {
+	responseList, err := ReadCannedResponses()
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []CannedResponse
+	for _, response := range responseList.CannedResponses {
+		if response.IsVisibleTo(user) {
+			responses = append(responses, response)
+		}
+	}
+
+	sort.SliceStable(responses, func(i, j int) bool {
+		return strings.ToLower(responses[i].Name) < strings.ToLower(responses[j].Name)
+	})
+	return responses, nil
+}
+
+// Replaces the placeholders in the text with the values of the ticket and the editor
+func ExpandPlaceholders(text string, ticket Ticket, editor string) string {
+	replacer := strings.NewReplacer(
+		PlaceholderCustomer, ticket.Client,
+		PlaceholderTicketID, strconv.Itoa(ticket.ID),
+		PlaceholderSubject, ticket.Reference,
+		PlaceholderEditor, editor,
+	)
+	return replacer.Replace(text)
+}
+
+// Returns all stored canned responses
+func ReadCannedResponses() (CannedResponseList, error) {
+	file, err := ioutil.ReadFile(config.CannedResponsesFilePath())
+	if err != nil {
+		return CannedResponseList{}, err
+	}
+
+	var responseList CannedResponseList
+	err = xml.Unmarshal(file, &responseList)
+	if err != nil {
+		return CannedResponseList{}, err
+	}
+
+	return responseList, nil
+}
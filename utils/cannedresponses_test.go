@@ -0,0 +1,127 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCreateCannedResponse(t *testing.T) {
+	setup()
+	defer teardown()
+
+	first, err := CreateCannedResponse("Greeting", "Hello {customer}", "Test123", true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first.ID)
+	second, err := CreateCannedResponse("Goodbye", "Bye", "Test123", false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, second.ID)
+
+	_, err = CreateCannedResponse(" ", "Text", "Test123", false)
+	assert.NotNil(t, err)
+	_, err = CreateCannedResponse("Name", "", "Test123", false)
+	assert.NotNil(t, err)
+
+	response, err := GetCannedResponse(first.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello {customer}", response.Text)
+	assert.True(t, response.Shared)
+
+	_, err = GetCannedResponse(3)
+	assert.NotNil(t, err)
+}
+
+func TestUpdateAndDeleteCannedResponse(t *testing.T) {
+	setup()
+	defer teardown()
+
+	response, err := CreateCannedResponse("Greeting", "Hello", "Test123", false)
+	assert.Nil(t, err)
+	assert.Nil(t, IncrementCannedResponseUsage(response.ID))
+
+	updated, err := UpdateCannedResponse(response.ID, "Welcome", "Welcome {customer}", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "Welcome", updated.Name)
+	assert.True(t, updated.Shared)
+	assert.Equal(t, 1, updated.UsageCount)
+
+	_, err = UpdateCannedResponse(5, "Name", "Text", false)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, DeleteCannedResponse(response.ID))
+	assert.NotNil(t, DeleteCannedResponse(response.ID))
+
+	responseList, err := ReadCannedResponses()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(responseList.CannedResponses))
+	assert.Equal(t, 1, responseList.CannedResponseIDCounter)
+}
+
+func TestCannedResponseUsage(t *testing.T) {
+	setup()
+	defer teardown()
+
+	response, err := CreateCannedResponse("Greeting", "Hello", "Test123", false)
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, IncrementCannedResponseUsage(response.ID))
+	}
+	assert.NotNil(t, IncrementCannedResponseUsage(2))
+
+	response, err = GetCannedResponse(response.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, response.UsageCount)
+}
+
+func TestGetCannedResponsesForUser(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateCannedResponse("b shared", "Text", "Other", true)
+	assert.Nil(t, err)
+	_, err = CreateCannedResponse("personal of other", "Text", "Other", false)
+	assert.Nil(t, err)
+	_, err = CreateCannedResponse("A personal", "Text", "Test123", false)
+	assert.Nil(t, err)
+
+	responses, err := GetCannedResponsesForUser(User{Username: "Test123"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(responses))
+	assert.Equal(t, "A personal", responses[0].Name)
+	assert.Equal(t, "b shared", responses[1].Name)
+}
+
+func TestCannedResponsePermissions(t *testing.T) {
+	config.Admins = []string{"Admin1"}
+	defer func() { config.Admins = nil }()
+
+	personal := CannedResponse{Owner: "Test123"}
+	shared := CannedResponse{Owner: "Test123", Shared: true}
+
+	tests := []struct {
+		response CannedResponse
+		user     User
+		visible  bool
+		editable bool
+	}{
+		{personal, User{Username: "Test123"}, true, true},
+		{personal, User{Username: "Other"}, false, false},
+		{personal, User{Username: "Admin1"}, false, true},
+		{shared, User{Username: "Other"}, true, false},
+		{shared, User{Username: "Admin1"}, true, true},
+	}
+	for _, d := range tests {
+		assert.Equal(t, d.visible, d.response.IsVisibleTo(d.user))
+		assert.Equal(t, d.editable, d.response.IsEditableBy(d.user))
+	}
+}
+
+func TestExpandPlaceholders(t *testing.T) {
+	ticket := Ticket{ID: 7, Client: "client@dhbw.de", Reference: "PC problem"}
+
+	text := ExpandPlaceholders("Hello {customer}, regarding {subject} ({ticketId}) - {editor} {unknown}", ticket, "Test123")
+	assert.Equal(t, "Hello client@dhbw.de, regarding PC problem (7) - Test123 {unknown}", text)
+}
@@ -0,0 +1,134 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Dimensions of the charts in pixels
+const (
+	chartWidth        = 800
+	chartHeight       = 300
+	chartMarginLeft   = 50
+	chartMarginRight  = 20
+	chartMarginTop    = 40
+	chartMarginBottom = 50
+	chartMaxLabels    = 16 // Further labels of the x axis are left out, so they don't overlap
+)
+
+// Values of a chart which are drawn in the same color
+type ChartSeries struct {
+	Name   string
+	Color  string
+	Values []int
+}
+
+// Renders the series as grouped bars, one group per label
+func BarChartSVG(title string, labels []string, series []ChartSeries) string {
+	var svg strings.Builder
+	maximum := writeChartFrame(&svg, title, labels, series)
+
+	groupWidth := plotWidth() / float64(maxInt(len(labels), 1))
+	barWidth := groupWidth * 0.8 / float64(maxInt(len(series), 1))
+	for i := range labels {
+		for j, actSeries := range series {
+			if i >= len(actSeries.Values) {
+				continue
+			}
+			height := float64(actSeries.Values[i]) / float64(maximum) * plotHeight()
+			x := chartMarginLeft + float64(i)*groupWidth + groupWidth*0.1 + float64(j)*barWidth
+			fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %d</title></rect>`,
+				x, chartMarginTop+plotHeight()-height, barWidth, height, html.EscapeString(actSeries.Color),
+				html.EscapeString(actSeries.Name+" "+labels[i]), actSeries.Values[i])
+		}
+	}
+
+	svg.WriteString("</svg>")
+	return svg.String()
+}
+
+// Renders the series as lines through one point per label
+func LineChartSVG(title string, labels []string, series []ChartSeries) string {
+	var svg strings.Builder
+	maximum := writeChartFrame(&svg, title, labels, series)
+
+	step := plotWidth() / float64(maxInt(len(labels), 1))
+	for _, actSeries := range series {
+		var points []string
+		for i, value := range actSeries.Values {
+			if i >= len(labels) {
+				break
+			}
+			x := chartMarginLeft + float64(i)*step + step/2
+			y := chartMarginTop + plotHeight() - float64(value)/float64(maximum)*plotHeight()
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		fmt.Fprintf(&svg, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`,
+			strings.Join(points, " "), html.EscapeString(actSeries.Color))
+	}
+
+	svg.WriteString("</svg>")
+	return svg.String()
+}
+
+// Writes the opening of the SVG with the title, the axes, the labels and the legend. It returns the value
+// at the top of the y axis
+func writeChartFrame(svg *strings.Builder, title string, labels []string, series []ChartSeries) int {
+	maximum := 1
+	for _, actSeries := range series {
+		for _, value := range actSeries.Values {
+			maximum = maxInt(maximum, value)
+		}
+	}
+
+	fmt.Fprintf(svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%" font-family="sans-serif" font-size="11">`,
+		chartWidth, chartHeight)
+	fmt.Fprintf(svg, `<text x="%d" y="20" font-size="14" font-weight="bold">%s</text>`, chartMarginLeft, html.EscapeString(title))
+
+	bottom := chartMarginTop + plotHeight()
+	fmt.Fprintf(svg, `<line x1="%d" y1="%d" x2="%d" y2="%.1f" stroke="#888"/>`, chartMarginLeft, chartMarginTop, chartMarginLeft, bottom)
+	fmt.Fprintf(svg, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#888"/>`, chartMarginLeft, bottom, chartWidth-chartMarginRight, bottom)
+	for _, value := range []int{0, maximum / 2, maximum} {
+		y := bottom - float64(value)/float64(maximum)*plotHeight()
+		fmt.Fprintf(svg, `<text x="%d" y="%.1f" text-anchor="end">%d</text>`, chartMarginLeft-5, y+4, value)
+		fmt.Fprintf(svg, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#eee"/>`, chartMarginLeft, y, chartWidth-chartMarginRight, y)
+	}
+
+	step := plotWidth() / float64(maxInt(len(labels), 1))
+	every := (len(labels) + chartMaxLabels - 1) / chartMaxLabels
+	for i, label := range labels {
+		if i%maxInt(every, 1) != 0 {
+			continue
+		}
+		fmt.Fprintf(svg, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`,
+			chartMarginLeft+float64(i)*step+step/2, bottom+18, html.EscapeString(label))
+	}
+
+	x := chartWidth - chartMarginRight
+	for i := len(series) - 1; i >= 0; i-- {
+		x -= 10 + 7*len(series[i].Name)
+		fmt.Fprintf(svg, `<rect x="%d" y="10" width="10" height="10" fill="%s"/><text x="%d" y="19">%s</text>`,
+			x, html.EscapeString(series[i].Color), x+14, html.EscapeString(series[i].Name))
+		x -= 20
+	}
+
+	return maximum
+}
+
+func plotWidth() float64 {
+	return chartWidth - chartMarginLeft - chartMarginRight
+}
+
+func plotHeight() float64 {
+	return chartHeight - chartMarginTop - chartMarginBottom
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
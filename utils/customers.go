@@ -0,0 +1,78 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Preferences of a customer which apply to all of their tickets
+type Customer struct {
+	Mail     string `xml:"Mail"`
+	Language string `xml:"Language"` // Language of the mails to the customer, empty for the default language
+}
+
+type CustomerList struct {
+	XMLName   xml.Name   `xml:"Customers"`
+	Customers []Customer `xml:"customers>customer"`
+}
+
+var mutexCustomers = &sync.Mutex{}
+
+// Returns the preferred language of the customer or an empty string if it is unknown
+func CustomerLanguage(mail string) string {
+	customerList, err := ReadCustomers()
+	if err != nil {
+		return ""
+	}
+
+	for _, customer := range customerList.Customers {
+		if strings.EqualFold(customer.Mail, mail) {
+			return customer.Language
+		}
+	}
+	return ""
+}
+
+// Remembers the language for the mails to the customer, also for the tickets they create by mail later on
+func SetCustomerLanguage(mail string, language string) error {
+	if !languageRegExp.MatchString(language) {
+		return nil
+	}
+
+	mutexCustomers.Lock()
+	defer mutexCustomers.Unlock()
+
+	customerList, err := ReadCustomers()
+	if err != nil {
+		return err
+	}
+
+	for i, customer := range customerList.Customers {
+		if strings.EqualFold(customer.Mail, mail) {
+			if customer.Language == language {
+				return nil
+			}
+			customerList.Customers[i].Language = language
+			return WriteToXML(customerList, config.CustomersFilePath())
+		}
+	}
+
+	customerList.Customers = append(customerList.Customers, Customer{Mail: mail, Language: language})
+	return WriteToXML(customerList, config.CustomersFilePath())
+}
+
+func ReadCustomers() (CustomerList, error) {
+	file, err := ioutil.ReadFile(config.CustomersFilePath())
+	if err != nil {
+		return CustomerList{}, err
+	}
+
+	var customerList CustomerList
+	err = xml.Unmarshal(file, &customerList)
+	return customerList, err
+}
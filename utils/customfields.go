@@ -0,0 +1,397 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of the custom fields the administrators can define
+const (
+	FieldTypeText        = "text"
+	FieldTypeNumber      = "number"
+	FieldTypeDate        = "date"
+	FieldTypeSelect      = "select"
+	FieldTypeMultiSelect = "multiselect"
+)
+
+// Layout of the values of date fields
+const FieldDateLayout = "2006-01-02"
+
+// Custom field of the tickets, e.g. the product or the order number
+type FieldDefinition struct {
+	ID       int      `xml:"ID"`
+	Name     string   `xml:"Name"`
+	Type     string   `xml:"Type"`
+	Options  []string `xml:"Options>Option"` // Allowed values of select fields
+	Required bool     `xml:"Required"`
+}
+
+type FieldDefinitionList struct {
+	FieldIDCounter int               `xml:"FieldIDCounter"`
+	Fields         []FieldDefinition `xml:"fields>field"`
+}
+
+// Values of a custom field of a ticket, only multi select fields have more than one value
+type FieldValue struct {
+	ID     int      `xml:"ID" json:"id"`
+	Values []string `xml:"Value" json:"values"`
+}
+
+// Restricts ticket listings to the tickets with a tag and a value of a custom field. Empty parts match every ticket
+type TicketFilter struct {
+	Tag   string
+	Field int
+	Value string
+}
+
+var mutexFields = &sync.Mutex{}
+
+func IsFieldType(fieldType string) bool {
+	switch fieldType {
+	case FieldTypeText, FieldTypeNumber, FieldTypeDate, FieldTypeSelect, FieldTypeMultiSelect:
+		return true
+	default:
+		return false
+	}
+}
+
+func (field FieldDefinition) IsSelect() bool {
+	return field.Type == FieldTypeSelect || field.Type == FieldTypeMultiSelect
+}
+
+func (field FieldDefinition) HasOption(option string) bool {
+	for _, o := range field.Options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the options separated by commas like they are entered in the form
+func (field FieldDefinition) OptionsText() string {
+	return strings.Join(field.Options, ", ")
+}
+
+// Checks the values for the field and returns them without empty values
+func (field FieldDefinition) ValidateValues(values []string) ([]string, error) {
+	var valid []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			valid = append(valid, value)
+		}
+	}
+
+	if len(valid) == 0 {
+		if field.Required {
+			return nil, fmt.Errorf("the field %s is required", field.Name)
+		}
+		return nil, nil
+	}
+	if len(valid) > 1 && field.Type != FieldTypeMultiSelect {
+		return nil, fmt.Errorf("the field %s only takes one value", field.Name)
+	}
+
+	for _, value := range valid {
+		var err error
+		switch field.Type {
+		case FieldTypeText:
+			if !CheckEmptyXSSString(value) {
+				err = fmt.Errorf("the field %s contains invalid characters or is too long", field.Name)
+			}
+		case FieldTypeNumber:
+			if _, parseErr := strconv.ParseFloat(value, 64); parseErr != nil {
+				err = fmt.Errorf("the field %s needs a number", field.Name)
+			}
+		case FieldTypeDate:
+			if _, parseErr := time.Parse(FieldDateLayout, value); parseErr != nil {
+				err = fmt.Errorf("the field %s needs a date like %s", field.Name, FieldDateLayout)
+			}
+		case FieldTypeSelect, FieldTypeMultiSelect:
+			if !field.HasOption(value) {
+				err = fmt.Errorf("%q is no option of the field %s", value, field.Name)
+			}
+		default:
+			err = fmt.Errorf("unknown field type %q", field.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return valid, nil
+}
+
+// Returns the values of the custom field of the ticket
+func (ticket Ticket) FieldValues(id int) []string {
+	for _, field := range ticket.Fields {
+		if field.ID == id {
+			return field.Values
+		}
+	}
+	return nil
+}
+
+// Returns the values of the custom field separated by commas
+func (ticket Ticket) FieldText(id int) string {
+	return strings.Join(ticket.FieldValues(id), ", ")
+}
+
+func (ticket Ticket) HasFieldValue(id int, value string) bool {
+	for _, v := range ticket.FieldValues(id) {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter TicketFilter) IsEmpty() bool {
+	return filter.Tag == "" && (filter.Field == 0 || filter.Value == "")
+}
+
+func (filter TicketFilter) Matches(ticket Ticket) bool {
+	if filter.Tag != "" && !ticket.HasTag(filter.Tag) {
+		return false
+	}
+	if filter.Field != 0 && filter.Value != "" && !ticket.HasFieldValue(filter.Field, filter.Value) {
+		return false
+	}
+	return true
+}
+
+// Replaces the values of the custom fields of the ticket. Every defined field is validated, the values of fields which
+// were removed by the administrators are kept, so they are not lost if the field is defined again
+func SetTicketFields(id int, values map[int][]string) error {
+	definitions, err := ReadFieldDefinitions()
+	if err != nil {
+		return err
+	}
+
+	ticket, err := ReadTicket(id)
+	if err != nil {
+		return err
+	}
+
+	var fields []FieldValue
+	for _, field := range ticket.Fields {
+		if _, err := findFieldDefinition(definitions.Fields, field.ID); err != nil {
+			fields = append(fields, field)
+		}
+	}
+	for _, definition := range definitions.Fields {
+		valid, err := definition.ValidateValues(values[definition.ID])
+		if err != nil {
+			return err
+		}
+		if len(valid) > 0 {
+			fields = append(fields, FieldValue{ID: definition.ID, Values: valid})
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].ID < fields[j].ID
+	})
+	ticket.Fields = fields
+	return StoreTicket(ticket)
+}
+
+// Returns the changes of the custom fields, they are named after the field
+func fieldChanges(before Ticket, after Ticket) []FieldChange {
+	ids := make(map[int]bool)
+	for _, field := range append(append([]FieldValue{}, before.Fields...), after.Fields...) {
+		ids[field.ID] = true
+	}
+
+	var sorted []int
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Ints(sorted)
+
+	var changes []FieldChange
+	for _, id := range sorted {
+		if before.FieldText(id) != after.FieldText(id) {
+			changes = append(changes, FieldChange{Field: "field " + FieldName(id), Before: before.FieldText(id), After: after.FieldText(id)})
+		}
+	}
+	return changes
+}
+
+// Returns the name of the custom field or its ID if it was removed
+func FieldName(id int) string {
+	definition, err := GetFieldDefinition(id)
+	if err != nil {
+		return strconv.Itoa(id)
+	}
+	return definition.Name
+}
+
+// Splits the comma separated options of a select field and removes duplicates, the order is kept
+func ParseFieldOptions(text string) []string {
+	var options []string
+	seen := make(map[string]bool)
+	for _, option := range strings.Split(text, ",") {
+		option = strings.TrimSpace(option)
+		if option != "" && !seen[option] {
+			seen[option] = true
+			options = append(options, option)
+		}
+	}
+
+	return options
+}
+
+func validateFieldDefinition(field FieldDefinition, fields []FieldDefinition) error {
+	if strings.TrimSpace(field.Name) == "" {
+		return fmt.Errorf("a field needs a name")
+	}
+	if !IsFieldType(field.Type) {
+		return fmt.Errorf("unknown field type %q", field.Type)
+	}
+	if field.IsSelect() && len(field.Options) == 0 {
+		return fmt.Errorf("the select field %s needs options", field.Name)
+	}
+	for _, option := range field.Options {
+		if !CheckEmptyXSSString(option) {
+			return fmt.Errorf("the option %q contains invalid characters", option)
+		}
+	}
+
+	for _, other := range fields {
+		if other.ID != field.ID && strings.EqualFold(other.Name, field.Name) {
+			return fmt.Errorf("the field %s already exists", field.Name)
+		}
+	}
+
+	return nil
+}
+
+// Creates a new custom field for all tickets
+func CreateFieldDefinition(field FieldDefinition) (FieldDefinition, error) {
+	mutexFields.Lock()
+	defer mutexFields.Unlock()
+
+	definitions, err := ReadFieldDefinitions()
+	if err != nil {
+		return FieldDefinition{}, err
+	}
+
+	field.ID = definitions.FieldIDCounter + 1
+	if !field.IsSelect() {
+		field.Options = nil
+	}
+	err = validateFieldDefinition(field, definitions.Fields)
+	if err != nil {
+		return FieldDefinition{}, err
+	}
+
+	definitions.FieldIDCounter++
+	definitions.Fields = append(definitions.Fields, field)
+	return field, WriteToXML(definitions, config.FieldsFilePath())
+}
+
+// Changes the custom field with the same ID. Values of the tickets which don't fit the changed field are kept until the ticket is edited
+func UpdateFieldDefinition(field FieldDefinition) (FieldDefinition, error) {
+	if !field.IsSelect() {
+		field.Options = nil
+	}
+
+	err := changeFieldDefinitions(func(fields []FieldDefinition) ([]FieldDefinition, error) {
+		i, err := findFieldDefinition(fields, field.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateFieldDefinition(field, fields)
+		if err != nil {
+			return nil, err
+		}
+
+		fields[i] = field
+		return fields, nil
+	})
+
+	return field, err
+}
+
+// Removes a custom field, the values of the tickets are kept but not shown anymore
+func DeleteFieldDefinition(id int) error {
+	return changeFieldDefinitions(func(fields []FieldDefinition) ([]FieldDefinition, error) {
+		i, err := findFieldDefinition(fields, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(fields[:i], fields[i+1:]...), nil
+	})
+}
+
+// Applies the change to the stored custom fields while holding the lock
+func changeFieldDefinitions(change func(fields []FieldDefinition) ([]FieldDefinition, error)) error {
+	mutexFields.Lock()
+	defer mutexFields.Unlock()
+
+	definitions, err := ReadFieldDefinitions()
+	if err != nil {
+		return err
+	}
+
+	definitions.Fields, err = change(definitions.Fields)
+	if err != nil {
+		return err
+	}
+
+	return WriteToXML(definitions, config.FieldsFilePath())
+}
+
+func findFieldDefinition(fields []FieldDefinition, id int) (int, error) {
+	for i, field := range fields {
+		if field.ID == id {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("couldn't find the field")
+}
+
+// Returns the custom field with the specified ID
+func GetFieldDefinition(id int) (FieldDefinition, error) {
+	definitions, err := ReadFieldDefinitions()
+	if err != nil {
+		return FieldDefinition{}, err
+	}
+
+	i, err := findFieldDefinition(definitions.Fields, id)
+	if err != nil {
+		return FieldDefinition{}, err
+	}
+
+	return definitions.Fields[i], nil
+}
+
+// Returns all custom fields
+func ReadFieldDefinitions() (FieldDefinitionList, error) {
+	file, err := ioutil.ReadFile(config.FieldsFilePath())
+	if err != nil {
+		return FieldDefinitionList{}, err
+	}
+
+	var definitions FieldDefinitionList
+	err = xml.Unmarshal(file, &definitions)
+	if err != nil {
+		return FieldDefinitionList{}, err
+	}
+
+	return definitions, nil
+}
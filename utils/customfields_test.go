@@ -0,0 +1,158 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFieldDefinitionStorage(t *testing.T) {
+	setup()
+	defer teardown()
+
+	field, err := CreateFieldDefinition(FieldDefinition{Name: "Product", Type: FieldTypeSelect, Options: []string{"Laptop", "Printer"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, field.ID)
+
+	_, err = CreateFieldDefinition(FieldDefinition{Name: "product", Type: FieldTypeText})
+	assert.NotNil(t, err)
+	_, err = CreateFieldDefinition(FieldDefinition{Name: "Category", Type: FieldTypeMultiSelect})
+	assert.NotNil(t, err)
+	_, err = CreateFieldDefinition(FieldDefinition{Name: "Category", Type: "color"})
+	assert.NotNil(t, err)
+	_, err = CreateFieldDefinition(FieldDefinition{Name: "", Type: FieldTypeText})
+	assert.NotNil(t, err)
+
+	// Only select fields keep their options
+	order, err := CreateFieldDefinition(FieldDefinition{Name: "Order number", Type: FieldTypeText, Options: []string{"a"}})
+	assert.Nil(t, err)
+	assert.Nil(t, order.Options)
+
+	field.Options = ParseFieldOptions("Laptop, Printer, Phone, Laptop")
+	_, err = UpdateFieldDefinition(field)
+	assert.Nil(t, err)
+	field, err = GetFieldDefinition(field.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Laptop, Printer, Phone", field.OptionsText())
+	_, err = UpdateFieldDefinition(FieldDefinition{ID: 99, Name: "Unknown", Type: FieldTypeText})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, DeleteFieldDefinition(order.ID))
+	assert.NotNil(t, DeleteFieldDefinition(order.ID))
+	definitions, err := ReadFieldDefinitions()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(definitions.Fields))
+}
+
+func TestValidateFieldValues(t *testing.T) {
+	tests := []struct {
+		field  FieldDefinition
+		values []string
+		valid  []string
+		ok     bool
+	}{
+		{FieldDefinition{Type: FieldTypeText}, []string{" A-123 "}, []string{"A-123"}, true},
+		{FieldDefinition{Type: FieldTypeText}, []string{"<script>"}, nil, false},
+		{FieldDefinition{Type: FieldTypeText}, []string{""}, nil, true},
+		{FieldDefinition{Type: FieldTypeText, Required: true}, []string{""}, nil, false},
+		{FieldDefinition{Type: FieldTypeNumber}, []string{"12.5"}, []string{"12.5"}, true},
+		{FieldDefinition{Type: FieldTypeNumber}, []string{"twelve"}, nil, false},
+		{FieldDefinition{Type: FieldTypeDate}, []string{"2020-05-01"}, []string{"2020-05-01"}, true},
+		{FieldDefinition{Type: FieldTypeDate}, []string{"01.05.2020"}, nil, false},
+		{FieldDefinition{Type: FieldTypeSelect, Options: []string{"A", "B"}}, []string{"B"}, []string{"B"}, true},
+		{FieldDefinition{Type: FieldTypeSelect, Options: []string{"A", "B"}}, []string{"A", "B"}, nil, false},
+		{FieldDefinition{Type: FieldTypeSelect, Options: []string{"A", "B"}}, []string{"C"}, nil, false},
+		{FieldDefinition{Type: FieldTypeMultiSelect, Options: []string{"A", "B"}}, []string{"A", "B"}, []string{"A", "B"}, true},
+		{FieldDefinition{Type: FieldTypeMultiSelect, Options: []string{"A", "B"}}, []string{"A", "C"}, nil, false},
+	}
+	for _, d := range tests {
+		valid, err := d.field.ValidateValues(d.values)
+		assert.Equal(t, d.ok, err == nil, d.values)
+		assert.Equal(t, d.valid, valid)
+	}
+}
+
+func TestSetTicketFields(t *testing.T) {
+	setup()
+	defer teardown()
+
+	product, err := CreateFieldDefinition(FieldDefinition{Name: "Product", Type: FieldTypeMultiSelect, Options: []string{"Laptop", "Printer"}})
+	assert.Nil(t, err)
+	order, err := CreateFieldDefinition(FieldDefinition{Name: "Order number", Type: FieldTypeNumber, Required: true})
+	assert.Nil(t, err)
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+
+	// Invalid values change nothing
+	assert.NotNil(t, SetTicketFields(ticket.ID, map[int][]string{product.ID: {"Laptop"}}))
+	assert.NotNil(t, SetTicketFields(ticket.ID, map[int][]string{order.ID: {"abc"}}))
+
+	before, err := ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, SetTicketFields(ticket.ID, map[int][]string{product.ID: {"Laptop", "Printer"}, order.ID: {"4711"}}))
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Laptop, Printer", ticket.FieldText(product.ID))
+	assert.True(t, ticket.HasFieldValue(product.ID, "printer"))
+	assert.Equal(t, []FieldChange{{Field: "field Product", Before: "", After: "Laptop, Printer"}, {Field: "field Order number", Before: "", After: "4711"}},
+		TicketChanges(before, ticket))
+
+	// The values of removed fields are kept
+	assert.Nil(t, DeleteFieldDefinition(product.ID))
+	assert.Nil(t, SetTicketFields(ticket.ID, map[int][]string{order.ID: {"4712"}}))
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []FieldValue{{ID: product.ID, Values: []string{"Laptop", "Printer"}}, {ID: order.ID, Values: []string{"4712"}}}, ticket.Fields)
+}
+
+func TestReadTicketWithoutFields(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Tickets stored before the tags and custom fields were introduced
+	old := `<Ticket><ID>1</ID><ClientAddress>client@dhbw.de</ClientAddress><Subject>Old</Subject><Status>0</Status><Editor></Editor>` +
+		`<MessageList><Message><Actor>client@dhbw.de</Actor><Text>Help</Text></Message></MessageList></Ticket>`
+	assert.Nil(t, ioutil.WriteFile(config.TicketXMLPath(1), []byte(old), 0644))
+
+	ticket, err := ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Nil(t, ticket.Tags)
+	assert.Nil(t, ticket.Fields)
+	assert.Equal(t, "", ticket.FieldText(1))
+}
+
+func TestTicketFilter(t *testing.T) {
+	ticket := Ticket{Tags: []string{"billing"}, Fields: []FieldValue{{ID: 1, Values: []string{"Laptop"}}}}
+
+	assert.True(t, TicketFilter{}.IsEmpty())
+	assert.True(t, TicketFilter{}.Matches(ticket))
+	assert.True(t, TicketFilter{Tag: "Billing"}.Matches(ticket))
+	assert.False(t, TicketFilter{Tag: "network"}.Matches(ticket))
+	assert.True(t, TicketFilter{Field: 1, Value: "laptop"}.Matches(ticket))
+	assert.False(t, TicketFilter{Field: 1, Value: "Printer"}.Matches(ticket))
+	assert.False(t, TicketFilter{Tag: "billing", Field: 2, Value: "Laptop"}.Matches(ticket))
+}
+
+func TestMacroActionTag(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := ParseMacroActions("tag")
+	assert.NotNil(t, err)
+	actions, err := ParseMacroActions("tag Billing, refund")
+	assert.Nil(t, err)
+
+	ticket, err := CreateTicket("client@dhbw.de", "Invoice", "Wrong amount")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeTags(ticket.ID, []string{"urgent"}))
+	_, err = RunMacro(Macro{Name: "Billing", Actions: actions}, ticket.ID, User{Username: "Anna"}, SourceWeb)
+	assert.Nil(t, err)
+
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"billing", "refund", "urgent"}, ticket.Tags)
+}
@@ -20,6 +20,9 @@ const (
 	ErrorURLParsing
 	ErrorDataStoring
 	ErrorAssigneeInHoliday
+	ErrorInvalidPortalLink
+	ErrorMacroExecution
+	ErrorTicketBlocked
 )
 
 // This is inspired by http://golang-basic.blogspot.com/2014/07/enumeration-example-golang.html
@@ -38,6 +41,9 @@ var errors = []string{
 	"We had issues parsing your URL. Please try it again!",
 	"We had issues storing your changes. Please try it again!",
 	"You cannot assign a ticket to an editor who is in the holidays!",
+	"Your access link is invalid or has expired. Please request a new one!",
+	"The macro could not be run on this ticket. None of its actions were applied!",
+	"The ticket cannot be closed while it is blocked by tickets which are not closed yet!",
 }
 
 // Returns the error message for a particular error
@@ -0,0 +1,115 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventTicketCreated   EventType = "ticket.created"
+	EventTicketCommented EventType = "ticket.commented"
+	EventTicketAssigned  EventType = "ticket.assigned"
+	EventTicketReleased  EventType = "ticket.released"
+	EventTicketClosed    EventType = "ticket.closed"
+	EventTicketReopened  EventType = "ticket.reopened"
+	EventTicketMerged    EventType = "ticket.merged"
+	EventTicketUnmerged  EventType = "ticket.unmerged" // A merge was undone
+	EventTicketSplit     EventType = "ticket.split"    // Messages were moved into a new ticket
+	EventTicketMoved     EventType = "ticket.moved"    // The ticket was moved into another queue
+	EventTicketUpdated   EventType = "ticket.updated"  // Other changes of the ticket, e.g. its priority
+)
+
+// Sources describe through which channel an action was triggered
+const (
+	SourceWeb    = "web"
+	SourceAPI    = "api" // Actions of external services through the REST API, mails posted by the mail service count as mail
+	SourceMail   = "mail"
+	SourceSystem = "system" // Actions the ticket system performed on its own, e.g. by automation rules
+)
+
+type Event struct {
+	Type      EventType         `json:"event"`
+	TicketID  int               `json:"ticketId"`
+	Actor     string            `json:"actor"`
+	Source    string            `json:"source"`
+	Timestamp time.Time         `json:"timestamp"`
+	Ticket    Ticket            `json:"ticket"`
+	Changes   []FieldChange     `json:"changes,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+type FieldChange struct {
+	Field  string `xml:"Field" json:"field"`
+	Before string `xml:"Before" json:"before"`
+	After  string `xml:"After" json:"after"`
+}
+
+type EventHandler func(Event)
+
+var eventHandlers []EventHandler
+
+var mutexEventHandlers = &sync.RWMutex{}
+
+// Registers a handler which gets called for every published event
+func SubscribeEvents(handler EventHandler) {
+	mutexEventHandlers.Lock()
+	defer mutexEventHandlers.Unlock()
+
+	eventHandlers = append(eventHandlers, handler)
+}
+
+// Informs all subscribers about an action which was performed on a ticket
+func PublishEvent(event Event) {
+	if event.TicketID == 0 {
+		event.TicketID = event.Ticket.ID
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	mutexEventHandlers.RLock()
+	handlers := make([]EventHandler, len(eventHandlers))
+	copy(handlers, eventHandlers)
+	mutexEventHandlers.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Returns the fields which differ between two states of the same ticket
+func TicketChanges(before Ticket, after Ticket) []FieldChange {
+	var changes []FieldChange
+	if before.Reference != after.Reference {
+		changes = append(changes, FieldChange{Field: "subject", Before: before.Reference, After: after.Reference})
+	}
+	if before.Status != after.Status {
+		changes = append(changes, FieldChange{Field: "status", Before: TicketStatusName(before.Status), After: TicketStatusName(after.Status)})
+	}
+	if before.Editor != after.Editor {
+		changes = append(changes, FieldChange{Field: "editor", Before: before.Editor, After: after.Editor})
+	}
+	if before.Priority != after.Priority {
+		changes = append(changes, FieldChange{Field: "priority", Before: TicketPriorityName(before.Priority), After: TicketPriorityName(after.Priority)})
+	}
+	if before.Queue != after.Queue {
+		changes = append(changes, FieldChange{Field: "queue", Before: before.QueueName(), After: after.QueueName()})
+	}
+	if before.TagsText() != after.TagsText() {
+		changes = append(changes, FieldChange{Field: "tags", Before: before.TagsText(), After: after.TagsText()})
+	}
+	changes = append(changes, fieldChanges(before, after)...)
+	if before.RelationsText() != after.RelationsText() {
+		changes = append(changes, FieldChange{Field: "relations", Before: before.RelationsText(), After: after.RelationsText()})
+	}
+	if len(before.MessageList) != len(after.MessageList) {
+		changes = append(changes, FieldChange{Field: "messages", Before: strconv.Itoa(len(before.MessageList)), After: strconv.Itoa(len(after.MessageList))})
+	}
+
+	return changes
+}
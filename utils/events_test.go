@@ -0,0 +1,62 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPublishEvent(t *testing.T) {
+	var received []Event
+	SubscribeEvents(func(event Event) {
+		received = append(received, event)
+	})
+
+	PublishEvent(Event{Type: EventTicketClosed, Ticket: Ticket{ID: 42}, Actor: "Test123", Source: SourceWeb})
+
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, EventTicketClosed, received[0].Type)
+	assert.Equal(t, 42, received[0].TicketID)
+	assert.Equal(t, "Test123", received[0].Actor)
+	assert.Equal(t, SourceWeb, received[0].Source)
+	assert.False(t, received[0].Timestamp.IsZero())
+}
+
+func TestCreateTicketFromMailPublishesEvents(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var received []EventType
+	SubscribeEvents(func(event Event) {
+		if event.Source == SourceMail && event.Actor == "events@mail" {
+			received = append(received, event.Type)
+		}
+	})
+
+	ticket, err := CreateTicketFromMail("events@mail", "testCaption", "testMsgOne")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeStatus(ticket.ID, TicketStatusClosed))
+	_, err = CreateTicketFromMail("events@mail", "testCaption", "testMsgTwo")
+	assert.Nil(t, err)
+
+	assert.Equal(t, []EventType{EventTicketCreated, EventTicketCommented, EventTicketReopened}, received)
+}
+
+func TestTicketChanges(t *testing.T) {
+	before := Ticket{ID: 1, Reference: "PC problem", Status: TicketStatusOpen, MessageList: []Message{{Text: "Help"}}}
+
+	assert.Equal(t, 0, len(TicketChanges(before, before)))
+
+	after := before
+	after.Status = TicketStatusClosed
+	after.Editor = "Test123"
+	after.Priority = TicketPriorityHigh
+	after.MessageList = append(after.MessageList, Message{Text: "Solved"})
+	assert.Equal(t, []FieldChange{
+		{Field: "status", Before: "open", After: "closed"},
+		{Field: "editor", Before: "", After: "Test123"},
+		{Field: "priority", Before: "normal", After: "high"},
+		{Field: "messages", Before: "1", After: "2"},
+	}, TicketChanges(before, after))
+}
@@ -0,0 +1,475 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of the exports and imports
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatJSON = "json"
+)
+
+// Columns of the ticket CSV, every row contains one message together with the data of its ticket
+var ticketCSVColumns = []string{"ticket_id", "subject", "client", "status", "editor", "priority", "queue", "tags",
+	"message_date", "message_author", "message_type", "message_text"}
+
+var userCSVColumns = []string{"username", "email", "admin", "holiday_mode", "capacity", "skills"}
+
+// Cells starting with one of these characters are evaluated as formulas by spreadsheet programs
+const csvFormulaPrefixes = "=+-@"
+
+// Formats of the message dates which are accepted by the import besides RFC 3339
+var importDateLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// Ticket in the format of the exports. Status, priority and queue are exported with their names, so the export can be
+// read by other help desks and imported again
+type ExportedTicket struct {
+	ID       int               `json:"id"`
+	Subject  string            `json:"subject"`
+	Client   string            `json:"client"`
+	Status   string            `json:"status"`
+	Editor   string            `json:"editor"`
+	Priority string            `json:"priority"`
+	Queue    string            `json:"queue"`
+	Tags     []string          `json:"tags"`
+	Messages []ExportedMessage `json:"messages"`
+}
+
+type ExportedMessage struct {
+	Date   time.Time `json:"date"`
+	Author string    `json:"author"`
+	Type   string    `json:"type"`
+	Text   string    `json:"text"`
+}
+
+// User without the password hash and the session
+type ExportedUser struct {
+	Username    string   `json:"username"`
+	Email       string   `json:"email"`
+	Admin       bool     `json:"admin"`
+	HolidayMode bool     `json:"holidayMode"`
+	Capacity    int      `json:"capacity"`
+	Skills      []string `json:"skills"`
+}
+
+// Restricts the exported tickets, the zero value of the dates doesn't restrict the creation date
+type TicketExportFilter struct {
+	Status int // -1 exports every status
+	Queue  int // -1 exports every queue
+	Filter TicketFilter
+	From   time.Time
+	To     time.Time
+}
+
+// Ticket of another help desk. The ID is kept as text, because other help desks don't need to use numbers
+type ImportedTicket struct {
+	ExternalID string
+	Subject    string
+	Client     string
+	Status     string
+	Editor     string
+	Priority   string
+	Queue      string
+	Tags       []string
+	Messages   []ExportedMessage
+}
+
+// Ticket which was created for an imported ticket. Tickets which were imported before are not imported again
+type ImportMapping struct {
+	ExternalID string
+	TicketID   int
+	Existing   bool
+	Notes      []string // Data of the imported ticket which couldn't be taken over
+}
+
+type importedTicketJSON struct {
+	ID json.RawMessage `json:"id"`
+	ExportedTicket
+}
+
+func IsExportFormat(format string) bool {
+	return format == ExportFormatCSV || format == ExportFormatJSON
+}
+
+func (filter TicketExportFilter) Matches(ticket Ticket) bool {
+	if filter.Status != -1 && ticket.Status != filter.Status {
+		return false
+	}
+	if filter.Queue != -1 && ticket.Queue != filter.Queue {
+		return false
+	}
+	if !filter.Filter.Matches(ticket) {
+		return false
+	}
+	if len(ticket.MessageList) > 0 {
+		created := ticket.MessageList[0].CreationDate
+		if (!filter.From.IsZero() && created.Before(filter.From)) || (!filter.To.IsZero() && !created.Before(filter.To)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the tickets which match the filter ordered by their ID, tickets which were merged into another one are left out
+func ExportTickets(filter TicketExportFilter) []ExportedTicket {
+	var tickets []ExportedTicket
+	for _, id := range storedTicketIDs() {
+		ticket, err := ReadTicket(id)
+		if err != nil || ticket.IsMerged() || !filter.Matches(ticket) {
+			continue
+		}
+
+		exported := ExportedTicket{ID: ticket.ID, Subject: ticket.Reference, Client: ticket.Client, Status: ticket.StatusName(),
+			Editor: ticket.Editor, Priority: ticket.PriorityName(), Queue: ticket.QueueName(), Tags: ticket.Tags}
+		for _, message := range ticket.MessageList {
+			exported.Messages = append(exported.Messages, ExportedMessage{Date: message.CreationDate, Author: message.Actor,
+				Type: string(message.Type), Text: message.Text})
+		}
+		tickets = append(tickets, exported)
+	}
+	return tickets
+}
+
+// Returns all users ordered by their name
+func ExportUsers() ([]ExportedUser, error) {
+	userMap, err := ReadUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []ExportedUser
+	for _, user := range userMap {
+		users = append(users, ExportedUser{Username: user.Username, Email: user.Email, Admin: user.IsAdmin(),
+			HolidayMode: user.HolidayMode, Capacity: user.Capacity, Skills: user.Skills})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+// Writes the tickets in the format, the CSV contains one row per message
+func WriteTickets(w io.Writer, tickets []ExportedTicket, format string) error {
+	if format == ExportFormatJSON {
+		return writeJSON(w, tickets)
+	}
+	if format != ExportFormatCSV {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	records := [][]string{ticketCSVColumns}
+	for _, ticket := range tickets {
+		for _, message := range ticket.Messages {
+			records = append(records, []string{strconv.Itoa(ticket.ID), ticket.Subject, ticket.Client, ticket.Status, ticket.Editor,
+				ticket.Priority, ticket.Queue, strings.Join(ticket.Tags, ", "), message.Date.Format(time.RFC3339),
+				message.Author, message.Type, message.Text})
+		}
+	}
+	return writeCSV(w, records)
+}
+
+func WriteUsers(w io.Writer, users []ExportedUser, format string) error {
+	if format == ExportFormatJSON {
+		return writeJSON(w, users)
+	}
+	if format != ExportFormatCSV {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	records := [][]string{userCSVColumns}
+	for _, user := range users {
+		records = append(records, []string{user.Username, user.Email, strconv.FormatBool(user.Admin), strconv.FormatBool(user.HolidayMode),
+			strconv.Itoa(user.Capacity), strings.Join(user.Skills, ", ")})
+	}
+	return writeCSV(w, records)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// Writes the records, cells which spreadsheet programs would evaluate as formulas are prefixed with an apostrophe,
+// so texts of customers can't run formulas when an editor opens the export
+func writeCSV(w io.Writer, records [][]string) error {
+	for _, record := range records {
+		for i, cell := range record {
+			if cell != "" && strings.ContainsRune(csvFormulaPrefixes, rune(cell[0])) {
+				record[i] = "'" + cell
+			}
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	err := writer.WriteAll(records)
+	if err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// Reads the tickets of an export in the format
+func ParseImport(r io.Reader, format string) ([]ImportedTicket, error) {
+	switch format {
+	case ExportFormatCSV:
+		return ParseTicketsCSV(r)
+	case ExportFormatJSON:
+		return ParseTicketsJSON(r)
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+}
+
+// Reads tickets from a CSV with one message per row. The columns are identified by the header like in the export,
+// ticket_id, subject, client, message_date and message_text are required. The rows of a ticket are grouped by its ID,
+// the data of the ticket is taken from its first row
+func ParseTicketsCSV(r io.Reader) ([]ImportedTicket, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("the CSV has no header")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"ticket_id", "subject", "client", "message_date", "message_text"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the CSV has no column %s", name)
+		}
+	}
+	value := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		// Formulas which were escaped by the export are read as they were written
+		cell := strings.TrimSpace(record[i])
+		if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(cell[1])) {
+			return cell[1:]
+		}
+		return cell
+	}
+
+	var tickets []ImportedTicket
+	indexes := make(map[string]int)
+	for line, record := range records[1:] {
+		date, err := parseImportDate(value(record, "message_date"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", line+2, err)
+		}
+		message := ExportedMessage{Date: date, Author: value(record, "message_author"), Type: value(record, "message_type"),
+			Text: value(record, "message_text")}
+
+		id := value(record, "ticket_id")
+		i, ok := indexes[id]
+		if !ok {
+			i = len(tickets)
+			indexes[id] = i
+			tickets = append(tickets, ImportedTicket{ExternalID: id, Subject: value(record, "subject"), Client: value(record, "client"),
+				Status: value(record, "status"), Editor: value(record, "editor"), Priority: value(record, "priority"),
+				Queue: value(record, "queue"), Tags: ParseTags(value(record, "tags"))})
+		}
+		tickets[i].Messages = append(tickets[i].Messages, message)
+	}
+	return tickets, nil
+}
+
+// Reads tickets from a JSON array in the format of the export. The IDs may be numbers or texts
+func ParseTicketsJSON(r io.Reader) ([]ImportedTicket, error) {
+	var decoded []importedTicketJSON
+	err := json.NewDecoder(r).Decode(&decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var tickets []ImportedTicket
+	for _, ticket := range decoded {
+		// Numbers are kept as they were written, large IDs would lose digits as float
+		var id string
+		var number json.Number
+		if json.Unmarshal(ticket.ID, &number) == nil {
+			id = number.String()
+		} else if json.Unmarshal(ticket.ID, &id) != nil {
+			return nil, fmt.Errorf("invalid ticket ID %s", string(ticket.ID))
+		}
+		tickets = append(tickets, ImportedTicket{ExternalID: strings.TrimSpace(id), Subject: ticket.Subject, Client: ticket.Client,
+			Status: ticket.Status, Editor: ticket.Editor, Priority: ticket.Priority, Queue: ticket.Queue, Tags: ParseTags(strings.Join(ticket.Tags, ",")),
+			Messages: ticket.Messages})
+	}
+	return tickets, nil
+}
+
+func parseImportDate(text string) (time.Time, error) {
+	date, err := time.Parse(time.RFC3339, text)
+	if err == nil {
+		return date, nil
+	}
+	for _, layout := range importDateLayouts {
+		date, err = time.ParseInLocation(layout, text, time.Local)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid message date %q", text)
+}
+
+// Creates a ticket for every imported ticket with the original messages, their dates and authors. The source names the
+// help desk the tickets come from, because the IDs are only unique within it. All tickets are validated before the first
+// one is created. Tickets which were imported from the same source before are skipped, editors who don't exist leave the
+// ticket unassigned and unknown queues leave it without a queue. Neither events are published nor mails are sent,
+// because the tickets were already handled in the other help desk
+func ImportTickets(tickets []ImportedTicket, source string, actor string) ([]ImportMapping, error) {
+	source = strings.TrimSpace(source)
+	if source == "" || !CheckEmptyXSSString(source) {
+		return nil, fmt.Errorf("the import needs the name of the help desk the tickets come from")
+	}
+	if len(tickets) == 0 {
+		return nil, fmt.Errorf("the import contains no tickets")
+	}
+
+	seen := make(map[string]bool)
+	for _, ticket := range tickets {
+		if ticket.ExternalID == "" {
+			return nil, fmt.Errorf("every imported ticket needs an ID")
+		}
+		if seen[ticket.ExternalID] {
+			return nil, fmt.Errorf("the ticket %s is contained twice", ticket.ExternalID)
+		}
+		seen[ticket.ExternalID] = true
+
+		_, err := newImportedTicket(ticket)
+		if err != nil {
+			return nil, fmt.Errorf("ticket %s: %v", ticket.ExternalID, err)
+		}
+	}
+
+	users, err := ReadUsers()
+	if err != nil {
+		return nil, err
+	}
+	imported := make(map[string]int)
+	for _, id := range storedTicketIDs() {
+		ticket, err := ReadTicket(id)
+		if err == nil && ticket.ImportedFrom != "" && strings.EqualFold(ticket.ImportSource, source) {
+			imported[ticket.ImportedFrom] = ticket.ID
+		}
+	}
+
+	var mappings []ImportMapping
+	for _, importedTicket := range tickets {
+		if id, ok := imported[importedTicket.ExternalID]; ok {
+			mappings = append(mappings, ImportMapping{ExternalID: importedTicket.ExternalID, TicketID: id, Existing: true})
+			continue
+		}
+
+		mapping := ImportMapping{ExternalID: importedTicket.ExternalID}
+		ticket, _ := newImportedTicket(importedTicket)
+		ticket.ImportSource = source
+		if _, ok := users[ticket.Editor]; ticket.Editor != "" && !ok {
+			mapping.Notes = append(mapping.Notes, fmt.Sprintf("editor %s doesn't exist", ticket.Editor))
+			ticket.Editor = ""
+			if ticket.Status == TicketStatusInProcess {
+				ticket.Status = TicketStatusOpen
+			}
+		}
+		if importedTicket.Queue != "" {
+			queue, err := GetQueueByName(importedTicket.Queue)
+			if err != nil {
+				mapping.Notes = append(mapping.Notes, fmt.Sprintf("queue %s doesn't exist", importedTicket.Queue))
+			} else {
+				ticket.Queue = queue.ID
+			}
+		}
+
+		created, err := CreateTicket(ticket.Client, ticket.Reference, ticket.MessageList[0].Text)
+		if err != nil {
+			return mappings, err
+		}
+		ticket.ID = created.ID
+		ticket, err = AddSystemMessage(ticket, fmt.Sprintf("Imported by %s from ticket %s of %s", actor, importedTicket.ExternalID, source))
+		if err != nil {
+			return mappings, err
+		}
+
+		mapping.TicketID = ticket.ID
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// Validates the imported ticket and converts it without an ID, editor and queue are not checked
+func newImportedTicket(imported ImportedTicket) (Ticket, error) {
+	if !CheckMailFormal(imported.Client) {
+		return Ticket{}, fmt.Errorf("invalid client %q", imported.Client)
+	}
+	if !CheckEmptyXSSString(imported.Subject) {
+		return Ticket{}, fmt.Errorf("invalid subject %q", imported.Subject)
+	}
+	if len(imported.Messages) == 0 {
+		return Ticket{}, fmt.Errorf("the ticket has no messages")
+	}
+
+	ticket := Ticket{Client: imported.Client, Reference: imported.Subject, Editor: imported.Editor, Tags: imported.Tags,
+		ImportedFrom: imported.ExternalID}
+	ok := true
+	if imported.Status != "" {
+		ticket.Status, ok = ParseTicketStatus(strings.ToLower(imported.Status))
+	}
+	if !ok {
+		return Ticket{}, fmt.Errorf("invalid status %q", imported.Status)
+	}
+	if imported.Priority != "" {
+		ticket.Priority, ok = ParseTicketPriority(strings.ToLower(imported.Priority))
+	}
+	if !ok {
+		return Ticket{}, fmt.Errorf("invalid priority %q", imported.Priority)
+	}
+	for _, tag := range ticket.Tags {
+		if !CheckEmptyXSSString(tag) {
+			return Ticket{}, fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+
+	for _, importedMessage := range imported.Messages {
+		// The texts are escaped when they are shown, like the texts of mails
+		if strings.TrimSpace(importedMessage.Text) == "" {
+			return Ticket{}, fmt.Errorf("the ticket has an empty message")
+		}
+		if importedMessage.Date.IsZero() {
+			return Ticket{}, fmt.Errorf("the ticket has a message without a date")
+		}
+
+		message := Message{CreationDate: importedMessage.Date, Actor: importedMessage.Author, Text: importedMessage.Text}
+		if message.Actor == "" {
+			message.Actor = ticket.Client
+		}
+		switch MessageType(strings.ToLower(importedMessage.Type)) {
+		case "":
+			message.Type = inferMessageType(ticket, message.Actor)
+		case MessageTypeCustomer, MessageTypeReply, MessageTypeNote, MessageTypeSystem:
+			message.Type = MessageType(strings.ToLower(importedMessage.Type))
+		default:
+			return Ticket{}, fmt.Errorf("invalid message type %q", importedMessage.Type)
+		}
+		ticket.MessageList = append(ticket.MessageList, message)
+	}
+	sort.SliceStable(ticket.MessageList, func(i, j int) bool {
+		return ticket.MessageList[i].CreationDate.Before(ticket.MessageList[j].CreationDate)
+	})
+	return ticket, nil
+}
@@ -0,0 +1,192 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	day := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	ids := createTickets(t, "Outage", "Printer, broken", "No internet")
+	storeTicketHistory(t, ids[0], "Anna", TicketStatusInProcess,
+		Message{CreationDate: day, Actor: "client@dhbw.de", Text: "Help", Type: MessageTypeCustomer},
+		Message{CreationDate: day.Add(time.Hour), Actor: "Anna", Text: "Restart it", Type: MessageTypeReply})
+	assert.Nil(t, ChangeTags(ids[1], []string{"hardware", "printer"}))
+	assert.Nil(t, MergeTickets(ids[1], ids[2], "Anna"))
+
+	// The merged ticket is left out
+	tickets := ExportTickets(TicketExportFilter{Status: -1, Queue: -1})
+	assert.Equal(t, 2, len(tickets))
+	assert.Equal(t, "in process", tickets[0].Status)
+	assert.Equal(t, "normal", tickets[0].Priority)
+	assert.Equal(t, ExportedMessage{Date: day.Add(time.Hour), Author: "Anna", Type: "reply", Text: "Restart it"}, tickets[0].Messages[1])
+
+	assert.Equal(t, 1, len(ExportTickets(TicketExportFilter{Status: TicketStatusInProcess, Queue: -1})))
+	assert.Equal(t, 0, len(ExportTickets(TicketExportFilter{Status: -1, Queue: 3})))
+	assert.Equal(t, ids[1], ExportTickets(TicketExportFilter{Status: -1, Queue: -1, Filter: TicketFilter{Tag: "printer"}})[0].ID)
+	assert.Equal(t, ids[0], ExportTickets(TicketExportFilter{Status: -1, Queue: -1, To: day.AddDate(0, 0, 1)})[0].ID)
+	assert.Equal(t, ids[1], ExportTickets(TicketExportFilter{Status: -1, Queue: -1, From: day.AddDate(0, 0, 1)})[0].ID)
+
+	var buffer bytes.Buffer
+	assert.Nil(t, WriteTickets(&buffer, tickets[:1], ExportFormatCSV))
+	assert.Equal(t, strings.Join(ticketCSVColumns, ",")+"\n"+
+		"1,Outage,client@dhbw.de,in process,Anna,normal,,,2021-03-01T09:00:00Z,client@dhbw.de,customer,Help\n"+
+		"1,Outage,client@dhbw.de,in process,Anna,normal,,,2021-03-01T10:00:00Z,Anna,reply,Restart it\n", buffer.String())
+
+	buffer.Reset()
+	assert.Nil(t, WriteTickets(&buffer, tickets, ExportFormatJSON))
+	assert.Contains(t, buffer.String(), "\"subject\": \"Printer, broken\"")
+	assert.NotNil(t, WriteTickets(&buffer, tickets, "xml"))
+}
+
+func TestExportTicketsEscapesFormulas(t *testing.T) {
+	day := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	tickets := []ExportedTicket{{ID: 1, Subject: "=HYPERLINK(\"http://evil.com\")", Client: "client@dhbw.de", Status: "open",
+		Messages: []ExportedMessage{{Date: day, Author: "client@dhbw.de", Type: "customer", Text: "@SUM(A1:A9)"}}}}
+
+	var buffer bytes.Buffer
+	assert.Nil(t, WriteTickets(&buffer, tickets, ExportFormatCSV))
+	assert.Contains(t, buffer.String(), "\"'=HYPERLINK(\"\"http://evil.com\"\")\"")
+	assert.Contains(t, buffer.String(), ",'@SUM(A1:A9)\n")
+
+	// The import reads the cells as they were before the export
+	imported, err := ParseImport(&buffer, ExportFormatCSV)
+	assert.Nil(t, err)
+	assert.Equal(t, tickets[0].Subject, imported[0].Subject)
+	assert.Equal(t, "@SUM(A1:A9)", imported[0].Messages[0].Text)
+}
+
+func TestExportUsers(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Bert"}
+	defer func() { config.Admins = nil }()
+	createEditors(t, "Bert", "Anna")
+	assert.Nil(t, SetUserSkills("Anna", []string{"network", "printer"}))
+
+	users, err := ExportUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, []ExportedUser{{Username: "Anna", Skills: []string{"network", "printer"}}, {Username: "Bert", Admin: true}}, users)
+
+	var buffer bytes.Buffer
+	assert.Nil(t, WriteUsers(&buffer, users, ExportFormatCSV))
+	assert.Equal(t, "username,email,admin,holiday_mode,capacity,skills\nAnna,,false,false,0,\"network, printer\"\nBert,,true,false,0,\n", buffer.String())
+
+	// Neither the password hashes nor the sessions are exported
+	buffer.Reset()
+	assert.Nil(t, WriteUsers(&buffer, users, ExportFormatJSON))
+	assert.NotContains(t, strings.ToLower(buffer.String()), "password")
+	assert.NotContains(t, strings.ToLower(buffer.String()), "session")
+}
+
+func TestParseImport(t *testing.T) {
+	csvImport := "Ticket_ID,subject,client,status,message_date,message_author,message_text\n" +
+		"A-7,Outage,client@dhbw.de,closed,2021-03-01 09:00:00,,Help\n" +
+		"A-8,Printer,other@dhbw.de,,2021-03-02T10:00:00Z,,Paper jam\n" +
+		"A-7,ignored,ignored,open,2021-03-01 11:00:00,Anna,Restart it\n"
+	tickets, err := ParseImport(strings.NewReader(csvImport), ExportFormatCSV)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tickets))
+	assert.Equal(t, "A-7", tickets[0].ExternalID)
+	assert.Equal(t, "closed", tickets[0].Status)
+	assert.Equal(t, []ExportedMessage{
+		{Date: time.Date(2021, 3, 1, 9, 0, 0, 0, time.Local), Text: "Help"},
+		{Date: time.Date(2021, 3, 1, 11, 0, 0, 0, time.Local), Author: "Anna", Text: "Restart it"}}, tickets[0].Messages)
+
+	_, err = ParseImport(strings.NewReader("ticket_id,subject,client\nA-7,Outage,client@dhbw.de\n"), ExportFormatCSV)
+	assert.NotNil(t, err)
+	_, err = ParseImport(strings.NewReader(strings.Replace(csvImport, "2021-03-01 09:00:00", "yesterday", 1)), ExportFormatCSV)
+	assert.NotNil(t, err)
+
+	jsonImport := `[{"id": 12, "subject": "Outage", "client": "client@dhbw.de", "tags": ["Network"],
+		"messages": [{"date": "2021-03-01T09:00:00Z", "text": "Help"}]}, {"id": "x-1", "subject": "Printer"},
+		{"id": 12345678901234567890, "subject": "Large"}]`
+	tickets, err = ParseImport(strings.NewReader(jsonImport), ExportFormatJSON)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"12", "x-1", "12345678901234567890"}, []string{tickets[0].ExternalID, tickets[1].ExternalID, tickets[2].ExternalID})
+	assert.Equal(t, []string{"network"}, tickets[0].Tags)
+	_, err = ParseImport(strings.NewReader(`[{"id": {"nested": 1}}]`), ExportFormatJSON)
+	assert.NotNil(t, err)
+	_, err = ParseImport(strings.NewReader(jsonImport), "xml")
+	assert.NotNil(t, err)
+}
+
+func TestImportTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna")
+	queue, err := CreateQueue(Queue{Name: "Billing", Members: []string{"Anna"}})
+	assert.Nil(t, err)
+	createTickets(t, "Existing")
+	countBefore := countMails(t)
+
+	day := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	tickets := []ImportedTicket{
+		{ExternalID: "A-7", Subject: "Outage", Client: "client@dhbw.de", Status: "in process", Editor: "Anna", Priority: "High", Queue: "billing",
+			Messages: []ExportedMessage{{Date: day.Add(time.Hour), Author: "Anna", Type: "reply", Text: "Restart it"}, {Date: day, Text: "Help"}}},
+		{ExternalID: "A-8", Subject: "Printer", Client: "other@dhbw.de", Status: "in process", Editor: "Zoe", Queue: "Sales",
+			Messages: []ExportedMessage{{Date: day, Author: "Zoe", Text: "Checked the printer"}}},
+	}
+
+	// Invalid tickets abort the import before anything is created
+	invalid := append([]ImportedTicket{}, tickets...)
+	invalid[1].Priority = "whenever"
+	_, err = ImportTickets(invalid, "OTRS", "Admin")
+	assert.NotNil(t, err)
+	_, err = ImportTickets(append(tickets, tickets[0]), "OTRS", "Admin")
+	assert.NotNil(t, err)
+	_, err = ImportTickets(nil, "OTRS", "Admin")
+	assert.NotNil(t, err)
+	_, err = ImportTickets(tickets, " ", "Admin")
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, getTicketIDCounter())
+
+	mappings, err := ImportTickets(tickets, "OTRS", "Admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []ImportMapping{{ExternalID: "A-7", TicketID: 2}, {ExternalID: "A-8", TicketID: 3,
+		Notes: []string{"editor Zoe doesn't exist", "queue Sales doesn't exist"}}}, mappings)
+	assert.Equal(t, countBefore, countMails(t))
+
+	ticket, err := ReadTicket(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Anna", ticket.Editor)
+	assert.Equal(t, TicketStatusInProcess, ticket.Status)
+	assert.Equal(t, TicketPriorityHigh, ticket.Priority)
+	assert.Equal(t, queue.ID, ticket.Queue)
+	assert.Equal(t, "A-7", ticket.ImportedFrom)
+	assert.Equal(t, "OTRS", ticket.ImportSource)
+	assert.Equal(t, 3, len(ticket.MessageList))
+	assert.Equal(t, Message{CreationDate: day, Actor: "client@dhbw.de", Text: "Help", Type: MessageTypeCustomer}, ticket.MessageList[0])
+	assert.Equal(t, "Anna", ticket.MessageList[1].Actor)
+	assert.Equal(t, "Imported by Admin from ticket A-7 of OTRS", ticket.MessageList[2].Text)
+
+	// Tickets without an existing editor are open again, messages of unknown authors are internal notes
+	ticket, err = ReadTicket(3)
+	assert.Nil(t, err)
+	assert.Equal(t, "", ticket.Editor)
+	assert.Equal(t, TicketStatusOpen, ticket.Status)
+	assert.Equal(t, 0, ticket.Queue)
+	assert.Equal(t, MessageTypeNote, ticket.MessageList[0].Type)
+
+	// Importing the same tickets again only maps them to the existing ones
+	mappings, err = ImportTickets(tickets, "otrs", "Admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []ImportMapping{{ExternalID: "A-7", TicketID: 2, Existing: true}, {ExternalID: "A-8", TicketID: 3, Existing: true}}, mappings)
+	assert.Equal(t, 3, getTicketIDCounter())
+
+	// The same IDs of another help desk belong to other tickets
+	mappings, err = ImportTickets(tickets[:1], "Zammad", "Admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []ImportMapping{{ExternalID: "A-7", TicketID: 4}}, mappings)
+}
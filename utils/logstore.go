@@ -0,0 +1,544 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Identifies the files of the log store, a changed record format needs a new magic
+const logStoreMagic = "TSLOG001"
+
+// Kinds of the records in the log
+const (
+	logRecordTicket  byte = 1 // Current version of a ticket as XML
+	logRecordDelete  byte = 2 // Removes the ticket with the ID
+	logRecordCounter byte = 3 // ID of the last created ticket
+)
+
+// Length of the record header: the kind, the ID, the length of the payload and the CRC-32 of all of them
+const logRecordHeaderSize = 1 + 8 + 4 + 4
+
+// Logs are compacted once they are larger than this and most of their records are outdated
+var logCompactionMinSize int64 = 1 << 20
+
+// Stores the tickets in a single file to which every change is appended as a record. An index in memory points
+// to the latest record of every ticket, so tickets are read without scanning the file, and lists the tickets of every
+// status and editor. Outdated records are removed in the background by rewriting the file once they make up more
+// than half of it.
+// A record which was only partly written when the ticket system stopped is cut off when the log is opened again.
+// Damaged records before the end of the log keep it from being opened, because cutting them off would lose every
+// later record
+type logTicketStore struct {
+	mutex          sync.RWMutex
+	path           string
+	file           *os.File
+	size           int64
+	index          map[int]logRecord    // Latest record of every stored ticket
+	byStatus       map[int]map[int]bool // IDs of the stored tickets by their status
+	byEditor       map[string]map[int]bool
+	liveBytes      int64 // Size of the records in the index
+	lastTicketID   int
+	compactionDone chan struct{} // Closed when the compaction in the background has finished, nil if none runs
+}
+
+// Position of the payload of a record in the log and the indexed fields of its ticket
+type logRecord struct {
+	offset int64
+	length int
+	fields logIndexFields
+}
+
+// Fields of the tickets which are indexed, they are read from the records when the log is opened
+type logIndexFields struct {
+	Status int    `xml:"Status"`
+	Editor string `xml:"Editor"`
+}
+
+func openLogTicketStore(path string) (*logTicketStore, error) {
+	store := &logTicketStore{path: path}
+	err := store.open()
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Opens the log, creates it if it doesn't exist and reads all records into the index
+func (store *logTicketStore) open() error {
+	file, err := os.OpenFile(store.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	store.file = file
+	store.index = make(map[int]logRecord)
+	store.byStatus = make(map[int]map[int]bool)
+	store.byEditor = make(map[string]map[int]bool)
+	store.liveBytes = 0
+	store.lastTicketID = 0
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	if info.Size() == 0 {
+		mutexStorage.RLock()
+		_, err = file.Write([]byte(logStoreMagic))
+		mutexStorage.RUnlock()
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		store.size = int64(len(logStoreMagic))
+		return nil
+	}
+
+	store.size, err = store.readRecords(bufio.NewReader(file), info.Size())
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	if store.size < info.Size() {
+		log.Printf("Cutting off %d bytes of an incomplete record at the end of %s", info.Size()-store.size, store.path)
+		mutexStorage.RLock()
+		err = file.Truncate(store.size)
+		mutexStorage.RUnlock()
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	_, err = file.Seek(store.size, io.SeekStart)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	if store.needsCompaction() {
+		return store.compact()
+	}
+	return nil
+}
+
+// Builds the index from the records and returns the end of the last complete record. Only the last record may be
+// incomplete or damaged, a damaged record which is followed by others returns an error
+func (store *logTicketStore) readRecords(reader io.Reader, fileSize int64) (int64, error) {
+	magic := make([]byte, len(logStoreMagic))
+	_, err := io.ReadFull(reader, magic)
+	if err != nil || string(magic) != logStoreMagic {
+		return 0, fmt.Errorf("%s is no ticket log", store.path)
+	}
+
+	offset := int64(len(logStoreMagic))
+	header := make([]byte, logRecordHeaderSize)
+	for {
+		_, err = io.ReadFull(reader, header)
+		if err != nil {
+			return offset, nil
+		}
+		kind, id, length := header[0], int(int64(binary.BigEndian.Uint64(header[1:9]))), int(binary.BigEndian.Uint32(header[9:13]))
+		end := offset + int64(logRecordHeaderSize+length)
+		if end > fileSize {
+			// Either the last record was written only partly or the length of a record is damaged
+			rest, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return offset, err
+			}
+			if containsLogRecord(rest) {
+				return offset, fmt.Errorf("%s contains a record with a damaged length at offset %d which is followed by others", store.path, offset)
+			}
+			return offset, nil
+		}
+		payload := make([]byte, length)
+		_, err = io.ReadFull(reader, payload)
+		if err != nil {
+			return offset, err
+		}
+		if binary.BigEndian.Uint32(header[13:]) != logChecksum(header[:13], payload) {
+			if end == fileSize {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("%s contains a damaged record at offset %d which is followed by others", store.path, offset)
+		}
+		if kind != logRecordTicket && kind != logRecordDelete && kind != logRecordCounter {
+			return offset, fmt.Errorf("%s contains a record of the unknown kind %d", store.path, kind)
+		}
+
+		record := logRecord{offset: offset + logRecordHeaderSize, length: length}
+		if kind == logRecordTicket {
+			err = xml.Unmarshal(payload, &record.fields)
+			if err != nil {
+				return offset, fmt.Errorf("%s contains the unreadable ticket %d: %v", store.path, id, err)
+			}
+		}
+		store.applyRecord(kind, id, record)
+		offset = end
+	}
+}
+
+// Checks if the bytes contain a complete record with a valid checksum. The payloads never contain the bytes
+// of the record kinds, because XML doesn't allow them, hence only the bytes after a damaged length are searched
+func containsLogRecord(data []byte) bool {
+	for start := 0; start+logRecordHeaderSize <= len(data); start++ {
+		kind := data[start]
+		if kind != logRecordTicket && kind != logRecordDelete && kind != logRecordCounter {
+			continue
+		}
+		header := data[start : start+logRecordHeaderSize]
+		end := start + logRecordHeaderSize + int(binary.BigEndian.Uint32(header[9:13]))
+		if end > len(data) || end < start {
+			continue
+		}
+		if binary.BigEndian.Uint32(header[13:]) == logChecksum(header[:13], data[start+logRecordHeaderSize:end]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (store *logTicketStore) applyRecord(kind byte, id int, record logRecord) {
+	if previous, ok := store.index[id]; ok && kind != logRecordCounter {
+		store.liveBytes -= int64(logRecordHeaderSize + previous.length)
+		delete(store.index, id)
+		delete(store.byStatus[previous.fields.Status], id)
+		delete(store.byEditor[previous.fields.Editor], id)
+	}
+
+	switch kind {
+	case logRecordTicket:
+		store.index[id] = record
+		if store.byStatus[record.fields.Status] == nil {
+			store.byStatus[record.fields.Status] = make(map[int]bool)
+		}
+		store.byStatus[record.fields.Status][id] = true
+		if store.byEditor[record.fields.Editor] == nil {
+			store.byEditor[record.fields.Editor] = make(map[int]bool)
+		}
+		store.byEditor[record.fields.Editor][id] = true
+		store.liveBytes += int64(logRecordHeaderSize + record.length)
+		store.lastTicketID = maxInt(store.lastTicketID, id)
+	case logRecordCounter:
+		store.lastTicketID = id
+	}
+}
+
+func logChecksum(header []byte, payload []byte) uint32 {
+	checksum := crc32.NewIEEE()
+	_, _ = checksum.Write(header)
+	_, _ = checksum.Write(payload)
+	return checksum.Sum32()
+}
+
+func encodeLogRecord(kind byte, id int, payload []byte) []byte {
+	record := make([]byte, logRecordHeaderSize, logRecordHeaderSize+len(payload))
+	record[0] = kind
+	binary.BigEndian.PutUint64(record[1:9], uint64(id))
+	binary.BigEndian.PutUint32(record[9:13], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[13:], logChecksum(record[:13], payload))
+	return append(record, payload...)
+}
+
+// Appends the record to the log and updates the index. A record which couldn't be written completely is removed
+// again, so the next record doesn't follow a damaged one
+func (store *logTicketStore) append(kind byte, id int, payload []byte, fields logIndexFields) error {
+	if store.file == nil {
+		return fmt.Errorf("the ticket log is closed")
+	}
+
+	mutexStorage.RLock()
+	_, err := store.file.Write(encodeLogRecord(kind, id, payload))
+	if err != nil {
+		_ = store.file.Truncate(store.size)
+		_, _ = store.file.Seek(store.size, io.SeekStart)
+	}
+	mutexStorage.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	store.applyRecord(kind, id, logRecord{offset: store.size + logRecordHeaderSize, length: len(payload), fields: fields})
+	store.size += int64(logRecordHeaderSize + len(payload))
+	store.startCompactionIfNeeded()
+	return nil
+}
+
+// Checks if most of the log consists of outdated records, must be called with the store locked
+func (store *logTicketStore) needsCompaction() bool {
+	return store.size >= logCompactionMinSize && store.size-store.liveBytes >= store.size/2
+}
+
+// Compacts the log in the background, so the write which made the log too large doesn't wait for it. The compaction
+// is repeated as long as the writes during it leave too many outdated records. Must be called with the store locked
+func (store *logTicketStore) startCompactionIfNeeded() {
+	if store.compactionDone != nil || !store.needsCompaction() {
+		return
+	}
+
+	done := make(chan struct{})
+	store.compactionDone = done
+	go func() {
+		defer close(done)
+		for {
+			err := store.compact()
+			if err != nil {
+				log.Printf("Couldn't compact %s: %v\n", store.path, err)
+			}
+
+			store.mutex.Lock()
+			again := err == nil && store.file != nil && store.needsCompaction()
+			if !again {
+				store.compactionDone = nil
+			}
+			store.mutex.Unlock()
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+// Waits until the compaction in the background has finished, if there is one
+func (store *logTicketStore) waitForCompaction() {
+	store.mutex.RLock()
+	done := store.compactionDone
+	store.mutex.RUnlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// Rewrites the log with only the latest record of every ticket. The records are copied without blocking the store,
+// because the log is only appended to. The records which were appended meanwhile are copied as they are before the new
+// log replaces the old one. It is written completely before, so a crash during the compaction leaves the old log intact
+func (store *logTicketStore) compact() error {
+	store.mutex.RLock()
+	source, sourceSize, lastTicketID := store.file, store.size, store.lastTicketID
+	records := make(map[int]logRecord, len(store.index))
+	for id, record := range store.index {
+		records[id] = record
+	}
+	store.mutex.RUnlock()
+	if source == nil {
+		return fmt.Errorf("the ticket log is closed")
+	}
+
+	compactPath := store.path + ".compact"
+	file, size, offsets, err := writeCompactLog(compactPath, source, records, lastTicketID)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	mutexStorage.RLock()
+	defer mutexStorage.RUnlock()
+
+	if store.file != source {
+		err = fmt.Errorf("the ticket log was closed during the compaction")
+	}
+	appended := make([]byte, store.size-sourceSize)
+	if err == nil {
+		_, err = source.ReadAt(appended, sourceSize)
+	}
+	if err == nil {
+		_, err = file.Write(appended)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(compactPath, store.path)
+	}
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(compactPath)
+		return err
+	}
+
+	// The records of the index either were copied or moved together with the appended ones
+	for id, record := range store.index {
+		if record.offset >= sourceSize {
+			record.offset += size - sourceSize
+		} else {
+			record.offset = offsets[id]
+		}
+		store.index[id] = record
+	}
+	_ = source.Close()
+	store.file = file
+	store.size = size + int64(len(appended))
+	_, err = file.Seek(store.size, io.SeekStart)
+	return err
+}
+
+// Writes the counter and the records into a new log and returns it with its size and the new offsets of the payloads
+func writeCompactLog(path string, source *os.File, records map[int]logRecord, lastTicketID int) (*os.File, int64, map[int]int64, error) {
+	mutexStorage.RLock()
+	defer mutexStorage.RUnlock()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	ids := make([]int, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	writer := bufio.NewWriter(file)
+	size := int64(len(logStoreMagic))
+	_, err = writer.WriteString(logStoreMagic)
+	counter := encodeLogRecord(logRecordCounter, lastTicketID, nil)
+	if err == nil {
+		_, err = writer.Write(counter)
+		size += int64(len(counter))
+	}
+	offsets := make(map[int]int64, len(records))
+	for _, id := range ids {
+		if err != nil {
+			break
+		}
+		payload := make([]byte, records[id].length)
+		_, err = source.ReadAt(payload, records[id].offset)
+		if err == nil {
+			_, err = writer.Write(encodeLogRecord(logRecordTicket, id, payload))
+			offsets[id] = size + logRecordHeaderSize
+			size += int64(logRecordHeaderSize + len(payload))
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return nil, 0, nil, err
+	}
+	return file, size, offsets, nil
+}
+
+func (store *logTicketStore) readPayload(record logRecord) ([]byte, error) {
+	payload := make([]byte, record.length)
+	_, err := store.file.ReadAt(payload, record.offset)
+	return payload, err
+}
+
+func (store *logTicketStore) ReadTicket(id int) (Ticket, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	record, ok := store.index[id]
+	if !ok || store.file == nil {
+		return Ticket{}, fmt.Errorf("ticket %d doesn't exist", id)
+	}
+	payload, err := store.readPayload(record)
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	var ticket Ticket
+	err = xml.Unmarshal(payload, &ticket)
+	return ticket, err
+}
+
+func (store *logTicketStore) StoreTicket(ticket Ticket) error {
+	if ticket.ID <= 0 {
+		return fmt.Errorf("invalid ticket ID %d", ticket.ID)
+	}
+	payload, err := xml.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.append(logRecordTicket, ticket.ID, payload, logIndexFields{Status: ticket.Status, Editor: ticket.Editor})
+}
+
+func (store *logTicketStore) DeleteTicket(id int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.index[id]; !ok {
+		return fmt.Errorf("ticket %d doesn't exist", id)
+	}
+	return store.append(logRecordDelete, id, nil, logIndexFields{})
+}
+
+func (store *logTicketStore) TicketIDs() ([]int, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	ids := make([]int, 0, len(store.index))
+	for id := range store.index {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (store *logTicketStore) TicketIDsByStatus(status int) []int {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return sortedIDs(store.byStatus[status])
+}
+
+func (store *logTicketStore) TicketIDsByEditor(editor string) []int {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return sortedIDs(store.byEditor[editor])
+}
+
+func sortedIDs(set map[int]bool) []int {
+	ids := make([]int, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (store *logTicketStore) LastTicketID() int {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.lastTicketID
+}
+
+func (store *logTicketStore) SetLastTicketID(id int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.append(logRecordCounter, id, nil, logIndexFields{})
+}
+
+// Closes the log once the compaction in the background has finished
+func (store *logTicketStore) Close() error {
+	for {
+		store.mutex.Lock()
+		done := store.compactionDone
+		if done == nil {
+			break
+		}
+		store.mutex.Unlock()
+		<-done
+	}
+	defer store.mutex.Unlock()
+
+	if store.file == nil {
+		return nil
+	}
+	err := store.file.Close()
+	store.file = nil
+	return err
+}
@@ -0,0 +1,544 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of the actions a macro can consist of
+const (
+	MacroActionReply       = "reply"       // Sends the value with placeholders to the customer
+	MacroActionNote        = "note"        // Adds the value with placeholders as internal note
+	MacroActionCannedReply = "cannedReply" // Sends the canned response with the ID of the value to the customer
+	MacroActionStatus      = "status"      // Sets the status with the name of the value
+	MacroActionPriority    = "priority"    // Sets the priority with the name of the value
+	MacroActionAssign      = "assign"      // Assigns the ticket to the editor of the value or to the one running the macro if it is empty
+	MacroActionRelease     = "release"     // Releases the ticket of the one running the macro
+	MacroActionSpam        = "spam"        // Closes the ticket as spam
+	MacroActionQueue       = "queue"       // Moves the ticket into the queue with the name of the value
+	MacroActionTag         = "tag"         // Adds the comma separated tags of the value to the ticket
+)
+
+type MacroAction struct {
+	Type  string `xml:"Type"`
+	Value string `xml:"Value"`
+}
+
+type Macro struct {
+	ID           int           `xml:"ID"`
+	Name         string        `xml:"Name"`
+	Owner        string        `xml:"Owner"`
+	Shared       bool          `xml:"Shared"` // Shared macros are visible to all editors, others only to their owner
+	Actions      []MacroAction `xml:"Actions>Action"`
+	UsageCount   int           `xml:"UsageCount"`
+	CreationDate time.Time     `xml:"CreationDate"`
+}
+
+type MacroList struct {
+	MacroIDCounter int     `xml:"MacroIDCounter"`
+	Macros         []Macro `xml:"macros>macro"`
+}
+
+var mutexMacros = &sync.Mutex{}
+
+// Checks if the user is allowed to see and run the macro
+func (macro Macro) IsVisibleTo(user User) bool {
+	return macro.Shared || macro.Owner == user.Username
+}
+
+// Checks if the user is allowed to change and delete the macro
+func (macro Macro) IsEditableBy(user User) bool {
+	return macro.Owner == user.Username || user.IsAdmin()
+}
+
+// Returns the actions of the macro in the format which is parsed by ParseMacroActions
+func (macro Macro) ActionsText() string {
+	var lines []string
+	for _, action := range macro.Actions {
+		lines = append(lines, strings.TrimSpace(action.Type+" "+action.Value))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Parses one action per line. Every line starts with the type of the action, followed by its value
+func ParseMacroActions(text string) ([]MacroAction, error) {
+	var actions []MacroAction
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, " ", 2)
+		action := MacroAction{Type: parts[0]}
+		if len(parts) == 2 {
+			action.Value = strings.TrimSpace(parts[1])
+		}
+
+		err := validateMacroAction(action)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("a macro needs at least one action")
+	}
+	return actions, nil
+}
+
+// Checks the values of the action which do not depend on the ticket the macro is run on
+func validateMacroAction(action MacroAction) error {
+	switch action.Type {
+	case MacroActionReply, MacroActionNote:
+		if action.Value == "" {
+			return fmt.Errorf("the %s action needs a text", action.Type)
+		}
+	case MacroActionCannedReply:
+		if _, err := strconv.Atoi(action.Value); err != nil {
+			return fmt.Errorf("the %s action needs the ID of a canned response", action.Type)
+		}
+	case MacroActionStatus:
+		if _, ok := ParseTicketStatus(action.Value); !ok {
+			return fmt.Errorf("unknown status %q", action.Value)
+		}
+	case MacroActionPriority:
+		if _, ok := ParseTicketPriority(action.Value); !ok {
+			return fmt.Errorf("unknown priority %q", action.Value)
+		}
+	case MacroActionQueue:
+		if action.Value == "" {
+			return fmt.Errorf("the %s action needs the name of a queue", action.Type)
+		}
+	case MacroActionTag:
+		if len(ParseTags(action.Value)) == 0 || !CheckEmptyXSSString(action.Value) {
+			return fmt.Errorf("the %s action needs at least one valid tag", action.Type)
+		}
+	case MacroActionAssign, MacroActionRelease, MacroActionSpam:
+	default:
+		return fmt.Errorf("unknown macro action %q", action.Type)
+	}
+
+	return nil
+}
+
+// Creates a new macro owned by the specified user
+func CreateMacro(name string, actions []MacroAction, owner string, shared bool) (Macro, error) {
+	if strings.TrimSpace(name) == "" || len(actions) == 0 {
+		return Macro{}, fmt.Errorf("a macro needs a name and at least one action")
+	}
+
+	mutexMacros.Lock()
+	defer mutexMacros.Unlock()
+
+	macroList, err := ReadMacros()
+	if err != nil {
+		return Macro{}, err
+	}
+
+	macroList.MacroIDCounter++
+	macro := Macro{ID: macroList.MacroIDCounter, Name: name, Owner: owner, Shared: shared, Actions: actions, CreationDate: time.Now()}
+	macroList.Macros = append(macroList.Macros, macro)
+
+	return macro, WriteToXML(macroList, config.MacrosFilePath())
+}
+
+// Changes the name, actions and visibility of a macro. The usage count is kept
+func UpdateMacro(id int, name string, actions []MacroAction, shared bool) (Macro, error) {
+	if strings.TrimSpace(name) == "" || len(actions) == 0 {
+		return Macro{}, fmt.Errorf("a macro needs a name and at least one action")
+	}
+
+	var updated Macro
+	err := changeMacros(func(macros []Macro) ([]Macro, error) {
+		i, err := findMacro(macros, id)
+		if err != nil {
+			return nil, err
+		}
+
+		macros[i].Name = name
+		macros[i].Actions = actions
+		macros[i].Shared = shared
+		updated = macros[i]
+		return macros, nil
+	})
+
+	return updated, err
+}
+
+// Removes a macro
+func DeleteMacro(id int) error {
+	return changeMacros(func(macros []Macro) ([]Macro, error) {
+		i, err := findMacro(macros, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(macros[:i], macros[i+1:]...), nil
+	})
+}
+
+// Applies the change to the stored macros while holding the lock
+func changeMacros(change func(macros []Macro) ([]Macro, error)) error {
+	mutexMacros.Lock()
+	defer mutexMacros.Unlock()
+
+	macroList, err := ReadMacros()
+	if err != nil {
+		return err
+	}
+
+	macroList.Macros, err = change(macroList.Macros)
+	if err != nil {
+		return err
+	}
+
+	return WriteToXML(macroList, config.MacrosFilePath())
+}
+
+func findMacro(macros []Macro, id int) (int, error) {
+	for i, macro := range macros {
+		if macro.ID == id {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("couldn't find the macro")
+}
+
+// Returns the macro with the specified ID
+func GetMacro(id int) (Macro, error) {
+	macroList, err := ReadMacros()
+	if err != nil {
+		return Macro{}, err
+	}
+
+	i, err := findMacro(macroList.Macros, id)
+	if err != nil {
+		return Macro{}, err
+	}
+
+	return macroList.Macros[i], nil
+}
+
+// Returns the shared macros and the personal ones of the user ordered by their name
+func GetMacrosForUser(user User) ([]Macro, error) {
+	macroList, err := ReadMacros()
+	if err != nil {
+		return nil, err
+	}
+
+	var macros []Macro
+	for _, macro := range macroList.Macros {
+		if macro.IsVisibleTo(user) {
+			macros = append(macros, macro)
+		}
+	}
+
+	sort.SliceStable(macros, func(i, j int) bool {
+		return strings.ToLower(macros[i].Name) < strings.ToLower(macros[j].Name)
+	})
+	return macros, nil
+}
+
+// Returns all stored macros
+func ReadMacros() (MacroList, error) {
+	file, err := ioutil.ReadFile(config.MacrosFilePath())
+	if err != nil {
+		return MacroList{}, err
+	}
+
+	var macroList MacroList
+	err = xml.Unmarshal(file, &macroList)
+	if err != nil {
+		return MacroList{}, err
+	}
+
+	return macroList, nil
+}
+
+// State of the ticket before and after one action of a macro
+type macroStep struct {
+	action MacroAction
+	before Ticket
+	after  Ticket
+}
+
+// Reply of a macro, its mail is queued once all actions of the macro succeeded
+type macroReply struct {
+	message int // Index of the reply in the messages of the ticket
+	mail    Mail
+}
+
+// Runs all actions of the macro on the ticket and counts its usage
+func RunMacro(macro Macro, ticketID int, actor User, source string) (Ticket, error) {
+	ticket, err := runActions(macro.Actions, ticketID, actor, source, map[string]string{"macro": macro.Name}, true)
+	if err != nil {
+		return ticket, err
+	}
+
+	_ = changeMacros(func(macros []Macro) ([]Macro, error) {
+		if i, err := findMacro(macros, macro.ID); err == nil {
+			macros[i].UsageCount++
+		}
+		return macros, nil
+	})
+
+	return ticket, nil
+}
+
+// Runs the actions on the ticket while holding its lock. Either all actions are applied or, if one of them fails,
+// the ticket is restored. The mails of the replies are queued only after all actions succeeded, hence nothing is
+// sent for a failed macro. Afterwards an event with the details is published for every action and, if closureNotices
+// is set, the customer gets the same closure notice as for closing the ticket through the web interface
+func runActions(actions []MacroAction, ticketID int, actor User, source string, details map[string]string, closureNotices bool) (Ticket, error) {
+	unlock := lockTicket(ticketID)
+	ticket, steps, cannedResponseIDs, err := applyMacroActions(actions, ticketID, actor)
+	unlock()
+	if err != nil {
+		return ticket, err
+	}
+
+	for _, id := range cannedResponseIDs {
+		_ = IncrementCannedResponseUsage(id)
+	}
+
+	// The events are published without the lock, because the automation rules may run further actions on the ticket
+	for _, step := range steps {
+		event := Event{Type: macroActionEvent(step), Ticket: step.after, Actor: actor.Username, Source: source,
+			Changes: TicketChanges(step.before, step.after), Details: make(map[string]string)}
+		for key, value := range details {
+			event.Details[key] = value
+		}
+		switch step.action.Type {
+		case MacroActionReply, MacroActionCannedReply:
+			event.Details["sendoption"] = "customer"
+		case MacroActionNote:
+			event.Details["sendoption"] = "comments"
+		}
+		PublishEvent(event)
+
+		// Tickets closed as spam never notify the sender
+		if closureNotices && step.action.Type == MacroActionStatus && event.Type == EventTicketClosed {
+			err = SendClosureNotice(step.before, actor.Username)
+			if err != nil {
+				log.Printf("Couldn't send the closure notice for ticket %d: %v\n", ticketID, err)
+			}
+		}
+	}
+
+	return ticket, nil
+}
+
+// Applies the actions one after another and queues the mails of the replies at the end. If anything fails, the
+// original ticket is stored again
+func applyMacroActions(actions []MacroAction, ticketID int, actor User) (Ticket, []macroStep, []int, error) {
+	original, err := ReadTicket(ticketID)
+	if err != nil {
+		return Ticket{}, nil, nil, err
+	}
+
+	ticket := original
+	var steps []macroStep
+	var replies []macroReply
+	var cannedResponseIDs []int
+	for _, action := range actions {
+		before := ticket
+		var reply *macroReply
+		ticket, reply, err = applyMacroAction(action, ticket, actor)
+		if err != nil {
+			_ = StoreTicket(original)
+			return original, nil, nil, fmt.Errorf("macro action %q failed: %v", action.Type, err)
+		}
+
+		steps = append(steps, macroStep{action: action, before: before, after: ticket})
+		if reply != nil {
+			replies = append(replies, *reply)
+		}
+		if action.Type == MacroActionCannedReply {
+			id, _ := strconv.Atoi(action.Value)
+			cannedResponseIDs = append(cannedResponseIDs, id)
+		}
+	}
+	if len(replies) == 0 {
+		return ticket, steps, cannedResponseIDs, nil
+	}
+
+	mails := make([]Mail, len(replies))
+	for i, reply := range replies {
+		mails[i] = reply.mail
+	}
+	mails, err = QueueMails(mails)
+	if err != nil {
+		_ = StoreTicket(original)
+		return original, nil, nil, fmt.Errorf("couldn't queue the replies of the macro: %v", err)
+	}
+
+	// The replies are linked to their mails in the stored ticket and in the states of the events
+	for i := range steps {
+		steps[i].before = setReplyMailIDs(steps[i].before, replies, mails)
+		steps[i].after = setReplyMailIDs(steps[i].after, replies, mails)
+	}
+	ticket = setReplyMailIDs(ticket, replies, mails)
+
+	return ticket, steps, cannedResponseIDs, StoreTicket(ticket)
+}
+
+// Returns a copy of the ticket whose replies reference the mails which were queued for them
+func setReplyMailIDs(ticket Ticket, replies []macroReply, mails []Mail) Ticket {
+	messages := make([]Message, len(ticket.MessageList))
+	copy(messages, ticket.MessageList)
+	for i, reply := range replies {
+		if reply.message < len(messages) {
+			messages[reply.message].MailID = mails[i].ID
+		}
+	}
+
+	ticket.MessageList = messages
+	return ticket
+}
+
+// Applies a single action through the same store operations the web interface uses and returns the changed ticket.
+// Replies are stored without their mail, which is returned instead
+func applyMacroAction(action MacroAction, ticket Ticket, actor User) (Ticket, *macroReply, error) {
+	err := validateMacroAction(action)
+	if err != nil {
+		return ticket, nil, err
+	}
+
+	switch action.Type {
+	case MacroActionReply:
+		return addMacroReply(ticket, actor.Username, ExpandPlaceholders(action.Value, ticket, actor.Username))
+	case MacroActionNote:
+		ticket, err = AddMessage(ticket, actor.Username, ExpandPlaceholders(action.Value, ticket, actor.Username))
+		return ticket, nil, err
+	case MacroActionCannedReply:
+		id, _ := strconv.Atoi(action.Value)
+		response, err := GetCannedResponse(id)
+		if err != nil {
+			return ticket, nil, err
+		}
+		if !response.IsVisibleTo(actor) {
+			return ticket, nil, fmt.Errorf("the canned response is not visible to %s", actor.Username)
+		}
+		return addMacroReply(ticket, actor.Username, ExpandPlaceholders(response.Text, ticket, actor.Username))
+	case MacroActionStatus:
+		status, _ := ParseTicketStatus(action.Value)
+		if status == TicketStatusClosed && ticket.Status != TicketStatusClosed {
+			err = CheckClosable(ticket)
+		}
+		if err == nil {
+			err = ChangeStatus(ticket.ID, status)
+		}
+	case MacroActionPriority:
+		priority, _ := ParseTicketPriority(action.Value)
+		err = ChangePriority(ticket.ID, priority)
+	case MacroActionAssign:
+		err = assignByMacro(ticket, action.Value, actor)
+	case MacroActionSpam:
+		ticket, err = AddSystemMessage(ticket, "Closed as spam")
+		if err == nil {
+			err = ChangeStatus(ticket.ID, TicketStatusClosed)
+		}
+	case MacroActionQueue:
+		var queue Queue
+		queue, err = GetQueueByName(action.Value)
+		if err == nil {
+			ticket, err = MoveTicket(ticket, queue.ID, actor.Username)
+		}
+	case MacroActionTag:
+		err = ChangeTags(ticket.ID, ParseTags(ticket.TagsText()+","+action.Value))
+	case MacroActionRelease:
+		if ticket.Editor != actor.Username {
+			return ticket, nil, fmt.Errorf("only the editor of a ticket can release it")
+		}
+		err = ChangeEditor(ticket.ID, "")
+		if err == nil {
+			err = ChangeStatus(ticket.ID, TicketStatusOpen)
+		}
+	}
+	if err != nil {
+		return ticket, nil, err
+	}
+
+	ticket, err = ReadTicket(ticket.ID)
+	return ticket, nil, err
+}
+
+// Adds the reply like AddReply, but only renders its mail
+func addMacroReply(ticket Ticket, editor string, text string) (Ticket, *macroReply, error) {
+	mail, err := renderTicketMail(replyTemplate, replyMailData(ticket, editor, text))
+	if err != nil {
+		return ticket, nil, err
+	}
+
+	ticket, err = appendMessage(ticket, Message{Actor: editor, Text: text, Type: MessageTypeReply})
+	return ticket, &macroReply{message: len(ticket.MessageList) - 1, mail: mail}, err
+}
+
+// Assigns the ticket with the same checks as the assignment through the web interface, hence the editor has to be
+// a member of the queue of the ticket
+func assignByMacro(ticket Ticket, editor string, actor User) error {
+	if editor == "" {
+		editor = actor.Username
+	}
+
+	users, err := ReadUsers()
+	if err != nil {
+		return err
+	}
+
+	assignee, ok := users[editor]
+	if !ok {
+		return fmt.Errorf("the editor %s does not exist", editor)
+	}
+	if assignee.Username != actor.Username && !assignee.IsAvailable() {
+		return fmt.Errorf("the editor %s is absent", editor)
+	}
+	if !CanAccessTicket(assignee, ticket) {
+		return fmt.Errorf("the editor %s is no member of the queue of the ticket", editor)
+	}
+
+	err = ChangeEditor(ticket.ID, editor)
+	if err != nil {
+		return err
+	}
+	return ChangeStatus(ticket.ID, TicketStatusInProcess)
+}
+
+// Returns the event which describes the change of the action best
+func macroActionEvent(step macroStep) EventType {
+	switch step.action.Type {
+	case MacroActionReply, MacroActionNote, MacroActionCannedReply:
+		return EventTicketCommented
+	case MacroActionAssign:
+		return EventTicketAssigned
+	case MacroActionRelease:
+		return EventTicketReleased
+	case MacroActionQueue:
+		return EventTicketMoved
+	case MacroActionSpam:
+		return EventTicketClosed
+	case MacroActionStatus:
+		if step.after.Status == TicketStatusClosed && step.before.Status != TicketStatusClosed {
+			return EventTicketClosed
+		}
+		if step.before.Status == TicketStatusClosed && step.after.Status != TicketStatusClosed {
+			return EventTicketReopened
+		}
+	}
+
+	return EventTicketUpdated
+}
@@ -0,0 +1,227 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestParseMacroActions(t *testing.T) {
+	actions, err := ParseMacroActions("cannedReply 3\r\n\n  note Solved by {editor}\npriority low\nstatus in process\nassign\nrelease\n")
+	assert.Nil(t, err)
+	assert.Equal(t, []MacroAction{
+		{MacroActionCannedReply, "3"},
+		{MacroActionNote, "Solved by {editor}"},
+		{MacroActionPriority, "low"},
+		{MacroActionStatus, "in process"},
+		{MacroActionAssign, ""},
+		{MacroActionRelease, ""},
+	}, actions)
+	assert.Equal(t, "cannedReply 3\nnote Solved by {editor}\npriority low\nstatus in process\nassign\nrelease", Macro{Actions: actions}.ActionsText())
+
+	for _, text := range []string{"", "reply", "cannedReply abc", "status done", "priority", "delete"} {
+		_, err = ParseMacroActions(text)
+		assert.NotNil(t, err, text)
+	}
+}
+
+func TestMacroStorage(t *testing.T) {
+	setup()
+	defer teardown()
+
+	actions := []MacroAction{{MacroActionStatus, "closed"}}
+	macro, err := CreateMacro("Close", actions, "Test123", false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, macro.ID)
+	_, err = CreateMacro("", actions, "Test123", false)
+	assert.NotNil(t, err)
+	_, err = CreateMacro("Empty", nil, "Test123", false)
+	assert.NotNil(t, err)
+
+	_, err = CreateMacro("Shared", actions, "Other", true)
+	assert.Nil(t, err)
+	_, err = CreateMacro("Personal", actions, "Other", false)
+	assert.Nil(t, err)
+
+	macros, err := GetMacrosForUser(User{Username: "Test123"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(macros))
+	assert.Equal(t, "Close", macros[0].Name)
+	assert.Equal(t, "Shared", macros[1].Name)
+
+	macro, err = UpdateMacro(macro.ID, "Close quietly", []MacroAction{{MacroActionPriority, "low"}, {MacroActionStatus, "closed"}}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(macro.Actions))
+	macro, err = GetMacro(macro.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Close quietly", macro.Name)
+	assert.True(t, macro.Shared)
+
+	assert.Nil(t, DeleteMacro(macro.ID))
+	_, err = GetMacro(macro.ID)
+	assert.NotNil(t, err)
+	assert.NotNil(t, DeleteMacro(macro.ID))
+}
+
+func TestRunMacro(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateUser("Test123", "Aa!123456")
+	assert.Nil(t, err)
+	response, err := CreateCannedResponse("Solved", "Hello {customer}, your issue is solved.", "Test123", false)
+	assert.Nil(t, err)
+	ticket, err := CreateTicket("macro@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+
+	var received []EventType
+	SubscribeEvents(func(event Event) {
+		if event.Details["macro"] == "Solve" {
+			received = append(received, event.Type)
+		}
+	})
+
+	macro, err := CreateMacro("Solve", []MacroAction{
+		{MacroActionAssign, ""},
+		{MacroActionCannedReply, strconv.Itoa(response.ID)},
+		{MacroActionNote, "Solved by {editor}"},
+		{MacroActionPriority, "low"},
+		{MacroActionStatus, "closed"},
+	}, "Test123", false)
+	assert.Nil(t, err)
+
+	ticket, err = RunMacro(macro, ticket.ID, User{Username: "Test123"}, SourceWeb)
+	assert.Nil(t, err)
+	assert.Equal(t, "Test123", ticket.Editor)
+	assert.Equal(t, TicketStatusClosed, ticket.Status)
+	assert.Equal(t, TicketPriorityLow, ticket.Priority)
+	assert.Equal(t, 3, len(ticket.MessageList))
+	assert.Equal(t, MessageTypeReply, ticket.MessageList[1].Type)
+	assert.Equal(t, "Hello macro@dhbw.de, your issue is solved.", ticket.MessageList[1].Text)
+	assert.Equal(t, MessageTypeNote, ticket.MessageList[2].Type)
+	assert.Equal(t, "Solved by Test123", ticket.MessageList[2].Text)
+
+	assert.Equal(t, []EventType{EventTicketAssigned, EventTicketCommented, EventTicketCommented, EventTicketUpdated, EventTicketClosed}, received)
+
+	// The reply and the closure notice are queued once all actions succeeded
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(mailList.MailList))
+	assert.Equal(t, mailList.MailList[0].ID, ticket.MessageList[1].MailID)
+	stored, err := ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, ticket.MessageList[1].MailID, stored.MessageList[1].MailID)
+	assert.Contains(t, mailList.MailList[1].Subject, "closed")
+
+	macro, err = GetMacro(macro.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, macro.UsageCount)
+	response, err = GetCannedResponse(response.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, response.UsageCount)
+}
+
+func TestRunMacroRollback(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateUser("Test123", "Aa!123456")
+	assert.Nil(t, err)
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+
+	// The last action fails, because the editor does not exist
+	macro, err := CreateMacro("Broken", []MacroAction{
+		{MacroActionReply, "We are on it"},
+		{MacroActionPriority, "urgent"},
+		{MacroActionAssign, "Unknown"},
+	}, "Test123", false)
+	assert.Nil(t, err)
+
+	before, err := ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	_, err = RunMacro(macro, ticket.ID, User{Username: "Test123"}, SourceWeb)
+	assert.NotNil(t, err)
+
+	after, err := ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, before, after)
+
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mailList.MailList))
+
+	macro, err = GetMacro(macro.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, macro.UsageCount)
+}
+
+func TestRunMacroConcurrently(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+
+	// Macros on the same ticket don't overwrite the changes of each other
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := RunMacro(Macro{Name: "Note", Actions: []MacroAction{{MacroActionNote, "Checked"}}}, ticket.ID, User{Username: "Test123"}, SourceWeb)
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, len(ticket.MessageList))
+}
+
+func TestRunMacroPermissions(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateUser("Test123", "Aa!123456")
+	assert.Nil(t, err)
+	_, err = CreateUser("Holiday", "Aa!123456")
+	assert.Nil(t, err)
+	assert.Nil(t, SetUserHolidayMode("Holiday", true))
+	response, err := CreateCannedResponse("Private", "Text", "Other", false)
+	assert.Nil(t, err)
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+
+	tests := [][]MacroAction{
+		{{MacroActionRelease, ""}},
+		{{MacroActionAssign, "Holiday"}},
+		{{MacroActionCannedReply, strconv.Itoa(response.ID)}},
+	}
+	for _, actions := range tests {
+		_, err = RunMacro(Macro{Name: "Test", Actions: actions}, ticket.ID, User{Username: "Test123"}, SourceWeb)
+		assert.NotNil(t, err)
+	}
+
+	_, err = RunMacro(Macro{Name: "Test", Actions: []MacroAction{{MacroActionStatus, "closed"}}}, 99, User{Username: "Test123"}, SourceWeb)
+	assert.NotNil(t, err)
+
+	// Tickets of a queue are only assigned to its members, also by automation rules
+	_, err = CreateUser("Member", "Aa!123456")
+	assert.Nil(t, err)
+	queue, err := CreateQueue(Queue{Name: "Billing", Members: []string{"Member"}})
+	assert.Nil(t, err)
+	moved, err := MoveTicket(ticket, queue.ID, "Member")
+	assert.Nil(t, err)
+	_, err = RunMacro(Macro{Name: "Test", Actions: []MacroAction{{MacroActionAssign, "Test123"}}}, moved.ID, User{Username: "Member"}, SourceWeb)
+	assert.NotNil(t, err)
+	_, err = runActions([]MacroAction{{MacroActionAssign, "Test123"}}, moved.ID, User{Username: SystemActor}, SourceSystem, nil, true)
+	assert.NotNil(t, err)
+	assigned, err := RunMacro(Macro{Name: "Test", Actions: []MacroAction{{MacroActionAssign, "Member"}}}, moved.ID, User{Username: "Test123"}, SourceWeb)
+	assert.Nil(t, err)
+	assert.Equal(t, "Member", assigned.Editor)
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"strings"
 	"sync"
 	"time"
@@ -30,26 +31,83 @@ var mutexMailID = &sync.Mutex{}
 
 // Creates or merges a ticket that was sent through the REST API (PUSH /mails)
 func CreateTicketFromMail(mail string, reference string, message string) (Ticket, error) {
-	tickets := GetTicketsByClient(mail)
+	return ReceiveMail(SourceMail, "", mail, reference, message)
+}
 
+// Creates or merges a ticket like CreateTicketFromMail and records the source through which the mail was received.
+// New tickets are put into the queue of the recipient address
+func ReceiveMail(source string, recipient string, mail string, reference string, message string) (Ticket, error) {
 	// Check if the ticket is referring to an existing ticket
-	for _, actTicket := range tickets {
-		if CheckStringsDeviation(2, strings.ToLower(actTicket.Reference), strings.ToLower(reference)) {
-			newTicket, err := AddMessage(actTicket, mail, message)
-			if err != nil {
-				return newTicket, err
-			}
-			// Reopen closed tickets
-			if newTicket.Status == TicketStatusClosed {
-				err = ChangeStatus(newTicket.ID, TicketStatusInProcess)
-				newTicket.Status = TicketStatusInProcess
-				return newTicket, err
+	referenced, found := findReferencedTicket(mail, reference)
+	if found {
+		// Replies to a merged ticket are added to the ticket it was merged into as messages of the customer
+		actTicket, err := ResolveMergedTicket(referenced)
+		if err != nil {
+			return actTicket, err
+		}
+		reply := Message{Actor: mail, Text: message, Type: inferMessageType(actTicket, mail)}
+		if actTicket.ID != referenced.ID {
+			reply.Type = MessageTypeCustomer
+			reply.MergedFrom = referenced.ID
+		}
+
+		newTicket, err := appendMessage(actTicket, reply)
+		if err != nil {
+			return newTicket, err
+		}
+		PublishEvent(Event{Type: EventTicketCommented, Ticket: newTicket, Actor: mail, Source: source, Changes: TicketChanges(actTicket, newTicket)})
+
+		// Reopen closed tickets
+		if newTicket.Status == TicketStatusClosed {
+			closedTicket := newTicket
+			err = ChangeStatus(newTicket.ID, TicketStatusInProcess)
+			newTicket.Status = TicketStatusInProcess
+			if err == nil {
+				PublishEvent(Event{Type: EventTicketReopened, Ticket: newTicket, Actor: mail, Source: source, Changes: TicketChanges(closedTicket, newTicket)})
 			}
-			return newTicket, nil
+			return newTicket, err
 		}
+		return newTicket, nil
 	}
 
-	return CreateTicket(mail, reference, message)
+	newTicket, err := CreateTicket(mail, reference, message)
+	if err != nil {
+		return newTicket, err
+	}
+	newTicket, err = routeTicketByRecipient(newTicket, recipient)
+	if err != nil {
+		log.Printf("Couldn't route ticket %d to the queue of %s: %v\n", newTicket.ID, recipient, err)
+	}
+	PublishEvent(Event{Type: EventTicketCreated, Ticket: newTicket, Actor: mail, Source: source})
+
+	// The automation rules may have changed the ticket
+	current, err := ReadTicket(newTicket.ID)
+	if err == nil {
+		err = SendAcknowledgement(current, source)
+	}
+	if err != nil {
+		log.Printf("Couldn't send the acknowledgement for ticket %d: %v\n", newTicket.ID, err)
+	}
+
+	return newTicket, nil
+}
+
+// Returns the ticket of the client the subject refers to, either by its reference token or by a similar subject
+func findReferencedTicket(mail string, reference string) (Ticket, bool) {
+	if id, ok := ParseTicketReference(reference); ok {
+		ticket, err := ReadClientTicket(mail, id)
+		if err == nil {
+			return ticket, true
+		}
+	}
+
+	for _, actTicket := range GetTicketsByClient(mail) {
+		if CheckStringsDeviation(2, strings.ToLower(actTicket.Reference), strings.ToLower(reference)) {
+			return actTicket, true
+		}
+	}
+
+	return Ticket{}, false
 }
 
 // Deletes all mails in the xml file which are already sent
@@ -85,21 +143,39 @@ func DeleteMails(mailIds []int) error {
 
 // Stores the input as a mail which needs to be sent
 func SendMail(mail string, subject string, message string) error {
+	_, err := QueueMail(mail, subject, message)
+	return err
+}
+
+// Stores the input as a mail which needs to be sent and returns it with its assigned ID
+func QueueMail(mail string, subject string, message string) (Mail, error) {
+	mails, err := QueueMails([]Mail{{Mail: mail, Subject: subject, Message: message}})
+	if err != nil {
+		return Mail{}, err
+	}
+	return mails[0], nil
+}
+
+// Stores all mails with one write, so either all of them are sent or none. The mails are returned with their assigned IDs
+func QueueMails(mails []Mail) ([]Mail, error) {
 	// Synchronizing the change of the mail ID counter
 	mutexMailID.Lock()
 	defer mutexMailID.Unlock()
 
 	mailList, err := ReadMailsFile()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	nextMailId := mailList.MailIDCounter + 1
-	newMail := Mail{Mail: mail, Subject: subject, Message: message, ID: nextMailId}
-	mailList.MailList = append(mailList.MailList, newMail)
-	mailList.MailIDCounter = nextMailId
+	queued := make([]Mail, len(mails))
+	for i, mail := range mails {
+		mailList.MailIDCounter++
+		mail.ID = mailList.MailIDCounter
+		queued[i] = mail
+	}
+	mailList.MailList = append(mailList.MailList, queued...)
 
-	return WriteToXML(mailList, config.MailFilePath())
+	return queued, WriteToXML(mailList, config.MailFilePath())
 }
 
 // Returns all mails which have to be sent
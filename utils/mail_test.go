@@ -117,3 +117,19 @@ func TestIncrementReadAttemptsCounter(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 1, testMail.ReadAttemptCounter)
 }
+
+func TestQueueMail(t *testing.T) {
+	setup()
+	defer teardown()
+
+	firstMail, err := QueueMail("test@test", "testCaption", "testMsg")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, firstMail.ID)
+	secondMail, err := QueueMail("test@test", "testCaption", "testMsg")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, secondMail.ID)
+
+	actMailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, MailList{2, []Mail{firstMail, secondMail}}, actMailList)
+}
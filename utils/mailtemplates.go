@@ -0,0 +1,151 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"bytes"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Names of the mail templates in the mail template folder
+const (
+	acknowledgementTemplate = "acknowledgement"
+	replyTemplate           = "reply"
+	closureTemplate         = "closure"
+	reminderTemplate        = "reminder"
+	handoverTemplate        = "handover"
+	duplicateTemplate       = "duplicate"
+	splitTemplate           = "split"
+)
+
+var languageRegExp = regexp.MustCompile("^[a-z]{2}$")
+
+// Functions which can be used in the mail templates in addition to the builtin ones
+var mailTemplateFuncs = template.FuncMap{
+	"quote": QuoteText,
+}
+
+type MailTemplateData struct {
+	Ticket    Ticket
+	Token     string    // Reference of the ticket which has to stay in the subject of replies
+	Editor    string    // Editor who is sending the mail, empty for mails sent by the ticket system itself
+	Message   string    // Text of the editor which is sent with the mail
+	Signature string    // Configured signature, the templates provide a default one if it is empty
+	History   []Message // Messages which were exchanged with the customer before, the latest first
+	Related   Ticket    // Other ticket the mail refers to, e.g. the canonical ticket of a duplicate
+}
+
+// Returns the template data of a mail about the ticket
+func NewMailTemplateData(ticket Ticket, editor string, message string) MailTemplateData {
+	var history []Message
+	for i := len(ticket.MessageList) - 1; i >= 0; i-- {
+		if ticket.MessageList[i].IsPublic() {
+			history = append(history, ticket.MessageList[i])
+		}
+	}
+
+	return MailTemplateData{Ticket: ticket, Token: TicketReferenceToken(ticket.ID), Editor: editor, Message: message, Signature: config.MailSignature, History: history}
+}
+
+// Renders the template in the language of the ticket and queues it for the client of the ticket. Tickets without
+// a language use the one the client preferred for another ticket
+func sendTicketMail(name string, data MailTemplateData) (Mail, error) {
+	mail, err := renderTicketMail(name, data)
+	if err != nil {
+		return Mail{}, err
+	}
+
+	return QueueMail(mail.Mail, mail.Subject, mail.Message)
+}
+
+// Renders the mail to the client of the ticket without queueing it
+func renderTicketMail(name string, data MailTemplateData) (Mail, error) {
+	language := data.Ticket.Language
+	if language == "" {
+		language = CustomerLanguage(data.Ticket.Client)
+	}
+
+	subject, body, err := RenderMailTemplate(name, language, data)
+	if err != nil {
+		return Mail{}, err
+	}
+
+	return Mail{Mail: data.Ticket.Client, Subject: subject, Message: body}, nil
+}
+
+// Renders the subject and the body of a mail template in the requested language.
+// Missing translations fall back to the default language
+func RenderMailTemplate(name string, language string, data interface{}) (string, string, error) {
+	file := mailTemplateFile(name, language)
+	tmpl, err := template.New(path.Base(file)).Funcs(mailTemplateFuncs).ParseFiles(file)
+	if err != nil {
+		return "", "", err
+	}
+
+	var subject, body bytes.Buffer
+	err = tmpl.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return "", "", err
+	}
+	err = tmpl.ExecuteTemplate(&body, "body", data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSpace(subject.String()), strings.TrimSpace(body.String()), nil
+}
+
+// Returns the path of the template in the language or in the default language if there is no translation
+func mailTemplateFile(name string, language string) string {
+	if languageRegExp.MatchString(language) {
+		file := path.Join(config.MailTemplatePath, name+"."+language+".txt")
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+
+	return path.Join(config.MailTemplatePath, name+"."+config.DefaultLanguage+".txt")
+}
+
+// Sets the language of the mails to the client of the ticket and remembers it as preference of the client.
+// Invalid languages reset the ticket to the default language and keep the preference
+func SetTicketLanguage(ticket Ticket, language string) (Ticket, error) {
+	if !languageRegExp.MatchString(language) {
+		language = ""
+	}
+
+	ticket.Language = language
+	err := StoreTicket(ticket)
+	if err != nil {
+		return ticket, err
+	}
+	return ticket, SetCustomerLanguage(ticket.Client, language)
+}
+
+// Returns the preferred language of an Accept-Language header or an empty string if there is none
+func LanguageFromHeader(header string) string {
+	// The languages are ordered by preference in most browsers, hence the quality values are ignored
+	preferred := strings.Split(header, ",")[0]
+	preferred = strings.Split(preferred, ";")[0]
+	language := strings.ToLower(strings.TrimSpace(strings.Split(preferred, "-")[0]))
+
+	if !languageRegExp.MatchString(language) {
+		return ""
+	}
+	return language
+}
+
+// Prefixes every line of the text with "> " like mail clients do for quoted messages
+func QuoteText(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
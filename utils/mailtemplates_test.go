@@ -0,0 +1,154 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRenderMailTemplate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	data := MailTemplateData{Ticket: Ticket{ID: 3, Reference: "PC problem", MessageList: []Message{{Text: "Help"}}}, Token: TicketReferenceToken(3)}
+
+	subject, body, err := RenderMailTemplate(acknowledgementTemplate, "en", data)
+	assert.Nil(t, err)
+	assert.Equal(t, "[Ticket #3] We received your request: PC problem", subject)
+	assert.Contains(t, body, "Help")
+
+	subject, _, err = RenderMailTemplate(acknowledgementTemplate, "de", data)
+	assert.Nil(t, err)
+	assert.Equal(t, "[Ticket #3] Wir haben Ihre Anfrage erhalten: PC problem", subject)
+
+	// Missing translations and invalid languages fall back to the default language
+	for _, language := range []string{"fr", "", "../acknowledgement"} {
+		subject, _, err = RenderMailTemplate(acknowledgementTemplate, language, data)
+		assert.Nil(t, err)
+		assert.Equal(t, "[Ticket #3] We received your request: PC problem", subject)
+	}
+
+	_, _, err = RenderMailTemplate("unknown", "en", data)
+	assert.NotNil(t, err)
+}
+
+func TestLanguageFromHeader(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"de-DE,de;q=0.9,en;q=0.8", "de"},
+		{"en", "en"},
+		{"FR-fr", "fr"},
+		{"", ""},
+		{"*", ""},
+	}
+	for _, d := range tests {
+		assert.Equal(t, d.expected, LanguageFromHeader(d.header))
+	}
+}
+
+func TestNewMailTemplateData(t *testing.T) {
+	config.MailSignature = "DHBW Support"
+	defer func() { config.MailSignature = "" }()
+
+	ticket := Ticket{ID: 3, MessageList: []Message{
+		{Text: "First", Type: MessageTypeCustomer},
+		{Text: "Internal", Type: MessageTypeNote},
+		{Text: "Second", Type: MessageTypeReply},
+	}}
+
+	data := NewMailTemplateData(ticket, "Test123", "Text")
+	assert.Equal(t, "[Ticket #3]", data.Token)
+	assert.Equal(t, "Test123", data.Editor)
+	assert.Equal(t, "Text", data.Message)
+	assert.Equal(t, "DHBW Support", data.Signature)
+	assert.Equal(t, []Message{ticket.MessageList[2], ticket.MessageList[0]}, data.History)
+}
+
+func TestRenderReplyTemplate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket := Ticket{ID: 3, Reference: "PC problem", MessageList: []Message{
+		{CreationDate: time.Date(2019, 12, 1, 10, 30, 0, 0, time.UTC), Actor: "client@dhbw.de", Text: "Help\nPlease", Type: MessageTypeCustomer},
+	}}
+
+	subject, body, err := RenderMailTemplate(replyTemplate, "en", NewMailTemplateData(ticket, "Test123", "Restart it"))
+	assert.Nil(t, err)
+	assert.Equal(t, "[Ticket #3] Re: PC problem", subject)
+	assert.Contains(t, body, "Restart it")
+	assert.Contains(t, body, "Test123\nYour support team")
+	assert.Contains(t, body, "On 2019-12-01 10:30 client@dhbw.de wrote:\n> Help\n> Please")
+
+	config.MailSignature = "DHBW Support"
+	subject, body, err = RenderMailTemplate(replyTemplate, "de", NewMailTemplateData(ticket, "Test123", "Neu starten"))
+	config.MailSignature = ""
+	assert.Nil(t, err)
+	assert.Equal(t, "[Ticket #3] AW: PC problem", subject)
+	assert.Contains(t, body, "Test123\nDHBW Support")
+	assert.Contains(t, body, "Am 01.12.2019 10:30 schrieb client@dhbw.de:")
+}
+
+func TestQuoteText(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"Hello", "> Hello"},
+		{"Hello\n\nWorld\n", "> Hello\n>\n> World"},
+	}
+	for _, d := range tests {
+		assert.Equal(t, d.expected, QuoteText(d.text))
+	}
+}
+
+func TestSetTicketLanguage(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+
+	ticket, err = SetTicketLanguage(ticket, "de")
+	assert.Nil(t, err)
+	storedTicket, err := ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "de", storedTicket.Language)
+
+	ticket, err = SetTicketLanguage(ticket, "../de")
+	assert.Nil(t, err)
+	assert.Equal(t, "", ticket.Language)
+	assert.Equal(t, "de", CustomerLanguage("client@dhbw.de"))
+}
+
+func TestCustomerLanguage(t *testing.T) {
+	setup()
+	defer teardown()
+
+	assert.Equal(t, "", CustomerLanguage("client@dhbw.de"))
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	_, err = SetTicketLanguage(ticket, "de")
+	assert.Nil(t, err)
+
+	// Tickets the customer creates by mail later on are answered in the language of the customer
+	ticket, err = CreateTicketFromMail("Client@dhbw.de", "Printer broken", "Help")
+	assert.Nil(t, err)
+	assert.Equal(t, "de", ticket.Language)
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Contains(t, mailList.MailList[0].Subject, "Wir haben Ihre Anfrage erhalten")
+
+	// Invalid languages keep the preference
+	assert.Nil(t, SetCustomerLanguage("client@dhbw.de", "en"))
+	assert.Nil(t, SetCustomerLanguage("client@dhbw.de", "invalid"))
+	assert.Equal(t, "en", CustomerLanguage("CLIENT@dhbw.de"))
+	customerList, err := ReadCustomers()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(customerList.Customers))
+}
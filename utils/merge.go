@@ -0,0 +1,185 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var mutexMerge = &sync.Mutex{}
+
+// Checks if the ticket was merged into another one and is only kept as a tombstone
+func (ticket Ticket) IsMerged() bool {
+	return ticket.MergedInto != 0
+}
+
+// Merges the second ticket into the first one. The messages of the second ticket are copied into the first one in
+// chronological order and remember where they were written. The second ticket is kept as a tombstone which
+// redirects to the first one, so the merge can be undone and mails for the second ticket reach the first one
+func MergeTickets(firstTicketID int, secondTicketID int, actor string) error {
+	mutexMerge.Lock()
+	defer mutexMerge.Unlock()
+
+	firstTicket, err := ReadTicket(firstTicketID)
+	if err != nil {
+		return err
+	}
+
+	secondTicket, err := ReadTicket(secondTicketID)
+	if err != nil {
+		return err
+	}
+
+	if firstTicket.ID == secondTicket.ID {
+		return fmt.Errorf("a ticket can't be merged with itself")
+	}
+	if firstTicket.IsMerged() || secondTicket.IsMerged() {
+		return fmt.Errorf("tickets which were already merged into another one can't be merged again")
+	}
+	if firstTicket.Editor != secondTicket.Editor {
+		return fmt.Errorf("the two tickets for the merging process do not have the same editors")
+	}
+
+	for _, message := range secondTicket.MessageList {
+		// Messages which were merged into the second ticket before keep their origin, so that merge can be undone as well
+		if message.MergedFrom == 0 {
+			message.MergedFrom = secondTicket.ID
+		}
+		firstTicket.MessageList = append(firstTicket.MessageList, message)
+	}
+	sort.SliceStable(firstTicket.MessageList, func(i, j int) bool {
+		return firstTicket.MessageList[i].CreationDate.Before(firstTicket.MessageList[j].CreationDate)
+	})
+
+	// A closed ticket is reopened if an unfinished one is merged into it
+	if firstTicket.Status == TicketStatusClosed && secondTicket.Status != TicketStatusClosed {
+		firstTicket.Status = ReopenedStatus(firstTicket)
+	}
+
+	secondTicket, firstTicket, err = transferRelations(secondTicket, firstTicket)
+	if err != nil {
+		return err
+	}
+	firstTicket.Merged = append(firstTicket.Merged, secondTicket.ID)
+
+	_, err = AddSystemMessage(firstTicket, fmt.Sprintf("Ticket %d was merged into this ticket by %s", secondTicket.ID, actor))
+	if err != nil {
+		return err
+	}
+
+	secondTicket.MergedInto = firstTicket.ID
+	_, err = AddSystemMessage(secondTicket, fmt.Sprintf("Merged into ticket %d by %s", firstTicket.ID, actor))
+	return err
+}
+
+// Restores the ticket which was merged into another one. All messages which were written in it, also the ones
+// which reached the other ticket after the merge, are moved back
+func UnmergeTicket(id int, actor string) error {
+	mutexMerge.Lock()
+	defer mutexMerge.Unlock()
+
+	tombstone, err := ReadTicket(id)
+	if err != nil {
+		return err
+	}
+	if !tombstone.IsMerged() {
+		return fmt.Errorf("ticket %d was not merged into another ticket", id)
+	}
+
+	target, err := ReadTicket(tombstone.MergedInto)
+	if err != nil {
+		return err
+	}
+
+	// The messages of tickets which were merged into the restored ticket before belong to it as well
+	origins := map[int]bool{id: true}
+	for _, merged := range getMergedTicketsRecursively(id) {
+		origins[merged.ID] = true
+	}
+
+	var kept, restored []Message
+	for _, message := range target.MessageList {
+		if !origins[message.MergedFrom] {
+			kept = append(kept, message)
+			continue
+		}
+		if message.MergedFrom == id {
+			message.MergedFrom = 0
+		}
+		restored = append(restored, message)
+	}
+	if len(restored) == 0 {
+		return fmt.Errorf("ticket %d does not contain any message of ticket %d", target.ID, id)
+	}
+
+	tombstone, target, err = restoreRelations(tombstone, target, origins)
+	if err != nil {
+		return err
+	}
+	var merged []int
+	for _, mergedID := range target.Merged {
+		if mergedID != id {
+			merged = append(merged, mergedID)
+		}
+	}
+	target.Merged = merged
+	target.MessageList = kept
+	_, err = AddSystemMessage(target, fmt.Sprintf("Merge of ticket %d undone by %s", id, actor))
+	if err != nil {
+		return err
+	}
+
+	tombstone.MessageList = restored
+	tombstone.MergedInto = 0
+	_, err = AddSystemMessage(tombstone, fmt.Sprintf("Merge into ticket %d undone by %s", target.ID, actor))
+	return err
+}
+
+// Returns the ticket the specified ticket was merged into. Tickets which were not merged are returned unchanged
+func ResolveMergedTicket(ticket Ticket) (Ticket, error) {
+	visited := make(map[int]bool)
+	for ticket.IsMerged() {
+		if visited[ticket.ID] {
+			return Ticket{}, fmt.Errorf("the merges of ticket %d form a cycle", ticket.ID)
+		}
+		visited[ticket.ID] = true
+
+		var err error
+		ticket, err = ReadTicket(ticket.MergedInto)
+		if err != nil {
+			return Ticket{}, err
+		}
+	}
+
+	return ticket, nil
+}
+
+// Returns the tickets which were merged directly into the specified ticket
+func GetMergedTickets(id int) []Ticket {
+	ticket, err := ReadTicket(id)
+	if err != nil {
+		return nil
+	}
+
+	var tickets []Ticket
+	for _, mergedID := range ticket.Merged {
+		merged, err := ReadTicket(mergedID)
+		if err == nil && merged.MergedInto == id {
+			tickets = append(tickets, merged)
+		}
+	}
+
+	return tickets
+}
+
+func getMergedTicketsRecursively(id int) []Ticket {
+	var tickets []Ticket
+	for _, merged := range GetMergedTickets(id) {
+		tickets = append(tickets, merged)
+		tickets = append(tickets, getMergedTicketsRecursively(merged.ID)...)
+	}
+
+	return tickets
+}
@@ -0,0 +1,111 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMergeTicketsChronologically(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ids := createTickets(t, "Printer broken", "Printer still broken")
+	first, err := ReadTicket(ids[0])
+	assert.Nil(t, err)
+	_, err = AddMessage(first, "client@dhbw.de", "Any news?")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeStatus(ids[0], TicketStatusClosed))
+
+	assert.NotNil(t, MergeTickets(ids[0], ids[0], "Anna"))
+	assert.Nil(t, MergeTickets(ids[0], ids[1], "Anna"))
+
+	// The messages are ordered by their creation and the closed ticket is reopened by the unfinished one
+	merged, err := ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusOpen, merged.Status)
+	assert.Equal(t, []int{0, ids[1], 0, 0}, []int{merged.MessageList[0].MergedFrom, merged.MessageList[1].MergedFrom, merged.MessageList[2].MergedFrom, merged.MessageList[3].MergedFrom})
+	for i := 1; i < len(merged.MessageList); i++ {
+		assert.False(t, merged.MessageList[i].CreationDate.Before(merged.MessageList[i-1].CreationDate))
+	}
+
+	// Tombstones are left out of the lists of the editors
+	for _, ticket := range GetTicketsByStatus(TicketStatusOpen) {
+		assert.NotEqual(t, ids[1], ticket.ID)
+	}
+	assert.Equal(t, 2, len(GetTicketsByClient("client@dhbw.de")))
+	assert.Equal(t, []Ticket{mustReadTicket(t, ids[1])}, GetMergedTickets(ids[0]))
+}
+
+func TestMailToMergedTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	first, err := CreateTicket("first@dhbw.de", "Printer broken", "Help")
+	assert.Nil(t, err)
+	second, err := CreateTicket("second@dhbw.de", "Printer out of order", "Help")
+	assert.Nil(t, err)
+	third, err := CreateTicket("third@dhbw.de", "Printer down", "Help")
+	assert.Nil(t, err)
+	assert.Nil(t, MergeTickets(second.ID, third.ID, "Anna"))
+	assert.Nil(t, MergeTickets(first.ID, second.ID, "Anna"))
+
+	// Replies to the merged tickets reach the remaining ticket as messages of the customer
+	ticket, err := CreateTicketFromMail("third@dhbw.de", "Re: "+TicketReferenceToken(third.ID)+" Printer down", "It is working again")
+	assert.Nil(t, err)
+	assert.Equal(t, first.ID, ticket.ID)
+	last := ticket.MessageList[len(ticket.MessageList)-1]
+	assert.Equal(t, MessageTypeCustomer, last.Type)
+	assert.Equal(t, third.ID, last.MergedFrom)
+	assert.Equal(t, 3, getTicketIDCounter())
+
+	resolved, err := ResolveMergedTicket(mustReadTicket(t, third.ID))
+	assert.Nil(t, err)
+	assert.Equal(t, first.ID, resolved.ID)
+}
+
+func TestUnmergeTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	first, err := CreateTicket("first@dhbw.de", "Printer broken", "Help")
+	assert.Nil(t, err)
+	second, err := CreateTicket("second@dhbw.de", "Printer out of order", "Help")
+	assert.Nil(t, err)
+	third, err := CreateTicket("third@dhbw.de", "Printer down", "Help")
+	assert.Nil(t, err)
+
+	assert.NotNil(t, UnmergeTicket(second.ID, "Anna"))
+	assert.Nil(t, MergeTickets(second.ID, third.ID, "Anna"))
+	assert.Nil(t, MergeTickets(first.ID, second.ID, "Anna"))
+	_, err = CreateTicketFromMail("second@dhbw.de", TicketReferenceToken(second.ID), "Any news?")
+	assert.Nil(t, err)
+
+	// The restored ticket gets back its messages including the reply and the ones of the ticket merged into it
+	assert.Nil(t, UnmergeTicket(second.ID, "Bert"))
+	restored := mustReadTicket(t, second.ID)
+	assert.False(t, restored.IsMerged())
+	assert.Equal(t, "Any news?", restored.MessageList[len(restored.MessageList)-2].Text)
+	assert.Equal(t, "Merge into ticket 1 undone by Bert", restored.MessageList[len(restored.MessageList)-1].Text)
+	assert.Equal(t, third.ID, restored.MessageList[1].MergedFrom)
+
+	target := mustReadTicket(t, first.ID)
+	for _, message := range target.MessageList {
+		assert.Equal(t, 0, message.MergedFrom)
+	}
+	assert.Equal(t, "Merge of ticket 2 undone by Bert", target.MessageList[len(target.MessageList)-1].Text)
+
+	assert.Empty(t, GetMergedTickets(first.ID))
+	assert.Equal(t, []int{third.ID}, ticketIDs(GetMergedTickets(second.ID)))
+
+	// The earlier merge can be undone as well
+	assert.Nil(t, UnmergeTicket(third.ID, "Bert"))
+	assert.Equal(t, 0, len(GetMergedTickets(second.ID)))
+}
+
+func mustReadTicket(t *testing.T, id int) Ticket {
+	ticket, err := ReadTicket(id)
+	assert.Nil(t, err)
+	return ticket
+}
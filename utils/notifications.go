@@ -0,0 +1,384 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Delivery modes a user can choose for every notification kind
+const (
+	NotificationImmediate = "immediate"
+	NotificationDigest    = "digest"
+	NotificationOff       = "off"
+)
+
+// Kinds of notifications editors can receive
+const (
+	NotificationAssignment    = "assignment"
+	NotificationCustomerReply = "customerReply"
+	NotificationSLAWarning    = "slaWarning"
+	NotificationMention       = "mention"
+)
+
+// Empty modes are treated as immediate notifications
+type NotificationSettings struct {
+	Assignment    string `xml:"Assignment"`
+	CustomerReply string `xml:"CustomerReply"`
+	SLAWarning    string `xml:"SLAWarning"`
+	Mention       string `xml:"Mention"`
+}
+
+type Notification struct {
+	Username     string    `xml:"Username"`
+	Kind         string    `xml:"Kind"`
+	TicketID     int       `xml:"TicketID"`
+	Subject      string    `xml:"Subject"`
+	Message      string    `xml:"Message"`
+	CreationDate time.Time `xml:"CreationDate"`
+}
+
+// Remembers the customer message an SLA warning was sent for, so every message is only warned about once
+type SLAWarning struct {
+	TicketID    int       `xml:"TicketID"`
+	MessageDate time.Time `xml:"MessageDate"`
+}
+
+type NotificationList struct {
+	Pending     []Notification `xml:"pending>notification"`
+	SLAWarnings []SLAWarning   `xml:"slaWarnings>warning"`
+}
+
+var mutexNotifications = &sync.Mutex{}
+
+var registerNotificationsOnce = &sync.Once{}
+
+// Mentions have to start a word, so email addresses in the text are not treated as mentions
+var mentionRegExp = regexp.MustCompile(`(?:^|\s)@([A-Za-z0-9_-]+)`)
+
+// Returns the mode the user chose for the notification kind
+func (settings NotificationSettings) Mode(kind string) string {
+	var mode string
+	switch kind {
+	case NotificationAssignment:
+		mode = settings.Assignment
+	case NotificationCustomerReply:
+		mode = settings.CustomerReply
+	case NotificationSLAWarning:
+		mode = settings.SLAWarning
+	case NotificationMention:
+		mode = settings.Mention
+	}
+
+	if mode == "" {
+		return NotificationImmediate
+	}
+	return mode
+}
+
+// Describes the mode of every notification kind, e.g. for the audit log
+func (settings NotificationSettings) String() string {
+	return NotificationAssignment + ": " + settings.Mode(NotificationAssignment) + ", " + NotificationCustomerReply + ": " +
+		settings.Mode(NotificationCustomerReply) + ", " + NotificationSLAWarning + ": " + settings.Mode(NotificationSLAWarning) + ", " +
+		NotificationMention + ": " + settings.Mode(NotificationMention)
+}
+
+// Checks if the mode is one of the known notification modes
+func IsNotificationMode(mode string) bool {
+	return mode == NotificationImmediate || mode == NotificationDigest || mode == NotificationOff
+}
+
+// Subscribes the editor notifications to the ticket events. Calling it more than once has no effect
+func RegisterNotifications() {
+	registerNotificationsOnce.Do(func() {
+		SubscribeEvents(notifyEditors)
+	})
+}
+
+// Notifies the editors which are affected by the event, but never the actor who caused it
+func notifyEditors(event Event) {
+	ticket := event.Ticket
+
+	switch event.Type {
+	case EventTicketAssigned:
+		if ticket.Editor != "" && ticket.Editor != event.Actor {
+			notify(ticket.Editor, NotificationAssignment, ticket.ID, fmt.Sprintf("Ticket %d was assigned to you", ticket.ID),
+				fmt.Sprintf("%s assigned the ticket \"%s\" (ID: %d) to you.", event.Actor, ticket.Reference, ticket.ID))
+		}
+	case EventTicketCommented:
+		if len(ticket.MessageList) == 0 {
+			return
+		}
+		message := ticket.MessageList[len(ticket.MessageList)-1]
+
+		if event.Actor == ticket.Client && ticket.Editor != "" {
+			notify(ticket.Editor, NotificationCustomerReply, ticket.ID, fmt.Sprintf("The customer replied to ticket %d", ticket.ID),
+				fmt.Sprintf("%s replied to the ticket \"%s\" (ID: %d):\n\n%s", ticket.Client, ticket.Reference, ticket.ID, message.Text))
+		}
+
+		if message.Type == MessageTypeNote {
+			for _, username := range Mentions(message.Text) {
+				if username == event.Actor {
+					continue
+				}
+				notify(username, NotificationMention, ticket.ID, fmt.Sprintf("You were mentioned in ticket %d", ticket.ID),
+					fmt.Sprintf("%s mentioned you in the ticket \"%s\" (ID: %d):\n\n%s", event.Actor, ticket.Reference, ticket.ID, message.Text))
+			}
+		}
+	}
+}
+
+// Returns the distinct usernames which are mentioned with an @ in the text
+func Mentions(text string) []string {
+	var usernames []string
+	found := make(map[string]bool)
+	for _, match := range mentionRegExp.FindAllStringSubmatch(text, -1) {
+		if !found[match[1]] {
+			found[match[1]] = true
+			usernames = append(usernames, match[1])
+		}
+	}
+
+	return usernames
+}
+
+// Sends the notification right away or keeps it for the digest, depending on the preferences of the user.
+// Users without an email address are not notified
+func notify(username string, kind string, ticketID int, subject string, message string) {
+	users, err := ReadUsers()
+	if err != nil {
+		return
+	}
+
+	user, ok := users[username]
+	if !ok || user.Email == "" {
+		return
+	}
+
+	switch user.Notifications.Mode(kind) {
+	case NotificationImmediate:
+		err = SendMail(user.Email, subject, message)
+	case NotificationDigest:
+		err = addPendingNotification(Notification{Username: username, Kind: kind, TicketID: ticketID, Subject: subject, Message: message, CreationDate: time.Now()})
+	}
+	if err != nil {
+		log.Printf("Couldn't notify %s about ticket %d: %v\n", username, ticketID, err)
+	}
+}
+
+func addPendingNotification(notification Notification) error {
+	mutexNotifications.Lock()
+	defer mutexNotifications.Unlock()
+
+	notificationList, err := ReadNotifications()
+	if err != nil {
+		return err
+	}
+
+	notificationList.Pending = append(notificationList.Pending, notification)
+	return WriteToXML(notificationList, config.NotificationsFilePath())
+}
+
+// Sends the due SLA warnings and digests. It is called periodically by the server
+func ProcessNotifications(now time.Time) error {
+	err := checkSLAWarnings(now)
+	if err != nil {
+		return err
+	}
+
+	err = pruneSLAWarnings()
+	if err != nil {
+		return err
+	}
+
+	return sendDueDigests(now)
+}
+
+// Warns the editors of tickets in process whose last customer message has not been answered in time
+func checkSLAWarnings(now time.Time) error {
+	if config.SLAWarningAfter <= 0 {
+		return nil
+	}
+
+	for _, ticket := range GetTicketsByStatus(TicketStatusInProcess) {
+		message, ok := lastPublicMessage(ticket)
+		if !ok || message.Type != MessageTypeCustomer || now.Sub(message.CreationDate) < config.SLAWarningAfter {
+			continue
+		}
+
+		warned, err := markSLAWarning(SLAWarning{TicketID: ticket.ID, MessageDate: message.CreationDate})
+		if err != nil {
+			return err
+		}
+		if warned {
+			continue
+		}
+
+		notify(ticket.Editor, NotificationSLAWarning, ticket.ID, fmt.Sprintf("Ticket %d is waiting for an answer", ticket.ID),
+			fmt.Sprintf("The customer is waiting for an answer on the ticket \"%s\" (ID: %d) since %s.",
+				ticket.Reference, ticket.ID, message.CreationDate.Format("2006-01-02 15:04")))
+	}
+
+	return nil
+}
+
+// Returns the last message of the ticket which was exchanged with the customer
+func lastPublicMessage(ticket Ticket) (Message, bool) {
+	for i := len(ticket.MessageList) - 1; i >= 0; i-- {
+		if ticket.MessageList[i].IsPublic() {
+			return ticket.MessageList[i], true
+		}
+	}
+
+	return Message{}, false
+}
+
+// Records the SLA warning and returns whether it was already recorded before
+func markSLAWarning(warning SLAWarning) (bool, error) {
+	mutexNotifications.Lock()
+	defer mutexNotifications.Unlock()
+
+	notificationList, err := ReadNotifications()
+	if err != nil {
+		return false, err
+	}
+
+	for _, actWarning := range notificationList.SLAWarnings {
+		if actWarning.TicketID == warning.TicketID && actWarning.MessageDate.Equal(warning.MessageDate) {
+			return true, nil
+		}
+	}
+
+	notificationList.SLAWarnings = append(notificationList.SLAWarnings, warning)
+	return false, WriteToXML(notificationList, config.NotificationsFilePath())
+}
+
+// Removes the warnings of deleted, closed and answered tickets. They can't be warned about again, so the warnings
+// are only kept while the customer message is still waiting for an answer
+func pruneSLAWarnings() error {
+	mutexNotifications.Lock()
+	defer mutexNotifications.Unlock()
+
+	notificationList, err := ReadNotifications()
+	if err != nil {
+		return err
+	}
+
+	var current []SLAWarning
+	for _, warning := range notificationList.SLAWarnings {
+		ticket, err := ReadTicket(warning.TicketID)
+		if err != nil || ticket.Status == TicketStatusClosed {
+			continue
+		}
+		message, ok := lastPublicMessage(ticket)
+		if ok && message.Type == MessageTypeCustomer && message.CreationDate.Equal(warning.MessageDate) {
+			current = append(current, warning)
+		}
+	}
+	if len(current) == len(notificationList.SLAWarnings) {
+		return nil
+	}
+
+	notificationList.SLAWarnings = current
+	return WriteToXML(notificationList, config.NotificationsFilePath())
+}
+
+// Sends one digest mail to every user whose oldest pending notification is older than the digest interval
+func sendDueDigests(now time.Time) error {
+	mutexNotifications.Lock()
+	defer mutexNotifications.Unlock()
+
+	notificationList, err := ReadNotifications()
+	if err != nil {
+		return err
+	}
+
+	pendingByUser := make(map[string][]Notification)
+	var usernames []string
+	for _, notification := range notificationList.Pending {
+		if _, ok := pendingByUser[notification.Username]; !ok {
+			usernames = append(usernames, notification.Username)
+		}
+		pendingByUser[notification.Username] = append(pendingByUser[notification.Username], notification)
+	}
+
+	users, err := ReadUsers()
+	if err != nil {
+		return err
+	}
+
+	var remaining []Notification
+	for _, username := range usernames {
+		pending := pendingByUser[username]
+		if now.Sub(pending[0].CreationDate) < config.DigestInterval {
+			remaining = append(remaining, pending...)
+			continue
+		}
+
+		// Users who removed their email address in the meantime lose their pending notifications
+		if users[username].Email == "" {
+			continue
+		}
+
+		err = SendMail(users[username].Email, "Your notification digest ("+strconv.Itoa(len(pending))+")", digestMessage(pending))
+		if err != nil {
+			remaining = append(remaining, pending...)
+		}
+	}
+
+	notificationList.Pending = remaining
+	return WriteToXML(notificationList, config.NotificationsFilePath())
+}
+
+func digestMessage(notifications []Notification) string {
+	var parts []string
+	for _, notification := range notifications {
+		parts = append(parts, notification.CreationDate.Format("2006-01-02 15:04")+" - "+notification.Subject+"\n"+notification.Message)
+	}
+
+	return strings.Join(parts, "\n\n----------\n\n")
+}
+
+// Returns the pending digest notifications and the sent SLA warnings
+func ReadNotifications() (NotificationList, error) {
+	file, err := ioutil.ReadFile(config.NotificationsFilePath())
+	if err != nil {
+		return NotificationList{}, err
+	}
+
+	var notificationList NotificationList
+	err = xml.Unmarshal(file, &notificationList)
+	if err != nil {
+		return NotificationList{}, err
+	}
+
+	return notificationList, nil
+}
+
+// Processes the notifications in the configured interval until the done channel is closed
+func StartNotificationProcessing(done <-chan bool) {
+	ticker := time.NewTicker(config.NotificationInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				err := ProcessNotifications(now)
+				if err != nil {
+					log.Printf("Couldn't process the notifications: %v\n", err)
+				}
+			}
+		}
+	}()
+}
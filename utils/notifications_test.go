@@ -0,0 +1,191 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNotificationSettingsMode(t *testing.T) {
+	settings := NotificationSettings{Assignment: NotificationDigest, Mention: NotificationOff}
+
+	assert.Equal(t, NotificationDigest, settings.Mode(NotificationAssignment))
+	assert.Equal(t, NotificationImmediate, settings.Mode(NotificationCustomerReply))
+	assert.Equal(t, NotificationImmediate, settings.Mode(NotificationSLAWarning))
+	assert.Equal(t, NotificationOff, settings.Mode(NotificationMention))
+
+	assert.True(t, IsNotificationMode(NotificationDigest))
+	assert.False(t, IsNotificationMode(""))
+	assert.False(t, IsNotificationMode("weekly"))
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"@Test123 please have a look", []string{"Test123"}},
+		{"Asked @Test123 and @Other_1, @Test123 will answer", []string{"Test123", "Other_1"}},
+		{"Forwarded to support@dhbw.de", nil},
+		{"No mentions here", nil},
+	}
+	for _, d := range tests {
+		assert.Equal(t, d.expected, Mentions(d.text))
+	}
+}
+
+func TestNotifyEditors(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateUser("Test123", "Aa!123456")
+	assert.Nil(t, err)
+	assert.Nil(t, SetUserEmail("Test123", "test123@dhbw.de"))
+	_, err = CreateUser("NoMail", "Aa!123456")
+	assert.Nil(t, err)
+
+	ticket, err := CreateTicket("client@dhbw.de", "Subject", "Text")
+	assert.Nil(t, err)
+	ticket.Editor = "Test123"
+
+	// Assigning a ticket to yourself does not notify anyone
+	notifyEditors(Event{Type: EventTicketAssigned, Ticket: ticket, Actor: "Test123"})
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mailList.MailList))
+
+	notifyEditors(Event{Type: EventTicketAssigned, Ticket: ticket, Actor: "Admin1"})
+	ticket.MessageList = append(ticket.MessageList, Message{Actor: "client@dhbw.de", Text: "Any news?", Type: MessageTypeCustomer})
+	notifyEditors(Event{Type: EventTicketCommented, Ticket: ticket, Actor: "client@dhbw.de"})
+	ticket.MessageList = append(ticket.MessageList, Message{Actor: "Admin1", Text: "@Test123 @NoMail @Unknown see above", Type: MessageTypeNote})
+	notifyEditors(Event{Type: EventTicketCommented, Ticket: ticket, Actor: "Admin1"})
+
+	mailList, err = ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(mailList.MailList))
+	for _, mail := range mailList.MailList {
+		assert.Equal(t, "test123@dhbw.de", mail.Mail)
+	}
+	assert.Equal(t, "Ticket 1 was assigned to you", mailList.MailList[0].Subject)
+	assert.Equal(t, "The customer replied to ticket 1", mailList.MailList[1].Subject)
+	assert.Equal(t, "You were mentioned in ticket 1", mailList.MailList[2].Subject)
+
+	// Notifications which are turned off are not sent
+	assert.Nil(t, SetUserNotificationSettings("Test123", NotificationSettings{Assignment: NotificationOff}))
+	notifyEditors(Event{Type: EventTicketAssigned, Ticket: ticket, Actor: "Admin1"})
+	mailList, err = ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(mailList.MailList))
+}
+
+func TestNotificationDigest(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateUser("Test123", "Aa!123456")
+	assert.Nil(t, err)
+	assert.Nil(t, SetUserEmail("Test123", "test123@dhbw.de"))
+	assert.Nil(t, SetUserNotificationSettings("Test123", NotificationSettings{Assignment: NotificationDigest}))
+
+	ticket := Ticket{ID: 1, Client: "client@dhbw.de", Reference: "Subject", Editor: "Test123"}
+	notifyEditors(Event{Type: EventTicketAssigned, Ticket: ticket, Actor: "Admin1"})
+	ticket.ID = 2
+	notifyEditors(Event{Type: EventTicketAssigned, Ticket: ticket, Actor: "Admin1"})
+
+	notificationList, err := ReadNotifications()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(notificationList.Pending))
+
+	// The digest is not due yet
+	assert.Nil(t, ProcessNotifications(time.Now()))
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mailList.MailList))
+
+	assert.Nil(t, ProcessNotifications(time.Now().Add(config.DigestInterval)))
+	mailList, err = ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Equal(t, "Your notification digest (2)", mailList.MailList[0].Subject)
+	assert.Contains(t, mailList.MailList[0].Message, "Ticket 1 was assigned to you")
+	assert.Contains(t, mailList.MailList[0].Message, "Ticket 2 was assigned to you")
+
+	notificationList, err = ReadNotifications()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(notificationList.Pending))
+}
+
+func TestSLAWarnings(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateUser("Test123", "Aa!123456")
+	assert.Nil(t, err)
+	assert.Nil(t, SetUserEmail("Test123", "test123@dhbw.de"))
+
+	ticket, err := CreateTicket("client@dhbw.de", "Subject", "Text")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeEditor(ticket.ID, "Test123"))
+	assert.Nil(t, ChangeStatus(ticket.ID, TicketStatusInProcess))
+
+	// Not due yet
+	assert.Nil(t, ProcessNotifications(time.Now()))
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mailList.MailList))
+
+	// The warning is only sent once for the same customer message
+	later := time.Now().Add(config.SLAWarningAfter + time.Minute)
+	assert.Nil(t, ProcessNotifications(later))
+	assert.Nil(t, ProcessNotifications(later.Add(time.Hour)))
+	mailList, err = ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Equal(t, "Ticket 1 is waiting for an answer", mailList.MailList[0].Subject)
+
+	// Answered tickets are not warned about
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	_, err = AddReply(ticket, "Test123", "Answer")
+	assert.Nil(t, err)
+	assert.Nil(t, ProcessNotifications(later.Add(2*config.SLAWarningAfter)))
+	mailList, err = ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(mailList.MailList))
+	assert.Equal(t, "[Ticket #1] Re: Subject", mailList.MailList[1].Subject)
+
+	// The warning of the answered message is not kept
+	notificationList, err := ReadNotifications()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(notificationList.SLAWarnings))
+}
+
+func TestPruneSLAWarnings(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ids := createTickets(t, "Outage", "Printer broken", "No internet")
+	var warnings []SLAWarning
+	for _, id := range ids {
+		ticket, err := ReadTicket(id)
+		assert.Nil(t, err)
+		warnings = append(warnings, SLAWarning{TicketID: id, MessageDate: ticket.MessageList[0].CreationDate})
+	}
+	warnings = append(warnings, SLAWarning{TicketID: 1000, MessageDate: time.Now()})
+	assert.Nil(t, WriteToXML(NotificationList{SLAWarnings: warnings}, config.NotificationsFilePath()))
+
+	// Only the warning of the ticket which is still waiting for an answer is kept
+	assert.Nil(t, ChangeStatus(ids[0], TicketStatusClosed))
+	ticket, err := ReadTicket(ids[1])
+	assert.Nil(t, err)
+	_, err = AddReply(ticket, "Anna", "Answer")
+	assert.Nil(t, err)
+	assert.Nil(t, pruneSLAWarnings())
+
+	notificationList, err := ReadNotifications()
+	assert.Nil(t, err)
+	assert.Equal(t, []SLAWarning{warnings[2]}, notificationList.SLAWarnings)
+}
@@ -0,0 +1,207 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Purposes of the portal tokens, so a token can only be used for what it was issued for
+const (
+	PortalTokenLink    = "link"
+	PortalTokenSession = "session"
+)
+
+// Access links which were already used, they are kept until they expire
+type PortalLinkList struct {
+	XMLName   xml.Name         `xml:"PortalLinks"`
+	UsedLinks []UsedPortalLink `xml:"links>link"`
+}
+
+type UsedPortalLink struct {
+	Nonce      string    `xml:"Nonce"`
+	ExpiryDate time.Time `xml:"ExpiryDate"`
+}
+
+var mutexPortalLinks = &sync.Mutex{}
+
+var generatedPortalSecret string
+
+var generatePortalSecretOnce = &sync.Once{}
+
+// Returns the configured secret or a random one which is valid until the server restarts
+func portalSecret() string {
+	if config.PortalSecret != "" {
+		return config.PortalSecret
+	}
+
+	generatePortalSecretOnce.Do(func() {
+		buf := make([]byte, 32)
+		_, err := rand.Read(buf)
+		if err != nil {
+			panic(err)
+		}
+		generatedPortalSecret = hex.EncodeToString(buf)
+	})
+	return generatedPortalSecret
+}
+
+// Creates a signed token which grants access to the tickets of the client until it expires. Every token gets a random
+// nonce, so access links can be redeemed only once
+func CreatePortalToken(client string, purpose string, validity time.Duration) string {
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		panic(err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(client)) + "." + purpose + "." +
+		strconv.FormatInt(time.Now().Add(validity).Unix(), 10) + "." + hex.EncodeToString(nonce)
+	return payload + "." + signPortalPayload(payload)
+}
+
+// Returns the client of the token if it is correctly signed, issued for the purpose and not expired yet
+func VerifyPortalToken(token string, purpose string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return "", fmt.Errorf("malformed portal token")
+	}
+
+	payload := strings.Join(parts[:4], ".")
+	if !hmac.Equal([]byte(parts[4]), []byte(signPortalPayload(payload))) {
+		return "", fmt.Errorf("invalid portal token signature")
+	}
+
+	if parts[1] != purpose {
+		return "", fmt.Errorf("the portal token was issued for another purpose")
+	}
+
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", err
+	}
+	if time.Now().Unix() > expiry {
+		return "", fmt.Errorf("the portal token is expired")
+	}
+
+	client, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", err
+	}
+
+	return string(client), nil
+}
+
+// Returns the client of the access link and marks the link as used, so a leaked link can't be used again
+func RedeemPortalLink(token string) (string, error) {
+	client, err := VerifyPortalToken(token, PortalTokenLink)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(token, ".")
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", err
+	}
+
+	mutexPortalLinks.Lock()
+	defer mutexPortalLinks.Unlock()
+
+	linkList, err := readPortalLinks()
+	if err != nil {
+		return "", err
+	}
+
+	// Expired links are rejected by their signature anyway, hence they don't need to be kept
+	var usedLinks []UsedPortalLink
+	for _, link := range linkList.UsedLinks {
+		if link.Nonce == parts[3] {
+			return "", fmt.Errorf("the portal link was already used")
+		}
+		if time.Now().Before(link.ExpiryDate) {
+			usedLinks = append(usedLinks, link)
+		}
+	}
+	linkList.UsedLinks = append(usedLinks, UsedPortalLink{Nonce: parts[3], ExpiryDate: time.Unix(expiry, 0)})
+
+	return client, WriteToXML(linkList, config.PortalLinksFilePath())
+}
+
+func readPortalLinks() (PortalLinkList, error) {
+	file, err := ioutil.ReadFile(config.PortalLinksFilePath())
+	if err != nil {
+		return PortalLinkList{}, err
+	}
+
+	var linkList PortalLinkList
+	err = xml.Unmarshal(file, &linkList)
+	return linkList, err
+}
+
+func signPortalPayload(payload string) string {
+	mac := hmac.New(sha256.New, []byte(portalSecret()))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Queues a mail with a magic link to the customer portal. The link always points to the configured URL of the server,
+// never to the host of the request, so a forged request can't send the token elsewhere. Clients without tickets do not
+// get a mail
+func SendPortalLink(client string) error {
+	if len(GetTicketsByClient(client)) == 0 {
+		return nil
+	}
+
+	token := CreatePortalToken(client, PortalTokenLink, config.PortalLinkValidity)
+	message := "Please use the following link to access your tickets. The link is valid for " +
+		config.PortalLinkValidity.String() + ".\n\n" + config.ServerURL() + "/portal/login?token=" + token
+
+	return SendMail(client, "Access to your tickets", message)
+}
+
+// Returns the ticket if it belongs to the client
+func ReadClientTicket(client string, id int) (Ticket, error) {
+	ticket, err := ReadTicket(id)
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	if ticket.Client != client {
+		return Ticket{}, fmt.Errorf("the ticket does not belong to the client")
+	}
+
+	return ticket, nil
+}
+
+// Returns a copy of the ticket which only contains the messages the customer is allowed to see
+func PublicTicket(ticket Ticket) Ticket {
+	var messages []Message
+	for _, message := range ticket.MessageList {
+		if message.IsPublic() {
+			messages = append(messages, message)
+		}
+	}
+
+	ticket.MessageList = messages
+	return ticket
+}
+
+// Returns the status a ticket gets when it is reopened. Tickets keep their editor if they already had one
+func ReopenedStatus(ticket Ticket) int {
+	if ticket.Editor != "" {
+		return TicketStatusInProcess
+	}
+	return TicketStatusOpen
+}
@@ -0,0 +1,131 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPortalToken(t *testing.T) {
+	token := CreatePortalToken("client@dhbw.de", PortalTokenLink, time.Minute)
+	client, err := VerifyPortalToken(token, PortalTokenLink)
+	assert.Nil(t, err)
+	assert.Equal(t, "client@dhbw.de", client)
+
+	// Tokens can only be used for their purpose
+	_, err = VerifyPortalToken(token, PortalTokenSession)
+	assert.NotNil(t, err)
+
+	// Expired tokens
+	expiredToken := CreatePortalToken("client@dhbw.de", PortalTokenLink, -time.Minute)
+	_, err = VerifyPortalToken(expiredToken, PortalTokenLink)
+	assert.NotNil(t, err)
+
+	// Tampered tokens
+	parts := strings.Split(token, ".")
+	parts[0] = "b3RoZXJAZGhidy5kZQ"
+	_, err = VerifyPortalToken(strings.Join(parts, "."), PortalTokenLink)
+	assert.NotNil(t, err)
+
+	_, err = VerifyPortalToken("", PortalTokenLink)
+	assert.NotNil(t, err)
+	_, err = VerifyPortalToken("a.b.c.d.e", PortalTokenLink)
+	assert.NotNil(t, err)
+
+	// Every token is unique, even for the same client and expiry
+	assert.NotEqual(t, token, CreatePortalToken("client@dhbw.de", PortalTokenLink, time.Minute))
+}
+
+func TestRedeemPortalLink(t *testing.T) {
+	setup()
+	defer teardown()
+
+	token := CreatePortalToken("client@dhbw.de", PortalTokenLink, time.Minute)
+	client, err := RedeemPortalLink(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "client@dhbw.de", client)
+	_, err = RedeemPortalLink(token)
+	assert.NotNil(t, err)
+
+	// Session tokens are no access links
+	_, err = RedeemPortalLink(CreatePortalToken("client@dhbw.de", PortalTokenSession, time.Minute))
+	assert.NotNil(t, err)
+
+	// Used links are forgotten once they expired
+	linkList, err := readPortalLinks()
+	assert.Nil(t, err)
+	linkList.UsedLinks[0].ExpiryDate = time.Now().Add(-time.Second)
+	assert.Nil(t, WriteToXML(linkList, config.PortalLinksFilePath()))
+	_, err = RedeemPortalLink(CreatePortalToken("client@dhbw.de", PortalTokenLink, time.Minute))
+	assert.Nil(t, err)
+	linkList, err = readPortalLinks()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(linkList.UsedLinks))
+}
+
+func TestPortalTokenSecret(t *testing.T) {
+	config.PortalSecret = "firstSecret"
+	token := CreatePortalToken("client@dhbw.de", PortalTokenLink, time.Minute)
+	config.PortalSecret = "secondSecret"
+	defer func() { config.PortalSecret = "" }()
+
+	_, err := VerifyPortalToken(token, PortalTokenLink)
+	assert.NotNil(t, err)
+}
+
+func TestSendPortalLink(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Unknown clients do not get a mail
+	assert.Nil(t, SendPortalLink("client@dhbw.de"))
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mailList.MailList))
+
+	_, err = CreateTicket("client@dhbw.de", "PC problem", "PC does not start anymore. Any idea?")
+	assert.Nil(t, err)
+	assert.Nil(t, SendPortalLink("client@dhbw.de"))
+	mailList, err = ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Equal(t, "client@dhbw.de", mailList.MailList[0].Mail)
+	assert.Contains(t, mailList.MailList[0].Message, "https://localhost:4443/portal/login?token=")
+}
+
+func TestReadClientTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "PC does not start anymore. Any idea?")
+	assert.Nil(t, err)
+
+	_, err = ReadClientTicket("client@dhbw.de", ticket.ID)
+	assert.Nil(t, err)
+	_, err = ReadClientTicket("other@dhbw.de", ticket.ID)
+	assert.NotNil(t, err)
+	_, err = ReadClientTicket("client@dhbw.de", 1337)
+	assert.NotNil(t, err)
+}
+
+func TestPublicTicket(t *testing.T) {
+	ticket := Ticket{ID: 1, MessageList: []Message{
+		{Text: "Help", Type: MessageTypeCustomer},
+		{Text: "Internal", Type: MessageTypeNote},
+		{Text: "Answer", Type: MessageTypeReply},
+		{Text: "Reopened", Type: MessageTypeSystem},
+	}}
+
+	publicTicket := PublicTicket(ticket)
+	assert.Equal(t, []Message{{Text: "Help", Type: MessageTypeCustomer}, {Text: "Answer", Type: MessageTypeReply}}, publicTicket.MessageList)
+	assert.Equal(t, 4, len(ticket.MessageList))
+}
+
+func TestReopenedStatus(t *testing.T) {
+	assert.Equal(t, TicketStatusOpen, ReopenedStatus(Ticket{Status: TicketStatusClosed}))
+	assert.Equal(t, TicketStatusInProcess, ReopenedStatus(Ticket{Status: TicketStatusClosed, Editor: "Test123"}))
+}
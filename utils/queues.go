@@ -0,0 +1,324 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Queue of the tickets of a team. Tickets without a queue (ID 0) are visible to all editors
+type Queue struct {
+	ID      int      `xml:"ID"`
+	Name    string   `xml:"Name"`
+	Address string   `xml:"Address"` // Recipient address of the inbound mails which are routed to the queue
+	Members []string `xml:"Members>Member"`
+}
+
+type QueueList struct {
+	QueueIDCounter int     `xml:"QueueIDCounter"`
+	Queues         []Queue `xml:"queues>queue"`
+}
+
+var mutexQueues = &sync.Mutex{}
+
+func (queue Queue) HasMember(username string) bool {
+	for _, member := range queue.Members {
+		if member == username {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the members separated by commas like they are entered in the form
+func (queue Queue) MembersText() string {
+	return strings.Join(queue.Members, ", ")
+}
+
+// Returns the name of the queue the ticket belongs to or an empty string if it belongs to none
+func (ticket Ticket) QueueName() string {
+	return QueueName(ticket.Queue)
+}
+
+func QueueName(id int) string {
+	if id == 0 {
+		return ""
+	}
+
+	queue, err := GetQueue(id)
+	if err != nil {
+		return strconv.Itoa(id)
+	}
+	return queue.Name
+}
+
+// Checks if the user is allowed to see and edit the ticket. Only the members of a queue and administrators can access its tickets
+func CanAccessTicket(user User, ticket Ticket) bool {
+	return CanAccessQueue(user, ticket.Queue)
+}
+
+func CanAccessQueue(user User, id int) bool {
+	if id == 0 || user.IsAdmin() {
+		return true
+	}
+
+	queue, err := GetQueue(id)
+	return err == nil && queue.HasMember(user.Username)
+}
+
+// Returns the queues the user is a member of, administrators get all queues
+func GetQueuesForUser(user User) ([]Queue, error) {
+	queueList, err := ReadQueues()
+	if err != nil {
+		return nil, err
+	}
+
+	var queues []Queue
+	for _, queue := range queueList.Queues {
+		if user.IsAdmin() || queue.HasMember(user.Username) {
+			queues = append(queues, queue)
+		}
+	}
+	return queues, nil
+}
+
+// Checks the name and the address of the queue, they must be unique
+func validateQueue(queue Queue, queues []Queue) error {
+	if strings.TrimSpace(queue.Name) == "" {
+		return fmt.Errorf("a queue needs a name")
+	}
+	if queue.Address != "" && !CheckMailFormal(queue.Address) {
+		return fmt.Errorf("the address %s is invalid", queue.Address)
+	}
+
+	for _, other := range queues {
+		if other.ID == queue.ID {
+			continue
+		}
+		if strings.EqualFold(other.Name, queue.Name) {
+			return fmt.Errorf("the queue %s already exists", queue.Name)
+		}
+		if queue.Address != "" && strings.EqualFold(other.Address, queue.Address) {
+			return fmt.Errorf("the address %s is already used by the queue %s", queue.Address, other.Name)
+		}
+	}
+
+	return nil
+}
+
+// Creates a new queue with the specified members
+func CreateQueue(queue Queue) (Queue, error) {
+	mutexQueues.Lock()
+	defer mutexQueues.Unlock()
+
+	queueList, err := ReadQueues()
+	if err != nil {
+		return Queue{}, err
+	}
+
+	queue.ID = queueList.QueueIDCounter + 1
+	err = validateQueue(queue, queueList.Queues)
+	if err != nil {
+		return Queue{}, err
+	}
+
+	queueList.QueueIDCounter++
+	queueList.Queues = append(queueList.Queues, queue)
+	return queue, WriteToXML(queueList, config.QueuesFilePath())
+}
+
+// Changes the name, the address and the members of the queue with the same ID
+func UpdateQueue(queue Queue) (Queue, error) {
+	err := changeQueues(func(queues []Queue) ([]Queue, error) {
+		i, err := findQueue(queues, queue.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateQueue(queue, queues)
+		if err != nil {
+			return nil, err
+		}
+
+		queues[i] = queue
+		return queues, nil
+	})
+
+	return queue, err
+}
+
+// Removes a queue. Queues which still contain tickets can't be removed
+func DeleteQueue(id int) error {
+	for _, actualID := range storedTicketIDs() {
+		ticket, err := ReadTicket(actualID)
+		if err == nil && ticket.Queue == id {
+			return fmt.Errorf("the queue still contains ticket %d", ticket.ID)
+		}
+	}
+
+	return changeQueues(func(queues []Queue) ([]Queue, error) {
+		i, err := findQueue(queues, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(queues[:i], queues[i+1:]...), nil
+	})
+}
+
+// Moves the ticket into another queue and records it in the ticket. The editor keeps the ticket only
+// if they are a member of the new queue, otherwise it is released
+func MoveTicket(ticket Ticket, queueID int, actor string) (Ticket, error) {
+	var queue Queue
+	if queueID != 0 {
+		var err error
+		queue, err = GetQueue(queueID)
+		if err != nil {
+			return ticket, err
+		}
+	}
+	if ticket.Queue == queueID {
+		return ticket, nil
+	}
+
+	from := ticket.QueueName()
+	if from == "" {
+		from = "no queue"
+	}
+	to := queue.Name
+	if to == "" {
+		to = "no queue"
+	}
+
+	ticket, err := AddSystemMessage(ticket, fmt.Sprintf("Moved from %s to %s by %s", from, to, actor))
+	if err != nil {
+		return ticket, err
+	}
+
+	ticket.Queue = queueID
+	if ticket.Editor != "" && queueID != 0 && !queue.HasMember(ticket.Editor) {
+		ticket.Editor = ""
+		if ticket.Status == TicketStatusInProcess {
+			ticket.Status = TicketStatusOpen
+		}
+	}
+
+	return ticket, StoreTicket(ticket)
+}
+
+// Puts a new ticket into the queue of the recipient address. Tickets to unknown addresses stay without a queue
+func routeTicketByRecipient(ticket Ticket, recipient string) (Ticket, error) {
+	if recipient == "" {
+		return ticket, nil
+	}
+
+	queueList, err := ReadQueues()
+	if err != nil {
+		return ticket, err
+	}
+	for _, queue := range queueList.Queues {
+		if queue.Address != "" && strings.EqualFold(queue.Address, recipient) {
+			return MoveTicket(ticket, queue.ID, SystemActor)
+		}
+	}
+
+	return ticket, nil
+}
+
+// Applies the change to the stored queues while holding the lock
+func changeQueues(change func(queues []Queue) ([]Queue, error)) error {
+	mutexQueues.Lock()
+	defer mutexQueues.Unlock()
+
+	queueList, err := ReadQueues()
+	if err != nil {
+		return err
+	}
+
+	queueList.Queues, err = change(queueList.Queues)
+	if err != nil {
+		return err
+	}
+
+	return WriteToXML(queueList, config.QueuesFilePath())
+}
+
+func findQueue(queues []Queue, id int) (int, error) {
+	for i, queue := range queues {
+		if queue.ID == id {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("couldn't find the queue")
+}
+
+// Returns the queue with the specified ID
+func GetQueue(id int) (Queue, error) {
+	queueList, err := ReadQueues()
+	if err != nil {
+		return Queue{}, err
+	}
+
+	i, err := findQueue(queueList.Queues, id)
+	if err != nil {
+		return Queue{}, err
+	}
+
+	return queueList.Queues[i], nil
+}
+
+// Returns the queue with the specified name, the case is ignored
+func GetQueueByName(name string) (Queue, error) {
+	queueList, err := ReadQueues()
+	if err != nil {
+		return Queue{}, err
+	}
+
+	for _, queue := range queueList.Queues {
+		if strings.EqualFold(queue.Name, name) {
+			return queue, nil
+		}
+	}
+
+	return Queue{}, fmt.Errorf("couldn't find the queue %s", name)
+}
+
+// Splits the comma separated usernames and removes duplicates
+func ParseQueueMembers(text string) []string {
+	var members []string
+	seen := make(map[string]bool)
+	for _, member := range strings.Split(text, ",") {
+		member = strings.TrimSpace(member)
+		if member != "" && !seen[member] {
+			seen[member] = true
+			members = append(members, member)
+		}
+	}
+
+	sort.Strings(members)
+	return members
+}
+
+// Returns all stored queues
+func ReadQueues() (QueueList, error) {
+	file, err := ioutil.ReadFile(config.QueuesFilePath())
+	if err != nil {
+		return QueueList{}, err
+	}
+
+	var queueList QueueList
+	err = xml.Unmarshal(file, &queueList)
+	if err != nil {
+		return QueueList{}, err
+	}
+
+	return queueList, nil
+}
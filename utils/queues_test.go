@@ -0,0 +1,162 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseQueueMembers(t *testing.T) {
+	assert.Equal(t, []string{"Anna", "Bert"}, ParseQueueMembers(" Bert, Anna,,Bert "))
+	assert.Nil(t, ParseQueueMembers(""))
+}
+
+func TestQueueStorage(t *testing.T) {
+	setup()
+	defer teardown()
+
+	queue, err := CreateQueue(Queue{Name: "Billing", Address: "billing@dhbw.de", Members: []string{"Anna"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, queue.ID)
+
+	// Names and addresses must be unique
+	_, err = CreateQueue(Queue{Name: "billing"})
+	assert.NotNil(t, err)
+	_, err = CreateQueue(Queue{Name: "Sales", Address: "Billing@dhbw.de"})
+	assert.NotNil(t, err)
+	_, err = CreateQueue(Queue{Name: "Sales", Address: "no address"})
+	assert.NotNil(t, err)
+	_, err = CreateQueue(Queue{Name: " "})
+	assert.NotNil(t, err)
+
+	queue.Members = []string{"Anna", "Bert"}
+	_, err = UpdateQueue(queue)
+	assert.Nil(t, err)
+	queue, err = GetQueueByName("BILLING")
+	assert.Nil(t, err)
+	assert.Equal(t, "Anna, Bert", queue.MembersText())
+	_, err = UpdateQueue(Queue{ID: 99, Name: "Unknown"})
+	assert.NotNil(t, err)
+
+	// Queues with tickets can't be deleted
+	ticket, err := CreateTicket("client@dhbw.de", "Invoice", "Wrong amount")
+	assert.Nil(t, err)
+	ticket, err = MoveTicket(ticket, queue.ID, "Anna")
+	assert.Nil(t, err)
+	assert.NotNil(t, DeleteQueue(queue.ID))
+
+	_, err = MoveTicket(ticket, 0, "Anna")
+	assert.Nil(t, err)
+	assert.Nil(t, DeleteQueue(queue.ID))
+	assert.NotNil(t, DeleteQueue(queue.ID))
+}
+
+func TestCanAccessTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Admin"}
+	defer func() { config.Admins = nil }()
+
+	queue, err := CreateQueue(Queue{Name: "Billing", Members: []string{"Anna"}})
+	assert.Nil(t, err)
+
+	ticket := Ticket{ID: 1}
+	assert.True(t, CanAccessTicket(User{Username: "Bert"}, ticket))
+
+	ticket.Queue = queue.ID
+	assert.True(t, CanAccessTicket(User{Username: "Anna"}, ticket))
+	assert.True(t, CanAccessTicket(User{Username: "Admin"}, ticket))
+	assert.False(t, CanAccessTicket(User{Username: "Bert"}, ticket))
+	assert.False(t, CanAccessQueue(User{Username: "Anna"}, 99))
+
+	queues, err := GetQueuesForUser(User{Username: "Bert"})
+	assert.Nil(t, err)
+	assert.Empty(t, queues)
+	queues, err = GetQueuesForUser(User{Username: "Admin"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(queues))
+}
+
+func TestMoveTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	queue, err := CreateQueue(Queue{Name: "Billing", Members: []string{"Anna"}})
+	assert.Nil(t, err)
+
+	ticket, err := CreateTicket("client@dhbw.de", "Invoice", "Wrong amount")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeEditor(ticket.ID, "Bert"))
+	assert.Nil(t, ChangeStatus(ticket.ID, TicketStatusInProcess))
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+
+	// The editor is not a member of the new queue, so the ticket is released
+	before := ticket
+	ticket, err = MoveTicket(ticket, queue.ID, "Bert")
+	assert.Nil(t, err)
+	assert.Equal(t, "", ticket.Editor)
+	assert.Equal(t, TicketStatusOpen, ticket.Status)
+	assert.Equal(t, "Moved from no queue to Billing by Bert", ticket.MessageList[len(ticket.MessageList)-1].Text)
+	assert.Contains(t, TicketChanges(before, ticket), FieldChange{Field: "queue", Before: "", After: "Billing"})
+
+	stored, err := ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, queue.ID, stored.Queue)
+	assert.Equal(t, "Billing", stored.QueueName())
+
+	_, err = MoveTicket(ticket, 99, "Bert")
+	assert.NotNil(t, err)
+
+	// Moving into the same queue changes nothing
+	messages := len(stored.MessageList)
+	stored, err = MoveTicket(stored, queue.ID, "Anna")
+	assert.Nil(t, err)
+	assert.Equal(t, messages, len(stored.MessageList))
+}
+
+func TestRouteTicketByRecipient(t *testing.T) {
+	setup()
+	defer teardown()
+
+	queue, err := CreateQueue(Queue{Name: "Billing", Address: "billing@dhbw.de"})
+	assert.Nil(t, err)
+
+	ticket, err := ReceiveMail(SourceMail, "Billing@dhbw.de", "client@dhbw.de", "Invoice", "Wrong amount")
+	assert.Nil(t, err)
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, queue.ID, ticket.Queue)
+
+	// Mails to unknown addresses stay without a queue
+	ticket, err = ReceiveMail(SourceMail, "support@dhbw.de", "client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, ticket.Queue)
+}
+
+func TestMacroActionQueue(t *testing.T) {
+	setup()
+	defer teardown()
+
+	queue, err := CreateQueue(Queue{Name: "Billing"})
+	assert.Nil(t, err)
+
+	actions, err := ParseMacroActions("queue Billing")
+	assert.Nil(t, err)
+	_, err = ParseMacroActions("queue")
+	assert.NotNil(t, err)
+
+	ticket, err := CreateTicket("client@dhbw.de", "Invoice", "Wrong amount")
+	assert.Nil(t, err)
+	_, err = RunMacro(Macro{Name: "To billing", Shared: true, Actions: actions}, ticket.ID, User{Username: "Anna"}, SourceWeb)
+	assert.Nil(t, err)
+
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, queue.ID, ticket.Queue)
+}
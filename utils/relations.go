@@ -0,0 +1,426 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Types of the links between tickets, they describe the linked ticket from the view of the ticket which stores the link
+type RelationType string
+
+const (
+	RelationDuplicateOf  RelationType = "duplicate-of"  // The ticket describes the same problem as the linked canonical ticket
+	RelationDuplicatedBy RelationType = "duplicated-by" // The linked ticket is a duplicate of the ticket
+	RelationParentOf     RelationType = "parent-of"
+	RelationChildOf      RelationType = "child-of"
+	RelationRelated      RelationType = "related"
+	RelationBlocks       RelationType = "blocks"
+	RelationBlockedBy    RelationType = "blocked-by"
+)
+
+// Link to another ticket, every link is stored on both tickets with the inverse type on the linked ticket
+type Relation struct {
+	Type       RelationType `xml:"Type" json:"type"`
+	Ticket     int          `xml:"Ticket" json:"ticket"`
+	MergedFrom int          `xml:"MergedFrom,omitempty" json:"mergedFrom,omitempty"` // Ticket the link was moved from when it was merged into this one
+}
+
+// Linked ticket together with the type of the link for displaying it
+type RelatedTicket struct {
+	Type   RelationType
+	Ticket Ticket
+}
+
+var mutexRelations = &sync.Mutex{}
+
+var registerRelationsOnce = &sync.Once{}
+
+func IsRelationType(relationType RelationType) bool {
+	return InverseRelation(relationType) != ""
+}
+
+// Returns the type of the link which is stored on the linked ticket
+func InverseRelation(relationType RelationType) RelationType {
+	switch relationType {
+	case RelationDuplicateOf:
+		return RelationDuplicatedBy
+	case RelationDuplicatedBy:
+		return RelationDuplicateOf
+	case RelationParentOf:
+		return RelationChildOf
+	case RelationChildOf:
+		return RelationParentOf
+	case RelationRelated:
+		return RelationRelated
+	case RelationBlocks:
+		return RelationBlockedBy
+	case RelationBlockedBy:
+		return RelationBlocks
+	default:
+		return ""
+	}
+}
+
+// Returns the readable name of the relation type, e.g. "duplicate of"
+func (relationType RelationType) Name() string {
+	if relationType == RelationRelated {
+		return "related to"
+	}
+	return strings.Replace(string(relationType), "-", " ", -1)
+}
+
+// Returns the link to the other ticket
+func (ticket Ticket) RelationTo(id int) (Relation, bool) {
+	for _, relation := range ticket.Relations {
+		if relation.Ticket == id {
+			return relation, true
+		}
+	}
+	return Relation{}, false
+}
+
+// Returns the IDs of the tickets which are linked with the type
+func (ticket Ticket) RelatedIDs(relationType RelationType) []int {
+	var ids []int
+	for _, relation := range ticket.Relations {
+		if relation.Type == relationType {
+			ids = append(ids, relation.Ticket)
+		}
+	}
+	return ids
+}
+
+// Returns the links separated by commas, e.g. "duplicate of 3, related to 5"
+func (ticket Ticket) RelationsText() string {
+	var texts []string
+	for _, relation := range ticket.Relations {
+		texts = append(texts, relation.Type.Name()+" "+strconv.Itoa(relation.Ticket))
+	}
+	return strings.Join(texts, ", ")
+}
+
+// Returns the linked tickets, links to tickets which can't be read anymore are left out
+func GetRelatedTickets(ticket Ticket) []RelatedTicket {
+	var related []RelatedTicket
+	for _, relation := range ticket.Relations {
+		other, err := ReadTicket(relation.Ticket)
+		if err != nil {
+			continue
+		}
+		related = append(related, RelatedTicket{Type: relation.Type, Ticket: other})
+	}
+	return related
+}
+
+// Returns the tickets which block the ticket and are not closed yet
+func GetOpenBlockers(ticket Ticket) []Ticket {
+	var blockers []Ticket
+	for _, id := range ticket.RelatedIDs(RelationBlockedBy) {
+		blocker, err := ReadTicket(id)
+		if err == nil && blocker.Status != TicketStatusClosed {
+			blockers = append(blockers, blocker)
+		}
+	}
+	return blockers
+}
+
+// Returns an error if the ticket is blocked by tickets which are not closed yet, such tickets can't be closed
+func CheckClosable(ticket Ticket) error {
+	blockers := GetOpenBlockers(ticket)
+	if len(blockers) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for _, blocker := range blockers {
+		ids = append(ids, "#"+strconv.Itoa(blocker.ID))
+	}
+	return fmt.Errorf("ticket %d is blocked by %s", ticket.ID, strings.Join(ids, ", "))
+}
+
+// Links the ticket to the other one with the type and stores the inverse link on the other ticket.
+// Two tickets can only be linked once, a ticket has at most one parent and is the duplicate of at most one ticket
+func LinkTickets(id int, otherID int, relationType RelationType, actor string) error {
+	mutexRelations.Lock()
+	defer mutexRelations.Unlock()
+
+	if !IsRelationType(relationType) {
+		return fmt.Errorf("unknown relation type %q", relationType)
+	}
+	if id == otherID {
+		return fmt.Errorf("a ticket can't be linked to itself")
+	}
+
+	ticket, err := ReadTicket(id)
+	if err != nil {
+		return err
+	}
+	other, err := ReadTicket(otherID)
+	if err != nil {
+		return err
+	}
+
+	if relation, ok := ticket.RelationTo(otherID); ok {
+		return fmt.Errorf("the tickets are already linked as %s", relation.Type.Name())
+	}
+	err = validateRelation(ticket, other, relationType)
+	if err != nil {
+		return err
+	}
+
+	ticket.Relations = append(ticket.Relations, Relation{Type: relationType, Ticket: otherID})
+	other.Relations = append(other.Relations, Relation{Type: InverseRelation(relationType), Ticket: id})
+
+	_, err = AddSystemMessage(ticket, fmt.Sprintf("Linked by %s: %s ticket %d", actor, relationType.Name(), otherID))
+	if err != nil {
+		return err
+	}
+	_, err = AddSystemMessage(other, fmt.Sprintf("Linked by %s: %s ticket %d", actor, InverseRelation(relationType).Name(), id))
+	return err
+}
+
+// Checks the rules for parents and duplicates, the link is described from the view of the ticket
+func validateRelation(ticket Ticket, other Ticket, relationType RelationType) error {
+	switch relationType {
+	case RelationChildOf, RelationParentOf:
+		parent, child := other, ticket
+		if relationType == RelationParentOf {
+			parent, child = ticket, other
+		}
+		if len(child.RelatedIDs(RelationChildOf)) > 0 {
+			return fmt.Errorf("ticket %d already has a parent", child.ID)
+		}
+		// The parent must not be below the child, otherwise the tickets would form a cycle
+		for ancestors := parent.RelatedIDs(RelationChildOf); len(ancestors) > 0; {
+			if ancestors[0] == child.ID {
+				return fmt.Errorf("ticket %d is already above ticket %d", child.ID, parent.ID)
+			}
+			ancestor, err := ReadTicket(ancestors[0])
+			if err != nil {
+				break
+			}
+			ancestors = ancestor.RelatedIDs(RelationChildOf)
+		}
+	case RelationDuplicateOf, RelationDuplicatedBy:
+		duplicate, canonical := ticket, other
+		if relationType == RelationDuplicatedBy {
+			duplicate, canonical = other, ticket
+		}
+		if len(duplicate.RelatedIDs(RelationDuplicateOf)) > 0 {
+			return fmt.Errorf("ticket %d is already a duplicate", duplicate.ID)
+		}
+		if len(canonical.RelatedIDs(RelationDuplicateOf)) > 0 {
+			return fmt.Errorf("ticket %d is a duplicate itself", canonical.ID)
+		}
+	}
+
+	return nil
+}
+
+// Removes the link between the two tickets from both of them
+func UnlinkTickets(id int, otherID int, actor string) error {
+	mutexRelations.Lock()
+	defer mutexRelations.Unlock()
+
+	ticket, err := ReadTicket(id)
+	if err != nil {
+		return err
+	}
+	relation, ok := ticket.RelationTo(otherID)
+	if !ok {
+		return fmt.Errorf("the tickets are not linked")
+	}
+
+	ticket.Relations = removeRelation(ticket.Relations, otherID)
+	_, err = AddSystemMessage(ticket, fmt.Sprintf("Link removed by %s: %s ticket %d", actor, relation.Type.Name(), otherID))
+	if err != nil {
+		return err
+	}
+
+	// The other ticket may have been deleted in the meantime
+	other, err := ReadTicket(otherID)
+	if err != nil {
+		return nil
+	}
+	other.Relations = removeRelation(other.Relations, id)
+	_, err = AddSystemMessage(other, fmt.Sprintf("Link removed by %s: %s ticket %d", actor, InverseRelation(relation.Type).Name(), id))
+	return err
+}
+
+func removeRelation(relations []Relation, id int) []Relation {
+	var kept []Relation
+	for _, relation := range relations {
+		if relation.Ticket != id {
+			kept = append(kept, relation)
+		}
+	}
+	return kept
+}
+
+// Moves the links of the ticket which is merged into the target ticket, so the linked tickets point to the remaining one.
+// The moved links remember where they came from, links the target already had are kept on the merged ticket, so an undone
+// merge can restore all of them. The returned tickets are not stored yet
+func transferRelations(from Ticket, to Ticket) (Ticket, Ticket, error) {
+	mutexRelations.Lock()
+	defer mutexRelations.Unlock()
+
+	to.Relations = removeRelation(to.Relations, from.ID)
+	var kept []Relation
+	for _, relation := range from.Relations {
+		if relation.Ticket == to.ID {
+			kept = append(kept, relation)
+			continue
+		}
+
+		other, err := ReadTicket(relation.Ticket)
+		if err != nil {
+			continue
+		}
+		other.Relations = removeRelation(other.Relations, from.ID)
+		if _, ok := to.RelationTo(other.ID); ok {
+			kept = append(kept, relation)
+		} else {
+			if relation.MergedFrom == 0 {
+				relation.MergedFrom = from.ID
+			}
+			to.Relations = append(to.Relations, relation)
+			other.Relations = append(other.Relations, Relation{Type: InverseRelation(relation.Type), Ticket: to.ID})
+		}
+
+		err = StoreTicket(other)
+		if err != nil {
+			return from, to, err
+		}
+	}
+
+	from.Relations = kept
+	return from, to, nil
+}
+
+// Moves the links which came with the restored ticket back from the target ticket and links the tickets again which were
+// linked with both of them. The origins are the tickets whose links belong to the restored ticket. The returned tickets
+// are not stored yet
+func restoreRelations(restored Ticket, target Ticket, origins map[int]bool) (Ticket, Ticket, error) {
+	mutexRelations.Lock()
+	defer mutexRelations.Unlock()
+
+	var kept, moved []Relation
+	for _, relation := range target.Relations {
+		if !origins[relation.MergedFrom] {
+			kept = append(kept, relation)
+			continue
+		}
+		if relation.MergedFrom == restored.ID {
+			relation.MergedFrom = 0
+		}
+		moved = append(moved, relation)
+	}
+	target.Relations = kept
+
+	for _, relation := range moved {
+		other, err := ReadTicket(relation.Ticket)
+		if err != nil {
+			continue
+		}
+		other.Relations = append(removeRelation(other.Relations, target.ID), Relation{Type: InverseRelation(relation.Type), Ticket: restored.ID})
+		err = StoreTicket(other)
+		if err != nil {
+			return restored, target, err
+		}
+	}
+
+	for _, relation := range restored.Relations {
+		if relation.Ticket == target.ID {
+			if _, ok := target.RelationTo(restored.ID); !ok {
+				target.Relations = append(target.Relations, Relation{Type: InverseRelation(relation.Type), Ticket: restored.ID})
+			}
+			continue
+		}
+
+		other, err := ReadTicket(relation.Ticket)
+		if err != nil {
+			continue
+		}
+		if _, ok := other.RelationTo(restored.ID); !ok {
+			other.Relations = append(other.Relations, Relation{Type: InverseRelation(relation.Type), Ticket: restored.ID})
+			err = StoreTicket(other)
+			if err != nil {
+				return restored, target, err
+			}
+		}
+	}
+
+	restored.Relations = append(restored.Relations, moved...)
+	return restored, target, nil
+}
+
+// Subscribes the rules of the ticket relations to the ticket events. Calling it more than once has no effect
+func RegisterTicketRelations() {
+	registerRelationsOnce.Do(func() {
+		SubscribeEvents(closeChildTickets)
+	})
+}
+
+// Closes the unfinished children of a closed parent ticket, children with open blockers are skipped.
+// The children publish their closure as well, hence their own children are closed in turn
+func closeChildTickets(event Event) {
+	if event.Type != EventTicketClosed {
+		return
+	}
+
+	parent, err := ReadTicket(event.TicketID)
+	if err != nil {
+		return
+	}
+
+	// A customer who closed the ticket in the portal only closes the child tickets of their own,
+	// the cascade keeps this restriction for the grandchildren
+	customer := event.Details["customer"]
+	if event.Actor == parent.Client {
+		customer = parent.Client
+	}
+
+	for _, id := range parent.RelatedIDs(RelationParentOf) {
+		child, err := ReadTicket(id)
+		if err != nil || child.Status == TicketStatusClosed {
+			continue
+		}
+		if customer != "" && child.Client != customer {
+			continue
+		}
+
+		// Blocked children stay open, the note tells their editor why
+		blocked := CheckClosable(child)
+		if blocked != nil {
+			log.Printf("Didn't close ticket %d together with its parent %d: %v\n", id, parent.ID, blocked)
+			_, err = AddSystemMessage(child, fmt.Sprintf("Not closed together with the parent ticket %d, because %v", parent.ID, blocked))
+			if err != nil {
+				log.Printf("Couldn't add the note to ticket %d: %v\n", id, err)
+			}
+			continue
+		}
+
+		before := child
+		child, err = AddSystemMessage(child, fmt.Sprintf("Closed together with the parent ticket %d", parent.ID))
+		if err == nil {
+			child.Status = TicketStatusClosed
+			err = StoreTicket(child)
+		}
+		if err != nil {
+			log.Printf("Couldn't close ticket %d together with its parent %d: %v\n", id, parent.ID, err)
+			continue
+		}
+
+		details := map[string]string{"parentTicketId": strconv.Itoa(parent.ID)}
+		if customer != "" {
+			details["customer"] = customer
+		}
+		PublishEvent(Event{Type: EventTicketClosed, Ticket: child, Actor: SystemActor, Source: SourceSystem,
+			Changes: TicketChanges(before, child), Details: details})
+	}
+}
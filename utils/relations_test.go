@@ -0,0 +1,235 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Creates tickets with the subjects and returns their IDs
+func createTickets(t *testing.T, subjects ...string) []int {
+	var ids []int
+	for _, subject := range subjects {
+		ticket, err := CreateTicket("client@dhbw.de", subject, "Help")
+		assert.Nil(t, err)
+		ids = append(ids, ticket.ID)
+	}
+	return ids
+}
+
+func TestInverseRelation(t *testing.T) {
+	for _, relationType := range []RelationType{RelationDuplicateOf, RelationDuplicatedBy, RelationParentOf, RelationChildOf, RelationRelated, RelationBlocks, RelationBlockedBy} {
+		assert.True(t, IsRelationType(relationType))
+		assert.Equal(t, relationType, InverseRelation(InverseRelation(relationType)))
+	}
+	assert.False(t, IsRelationType("sibling"))
+	assert.Equal(t, "duplicate of", RelationDuplicateOf.Name())
+	assert.Equal(t, "related to", RelationRelated.Name())
+}
+
+func TestLinkTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ids := createTickets(t, "Outage", "No internet", "Slow network", "Router broken")
+
+	assert.NotNil(t, LinkTickets(ids[0], ids[0], RelationRelated, "Anna"))
+	assert.NotNil(t, LinkTickets(ids[0], ids[1], "sibling", "Anna"))
+	assert.NotNil(t, LinkTickets(ids[0], 99, RelationRelated, "Anna"))
+
+	assert.Nil(t, LinkTickets(ids[1], ids[0], RelationChildOf, "Anna"))
+	assert.Nil(t, LinkTickets(ids[0], ids[2], RelationParentOf, "Anna"))
+	assert.Nil(t, LinkTickets(ids[2], ids[3], RelationParentOf, "Anna"))
+
+	// Every pair is linked once, a child has one parent and the tickets must not form a cycle
+	assert.NotNil(t, LinkTickets(ids[0], ids[1], RelationRelated, "Anna"))
+	assert.NotNil(t, LinkTickets(ids[1], ids[2], RelationChildOf, "Anna"))
+	assert.NotNil(t, LinkTickets(ids[3], ids[0], RelationParentOf, "Anna"))
+
+	parent, err := ReadTicket(ids[0])
+	assert.Nil(t, err)
+	child, err := ReadTicket(ids[1])
+	assert.Nil(t, err)
+	assert.Equal(t, []int{ids[1], ids[2]}, parent.RelatedIDs(RelationParentOf))
+	assert.Equal(t, []Relation{{Type: RelationChildOf, Ticket: ids[0]}}, child.Relations)
+	assert.Equal(t, "Linked by Anna: child of ticket 1", child.MessageList[len(child.MessageList)-1].Text)
+
+	assert.Nil(t, UnlinkTickets(ids[0], ids[1], "Bert"))
+	assert.NotNil(t, UnlinkTickets(ids[0], ids[1], "Bert"))
+	child, err = ReadTicket(ids[1])
+	assert.Nil(t, err)
+	assert.Nil(t, child.Relations)
+	assert.Equal(t, "Link removed by Bert: child of ticket 1", child.MessageList[len(child.MessageList)-1].Text)
+}
+
+func TestLinkDuplicates(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ids := createTickets(t, "Outage", "Outage again", "Still an outage")
+
+	assert.Nil(t, LinkTickets(ids[1], ids[0], RelationDuplicateOf, "Anna"))
+	assert.NotNil(t, LinkTickets(ids[1], ids[2], RelationDuplicateOf, "Anna"))
+	assert.NotNil(t, LinkTickets(ids[2], ids[1], RelationDuplicateOf, "Anna"))
+	assert.Nil(t, LinkTickets(ids[0], ids[2], RelationDuplicatedBy, "Anna"))
+
+	canonical, err := ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "duplicated by 2, duplicated by 3", canonical.RelationsText())
+
+	// The customer of the duplicate is told about the canonical ticket
+	duplicate, err := ReadTicket(ids[1])
+	assert.Nil(t, err)
+	mails := countMails(t)
+	assert.Nil(t, SendDuplicateNotice(duplicate, canonical, "Anna"))
+	assert.Equal(t, mails+1, countMails(t))
+
+	data := NewMailTemplateData(duplicate, "Anna", "")
+	data.Related = canonical
+	subject, body, err := RenderMailTemplate(duplicateTemplate, "", data)
+	assert.Nil(t, err)
+	assert.Contains(t, subject, TicketReferenceToken(ids[1]))
+	assert.Contains(t, body, "ticket 1")
+}
+
+func TestCloseChildTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ids := createTickets(t, "Outage", "No internet", "Router broken", "Printer broken")
+	assert.Nil(t, LinkTickets(ids[0], ids[1], RelationParentOf, "Anna"))
+	assert.Nil(t, LinkTickets(ids[1], ids[2], RelationParentOf, "Anna"))
+	assert.Nil(t, LinkTickets(ids[0], ids[3], RelationRelated, "Anna"))
+
+	var closed []int
+	SubscribeEvents(func(event Event) {
+		if event.Type == EventTicketClosed && event.Actor == SystemActor {
+			closed = append(closed, event.TicketID)
+		}
+	})
+	RegisterTicketRelations()
+
+	// Other events and related tickets are left alone
+	closeChildTickets(Event{Type: EventTicketUpdated, TicketID: ids[0]})
+	assert.Equal(t, 0, len(closed))
+
+	assert.Nil(t, ChangeStatus(ids[0], TicketStatusClosed))
+	parent, err := ReadTicket(ids[0])
+	assert.Nil(t, err)
+	PublishEvent(Event{Type: EventTicketClosed, Ticket: parent, Actor: "Anna", Source: SourceWeb})
+
+	// The grandchild is closed by the event of its parent
+	assert.Equal(t, []int{ids[1], ids[2]}, closed)
+	for _, id := range ids[1:3] {
+		child, err := ReadTicket(id)
+		assert.Nil(t, err)
+		assert.Equal(t, TicketStatusClosed, child.Status)
+	}
+	child, err := ReadTicket(ids[1])
+	assert.Nil(t, err)
+	assert.Equal(t, "Closed together with the parent ticket 1", child.MessageList[len(child.MessageList)-1].Text)
+
+	related, err := ReadTicket(ids[3])
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusOpen, related.Status)
+}
+
+func TestCloseChildTicketsSkipsBlockedAndForeignChildren(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ids := createTickets(t, "Outage", "No internet", "Router broken", "Printer broken")
+	foreign, err := CreateTicket("other@dhbw.de", "No internet either", "Help")
+	assert.Nil(t, err)
+	assert.Nil(t, LinkTickets(ids[0], ids[1], RelationParentOf, "Anna"))
+	assert.Nil(t, LinkTickets(ids[0], ids[2], RelationParentOf, "Anna"))
+	assert.Nil(t, LinkTickets(ids[2], ids[3], RelationBlockedBy, "Anna"))
+	assert.Nil(t, LinkTickets(ids[1], foreign.ID, RelationParentOf, "Anna"))
+	RegisterTicketRelations()
+
+	// The customer closes the parent in the portal
+	assert.Nil(t, ChangeStatus(ids[0], TicketStatusClosed))
+	parent, err := ReadTicket(ids[0])
+	assert.Nil(t, err)
+	PublishEvent(Event{Type: EventTicketClosed, Ticket: parent, Actor: "client@dhbw.de", Source: SourceWeb})
+
+	child, err := ReadTicket(ids[1])
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusClosed, child.Status)
+
+	// The blocked child stays open and is told why, the ticket of the other customer is left alone
+	blocked, err := ReadTicket(ids[2])
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusOpen, blocked.Status)
+	assert.Equal(t, "Not closed together with the parent ticket 1, because ticket 3 is blocked by #4",
+		blocked.MessageList[len(blocked.MessageList)-1].Text)
+	foreign, err = ReadTicket(foreign.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusOpen, foreign.Status)
+}
+
+func TestMergeTicketsKeepsRelations(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ids := createTickets(t, "Outage", "Outage again", "Router broken")
+	assert.Nil(t, LinkTickets(ids[0], ids[1], RelationRelated, "Anna"))
+	assert.Nil(t, LinkTickets(ids[1], ids[2], RelationBlockedBy, "Anna"))
+
+	assert.Nil(t, MergeTickets(ids[0], ids[1], "Anna"))
+
+	// The links of the merged ticket point to the remaining ticket
+	merged, err := ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, []Relation{{Type: RelationBlockedBy, Ticket: ids[2], MergedFrom: ids[1]}}, merged.Relations)
+	blocker, err := ReadTicket(ids[2])
+	assert.Nil(t, err)
+	assert.Equal(t, []Relation{{Type: RelationBlocks, Ticket: ids[0]}}, blocker.Relations)
+	assert.Equal(t, 1, len(GetOpenBlockers(merged)))
+	assert.Equal(t, 1, len(GetRelatedTickets(merged)))
+
+	// Undoing the merge moves the links back
+	assert.Nil(t, UnmergeTicket(ids[1], "Anna"))
+	restored, err := ReadTicket(ids[1])
+	assert.Nil(t, err)
+	assert.Equal(t, []Relation{{Type: RelationRelated, Ticket: ids[0]}, {Type: RelationBlockedBy, Ticket: ids[2]}}, restored.Relations)
+	merged, err = ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, []Relation{{Type: RelationRelated, Ticket: ids[1]}}, merged.Relations)
+	blocker, err = ReadTicket(ids[2])
+	assert.Nil(t, err)
+	assert.Equal(t, []Relation{{Type: RelationBlocks, Ticket: ids[1]}}, blocker.Relations)
+}
+
+func TestCloseBlockedTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateUser("Anna", "Aa!123456")
+	assert.Nil(t, err)
+	ids := createTickets(t, "Outage", "Router broken", "Printer broken")
+	assert.Nil(t, LinkTickets(ids[0], ids[1], RelationBlockedBy, "Anna"))
+
+	blocked, err := ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.NotNil(t, CheckClosable(blocked))
+
+	// Neither macros nor bulk operations close a ticket with open blockers
+	closeMacro := Macro{Name: "Close", Actions: []MacroAction{{MacroActionStatus, "closed"}}}
+	_, err = RunMacro(closeMacro, ids[0], User{Username: "Anna"}, SourceWeb)
+	assert.NotNil(t, err)
+	results, err := RunBulkOperation(BulkClose, "", []int{ids[0], ids[2]}, User{Username: "Anna"})
+	assert.Nil(t, err)
+	assert.False(t, results[0].Succeeded())
+	assert.True(t, results[1].Succeeded())
+	blocked, err = ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusOpen, blocked.Status)
+
+	// Once the blocker is closed the ticket can be closed as well
+	assert.Nil(t, ChangeStatus(ids[1], TicketStatusClosed))
+	assert.Nil(t, CheckClosable(blocked))
+	_, err = RunMacro(closeMacro, ids[0], User{Username: "Anna"}, SourceWeb)
+	assert.Nil(t, err)
+}
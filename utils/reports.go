@@ -0,0 +1,373 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Sections of a report which can be exported as CSV
+const (
+	ReportSectionDaily    = "daily"    // Created, closed and unfinished tickets per day
+	ReportSectionTickets  = "tickets"  // First response and resolution time of every ticket created within the period
+	ReportSectionWorkload = "workload" // Assigned tickets, replies and closures per editor
+)
+
+// Reports cover at most one year, so the charts stay readable
+const maxReportDays = 366
+
+// Upper limits of the buckets of the time distributions, the last bucket contains all longer times
+var durationBuckets = []struct {
+	label string
+	limit time.Duration
+}{
+	{"< 1h", time.Hour},
+	{"1-4h", 4 * time.Hour},
+	{"4-24h", 24 * time.Hour},
+	{"1-3d", 3 * 24 * time.Hour},
+	{"3-7d", 7 * 24 * time.Hour},
+	{"> 7d", 0},
+}
+
+type ReportDay struct {
+	Day     time.Time
+	Created int
+	Closed  int
+	Backlog int // Unfinished tickets at the end of the day
+}
+
+type DurationBucket struct {
+	Label string
+	Count int
+}
+
+type Distribution struct {
+	Buckets []DurationBucket
+	Count   int
+	Median  time.Duration
+	Average time.Duration
+}
+
+type TicketTimes struct {
+	TicketID      int
+	Created       time.Time
+	FirstResponse time.Duration // 0 if the customer hasn't received a reply yet
+	Resolution    time.Duration // 0 if the ticket isn't closed
+}
+
+type EditorWorkload struct {
+	Editor   string
+	Assigned int // Unfinished tickets the editor is working on
+	Replies  int // Replies to customers within the period
+	Closed   int // Tickets the editor closed within the period
+}
+
+// Ticket volume, response times and workload of the editors between the first and the last day of the report
+type Report struct {
+	From          time.Time
+	To            time.Time
+	Days          []ReportDay
+	Tickets       []TicketTimes
+	FirstResponse Distribution // Times until the first reply to the tickets created within the period
+	Resolution    Distribution // Times until the closure of the tickets created within the period
+	Workload      []EditorWorkload
+}
+
+// Closure or reopening of a ticket
+type statusChange struct {
+	at     time.Time
+	closed bool
+	actor  string
+}
+
+// Computes the report for the days from the first to the last specified day. Messages provide the creation and the
+// replies of the tickets, the status changes recorded in the audit log provide their closures
+func GenerateReport(from time.Time, to time.Time) (Report, error) {
+	report := Report{From: startOfDay(from), To: startOfDay(to)}
+	if report.To.Before(report.From) {
+		return Report{}, fmt.Errorf("the report has to end after it starts")
+	}
+	for day := report.From; !day.After(report.To); day = day.AddDate(0, 0, 1) {
+		report.Days = append(report.Days, ReportDay{Day: day})
+		if len(report.Days) > maxReportDays {
+			return Report{}, fmt.Errorf("a report covers at most %d days", maxReportDays)
+		}
+	}
+	end := report.To.AddDate(0, 0, 1)
+
+	history, err := readStatusHistory()
+	if err != nil {
+		return Report{}, err
+	}
+
+	users, err := ReadUsers()
+	if err != nil {
+		return Report{}, err
+	}
+	workload := make(map[string]*EditorWorkload)
+	for name := range users {
+		workload[name] = &EditorWorkload{Editor: name}
+	}
+
+	dayIndex := func(t time.Time) (int, bool) {
+		if t.Before(report.From) || !t.Before(end) {
+			return -1, false
+		}
+		for i := len(report.Days) - 1; i >= 0; i-- {
+			if !t.Before(report.Days[i].Day) {
+				return i, true
+			}
+		}
+		return -1, false
+	}
+
+	var firstResponses, resolutions []time.Duration
+	for _, id := range storedTicketIDs() {
+		ticket, err := ReadTicket(id)
+		if err != nil || ticket.IsMerged() || len(ticket.MessageList) == 0 {
+			continue
+		}
+		created := ticket.MessageList[0].CreationDate
+		changes := history[id]
+		if ticket.Status == TicketStatusClosed && (len(changes) == 0 || !changes[len(changes)-1].closed) {
+			// Tickets closed without a recorded status change, e.g. before the audit log existed, count as closed with their last message
+			changes = append(changes, statusChange{at: ticket.MessageList[len(ticket.MessageList)-1].CreationDate, closed: true, actor: ticket.Editor})
+		}
+
+		if i, ok := dayIndex(created); ok {
+			report.Days[i].Created++
+		}
+		for _, change := range changes {
+			if i, ok := dayIndex(change.at); ok && change.closed {
+				report.Days[i].Closed++
+				if editor, ok := workload[change.actor]; ok {
+					editor.Closed++
+				}
+			}
+		}
+		for i := range report.Days {
+			dayEnd := report.Days[i].Day.AddDate(0, 0, 1)
+			if created.Before(dayEnd) && !closedAt(changes, dayEnd) {
+				report.Days[i].Backlog++
+			}
+		}
+
+		for _, message := range ticket.MessageList {
+			if _, ok := dayIndex(message.CreationDate); ok && message.Type == MessageTypeReply {
+				if editor, ok := workload[message.Actor]; ok {
+					editor.Replies++
+				}
+			}
+		}
+		if editor, ok := workload[ticket.Editor]; ok && ticket.Status != TicketStatusClosed {
+			editor.Assigned++
+		}
+
+		if _, ok := dayIndex(created); !ok {
+			continue
+		}
+		times := TicketTimes{TicketID: ticket.ID, Created: created}
+		if reply, ok := firstReply(ticket); ok {
+			times.FirstResponse = reply.CreationDate.Sub(created)
+			firstResponses = append(firstResponses, times.FirstResponse)
+		}
+		if ticket.Status == TicketStatusClosed {
+			times.Resolution = changes[len(changes)-1].at.Sub(created)
+			resolutions = append(resolutions, times.Resolution)
+		}
+		report.Tickets = append(report.Tickets, times)
+	}
+
+	report.FirstResponse = newDistribution(firstResponses)
+	report.Resolution = newDistribution(resolutions)
+	for _, editor := range workload {
+		report.Workload = append(report.Workload, *editor)
+	}
+	sort.Slice(report.Workload, func(i, j int) bool {
+		return report.Workload[i].Editor < report.Workload[j].Editor
+	})
+
+	return report, nil
+}
+
+// Returns the closures and reopenings of all tickets in chronological order
+func readStatusHistory() (map[int][]statusChange, error) {
+	entries, err := QueryAuditLog(AuditFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	closed := TicketStatusName(TicketStatusClosed)
+	history := make(map[int][]statusChange)
+	for _, entry := range entries {
+		if entry.Field == "status" && (entry.Before == closed) != (entry.After == closed) {
+			history[entry.TicketID] = append(history[entry.TicketID], statusChange{at: entry.Timestamp, closed: entry.After == closed, actor: entry.Actor})
+		}
+	}
+
+	return history, nil
+}
+
+func closedAt(changes []statusChange, t time.Time) bool {
+	closed := false
+	for _, change := range changes {
+		if change.at.Before(t) {
+			closed = change.closed
+		}
+	}
+	return closed
+}
+
+// Returns the first reply to the customer which was written in the ticket itself
+func firstReply(ticket Ticket) (Message, bool) {
+	for _, message := range ticket.MessageList {
+		if message.Type == MessageTypeReply && message.MergedFrom == 0 {
+			return message, true
+		}
+	}
+	return Message{}, false
+}
+
+func newDistribution(durations []time.Duration) Distribution {
+	distribution := Distribution{Count: len(durations)}
+	for _, bucket := range durationBuckets {
+		distribution.Buckets = append(distribution.Buckets, DurationBucket{Label: bucket.label})
+	}
+	if len(durations) == 0 {
+		return distribution
+	}
+
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	var sum time.Duration
+	for _, duration := range durations {
+		sum += duration
+		for i, bucket := range durationBuckets {
+			if bucket.limit == 0 || duration < bucket.limit {
+				distribution.Buckets[i].Count++
+				break
+			}
+		}
+	}
+
+	distribution.Average = sum / time.Duration(len(durations))
+	distribution.Median = durations[len(durations)/2]
+	if len(durations)%2 == 0 {
+		distribution.Median = (durations[len(durations)/2-1] + durations[len(durations)/2]) / 2
+	}
+	return distribution
+}
+
+// Returns the time in days, hours and minutes, e.g. "2d 3h" or "45m"
+func FormatReportDuration(duration time.Duration) string {
+	duration = duration.Round(time.Minute)
+	days := int(duration / (24 * time.Hour))
+	hours := int(duration % (24 * time.Hour) / time.Hour)
+	minutes := int(duration % time.Hour / time.Minute)
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+func (distribution Distribution) MedianText() string {
+	return FormatReportDuration(distribution.Median)
+}
+
+func (distribution Distribution) AverageText() string {
+	return FormatReportDuration(distribution.Average)
+}
+
+// Writes the section of the report as CSV with a header line. Times are given in hours
+func WriteReportCSV(w io.Writer, report Report, section string) error {
+	var records [][]string
+	switch section {
+	case ReportSectionDaily:
+		records = append(records, []string{"date", "created", "closed", "backlog"})
+		for _, day := range report.Days {
+			records = append(records, []string{day.Day.Format("2006-01-02"), strconv.Itoa(day.Created), strconv.Itoa(day.Closed), strconv.Itoa(day.Backlog)})
+		}
+	case ReportSectionTickets:
+		records = append(records, []string{"ticket", "created", "first_response_hours", "resolution_hours"})
+		for _, ticket := range report.Tickets {
+			records = append(records, []string{strconv.Itoa(ticket.TicketID), ticket.Created.Format(time.RFC3339),
+				formatHours(ticket.FirstResponse), formatHours(ticket.Resolution)})
+		}
+	case ReportSectionWorkload:
+		records = append(records, []string{"editor", "assigned", "replies", "closed"})
+		for _, editor := range report.Workload {
+			records = append(records, []string{editor.Editor, strconv.Itoa(editor.Assigned), strconv.Itoa(editor.Replies), strconv.Itoa(editor.Closed)})
+		}
+	default:
+		return fmt.Errorf("unknown report section %q", section)
+	}
+
+	writer := csv.NewWriter(w)
+	err := writer.WriteAll(records)
+	if err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// Returns the duration in hours or an empty value for missing durations
+func formatHours(duration time.Duration) string {
+	if duration == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(duration.Hours(), 'f', 2, 64)
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Renders the charts of the report as SVG: the ticket volume, the backlog, both time distributions and the workload
+func (report Report) Charts() []string {
+	var days []string
+	var created, closed, backlog []int
+	for _, day := range report.Days {
+		days = append(days, day.Day.Format("01-02"))
+		created = append(created, day.Created)
+		closed = append(closed, day.Closed)
+		backlog = append(backlog, day.Backlog)
+	}
+
+	var buckets []string
+	var firstResponses, resolutions []int
+	for i := range durationBuckets {
+		buckets = append(buckets, report.FirstResponse.Buckets[i].Label)
+		firstResponses = append(firstResponses, report.FirstResponse.Buckets[i].Count)
+		resolutions = append(resolutions, report.Resolution.Buckets[i].Count)
+	}
+
+	var editors []string
+	var assigned, replies, closures []int
+	for _, editor := range report.Workload {
+		editors = append(editors, editor.Editor)
+		assigned = append(assigned, editor.Assigned)
+		replies = append(replies, editor.Replies)
+		closures = append(closures, editor.Closed)
+	}
+
+	return []string{
+		BarChartSVG("Created and closed tickets per day", days, []ChartSeries{{Name: "Created", Color: "#007bff", Values: created},
+			{Name: "Closed", Color: "#28a745", Values: closed}}),
+		LineChartSVG("Unfinished tickets at the end of the day", days, []ChartSeries{{Name: "Backlog", Color: "#dc3545", Values: backlog}}),
+		BarChartSVG("Time until the first response", buckets, []ChartSeries{{Name: "Tickets", Color: "#17a2b8", Values: firstResponses}}),
+		BarChartSVG("Time until the resolution", buckets, []ChartSeries{{Name: "Tickets", Color: "#6f42c1", Values: resolutions}}),
+		BarChartSVG("Workload per editor", editors, []ChartSeries{{Name: "Assigned", Color: "#007bff", Values: assigned},
+			{Name: "Replies", Color: "#ffc107", Values: replies}, {Name: "Closed", Color: "#28a745", Values: closures}}),
+	}
+}
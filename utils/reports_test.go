@@ -0,0 +1,126 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Replaces the messages, the editor and the status of the ticket, so it has a history at fixed dates
+func storeTicketHistory(t *testing.T, id int, editor string, status int, messages ...Message) {
+	ticket, err := ReadTicket(id)
+	assert.Nil(t, err)
+	ticket.Editor = editor
+	ticket.Status = status
+	ticket.MessageList = messages
+	assert.Nil(t, StoreTicket(ticket))
+}
+
+func TestGenerateReport(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna", "Bert")
+	day := time.Date(2021, 3, 1, 9, 0, 0, 0, time.Local)
+	ids := createTickets(t, "Outage", "Printer broken", "No internet", "Old request")
+
+	storeTicketHistory(t, ids[0], "Anna", TicketStatusClosed,
+		Message{CreationDate: day, Actor: "client@dhbw.de", Text: "Help", Type: MessageTypeCustomer},
+		Message{CreationDate: day.Add(90 * time.Minute), Actor: "Anna", Text: "Restart it", Type: MessageTypeReply})
+	assert.Nil(t, RecordAuditEntry(AuditEntry{Timestamp: day.AddDate(0, 0, 1), Actor: "Anna", Action: string(EventTicketClosed),
+		TicketID: ids[0], Field: "status", Before: "in process", After: "closed"}))
+	storeTicketHistory(t, ids[1], "Anna", TicketStatusInProcess,
+		Message{CreationDate: day.AddDate(0, 0, 1).Add(3 * time.Hour), Actor: "client@dhbw.de", Text: "Help", Type: MessageTypeCustomer})
+	// Closed without a recorded status change, so the last message counts as closure
+	storeTicketHistory(t, ids[2], "Bert", TicketStatusClosed,
+		Message{CreationDate: day.AddDate(0, 0, 1).Add(-time.Hour), Actor: "client@dhbw.de", Text: "Help", Type: MessageTypeCustomer},
+		Message{CreationDate: day.AddDate(0, 0, 2).Add(-time.Hour), Actor: "Bert", Text: "Fixed", Type: MessageTypeReply})
+	storeTicketHistory(t, ids[3], "", TicketStatusOpen,
+		Message{CreationDate: day.AddDate(0, 0, -5), Actor: "client@dhbw.de", Text: "Help", Type: MessageTypeCustomer})
+
+	_, err := GenerateReport(day, day.AddDate(0, 0, -1))
+	assert.NotNil(t, err)
+	_, err = GenerateReport(day, day.AddDate(2, 0, 0))
+	assert.NotNil(t, err)
+
+	report, err := GenerateReport(day.Add(5*time.Hour), day.AddDate(0, 0, 2))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(report.Days))
+	assert.Equal(t, startOfDay(day), report.From)
+	for i, expected := range []ReportDay{{Created: 1, Closed: 0, Backlog: 2}, {Created: 2, Closed: 1, Backlog: 3}, {Created: 0, Closed: 1, Backlog: 2}} {
+		expected.Day = startOfDay(day).AddDate(0, 0, i)
+		assert.Equal(t, expected, report.Days[i])
+	}
+
+	assert.Equal(t, 3, len(report.Tickets))
+	assert.Equal(t, 2, report.FirstResponse.Count)
+	assert.Equal(t, 12*time.Hour+45*time.Minute, report.FirstResponse.Median)
+	assert.Equal(t, []int{0, 1, 0, 1, 0, 0}, bucketCounts(report.FirstResponse))
+	assert.Equal(t, 2, report.Resolution.Count)
+	assert.Equal(t, 24*time.Hour, report.Resolution.Average)
+	assert.Equal(t, "1d 0h", report.Resolution.AverageText())
+
+	assert.Equal(t, []EditorWorkload{{Editor: "Anna", Assigned: 1, Replies: 1, Closed: 1}, {Editor: "Bert", Assigned: 0, Replies: 1, Closed: 1}}, report.Workload)
+	assert.Equal(t, 5, len(report.Charts()))
+}
+
+func bucketCounts(distribution Distribution) []int {
+	var counts []int
+	for _, bucket := range distribution.Buckets {
+		counts = append(counts, bucket.Count)
+	}
+	return counts
+}
+
+func TestWriteReportCSV(t *testing.T) {
+	day := time.Date(2021, 3, 1, 0, 0, 0, 0, time.Local)
+	report := Report{
+		Days:     []ReportDay{{Day: day, Created: 3, Closed: 1, Backlog: 7}},
+		Tickets:  []TicketTimes{{TicketID: 4, Created: day, FirstResponse: 90 * time.Minute}},
+		Workload: []EditorWorkload{{Editor: "Anna, Berlin", Assigned: 2, Replies: 5, Closed: 1}},
+	}
+
+	var buffer bytes.Buffer
+	assert.Nil(t, WriteReportCSV(&buffer, report, ReportSectionDaily))
+	assert.Equal(t, "date,created,closed,backlog\n2021-03-01,3,1,7\n", buffer.String())
+
+	buffer.Reset()
+	assert.Nil(t, WriteReportCSV(&buffer, report, ReportSectionTickets))
+	assert.Contains(t, buffer.String(), ",1.50,\n")
+
+	buffer.Reset()
+	assert.Nil(t, WriteReportCSV(&buffer, report, ReportSectionWorkload))
+	assert.Contains(t, buffer.String(), "\"Anna, Berlin\",2,5,1\n")
+
+	assert.NotNil(t, WriteReportCSV(&buffer, report, "customers"))
+}
+
+func TestFormatReportDuration(t *testing.T) {
+	assert.Equal(t, "0m", FormatReportDuration(0))
+	assert.Equal(t, "45m", FormatReportDuration(45*time.Minute))
+	assert.Equal(t, "3h 5m", FormatReportDuration(3*time.Hour+5*time.Minute))
+	assert.Equal(t, "2d 4h", FormatReportDuration(52*time.Hour))
+}
+
+func TestChartsSVG(t *testing.T) {
+	series := []ChartSeries{{Name: "Created", Color: "#007bff", Values: []int{1, 4, 2}}, {Name: "<Closed>", Color: "#28a745", Values: []int{0, 2}}}
+
+	bars := BarChartSVG("Tickets & more", []string{"03-01", "03-02", "03-03"}, series)
+	assert.True(t, strings.HasPrefix(bars, "<svg"))
+	assert.True(t, strings.HasSuffix(bars, "</svg>"))
+	assert.Contains(t, bars, "Tickets &amp; more")
+	assert.Contains(t, bars, "&lt;Closed&gt;")
+	assert.NotContains(t, bars, "<Closed>")
+	assert.Equal(t, 5+2, strings.Count(bars, "<rect"))
+
+	line := LineChartSVG("Backlog", []string{"03-01", "03-02", "03-03"}, series[:1])
+	assert.Equal(t, 1, strings.Count(line, "<polyline"))
+	assert.Contains(t, line, ">4</text>")
+
+	// Charts without values still have a scale
+	assert.Contains(t, BarChartSVG("Empty", nil, nil), ">1</text>")
+}
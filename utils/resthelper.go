@@ -29,6 +29,7 @@ type MailData struct {
 	EMailAddress string `xml:"emailAddress"`
 	Subject      string `xml:"subject"`
 	Message      string `xml:"message"`
+	Recipient    string `xml:"recipient,omitempty"` // Address the mail was sent to, used to route it into a queue
 }
 
 // Writes xml error response
@@ -0,0 +1,273 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+)
+
+// Kinds of the time based jobs which are run by the scheduler
+const (
+	JobReminder   = "reminder"
+	JobAutoClose  = "autoClose"
+	JobEscalation = "escalation"
+	JobHandover   = "handover"
+)
+
+// Source of the current time. The tests replace it with a fake clock to simulate the passing of days
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// A job which was already run. Jobs refer to the message which started the waiting time, so they are only run once per message
+type ScheduledJob struct {
+	Kind     string    `xml:"Kind"`
+	TicketID int       `xml:"TicketID"`
+	Since    time.Time `xml:"Since"`
+	FiredAt  time.Time `xml:"FiredAt"`
+}
+
+type SchedulerState struct {
+	Jobs []ScheduledJob `xml:"jobs>job"`
+}
+
+var schedulerClock Clock = systemClock{}
+
+var mutexScheduler = &sync.Mutex{}
+
+// Runs the scheduled jobs in the configured interval until the done channel is closed
+func StartScheduler(done <-chan bool) {
+	ticker := time.NewTicker(config.SchedulerInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := RunScheduledJobs()
+				if err != nil {
+					log.Printf("Couldn't run the scheduled jobs: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// Reminds customers who didn't answer, closes the tickets which are still unanswered after the reminder,
+// escalates idle tickets to the fallback editor and hands the tickets of absent editors over to their delegates
+func RunScheduledJobs() error {
+	now := schedulerClock.Now()
+
+	mutexScheduler.Lock()
+	defer mutexScheduler.Unlock()
+
+	state, err := ReadSchedulerState()
+	if err != nil {
+		return err
+	}
+	users, err := ReadUsers()
+	if err != nil {
+		return err
+	}
+	state.Jobs = pruneJobs(state.Jobs, users, now)
+
+	tickets := append(GetTicketsByStatus(TicketStatusOpen), GetTicketsByStatus(TicketStatusInProcess)...)
+	for _, ticket := range tickets {
+		job, run := dueJob(state.Jobs, users, ticket, now)
+		if !run {
+			continue
+		}
+
+		err = runJob(job, ticket, users)
+		if err != nil {
+			log.Printf("Couldn't run the %s job for ticket %d: %v\n", job.Kind, ticket.ID, err)
+			continue
+		}
+
+		// The state is stored after every job, so a restart never runs a job twice
+		state.Jobs = append(state.Jobs, job)
+		err = WriteToXML(state, config.SchedulerFilePath())
+		if err != nil {
+			return err
+		}
+	}
+
+	return WriteToXML(state, config.SchedulerFilePath())
+}
+
+// Returns the job which is due for the ticket, if there is any
+func dueJob(jobs []ScheduledJob, users map[string]User, ticket Ticket, now time.Time) (ScheduledJob, bool) {
+	// The absence of the editor comes first, so no job is run for a ticket nobody is working on
+	if editor, absent := absentEditor(users, ticket, now); absent {
+		if _, handedOver := findJob(jobs, JobHandover, ticket.ID, editor.Absence.From); !handedOver {
+			return ScheduledJob{Kind: JobHandover, TicketID: ticket.ID, Since: editor.Absence.From, FiredAt: now}, true
+		}
+	}
+
+	message, ok := lastPublicMessage(ticket)
+	if ok && message.Type == MessageTypeReply {
+		// The ticket is waiting for an answer of the customer
+		reminder, reminded := findJob(jobs, JobReminder, ticket.ID, message.CreationDate)
+		if !reminded {
+			due := config.ReminderAfter > 0 && now.Sub(message.CreationDate) >= config.ReminderAfter
+			return ScheduledJob{Kind: JobReminder, TicketID: ticket.ID, Since: message.CreationDate, FiredAt: now}, due
+		}
+
+		_, closed := findJob(jobs, JobAutoClose, ticket.ID, message.CreationDate)
+		due := !closed && config.AutoCloseAfter > 0 && now.Sub(reminder.FiredAt) >= config.AutoCloseAfter
+		return ScheduledJob{Kind: JobAutoClose, TicketID: ticket.ID, Since: message.CreationDate, FiredAt: now}, due
+	}
+
+	if ticket.Status != TicketStatusInProcess || config.EscalationAfter <= 0 || config.FallbackEditor == "" || ticket.Editor == config.FallbackEditor {
+		return ScheduledJob{}, false
+	}
+
+	activity := lastActivity(ticket)
+	_, escalated := findJob(jobs, JobEscalation, ticket.ID, activity)
+	due := !escalated && now.Sub(activity) >= config.EscalationAfter
+	return ScheduledJob{Kind: JobEscalation, TicketID: ticket.ID, Since: activity, FiredAt: now}, due
+}
+
+func runJob(job ScheduledJob, ticket Ticket, users map[string]User) error {
+	before := ticket
+	var eventType EventType
+	var err error
+
+	switch job.Kind {
+	case JobReminder:
+		// The mail is queued last, so a failed change of the ticket doesn't send the reminder again in the next run
+		eventType = EventTicketUpdated
+		ticket, err = AddSystemMessage(ticket, "Reminded the customer to answer")
+		if err == nil {
+			err = SendReminder(ticket)
+		}
+	case JobAutoClose:
+		// The ticket stays open until its blockers are closed, it is closed in a later run then
+		err = CheckClosable(ticket)
+		if err != nil {
+			return err
+		}
+
+		eventType = EventTicketClosed
+		ticket, err = AddSystemMessage(ticket, "Closed automatically, because the customer didn't answer")
+		if err == nil {
+			err = ChangeStatus(ticket.ID, TicketStatusClosed)
+			ticket.Status = TicketStatusClosed
+		}
+		if err == nil {
+			err = SendClosureNotice(ticket, "")
+		}
+	case JobEscalation:
+		eventType = EventTicketAssigned
+		fallback, ok := users[config.FallbackEditor]
+		if !ok {
+			return fmt.Errorf("the fallback editor %s does not exist", config.FallbackEditor)
+		}
+		// The ticket stays with its editor until the fallback editor is back, it is escalated in a later run then
+		if !fallback.IsAvailable() {
+			return fmt.Errorf("the fallback editor %s is absent", config.FallbackEditor)
+		}
+
+		ticket, err = AddSystemMessage(ticket, fmt.Sprintf("Escalated from %s to %s, because there was no activity since %s",
+			ticket.Editor, config.FallbackEditor, job.Since.Format("2006-01-02 15:04")))
+		if err == nil {
+			err = ChangeEditor(ticket.ID, config.FallbackEditor)
+			ticket.Editor = config.FallbackEditor
+		}
+	case JobHandover:
+		absent := users[ticket.Editor]
+		ticket, eventType, err = handOverTicket(ticket, absent, users)
+		if err == nil && absent.Absence.NotifyCustomers {
+			err = SendHandoverNotice(ticket, ticket.Editor)
+		}
+	default:
+		return fmt.Errorf("unknown job %q", job.Kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	PublishEvent(Event{Type: eventType, Ticket: ticket, Actor: SystemActor, Source: SourceSystem, Timestamp: job.FiredAt,
+		Changes: TicketChanges(before, ticket), Details: map[string]string{"job": job.Kind}})
+	return nil
+}
+
+// Returns the date of the last message which wasn't recorded by the ticket system itself
+func lastActivity(ticket Ticket) time.Time {
+	for i := len(ticket.MessageList) - 1; i >= 0; i-- {
+		if ticket.MessageList[i].Type != MessageTypeSystem {
+			return ticket.MessageList[i].CreationDate
+		}
+	}
+
+	return time.Time{}
+}
+
+func findJob(jobs []ScheduledJob, kind string, ticketID int, since time.Time) (ScheduledJob, bool) {
+	for _, job := range jobs {
+		if job.Kind == kind && job.TicketID == ticketID && job.Since.Equal(since) {
+			return job, true
+		}
+	}
+
+	return ScheduledJob{}, false
+}
+
+// Removes the jobs which refer to deleted or closed tickets, to messages which were already answered or to absences
+// which are over
+func pruneJobs(jobs []ScheduledJob, users map[string]User, now time.Time) []ScheduledJob {
+	var current []ScheduledJob
+	for _, job := range jobs {
+		ticket, err := ReadTicket(job.TicketID)
+		if err != nil || ticket.Status == TicketStatusClosed {
+			continue
+		}
+
+		var since time.Time
+		switch job.Kind {
+		case JobEscalation:
+			since = lastActivity(ticket)
+		case JobHandover:
+			if editor, absent := absentEditor(users, ticket, now); absent {
+				since = editor.Absence.From
+			}
+		default:
+			message, _ := lastPublicMessage(ticket)
+			since = message.CreationDate
+		}
+		if job.Since.Equal(since) {
+			current = append(current, job)
+		}
+	}
+
+	return current
+}
+
+// Returns the jobs which were already run
+func ReadSchedulerState() (SchedulerState, error) {
+	file, err := ioutil.ReadFile(config.SchedulerFilePath())
+	if err != nil {
+		return SchedulerState{}, err
+	}
+
+	var state SchedulerState
+	err = xml.Unmarshal(file, &state)
+	if err != nil {
+		return SchedulerState{}, err
+	}
+
+	return state, nil
+}
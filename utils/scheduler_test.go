@@ -0,0 +1,251 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(duration time.Duration) {
+	clock.now = clock.now.Add(duration)
+}
+
+// Replaces the clock of the scheduler until the returned function is called
+func useFakeClock() (*fakeClock, func()) {
+	clock := &fakeClock{now: time.Now()}
+	schedulerClock = clock
+	return clock, func() { schedulerClock = systemClock{} }
+}
+
+func countMails(t *testing.T) int {
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	return len(mailList.MailList)
+}
+
+func TestSchedulerReminderAndAutoClose(t *testing.T) {
+	setup()
+	defer teardown()
+
+	clock, reset := useFakeClock()
+	defer reset()
+
+	_, err := CreateUser("Test123", "Aa!123456")
+	assert.Nil(t, err)
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	ticket, err = AddReply(ticket, "Test123", "Did you restart it?")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeEditor(ticket.ID, "Test123"))
+	assert.Nil(t, ChangeStatus(ticket.ID, TicketStatusInProcess))
+
+	var received []Event
+	SubscribeEvents(func(event Event) {
+		if event.TicketID == ticket.ID && event.Actor == SystemActor && event.Details["job"] != "" {
+			received = append(received, event)
+		}
+	})
+
+	// Nothing happens before the reminder is due
+	mails := countMails(t)
+	clock.Advance(config.ReminderAfter - time.Hour)
+	assert.Nil(t, RunScheduledJobs())
+	assert.Equal(t, mails, countMails(t))
+
+	clock.Advance(2 * time.Hour)
+	assert.Nil(t, RunScheduledJobs())
+	assert.Equal(t, mails+1, countMails(t))
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, JobReminder, received[0].Details["job"])
+
+	// Running the scheduler again doesn't send a second reminder
+	assert.Nil(t, RunScheduledJobs())
+	assert.Equal(t, mails+1, countMails(t))
+
+	clock.Advance(config.AutoCloseAfter + time.Minute)
+	assert.Nil(t, RunScheduledJobs())
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusClosed, ticket.Status)
+	assert.Equal(t, MessageTypeSystem, ticket.MessageList[len(ticket.MessageList)-1].Type)
+	assert.Equal(t, 2, len(received))
+	assert.Equal(t, EventTicketClosed, received[1].Type)
+	assert.Equal(t, SourceSystem, received[1].Source)
+
+	state, err := ReadSchedulerState()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(state.Jobs))
+}
+
+func TestSchedulerCustomerAnswerResetsReminder(t *testing.T) {
+	setup()
+	defer teardown()
+
+	clock, reset := useFakeClock()
+	defer reset()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	ticket, err = AddReply(ticket, "Test123", "Did you restart it?")
+	assert.Nil(t, err)
+
+	clock.Advance(config.ReminderAfter + time.Minute)
+	assert.Nil(t, RunScheduledJobs())
+	state, err := ReadSchedulerState()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(state.Jobs))
+
+	// The answer of the customer stops the auto-close and the old reminder is forgotten
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	_, err = AddMessage(ticket, ticket.Client, "Yes, it still doesn't work")
+	assert.Nil(t, err)
+
+	clock.Advance(config.AutoCloseAfter + time.Minute)
+	assert.Nil(t, RunScheduledJobs())
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusOpen, ticket.Status)
+
+	state, err = ReadSchedulerState()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(state.Jobs))
+}
+
+func TestSchedulerEscalation(t *testing.T) {
+	setup()
+	defer teardown()
+
+	clock, reset := useFakeClock()
+	defer reset()
+
+	config.FallbackEditor = "Fallback"
+	defer func() { config.FallbackEditor = "" }()
+
+	_, err := CreateUser("Test123", "Aa!123456")
+	assert.Nil(t, err)
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeEditor(ticket.ID, "Test123"))
+	assert.Nil(t, ChangeStatus(ticket.ID, TicketStatusInProcess))
+
+	// The escalation fails as long as the fallback editor doesn't exist
+	clock.Advance(config.EscalationAfter + time.Minute)
+	assert.Nil(t, RunScheduledJobs())
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Test123", ticket.Editor)
+
+	// An absent fallback editor doesn't get the ticket either
+	_, err = CreateUser("Fallback", "Aa!123456")
+	assert.Nil(t, err)
+	assert.Nil(t, SetUserHolidayMode("Fallback", true))
+	assert.Nil(t, RunScheduledJobs())
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Test123", ticket.Editor)
+
+	assert.Nil(t, SetUserHolidayMode("Fallback", false))
+	assert.Nil(t, RunScheduledJobs())
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Fallback", ticket.Editor)
+	assert.Equal(t, TicketStatusInProcess, ticket.Status)
+
+	// A reassignment without new activity doesn't escalate the ticket a second time
+	assert.Nil(t, ChangeEditor(ticket.ID, "Test123"))
+	clock.Advance(config.EscalationAfter + time.Minute)
+	assert.Nil(t, RunScheduledJobs())
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Test123", ticket.Editor)
+}
+
+func TestSchedulerDoesNotCloseBlockedTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	clock, reset := useFakeClock()
+	defer reset()
+
+	ids := createTickets(t, "PC problem", "Network outage")
+	ticket, err := ReadTicket(ids[0])
+	assert.Nil(t, err)
+	_, err = AddReply(ticket, "Test123", "Did you restart it?")
+	assert.Nil(t, err)
+	assert.Nil(t, LinkTickets(ids[0], ids[1], RelationBlockedBy, "Test123"))
+
+	clock.Advance(config.ReminderAfter + time.Minute)
+	assert.Nil(t, RunScheduledJobs())
+	clock.Advance(config.AutoCloseAfter + time.Minute)
+	assert.Nil(t, RunScheduledJobs())
+	ticket, err = ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusOpen, ticket.Status)
+
+	// The ticket is closed in the first run after its blocker was closed
+	assert.Nil(t, ChangeStatus(ids[1], TicketStatusClosed))
+	assert.Nil(t, RunScheduledJobs())
+	ticket, err = ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusClosed, ticket.Status)
+}
+
+func TestSchedulerPrunesClosedTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	clock, reset := useFakeClock()
+	defer reset()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	_, err = AddReply(ticket, "Test123", "Did you restart it?")
+	assert.Nil(t, err)
+
+	clock.Advance(config.ReminderAfter + time.Minute)
+	assert.Nil(t, RunScheduledJobs())
+	state, err := ReadSchedulerState()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(state.Jobs))
+
+	assert.Nil(t, ChangeStatus(ticket.ID, TicketStatusClosed))
+	assert.Nil(t, RunScheduledJobs())
+	state, err = ReadSchedulerState()
+	assert.Nil(t, err)
+	assert.Empty(t, state.Jobs)
+}
+
+func TestSchedulerStatePersists(t *testing.T) {
+	setup()
+	defer teardown()
+
+	clock, reset := useFakeClock()
+	defer reset()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	_, err = AddReply(ticket, "Test123", "Did you restart it?")
+	assert.Nil(t, err)
+
+	mails := countMails(t)
+	clock.Advance(config.ReminderAfter + time.Minute)
+	assert.Nil(t, RunScheduledJobs())
+	assert.Equal(t, mails+1, countMails(t))
+
+	// Clearing the ticket cache simulates a restart of the server, the job state is read from the file again
+	ticketMap = make(map[int]Ticket)
+	assert.Nil(t, RunScheduledJobs())
+	assert.Equal(t, mails+1, countMails(t))
+}
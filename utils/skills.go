@@ -0,0 +1,102 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Available editor with the tags of a ticket which match their skills
+type EditorMatch struct {
+	EditorLoad
+	Matched     []string
+	Explanation string // Why the editor was proposed, it is shown on the ticket
+}
+
+// Splits the comma separated tags, they are compared case insensitively, so all tags are stored in lower case
+func ParseTags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(text, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	sort.Strings(tags)
+	return tags
+}
+
+// Returns the tags separated by commas like they are entered in the form
+func (ticket Ticket) TagsText() string {
+	return strings.Join(ticket.Tags, ", ")
+}
+
+func (user User) SkillsText() string {
+	return strings.Join(user.Skills, ", ")
+}
+
+func (ticket Ticket) HasTag(tag string) bool {
+	for _, t := range ticket.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Proposes the available editors for the ticket. The editors with the most skills matching the tags of the ticket
+// come first, editors with the same number of matches are ordered by their load
+func ProposeEditors(ticket Ticket) ([]EditorMatch, error) {
+	users, err := ReadUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	available, err := availableEditors(ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []EditorMatch
+	for _, load := range available {
+		match := EditorMatch{EditorLoad: load}
+		for _, skill := range users[load.Username].Skills {
+			if ticket.HasTag(skill) {
+				match.Matched = append(match.Matched, strings.ToLower(skill))
+			}
+		}
+		match.Explanation = explainMatch(ticket, match)
+		matches = append(matches, match)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if len(matches[i].Matched) != len(matches[j].Matched) {
+			return len(matches[i].Matched) > len(matches[j].Matched)
+		}
+		return matches[i].Tickets < matches[j].Tickets
+	})
+	return matches, nil
+}
+
+func explainMatch(ticket Ticket, match EditorMatch) string {
+	var explanation string
+	switch {
+	case len(ticket.Tags) == 0:
+		explanation = "the ticket has no tags"
+	case len(match.Matched) == 0:
+		explanation = "no skill matches the tags"
+	default:
+		explanation = fmt.Sprintf("skills %s match %d of %d tags", strings.Join(match.Matched, ", "), len(match.Matched), len(ticket.Tags))
+	}
+
+	explanation += fmt.Sprintf(", %d unfinished tickets", match.Tickets)
+	if match.Capacity > 0 {
+		explanation += fmt.Sprintf(" of %d", match.Capacity)
+	}
+	return explanation
+}
@@ -0,0 +1,88 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	assert.Equal(t, []string{"billing", "network"}, ParseTags(" Network, billing,,BILLING "))
+	assert.Nil(t, ParseTags(" "))
+	assert.Equal(t, "billing, network", Ticket{Tags: []string{"billing", "network"}}.TagsText())
+}
+
+func TestProposeEditors(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna", "Bert", "Carl", "Dora")
+	assert.Nil(t, SetUserSkills("Anna", []string{"network"}))
+	assert.Nil(t, SetUserSkills("Bert", []string{"billing", "network"}))
+	assert.Nil(t, SetUserSkills("Carl", []string{"billing", "network"}))
+	assert.Nil(t, SetUserSkills("Dora", []string{"billing", "network"}))
+	assert.Nil(t, SetUserHolidayMode("Dora", true))
+
+	busy, err := CreateTicket("client@dhbw.de", "Old problem", "Help")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeEditor(busy.ID, "Bert"))
+
+	ticket, err := CreateTicket("client@dhbw.de", "Invoice", "The wrong amount was charged")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeTags(ticket.ID, []string{"billing", "network"}))
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+
+	// Editors in the holidays are excluded, equal matches are ordered by the load
+	matches, err := ProposeEditors(ticket)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(matches))
+	assert.Equal(t, "Carl", matches[0].Username)
+	assert.Equal(t, "Bert", matches[1].Username)
+	assert.Equal(t, "Anna", matches[2].Username)
+	assert.Equal(t, "skills billing, network match 2 of 2 tags, 0 unfinished tickets", matches[0].Explanation)
+	assert.Equal(t, "skills network match 1 of 2 tags, 0 unfinished tickets", matches[2].Explanation)
+
+	// Only members of the queue of the ticket are proposed
+	queue, err := CreateQueue(Queue{Name: "Network", Members: []string{"Anna"}})
+	assert.Nil(t, err)
+	ticket, err = MoveTicket(ticket, queue.ID, "Anna")
+	assert.Nil(t, err)
+	matches, err = ProposeEditors(ticket)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(matches))
+	assert.Equal(t, "Anna", matches[0].Username)
+
+	untagged, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	matches, err = ProposeEditors(untagged)
+	assert.Nil(t, err)
+	assert.Equal(t, "the ticket has no tags, 0 unfinished tickets", matches[0].Explanation)
+}
+
+func TestAutoAssignSkill(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna", "Bert")
+	assert.Nil(t, SetUserSkills("Bert", []string{"billing"}))
+
+	ticket, err := CreateTicket("client@dhbw.de", "Invoice", "The wrong amount was charged")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeTags(ticket.ID, []string{"billing"}))
+	assert.Nil(t, AutoAssignTicket(ticket.ID, AssignmentSkill))
+
+	// The explanation of the match is recorded in the ticket
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Bert", ticket.Editor)
+	assert.Equal(t, "Assigned automatically to Bert by skills: skills billing match 1 of 1 tags, 0 unfinished tickets",
+		ticket.MessageList[len(ticket.MessageList)-1].Text)
+
+	before := ticket
+	assert.Nil(t, ChangeTags(ticket.ID, []string{"billing", "refund"}))
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []FieldChange{{Field: "tags", Before: "billing", After: "billing, refund"}}, TicketChanges(before, ticket))
+}
@@ -0,0 +1,79 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Moves the messages with the indexes into a new ticket of the same client with the subject. The first message stays
+// in the ticket because it describes the original request, system messages can't be moved. Both tickets are linked
+// as related tickets, the new one takes over the editor, queue, priority and language of the original ticket
+func SplitTicket(id int, indexes []int, subject string, actor string) (Ticket, error) {
+	ticket, err := ReadTicket(id)
+	if err != nil {
+		return Ticket{}, err
+	}
+	if ticket.IsMerged() {
+		return Ticket{}, fmt.Errorf("tickets which were merged into another one can't be split")
+	}
+	if subject == "" || !CheckEmptyXSSString(subject) {
+		return Ticket{}, fmt.Errorf("the new ticket needs a valid subject")
+	}
+	if len(indexes) == 0 {
+		return Ticket{}, fmt.Errorf("at least one message has to be selected")
+	}
+
+	selected := make(map[int]bool)
+	for _, i := range indexes {
+		if i <= 0 || i >= len(ticket.MessageList) {
+			return Ticket{}, fmt.Errorf("the ticket has no message %d which can be split", i)
+		}
+		if ticket.MessageList[i].Type == MessageTypeSystem {
+			return Ticket{}, fmt.Errorf("system messages can't be split")
+		}
+		selected[i] = true
+	}
+
+	var kept, moved []Message
+	for i, message := range ticket.MessageList {
+		if selected[i] {
+			moved = append(moved, message)
+		} else {
+			kept = append(kept, message)
+		}
+	}
+	sort.SliceStable(moved, func(i, j int) bool {
+		return moved[i].CreationDate.Before(moved[j].CreationDate)
+	})
+
+	newTicket, err := CreateTicket(ticket.Client, subject, moved[0].Text)
+	if err != nil {
+		return Ticket{}, err
+	}
+	// The new ticket keeps the messages as they were written instead of the one created with it
+	newTicket.MessageList = moved
+	newTicket.Editor = ticket.Editor
+	newTicket.Status = ReopenedStatus(ticket)
+	newTicket.Queue = ticket.Queue
+	newTicket.Priority = ticket.Priority
+	newTicket.Language = ticket.Language
+	_, err = AddSystemMessage(newTicket, fmt.Sprintf("Split from ticket %d by %s", ticket.ID, actor))
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	ticket.MessageList = kept
+	_, err = AddSystemMessage(ticket, fmt.Sprintf("%d messages split into ticket %d by %s", len(moved), newTicket.ID, actor))
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	err = LinkTickets(ticket.ID, newTicket.ID, RelationRelated, actor)
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	return ReadTicket(newTicket.ID)
+}
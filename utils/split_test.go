@@ -0,0 +1,68 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSplitTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket, err := CreateTicket("client@dhbw.de", "Printer broken", "The printer does not work")
+	assert.Nil(t, err)
+	ticket, err = AddMessage(ticket, "client@dhbw.de", "By the way, my password expired")
+	assert.Nil(t, err)
+	ticket, err = AddSystemMessage(ticket, "Assigned to Anna")
+	assert.Nil(t, err)
+	ticket, err = AddMessage(ticket, "client@dhbw.de", "And I can't log in anymore")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeEditor(ticket.ID, "Anna"))
+	assert.Nil(t, ChangeStatus(ticket.ID, TicketStatusInProcess))
+	assert.Nil(t, ChangePriority(ticket.ID, 2))
+
+	_, err = SplitTicket(ticket.ID, []int{1}, "", "Anna")
+	assert.NotNil(t, err)
+	_, err = SplitTicket(ticket.ID, nil, "Password expired", "Anna")
+	assert.NotNil(t, err)
+	_, err = SplitTicket(ticket.ID, []int{0}, "Password expired", "Anna")
+	assert.NotNil(t, err)
+	_, err = SplitTicket(ticket.ID, []int{2}, "Password expired", "Anna")
+	assert.NotNil(t, err)
+	_, err = SplitTicket(ticket.ID, []int{9}, "Password expired", "Anna")
+	assert.NotNil(t, err)
+
+	newTicket, err := SplitTicket(ticket.ID, []int{3, 1}, "Password expired", "Anna")
+	assert.Nil(t, err)
+
+	// The new ticket keeps the moved messages and takes over the settings of the original ticket
+	assert.Equal(t, "client@dhbw.de", newTicket.Client)
+	assert.Equal(t, "Password expired", newTicket.Reference)
+	assert.Equal(t, "Anna", newTicket.Editor)
+	assert.Equal(t, TicketStatusInProcess, newTicket.Status)
+	assert.Equal(t, 2, newTicket.Priority)
+	assert.Equal(t, "By the way, my password expired", newTicket.MessageList[0].Text)
+	assert.Equal(t, "And I can't log in anymore", newTicket.MessageList[1].Text)
+	assert.Equal(t, "Split from ticket 1 by Anna", newTicket.MessageList[2].Text)
+	assert.Equal(t, []Relation{{Type: RelationRelated, Ticket: ticket.ID}}, newTicket.Relations)
+
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "The printer does not work", ticket.MessageList[0].Text)
+	assert.Equal(t, "Assigned to Anna", ticket.MessageList[1].Text)
+	assert.Equal(t, "2 messages split into ticket 2 by Anna", ticket.MessageList[2].Text)
+	assert.Equal(t, []Relation{{Type: RelationRelated, Ticket: newTicket.ID}}, ticket.Relations)
+
+	// The customer is told the ID of the new ticket
+	mails := countMails(t)
+	assert.Nil(t, SendSplitNotice(newTicket, ticket, "Anna"))
+	assert.Equal(t, mails+1, countMails(t))
+	data := NewMailTemplateData(newTicket, "Anna", "")
+	data.Related = ticket
+	subject, body, err := RenderMailTemplate(splitTemplate, "de", data)
+	assert.Nil(t, err)
+	assert.Contains(t, subject, TicketReferenceToken(newTicket.ID))
+	assert.Contains(t, body, "Ticket 1")
+}
@@ -0,0 +1,269 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var ticketFileRegExp = regexp.MustCompile(`^ticket(\d+)\.xml$`)
+
+// Storage backends of the tickets
+const (
+	StorageXML = "xml" // One XML file per ticket and the last ticket ID in definitions.xml
+	StorageLog = "log" // Single append-only file with an index in memory, see logTicketStore
+)
+
+// Stores the tickets and the counter of their IDs. The other data of the ticket system is always stored as XML
+type TicketStore interface {
+	ReadTicket(id int) (Ticket, error)
+	StoreTicket(ticket Ticket) error
+	DeleteTicket(id int) error
+	TicketIDs() ([]int, error) // IDs of all stored tickets in ascending order
+	LastTicketID() int         // ID of the last created ticket, -1 if it can't be read
+	SetLastTicketID(id int) error
+	Close() error
+}
+
+// Stores which index the status and the editor of their tickets, so the tickets with one of them are found without
+// reading every ticket
+type indexedTicketStore interface {
+	TicketIDsByStatus(status int) []int // IDs in ascending order
+	TicketIDsByEditor(editor string) []int
+}
+
+// Store of the configured backend, it is opened by InitDataStorage
+var ticketStore TicketStore = xmlTicketStore{}
+
+func IsStorageBackend(backend string) bool {
+	return backend == StorageXML || backend == StorageLog
+}
+
+// Opens the store of the backend in the data folder and creates its files if they don't exist
+func OpenTicketStore(backend string) (TicketStore, error) {
+	switch backend {
+	case StorageXML:
+		return openXMLTicketStore()
+	case StorageLog:
+		return openLogTicketStore(config.TicketLogFilePath())
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// Replaces the store of the ticket system with the one of the configured backend
+func openConfiguredTicketStore() error {
+	err := ticketStore.Close()
+	if err != nil {
+		return err
+	}
+
+	store, err := OpenTicketStore(config.StorageBackend)
+	if err != nil {
+		ticketStore = xmlTicketStore{}
+		return err
+	}
+	ticketStore = store
+	return nil
+}
+
+// Returns the IDs of all stored tickets in ascending order, tickets can't be listed if the store fails
+func storedTicketIDs() []int {
+	ids, err := ticketStore.TicketIDs()
+	if err != nil {
+		return nil
+	}
+	return ids
+}
+
+// Returns the IDs of the tickets which may have the status, stores without an index return all IDs
+func ticketIDsByStatus(status int) []int {
+	if store, ok := ticketStore.(indexedTicketStore); ok {
+		return store.TicketIDsByStatus(status)
+	}
+	return storedTicketIDs()
+}
+
+// Returns the IDs of the tickets which may be owned by the editor, stores without an index return all IDs
+func ticketIDsByEditor(editor string) []int {
+	if store, ok := ticketStore.(indexedTicketStore); ok {
+		return store.TicketIDsByEditor(editor)
+	}
+	return storedTicketIDs()
+}
+
+// Copies all tickets and the ID counter into the empty target store, the source store is left unchanged so
+// the migration can be undone by switching back to its backend. Returns the number of copied tickets
+func MigrateTickets(source TicketStore, target TicketStore) (int, error) {
+	existing, err := target.TicketIDs()
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) > 0 {
+		return 0, fmt.Errorf("the target store already contains %d tickets", len(existing))
+	}
+
+	ids, err := source.TicketIDs()
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		ticket, err := source.ReadTicket(id)
+		if err != nil {
+			return i, err
+		}
+		err = target.StoreTicket(ticket)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	lastID := source.LastTicketID()
+	if len(ids) > 0 && ids[len(ids)-1] > lastID {
+		lastID = ids[len(ids)-1]
+	}
+	return len(ids), target.SetLastTicketID(maxInt(lastID, 0))
+}
+
+// Copies the tickets of the source backend into the configured one, which has to be empty
+func MigrateTicketStorage(source string) (int, error) {
+	if source == config.StorageBackend {
+		return 0, fmt.Errorf("the tickets are already stored with the backend %s", source)
+	}
+
+	err := InitDataStorage()
+	if err != nil {
+		return 0, err
+	}
+	sourceStore, err := OpenTicketStore(source)
+	if err != nil {
+		return 0, err
+	}
+	count, err := MigrateTickets(sourceStore, ticketStore)
+	closeErr := sourceStore.Close()
+	if err != nil {
+		return count, err
+	}
+	return count, closeErr
+}
+
+// Stores every ticket in its own XML file and caches the last read tickets in ticketMap. Tickets are returned as
+// copies, so changes of the callers don't reach the cache
+type xmlTicketStore struct{}
+
+func openXMLTicketStore() (TicketStore, error) {
+	err := os.MkdirAll(config.TicketsPath(), 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(config.DefinitionsFilePath())
+	if os.IsNotExist(err) {
+		err = WriteToXML(0, config.DefinitionsFilePath())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mutexTicketMap.Lock()
+	ticketMap = make(map[int]Ticket)
+	mutexTicketMap.Unlock()
+	return xmlTicketStore{}, nil
+}
+
+func (store xmlTicketStore) ReadTicket(id int) (Ticket, error) {
+	mutexTicketMap.Lock()
+	defer mutexTicketMap.Unlock()
+
+	if ticketMap[id].ID != 0 {
+		return ticketMap[id].copy(), nil
+	}
+
+	file, err := ioutil.ReadFile(config.TicketXMLPath(id))
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	var ticket Ticket
+	err = xml.Unmarshal(file, &ticket)
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	err = checkCache()
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	ticketMap[ticket.ID] = ticket
+	return ticket.copy(), nil
+}
+
+func (store xmlTicketStore) StoreTicket(ticket Ticket) error {
+	mutexTicketMap.Lock()
+	defer mutexTicketMap.Unlock()
+
+	delete(ticketMap, ticket.ID)
+	return WriteToXML(ticket, config.TicketXMLPath(ticket.ID))
+}
+
+func (store xmlTicketStore) DeleteTicket(id int) error {
+	mutexTicketMap.Lock()
+	defer mutexTicketMap.Unlock()
+
+	delete(ticketMap, id)
+	return os.Remove(config.TicketXMLPath(id))
+}
+
+func (store xmlTicketStore) TicketIDs() ([]int, error) {
+	entries, err := ioutil.ReadDir(config.TicketsPath())
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, entry := range entries {
+		match := ticketFileRegExp.FindStringSubmatch(entry.Name())
+		if match != nil {
+			id, _ := strconv.Atoi(match[1])
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// Unexpected errors will return -1
+func (store xmlTicketStore) LastTicketID() int {
+	file, err := ioutil.ReadFile(config.DefinitionsFilePath())
+	if err != nil {
+		return -1
+	}
+
+	var IDCounter int
+	err = xml.Unmarshal(file, &IDCounter)
+	if err != nil {
+		return -1
+	}
+
+	return IDCounter
+}
+
+func (store xmlTicketStore) SetLastTicketID(id int) error {
+	return WriteToXML(id, config.DefinitionsFilePath())
+}
+
+func (store xmlTicketStore) Close() error {
+	mutexTicketMap.Lock()
+	defer mutexTicketMap.Unlock()
+
+	ticketMap = make(map[int]Ticket)
+	return nil
+}
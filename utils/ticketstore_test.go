@@ -0,0 +1,339 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/binary"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// Checks the behavior every storage backend has to provide, it is run against each of them
+func testTicketStoreConformance(t *testing.T, backend string) {
+	setup()
+	defer teardown()
+
+	store, err := OpenTicketStore(backend)
+	assert.Nil(t, err)
+	defer func() { assert.Nil(t, store.Close()) }()
+
+	// An empty store
+	assert.Equal(t, 0, store.LastTicketID())
+	ids, err := store.TicketIDs()
+	assert.Nil(t, err)
+	assert.Empty(t, ids)
+	_, err = store.ReadTicket(1)
+	assert.NotNil(t, err)
+	assert.NotNil(t, store.DeleteTicket(1))
+
+	// Every field survives storing and reading
+	day := time.Date(2021, 3, 1, 9, 30, 0, 0, time.UTC)
+	ticket := Ticket{ID: 1, Client: "client@dhbw.de", Reference: "Printer <broken> & more", Status: TicketStatusInProcess, Editor: "Anna",
+		MessageList: []Message{
+			{CreationDate: day, Actor: "client@dhbw.de", Text: "Help\nplease", Type: MessageTypeCustomer},
+			{CreationDate: day.Add(time.Hour), Actor: "Anna", Text: "Restart it", Type: MessageTypeReply, MailID: 3, MergedFrom: 2},
+		},
+		Language: "de", Priority: TicketPriorityHigh, Queue: 2, Tags: []string{"hardware", "printer"},
+		Fields: []FieldValue{{ID: 1, Values: []string{"a", "b"}}}, Relations: []Relation{{Type: RelationRelated, Ticket: 3, MergedFrom: 4}}, Merged: []int{4}, ImportedFrom: "A-7", ImportSource: "OTRS"}
+	assert.Nil(t, store.StoreTicket(ticket))
+	assert.Nil(t, store.SetLastTicketID(1))
+	read, err := store.ReadTicket(1)
+	assert.Nil(t, err)
+	read.XMLName = xml.Name{}
+	assert.Equal(t, ticket, read)
+
+	// Storing a ticket again replaces it
+	ticket.Status = TicketStatusClosed
+	ticket.MessageList = append(ticket.MessageList, Message{CreationDate: day.Add(2 * time.Hour), Actor: SystemActor, Text: "Closed", Type: MessageTypeSystem})
+	assert.Nil(t, store.StoreTicket(ticket))
+	read, err = store.ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusClosed, read.Status)
+	assert.Equal(t, 3, len(read.MessageList))
+
+	for _, id := range []int{3, 2} {
+		assert.Nil(t, store.StoreTicket(Ticket{ID: id, Client: "client@dhbw.de", Reference: "Outage"}))
+	}
+	assert.Nil(t, store.SetLastTicketID(3))
+	assert.Nil(t, store.DeleteTicket(2))
+	_, err = store.ReadTicket(2)
+	assert.NotNil(t, err)
+	ids, err = store.TicketIDs()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 3}, ids)
+
+	// Deleting the last ticket doesn't free its ID
+	assert.Nil(t, store.DeleteTicket(3))
+	assert.Equal(t, 3, store.LastTicketID())
+
+	// Everything is kept when the store is opened again
+	assert.Nil(t, store.Close())
+	store, err = OpenTicketStore(backend)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, store.LastTicketID())
+	ids, err = store.TicketIDs()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, ids)
+	read, err = store.ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketStatusClosed, read.Status)
+	assert.Equal(t, "Printer <broken> & more", read.Reference)
+}
+
+func TestXMLTicketStoreConformance(t *testing.T) {
+	testTicketStoreConformance(t, StorageXML)
+}
+
+func TestLogTicketStoreConformance(t *testing.T) {
+	testTicketStoreConformance(t, StorageLog)
+}
+
+func TestOpenTicketStore(t *testing.T) {
+	setup()
+	defer teardown()
+
+	assert.True(t, IsStorageBackend(StorageLog))
+	assert.False(t, IsStorageBackend("sql"))
+	_, err := OpenTicketStore("sql")
+	assert.NotNil(t, err)
+
+	// Files which aren't ticket logs are not overwritten
+	assert.Nil(t, ioutil.WriteFile(config.TicketLogFilePath(), []byte("<tickets/>"), 0644))
+	_, err = OpenTicketStore(StorageLog)
+	assert.NotNil(t, err)
+}
+
+// The whole ticket system works with the log backend
+func TestLogStorageBackend(t *testing.T) {
+	config.StorageBackend = StorageLog
+	defer func() { config.StorageBackend = StorageXML }()
+	setup()
+	defer teardown()
+
+	ids := createTickets(t, "Outage", "Printer broken", "No internet")
+	assert.Nil(t, ChangeStatus(ids[1], TicketStatusClosed))
+	assert.Nil(t, MergeTickets(ids[0], ids[2], "Anna"))
+	assert.Equal(t, []int{ids[0]}, ticketIDs(GetTicketsByStatus(TicketStatusOpen)))
+	assert.Equal(t, 3, getTicketIDCounter())
+	_, err := os.Stat(config.TicketXMLPath(1))
+	assert.True(t, os.IsNotExist(err))
+
+	// Opening the storage again reads the tickets from the log
+	assert.Nil(t, InitDataStorage())
+	ticket, err := ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(ticket.MessageList))
+	assert.Equal(t, 3, getTicketIDCounter())
+}
+
+func ticketIDs(tickets []Ticket) []int {
+	var ids []int
+	for _, ticket := range tickets {
+		ids = append(ids, ticket.ID)
+	}
+	return ids
+}
+
+func TestLogTicketStoreRecovery(t *testing.T) {
+	setup()
+	defer teardown()
+
+	store, err := openLogTicketStore(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	assert.Nil(t, store.StoreTicket(Ticket{ID: 1, Client: "client@dhbw.de", Reference: "Outage"}))
+	assert.Nil(t, store.SetLastTicketID(1))
+	assert.Nil(t, store.Close())
+	info, err := os.Stat(config.TicketLogFilePath())
+	assert.Nil(t, err)
+
+	// The ticket system stopped while it was writing the next record
+	record := encodeLogRecord(logRecordTicket, 2, []byte("<Ticket><ID>2</ID></Ticket>"))
+	file, err := os.OpenFile(config.TicketLogFilePath(), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = file.Write(record[:len(record)-5])
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	store, err = openLogTicketStore(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	recovered, err := os.Stat(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	assert.Equal(t, info.Size(), recovered.Size())
+	ids, err := store.TicketIDs()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, ids)
+	assert.Equal(t, 1, store.LastTicketID())
+
+	// New records follow the last complete one
+	assert.Nil(t, store.StoreTicket(Ticket{ID: 2, Client: "client@dhbw.de", Reference: "Printer broken"}))
+	assert.Nil(t, store.Close())
+	store, err = openLogTicketStore(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	ticket, err := store.ReadTicket(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Printer broken", ticket.Reference)
+	assert.Nil(t, store.Close())
+	_, err = store.ReadTicket(2)
+	assert.NotNil(t, err)
+}
+
+func TestLogTicketStoreDamagedRecords(t *testing.T) {
+	setup()
+	defer teardown()
+
+	store, err := openLogTicketStore(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	for id := 1; id <= 3; id++ {
+		assert.Nil(t, store.StoreTicket(Ticket{ID: id, Client: "client@dhbw.de", Reference: "Outage"}))
+	}
+	second, last := store.index[2], store.index[3]
+	assert.Nil(t, store.Close())
+	content, err := ioutil.ReadFile(config.TicketLogFilePath())
+	assert.Nil(t, err)
+
+	// A damaged record in the middle of the log is not cut off with all later records
+	damaged := append([]byte{}, content...)
+	damaged[second.offset] ^= 0xFF
+	assert.Nil(t, ioutil.WriteFile(config.TicketLogFilePath(), damaged, 0644))
+	_, err = openLogTicketStore(config.TicketLogFilePath())
+	assert.NotNil(t, err)
+	kept, err := ioutil.ReadFile(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	assert.Equal(t, damaged, kept)
+
+	// Neither is a record in the middle whose damaged length runs past the end of the log
+	damaged = append([]byte{}, content...)
+	binary.BigEndian.PutUint32(damaged[second.offset-logRecordHeaderSize+9:], uint32(len(content)))
+	assert.Nil(t, ioutil.WriteFile(config.TicketLogFilePath(), damaged, 0644))
+	_, err = openLogTicketStore(config.TicketLogFilePath())
+	assert.NotNil(t, err)
+	kept, err = ioutil.ReadFile(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	assert.Equal(t, damaged, kept)
+
+	// A damaged record at the end was written only partly and is cut off
+	damaged = append([]byte{}, content...)
+	damaged[last.offset] ^= 0xFF
+	assert.Nil(t, ioutil.WriteFile(config.TicketLogFilePath(), damaged, 0644))
+	store, err = openLogTicketStore(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	defer func() { assert.Nil(t, store.Close()) }()
+	ids, err := store.TicketIDs()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2}, ids)
+}
+
+func TestLogTicketStoreIndex(t *testing.T) {
+	setup()
+	defer teardown()
+
+	store, err := openLogTicketStore(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	assert.Nil(t, store.StoreTicket(Ticket{ID: 1, Status: TicketStatusInProcess, Editor: "Anna"}))
+	assert.Nil(t, store.StoreTicket(Ticket{ID: 2, Status: TicketStatusOpen}))
+	assert.Nil(t, store.StoreTicket(Ticket{ID: 3, Status: TicketStatusInProcess, Editor: "Bert"}))
+	assert.Nil(t, store.StoreTicket(Ticket{ID: 3, Status: TicketStatusClosed, Editor: "Anna"}))
+	assert.Nil(t, store.StoreTicket(Ticket{ID: 4, Status: TicketStatusOpen}))
+	assert.Nil(t, store.DeleteTicket(4))
+
+	check := func() {
+		assert.Equal(t, []int{1}, store.TicketIDsByStatus(TicketStatusInProcess))
+		assert.Equal(t, []int{2}, store.TicketIDsByStatus(TicketStatusOpen))
+		assert.Equal(t, []int{3}, store.TicketIDsByStatus(TicketStatusClosed))
+		assert.Equal(t, []int{1, 3}, store.TicketIDsByEditor("Anna"))
+		assert.Equal(t, []int{}, store.TicketIDsByEditor("Bert"))
+		assert.Equal(t, []int{2}, store.TicketIDsByEditor(""))
+	}
+	check()
+
+	// The index is rebuilt from the log and kept by the compaction
+	assert.Nil(t, store.Close())
+	store, err = openLogTicketStore(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	check()
+	assert.Nil(t, store.compact())
+	check()
+	assert.Nil(t, store.Close())
+}
+
+func TestLogTicketStoreCompaction(t *testing.T) {
+	setup()
+	defer teardown()
+
+	minSize := logCompactionMinSize
+	logCompactionMinSize = 2048
+	defer func() { logCompactionMinSize = minSize }()
+
+	store, err := openLogTicketStore(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, store.StoreTicket(Ticket{ID: 1 + i%2, Client: "client@dhbw.de", Reference: "Outage " + time.Duration(i).String()}))
+	}
+	assert.Nil(t, store.StoreTicket(Ticket{ID: 3, Client: "client@dhbw.de", Reference: "Deleted"}))
+	assert.Nil(t, store.DeleteTicket(3))
+	assert.Nil(t, store.SetLastTicketID(3))
+
+	// Only the latest records are kept once the compaction in the background has finished
+	store.waitForCompaction()
+	info, err := os.Stat(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	assert.True(t, info.Size() < 2*logCompactionMinSize)
+	_, err = os.Stat(config.TicketLogFilePath() + ".compact")
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, store.Close())
+	store, err = openLogTicketStore(config.TicketLogFilePath())
+	assert.Nil(t, err)
+	defer func() { assert.Nil(t, store.Close()) }()
+	ids, err := store.TicketIDs()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2}, ids)
+	assert.Equal(t, 3, store.LastTicketID())
+	ticket, err := store.ReadTicket(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Outage 99ns", ticket.Reference)
+}
+
+func TestMigrateTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createTickets(t, "Outage", "Printer broken", "No internet")
+	assert.Nil(t, deleteTicket(2))
+
+	target, err := OpenTicketStore(StorageLog)
+	assert.Nil(t, err)
+	count, err := MigrateTickets(ticketStore, target)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	ids, err := target.TicketIDs()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 3}, ids)
+	assert.Equal(t, 3, target.LastTicketID())
+	ticket, err := target.ReadTicket(3)
+	assert.Nil(t, err)
+	assert.Equal(t, "No internet", ticket.Reference)
+
+	// Tickets are never migrated into a store which already has some
+	_, err = MigrateTickets(ticketStore, target)
+	assert.NotNil(t, err)
+	assert.Nil(t, target.Close())
+
+	// The configured backend receives the tickets of the other one
+	config.StorageBackend = StorageLog
+	defer func() { config.StorageBackend = StorageXML }()
+	_, err = MigrateTicketStorage(StorageLog)
+	assert.NotNil(t, err)
+	assert.Nil(t, os.Remove(config.TicketLogFilePath()))
+	count, err = MigrateTicketStorage(StorageXML)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	ticket, err = ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "Outage", ticket.Reference)
+}
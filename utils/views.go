@@ -0,0 +1,471 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Orders in which a saved view lists its tickets
+const (
+	ViewSortNewest   = "newest"   // Recently created tickets first
+	ViewSortOldest   = "oldest"   // Long waiting tickets first
+	ViewSortPriority = "priority" // Urgent tickets first, tickets with the same priority are ordered by their age
+	ViewSortActivity = "activity" // Tickets with the latest message of a customer or editor first
+)
+
+// Columns a saved view can show next to the subject of its tickets
+const (
+	ViewColumnClient   = "client"
+	ViewColumnStatus   = "status"
+	ViewColumnEditor   = "editor"
+	ViewColumnPriority = "priority"
+	ViewColumnQueue    = "queue"
+	ViewColumnTags     = "tags"
+	ViewColumnCreated  = "created"
+)
+
+// Status of a saved view which lists the tickets of every status
+const ViewStatusAll = "all"
+
+// Named ticket listing of an editor. Views are personal unless they are shared with teams,
+// which are the members of queues
+type SavedView struct {
+	ID           int          `xml:"ID"`
+	Name         string       `xml:"Name"`
+	Owner        string       `xml:"Owner"`
+	Status       string       `xml:"Status"` // Name of the listed status, empty for the unfinished tickets and "all" for every ticket
+	Queue        int          `xml:"Queue"`  // ID of the listed queue, -1 lists all accessible queues
+	Filter       TicketFilter `xml:"Filter"`
+	Sort         string       `xml:"Sort"`
+	Columns      []string     `xml:"Columns>Column"`
+	Teams        []int        `xml:"Teams>Queue"` // IDs of the queues whose members can use the view
+	PinnedBy     []string     `xml:"PinnedBy>Username"`
+	CreationDate time.Time    `xml:"CreationDate"`
+}
+
+type SavedViewList struct {
+	ViewIDCounter int         `xml:"ViewIDCounter"`
+	Views         []SavedView `xml:"views>view"`
+}
+
+var mutexViews = &sync.Mutex{}
+
+var viewColumns = []string{ViewColumnClient, ViewColumnStatus, ViewColumnEditor, ViewColumnPriority, ViewColumnQueue, ViewColumnTags, ViewColumnCreated}
+
+// Checks if the user owns the view or is a member of a team it is shared with
+func (view SavedView) IsVisibleTo(user User) bool {
+	if view.Owner == user.Username {
+		return true
+	}
+	for _, id := range view.Teams {
+		if queue, err := GetQueue(id); err == nil && queue.HasMember(user.Username) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the user is allowed to change and delete the view
+func (view SavedView) IsEditableBy(user User) bool {
+	return view.Owner == user.Username || user.IsAdmin()
+}
+
+func (view SavedView) IsPinnedBy(user User) bool {
+	return containsString(view.PinnedBy, user.Username)
+}
+
+func (view SavedView) HasColumn(column string) bool {
+	return containsString(view.Columns, column)
+}
+
+func (view SavedView) IsSharedWith(queueID int) bool {
+	for _, id := range view.Teams {
+		if id == queueID {
+			return true
+		}
+	}
+	return false
+}
+
+func (view SavedView) QueueName() string {
+	if view.Queue == -1 {
+		return ""
+	}
+	return QueueName(view.Queue)
+}
+
+// Returns the names of the columns a view can show
+func ViewColumns() []string {
+	return append([]string(nil), viewColumns...)
+}
+
+// Returns the value of the column for the ticket as it is shown in a saved view
+func (ticket Ticket) ColumnValue(column string) string {
+	switch column {
+	case ViewColumnClient:
+		return ticket.Client
+	case ViewColumnStatus:
+		return ticket.StatusName()
+	case ViewColumnEditor:
+		return ticket.Editor
+	case ViewColumnPriority:
+		return ticket.PriorityName()
+	case ViewColumnQueue:
+		return ticket.QueueName()
+	case ViewColumnTags:
+		return ticket.TagsText()
+	case ViewColumnCreated:
+		if len(ticket.MessageList) > 0 {
+			return ticket.MessageList[0].CreationDate.Format("2006-01-02 15:04")
+		}
+	}
+	return ""
+}
+
+// Checks the settings of the view which don't depend on its owner
+func validateView(view SavedView) error {
+	if strings.TrimSpace(view.Name) == "" || !CheckEmptyXSSString(view.Name) {
+		return fmt.Errorf("a view needs a valid name")
+	}
+	if view.Status != "" && view.Status != ViewStatusAll {
+		if _, ok := ParseTicketStatus(view.Status); !ok {
+			return fmt.Errorf("unknown status %q", view.Status)
+		}
+	}
+	switch view.Sort {
+	case ViewSortNewest, ViewSortOldest, ViewSortPriority, ViewSortActivity:
+	default:
+		return fmt.Errorf("unknown sort order %q", view.Sort)
+	}
+	for _, column := range view.Columns {
+		if !containsString(viewColumns, column) {
+			return fmt.Errorf("unknown column %q", column)
+		}
+	}
+	for _, text := range []string{view.Filter.Tag, view.Filter.Value} {
+		if text != "" && !CheckEmptyXSSString(text) {
+			return fmt.Errorf("the filter of the view contains invalid characters")
+		}
+	}
+	for _, id := range view.Teams {
+		if _, err := GetQueue(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stores a new view with the owner, name, filters, sort order, columns and teams of the specified view
+func CreateView(view SavedView) (SavedView, error) {
+	err := validateView(view)
+	if err != nil {
+		return SavedView{}, err
+	}
+
+	mutexViews.Lock()
+	defer mutexViews.Unlock()
+
+	viewList, err := ReadViews()
+	if err != nil {
+		return SavedView{}, err
+	}
+
+	viewList.ViewIDCounter++
+	view.ID = viewList.ViewIDCounter
+	view.PinnedBy = nil
+	view.CreationDate = time.Now()
+	viewList.Views = append(viewList.Views, view)
+
+	return view, WriteToXML(viewList, config.ViewsFilePath())
+}
+
+// Changes the name, filters, sort order, columns and teams of a view. The owner and the pins are kept
+func UpdateView(view SavedView) (SavedView, error) {
+	err := validateView(view)
+	if err != nil {
+		return SavedView{}, err
+	}
+
+	var updated SavedView
+	err = changeViews(func(views []SavedView) ([]SavedView, error) {
+		i, err := findView(views, view.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		view.Owner = views[i].Owner
+		view.PinnedBy = views[i].PinnedBy
+		view.CreationDate = views[i].CreationDate
+		views[i] = view
+		updated = view
+		return views, nil
+	})
+
+	return updated, err
+}
+
+// Removes a view
+func DeleteView(id int) error {
+	return changeViews(func(views []SavedView) ([]SavedView, error) {
+		i, err := findView(views, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(views[:i], views[i+1:]...), nil
+	})
+}
+
+// Pins the view to the navbar of the user or removes it from there
+func SetViewPinned(id int, username string, pinned bool) error {
+	return changeViews(func(views []SavedView) ([]SavedView, error) {
+		i, err := findView(views, id)
+		if err != nil {
+			return nil, err
+		}
+
+		var pinnedBy []string
+		for _, name := range views[i].PinnedBy {
+			if name != username {
+				pinnedBy = append(pinnedBy, name)
+			}
+		}
+		if pinned {
+			pinnedBy = append(pinnedBy, username)
+		}
+		views[i].PinnedBy = pinnedBy
+		return views, nil
+	})
+}
+
+// Applies the change to the stored views while holding the lock
+func changeViews(change func(views []SavedView) ([]SavedView, error)) error {
+	mutexViews.Lock()
+	defer mutexViews.Unlock()
+
+	viewList, err := ReadViews()
+	if err != nil {
+		return err
+	}
+
+	viewList.Views, err = change(viewList.Views)
+	if err != nil {
+		return err
+	}
+
+	return WriteToXML(viewList, config.ViewsFilePath())
+}
+
+func findView(views []SavedView, id int) (int, error) {
+	for i, view := range views {
+		if view.ID == id {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("couldn't find the view")
+}
+
+// Returns the view with the specified ID
+func GetView(id int) (SavedView, error) {
+	viewList, err := ReadViews()
+	if err != nil {
+		return SavedView{}, err
+	}
+
+	i, err := findView(viewList.Views, id)
+	if err != nil {
+		return SavedView{}, err
+	}
+
+	return viewList.Views[i], nil
+}
+
+// Returns the views the user can use ordered by their name
+func GetViewsForUser(user User) ([]SavedView, error) {
+	viewList, err := ReadViews()
+	if err != nil {
+		return nil, err
+	}
+
+	var views []SavedView
+	for _, view := range viewList.Views {
+		if view.IsVisibleTo(user) {
+			views = append(views, view)
+		}
+	}
+
+	sort.SliceStable(views, func(i, j int) bool {
+		return strings.ToLower(views[i].Name) < strings.ToLower(views[j].Name)
+	})
+	return views, nil
+}
+
+// Returns the views the user pinned to the navbar and can still use
+func GetPinnedViews(user User) ([]SavedView, error) {
+	views, err := GetViewsForUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var pinned []SavedView
+	for _, view := range views {
+		if view.IsPinnedBy(user) {
+			pinned = append(pinned, view)
+		}
+	}
+	return pinned, nil
+}
+
+// Returns all stored views
+func ReadViews() (SavedViewList, error) {
+	file, err := ioutil.ReadFile(config.ViewsFilePath())
+	if err != nil {
+		return SavedViewList{}, err
+	}
+
+	var viewList SavedViewList
+	err = xml.Unmarshal(file, &viewList)
+	if err != nil {
+		return SavedViewList{}, err
+	}
+
+	return viewList, nil
+}
+
+// Returns the tickets of the view which the user can access in the order of the view
+func GetViewTickets(view SavedView, user User) []Ticket {
+	var candidates []Ticket
+	switch view.Status {
+	case "":
+		candidates = append(GetTicketsByStatus(TicketStatusOpen), GetTicketsByStatus(TicketStatusInProcess)...)
+	case ViewStatusAll:
+		candidates = append(GetTicketsByStatus(TicketStatusOpen), GetTicketsByStatus(TicketStatusInProcess)...)
+		candidates = append(candidates, GetTicketsByStatus(TicketStatusClosed)...)
+	default:
+		status, _ := ParseTicketStatus(view.Status)
+		candidates = GetTicketsByStatus(status)
+	}
+
+	var tickets []Ticket
+	for _, ticket := range candidates {
+		if (view.Queue == -1 || ticket.Queue == view.Queue) && CanAccessTicket(user, ticket) && view.Filter.Matches(ticket) {
+			tickets = append(tickets, ticket)
+		}
+	}
+
+	sortTickets(tickets, view.Sort)
+	return tickets
+}
+
+func sortTickets(tickets []Ticket, order string) {
+	created := func(ticket Ticket) time.Time {
+		if len(ticket.MessageList) == 0 {
+			return time.Time{}
+		}
+		return ticket.MessageList[0].CreationDate
+	}
+
+	sort.SliceStable(tickets, func(i, j int) bool {
+		switch order {
+		case ViewSortOldest:
+			return created(tickets[i]).Before(created(tickets[j]))
+		case ViewSortPriority:
+			if urgency(tickets[i].Priority) != urgency(tickets[j].Priority) {
+				return urgency(tickets[i].Priority) > urgency(tickets[j].Priority)
+			}
+			return created(tickets[i]).Before(created(tickets[j]))
+		case ViewSortActivity:
+			return lastActivity(tickets[i]).After(lastActivity(tickets[j]))
+		default:
+			return created(tickets[i]).After(created(tickets[j]))
+		}
+	})
+}
+
+// Returns a value which grows with the urgency of the priority, since the low priority is stored after the normal one
+func urgency(priority int) int {
+	if priority == TicketPriorityLow {
+		return -1
+	}
+	return priority
+}
+
+// Categories of the unfinished tickets counted on the personal dashboard of an editor
+const (
+	DashboardAssigned   = "assigned"   // Tickets the editor is working on
+	DashboardWaiting    = "waiting"    // Tickets of the editor whose last public message is a reply to the customer
+	DashboardBreaching  = "breaching"  // Tickets of the editor whose customer has been waiting longer than the SLA allows
+	DashboardUnassigned = "unassigned" // Accessible tickets nobody is working on
+)
+
+// Numbers of tickets in the dashboard categories
+type Dashboard struct {
+	Assigned   int
+	Waiting    int
+	Breaching  int
+	Unassigned int
+}
+
+func IsDashboardCategory(category string) bool {
+	switch category {
+	case DashboardAssigned, DashboardWaiting, DashboardBreaching, DashboardUnassigned:
+		return true
+	default:
+		return false
+	}
+}
+
+// Checks if the unfinished ticket belongs to the category of the dashboard of the user
+func InDashboardCategory(category string, ticket Ticket, user User, now time.Time) bool {
+	message, ok := lastPublicMessage(ticket)
+	switch category {
+	case DashboardAssigned:
+		return ticket.Editor == user.Username
+	case DashboardWaiting:
+		return ticket.Editor == user.Username && ok && message.Type == MessageTypeReply
+	case DashboardBreaching:
+		return ticket.Editor == user.Username && ok && message.Type == MessageTypeCustomer &&
+			config.SLAWarningAfter > 0 && now.Sub(message.CreationDate) >= config.SLAWarningAfter
+	case DashboardUnassigned:
+		return ticket.Editor == ""
+	default:
+		return false
+	}
+}
+
+// Counts the unfinished tickets the user can access per dashboard category
+func GetDashboard(user User, now time.Time) Dashboard {
+	var dashboard Dashboard
+	for _, ticket := range append(GetTicketsByStatus(TicketStatusOpen), GetTicketsByStatus(TicketStatusInProcess)...) {
+		if !CanAccessTicket(user, ticket) {
+			continue
+		}
+		counts := map[string]*int{DashboardAssigned: &dashboard.Assigned, DashboardWaiting: &dashboard.Waiting,
+			DashboardBreaching: &dashboard.Breaching, DashboardUnassigned: &dashboard.Unassigned}
+		for category, count := range counts {
+			if InDashboardCategory(category, ticket, user, now) {
+				*count++
+			}
+		}
+	}
+	return dashboard
+}
+
+func containsString(values []string, value string) bool {
+	for _, actValue := range values {
+		if actValue == value {
+			return true
+		}
+	}
+	return false
+}
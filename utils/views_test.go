@@ -0,0 +1,140 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSavedViews(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna", "Bert", "Carl")
+	users, err := ReadUsers()
+	assert.Nil(t, err)
+	queue, err := CreateQueue(Queue{Name: "Billing", Members: []string{"Anna", "Bert"}})
+	assert.Nil(t, err)
+
+	_, err = CreateView(SavedView{Name: "", Owner: "Anna", Queue: -1, Sort: ViewSortNewest})
+	assert.NotNil(t, err)
+	_, err = CreateView(SavedView{Name: "Urgent", Owner: "Anna", Queue: -1, Sort: "random"})
+	assert.NotNil(t, err)
+	_, err = CreateView(SavedView{Name: "Urgent", Owner: "Anna", Queue: -1, Sort: ViewSortNewest, Columns: []string{"color"}})
+	assert.NotNil(t, err)
+	_, err = CreateView(SavedView{Name: "Urgent", Owner: "Anna", Queue: -1, Sort: ViewSortNewest, Status: "waiting"})
+	assert.NotNil(t, err)
+	_, err = CreateView(SavedView{Name: "Urgent", Owner: "Anna", Queue: -1, Sort: ViewSortNewest, Teams: []int{99}})
+	assert.NotNil(t, err)
+
+	personal, err := CreateView(SavedView{Name: "Urgent", Owner: "Anna", Queue: -1, Sort: ViewSortPriority, Columns: []string{ViewColumnClient}})
+	assert.Nil(t, err)
+	shared, err := CreateView(SavedView{Name: "billing", Owner: "Anna", Queue: queue.ID, Sort: ViewSortNewest, Teams: []int{queue.ID}})
+	assert.Nil(t, err)
+
+	// Only the members of the team can use the shared view, only the owner and admins can change it
+	assert.True(t, shared.IsVisibleTo(users["Bert"]))
+	assert.False(t, personal.IsVisibleTo(users["Bert"]))
+	assert.False(t, shared.IsVisibleTo(users["Carl"]))
+	assert.False(t, shared.IsEditableBy(users["Bert"]))
+	views, err := GetViewsForUser(users["Anna"])
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"billing", "Urgent"}, []string{views[0].Name, views[1].Name})
+
+	assert.Nil(t, SetViewPinned(shared.ID, "Bert", true))
+	assert.Nil(t, SetViewPinned(shared.ID, "Bert", true))
+	pinned, err := GetPinnedViews(users["Bert"])
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pinned))
+	assert.Equal(t, []string{"Bert"}, pinned[0].PinnedBy)
+
+	// Updates keep the owner and the pins, a view which isn't shared anymore disappears from the navbar
+	shared.Name = "Billing"
+	shared.Owner = "Bert"
+	shared.Teams = nil
+	updated, err := UpdateView(shared)
+	assert.Nil(t, err)
+	assert.Equal(t, "Anna", updated.Owner)
+	assert.Equal(t, []string{"Bert"}, updated.PinnedBy)
+	pinned, err = GetPinnedViews(users["Bert"])
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pinned))
+
+	assert.Nil(t, SetViewPinned(shared.ID, "Bert", false))
+	assert.Nil(t, DeleteView(personal.ID))
+	assert.NotNil(t, DeleteView(personal.ID))
+	_, err = GetView(personal.ID)
+	assert.NotNil(t, err)
+}
+
+func TestGetViewTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna")
+	users, err := ReadUsers()
+	assert.Nil(t, err)
+
+	ids := createTickets(t, "Outage", "Printer broken", "No internet")
+	assert.Nil(t, ChangePriority(ids[0], TicketPriorityLow))
+	assert.Nil(t, ChangePriority(ids[2], TicketPriorityUrgent))
+	assert.Nil(t, ChangeTags(ids[1], []string{"hardware"}))
+	assert.Nil(t, ChangeStatus(ids[1], TicketStatusClosed))
+
+	viewIDs := func(view SavedView) []int {
+		var result []int
+		for _, ticket := range GetViewTickets(view, users["Anna"]) {
+			result = append(result, ticket.ID)
+		}
+		return result
+	}
+
+	assert.Equal(t, []int{ids[2], ids[0]}, viewIDs(SavedView{Queue: -1, Sort: ViewSortNewest}))
+	assert.Equal(t, []int{ids[0], ids[1], ids[2]}, viewIDs(SavedView{Queue: -1, Status: ViewStatusAll, Sort: ViewSortOldest}))
+	assert.Equal(t, []int{ids[2], ids[1], ids[0]}, viewIDs(SavedView{Queue: -1, Status: ViewStatusAll, Sort: ViewSortPriority}))
+	assert.Equal(t, []int{ids[1]}, viewIDs(SavedView{Queue: -1, Status: "closed", Sort: ViewSortNewest}))
+	assert.Equal(t, []int{ids[1]}, viewIDs(SavedView{Queue: -1, Status: ViewStatusAll, Sort: ViewSortNewest, Filter: TicketFilter{Tag: "hardware"}}))
+	assert.Nil(t, viewIDs(SavedView{Queue: 5, Sort: ViewSortNewest}))
+
+	ticket, err := ReadTicket(ids[2])
+	assert.Nil(t, err)
+	assert.Equal(t, "urgent", ticket.ColumnValue(ViewColumnPriority))
+	assert.Equal(t, "client@dhbw.de", ticket.ColumnValue(ViewColumnClient))
+	assert.Equal(t, "open", ticket.ColumnValue(ViewColumnStatus))
+	assert.Equal(t, "", ticket.ColumnValue("color"))
+}
+
+func TestGetDashboard(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createEditors(t, "Anna")
+	users, err := ReadUsers()
+	assert.Nil(t, err)
+
+	ids := createTickets(t, "Outage", "Printer broken", "No internet", "New laptop")
+	for _, id := range ids[:3] {
+		assert.Nil(t, ChangeEditor(id, "Anna"))
+		assert.Nil(t, ChangeStatus(id, TicketStatusInProcess))
+	}
+	ticket, err := ReadTicket(ids[1])
+	assert.Nil(t, err)
+	_, err = AddReply(ticket, "Anna", "Did you restart it?")
+	assert.Nil(t, err)
+
+	dashboard := GetDashboard(users["Anna"], time.Now())
+	assert.Equal(t, Dashboard{Assigned: 3, Waiting: 1, Breaching: 0, Unassigned: 1}, dashboard)
+
+	// The customers of the unanswered tickets are waiting longer than the SLA allows
+	later := time.Now().Add(config.SLAWarningAfter + time.Minute)
+	dashboard = GetDashboard(users["Anna"], later)
+	assert.Equal(t, 2, dashboard.Breaching)
+	ticket, err = ReadTicket(ids[0])
+	assert.Nil(t, err)
+	assert.True(t, InDashboardCategory(DashboardBreaching, ticket, users["Anna"], later))
+	assert.False(t, InDashboardCategory(DashboardWaiting, ticket, users["Anna"], later))
+	assert.False(t, IsDashboardCategory("closed"))
+}
@@ -0,0 +1,260 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type WebhookDelivery struct {
+	ID              int       `xml:"ID"`
+	Event           EventType `xml:"Event"`
+	URL             string    `xml:"URL"`
+	Payload         string    `xml:"Payload"`
+	Attempts        int       `xml:"Attempts"`
+	Delivered       bool      `xml:"Delivered"`
+	LastStatusCode  int       `xml:"LastStatusCode"`
+	LastError       string    `xml:"LastError"`
+	CreationDate    time.Time `xml:"CreationDate"`
+	LastAttemptDate time.Time `xml:"LastAttemptDate"`
+}
+
+type WebhookDeliveryList struct {
+	DeliveryIDCounter int               `xml:"DeliveryIDCounter"`
+	Deliveries        []WebhookDelivery `xml:"deliveries>delivery"`
+}
+
+var mutexWebhookDeliveries = &sync.Mutex{}
+
+var registerWebhookDispatcherOnce = &sync.Once{}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Deliveries which are attempted in the background
+var pendingWebhookDeliveries = &sync.WaitGroup{}
+
+var warnMissingWebhookSecretOnce = &sync.Once{}
+
+// Subscribes the webhook dispatcher to the ticket events. Calling it more than once has no effect
+func RegisterWebhookDispatcher() {
+	registerWebhookDispatcherOnce.Do(func() {
+		SubscribeEvents(dispatchWebhooks)
+	})
+}
+
+// Creates a delivery for every configured webhook URL and delivers them in the background. Nothing is dispatched without
+// a webhook secret, because the receivers couldn't verify the origin of the payloads
+func dispatchWebhooks(event Event) {
+	if len(config.WebhookURLs) == 0 {
+		return
+	}
+	if config.WebhookSecret == "" {
+		warnMissingWebhookSecretOnce.Do(func() {
+			log.Println("The webhooks are not dispatched, because no webhook secret is configured")
+		})
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	for _, url := range config.WebhookURLs {
+		delivery, err := createWebhookDelivery(event.Type, url, string(payload))
+		if err != nil || config.WebhookMaxAttempts <= 0 {
+			// Without attempts the delivery is only logged and can be redelivered manually
+			continue
+		}
+
+		pendingWebhookDeliveries.Add(1)
+		go func(id int) {
+			defer pendingWebhookDeliveries.Done()
+			_, _ = deliverWebhook(id)
+		}(delivery.ID)
+	}
+}
+
+// Stores a new pending delivery in the delivery log
+func createWebhookDelivery(eventType EventType, url string, payload string) (WebhookDelivery, error) {
+	// Synchronizing the change of the delivery ID counter
+	mutexWebhookDeliveries.Lock()
+	defer mutexWebhookDeliveries.Unlock()
+
+	deliveryList, err := ReadWebhookDeliveries()
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	deliveryList.DeliveryIDCounter++
+	delivery := WebhookDelivery{ID: deliveryList.DeliveryIDCounter, Event: eventType, URL: url, Payload: payload, CreationDate: time.Now()}
+	deliveryList.Deliveries = append(deliveryList.Deliveries, delivery)
+	deliveryList.Deliveries = pruneWebhookDeliveries(deliveryList.Deliveries)
+
+	return delivery, WriteToXML(deliveryList, config.WebhooksFilePath())
+}
+
+// Keeps only the latest deliveries of the history, so the delivery log doesn't grow without limit
+func pruneWebhookDeliveries(deliveries []WebhookDelivery) []WebhookDelivery {
+	if config.WebhookHistory <= 0 || len(deliveries) <= config.WebhookHistory {
+		return deliveries
+	}
+	return append([]WebhookDelivery(nil), deliveries[len(deliveries)-config.WebhookHistory:]...)
+}
+
+// Posts the delivery to its URL and retries it with an increasing delay until it succeeds or the attempts are exhausted
+func deliverWebhook(id int) (WebhookDelivery, error) {
+	delivery, err := GetWebhookDelivery(id)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	for attempt := 1; attempt <= config.WebhookMaxAttempts; attempt++ {
+		delivery, err = attemptWebhookDelivery(delivery)
+		if err == nil {
+			return delivery, nil
+		}
+
+		if attempt < config.WebhookMaxAttempts {
+			time.Sleep(time.Duration(attempt) * config.WebhookRetryDelay)
+		}
+	}
+
+	return delivery, err
+}
+
+// Posts the delivery once and records the result in the delivery log. Deliveries which were removed from the log in
+// the meantime count as finished, so they are not retried
+func attemptWebhookDelivery(delivery WebhookDelivery) (WebhookDelivery, error) {
+	statusCode, err := postWebhook(delivery)
+
+	delivery.Attempts++
+	delivery.LastAttemptDate = time.Now()
+	delivery.LastStatusCode = statusCode
+	delivery.Delivered = err == nil
+	delivery.LastError = ""
+	if err != nil {
+		delivery.LastError = err.Error()
+	}
+
+	logged, storeErr := updateWebhookDelivery(delivery)
+	if storeErr != nil {
+		return delivery, storeErr
+	}
+	if !logged {
+		return delivery, nil
+	}
+
+	return delivery, err
+}
+
+// Sends the signed payload of the delivery and returns the status code of the response
+func postWebhook(delivery WebhookDelivery) (int, error) {
+	if config.WebhookSecret == "" {
+		return 0, fmt.Errorf("no webhook secret is configured")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", string(delivery.Event))
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhookPayload([]byte(delivery.Payload), config.WebhookSecret))
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// Returns the hex encoded HMAC-SHA256 of the payload so receivers can verify the origin of a webhook
+func SignWebhookPayload(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Delivers an already logged webhook once more, regardless of its previous result
+func RedeliverWebhook(id int) (WebhookDelivery, error) {
+	delivery, err := GetWebhookDelivery(id)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	return attemptWebhookDelivery(delivery)
+}
+
+// Returns the delivery with the specified ID from the delivery log
+func GetWebhookDelivery(id int) (WebhookDelivery, error) {
+	deliveryList, err := ReadWebhookDeliveries()
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	for _, delivery := range deliveryList.Deliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+
+	return WebhookDelivery{}, fmt.Errorf("couldn't find the webhook delivery")
+}
+
+// Replaces the stored delivery with the same ID, returns false if the delivery was already removed from the log
+func updateWebhookDelivery(delivery WebhookDelivery) (bool, error) {
+	mutexWebhookDeliveries.Lock()
+	defer mutexWebhookDeliveries.Unlock()
+
+	deliveryList, err := ReadWebhookDeliveries()
+	if err != nil {
+		return false, err
+	}
+
+	for i := range deliveryList.Deliveries {
+		if deliveryList.Deliveries[i].ID == delivery.ID {
+			deliveryList.Deliveries[i] = delivery
+			return true, WriteToXML(deliveryList, config.WebhooksFilePath())
+		}
+	}
+
+	return false, nil
+}
+
+// Returns the complete webhook delivery log
+func ReadWebhookDeliveries() (WebhookDeliveryList, error) {
+	file, err := ioutil.ReadFile(config.WebhooksFilePath())
+	if err != nil {
+		return WebhookDeliveryList{}, err
+	}
+
+	var deliveryList WebhookDeliveryList
+	err = xml.Unmarshal(file, &deliveryList)
+	if err != nil {
+		return WebhookDeliveryList{}, err
+	}
+
+	return deliveryList, nil
+}
@@ -0,0 +1,217 @@
+package utils
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	signature := SignWebhookPayload([]byte("payload"), "secret")
+	assert.Equal(t, 64, len(signature))
+	assert.Equal(t, signature, SignWebhookPayload([]byte("payload"), "secret"))
+	assert.NotEqual(t, signature, SignWebhookPayload([]byte("payload"), "otherSecret"))
+	assert.NotEqual(t, signature, SignWebhookPayload([]byte("otherPayload"), "secret"))
+}
+
+func TestDeliverWebhookSuccess(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.WebhookSecret = "secret"
+	defer func() { config.WebhookSecret = "" }()
+
+	var receivedEvent Event
+	var receivedSignature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		receivedSignature = r.Header.Get("X-Webhook-Signature")
+		_ = json.Unmarshal(body, &receivedEvent)
+		assert.Equal(t, "sha256="+SignWebhookPayload(body, "secret"), receivedSignature)
+	}))
+	defer server.Close()
+
+	payload, err := json.Marshal(Event{Type: EventTicketCreated, TicketID: 1})
+	assert.Nil(t, err)
+	delivery, err := createWebhookDelivery(EventTicketCreated, server.URL, string(payload))
+	assert.Nil(t, err)
+
+	delivery, err = deliverWebhook(delivery.ID)
+	assert.Nil(t, err)
+	assert.True(t, delivery.Delivered)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusOK, delivery.LastStatusCode)
+	assert.Equal(t, EventTicketCreated, receivedEvent.Type)
+	assert.Equal(t, 1, receivedEvent.TicketID)
+
+	storedDelivery, err := GetWebhookDelivery(delivery.ID)
+	assert.Nil(t, err)
+	assert.True(t, storedDelivery.Delivered)
+}
+
+func TestDeliverWebhookRetries(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.WebhookSecret = "secret"
+	defer func() { config.WebhookSecret = "" }()
+	config.WebhookRetryDelay = time.Millisecond
+	defer func() { config.WebhookRetryDelay = 5 * time.Second }()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	delivery, err := createWebhookDelivery(EventTicketClosed, server.URL, "{}")
+	assert.Nil(t, err)
+
+	delivery, err = deliverWebhook(delivery.ID)
+	assert.NotNil(t, err)
+	assert.False(t, delivery.Delivered)
+	assert.Equal(t, config.WebhookMaxAttempts, requests)
+	assert.Equal(t, config.WebhookMaxAttempts, delivery.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, delivery.LastStatusCode)
+	assert.NotEqual(t, "", delivery.LastError)
+}
+
+func TestRedeliverWebhook(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.WebhookSecret = "secret"
+	defer func() { config.WebhookSecret = "" }()
+
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	delivery, err := createWebhookDelivery(EventTicketClosed, server.URL, "{}")
+	assert.Nil(t, err)
+	delivery, err = RedeliverWebhook(delivery.ID)
+	assert.NotNil(t, err)
+	assert.False(t, delivery.Delivered)
+
+	failing = false
+	delivery, err = RedeliverWebhook(delivery.ID)
+	assert.Nil(t, err)
+	assert.True(t, delivery.Delivered)
+	assert.Equal(t, 2, delivery.Attempts)
+
+	_, err = RedeliverWebhook(1000)
+	assert.NotNil(t, err)
+
+	// Payloads are never sent without a signature
+	config.WebhookSecret = ""
+	delivery, err = RedeliverWebhook(delivery.ID)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, delivery.Attempts)
+}
+
+func TestAttemptPrunedWebhookDelivery(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.WebhookSecret = "secret"
+	config.WebhookHistory = 1
+	defer func() {
+		config.WebhookSecret = ""
+		config.WebhookHistory = 1000
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// The delivery is pruned by a newer one while it is retried, hence it is not retried anymore
+	delivery, err := createWebhookDelivery(EventTicketClosed, server.URL, "{}")
+	assert.Nil(t, err)
+	_, err = createWebhookDelivery(EventTicketClosed, server.URL, "{}")
+	assert.Nil(t, err)
+	delivery, err = attemptWebhookDelivery(delivery)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivery.Attempts)
+	deliveryList, err := ReadWebhookDeliveries()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deliveryList.Deliveries))
+	assert.Equal(t, 0, deliveryList.Deliveries[0].Attempts)
+}
+
+func TestWebhookHistory(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.WebhookHistory = 3
+	defer func() { config.WebhookHistory = 1000 }()
+
+	for i := 0; i < 5; i++ {
+		_, err := createWebhookDelivery(EventTicketClosed, "http://localhost", "{}")
+		assert.Nil(t, err)
+	}
+
+	// Only the latest deliveries are kept and their IDs keep counting
+	deliveryList, err := ReadWebhookDeliveries()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(deliveryList.Deliveries))
+	assert.Equal(t, 3, deliveryList.Deliveries[0].ID)
+	assert.Equal(t, 5, deliveryList.DeliveryIDCounter)
+	_, err = GetWebhookDelivery(1)
+	assert.NotNil(t, err)
+}
+
+func TestDispatchWebhooks(t *testing.T) {
+	setup()
+	defer teardown()
+
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-Webhook-Event")
+	}))
+	defer server.Close()
+
+	dispatchWebhooks(Event{Type: EventTicketAssigned})
+	deliveryList, err := ReadWebhookDeliveries()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deliveryList.Deliveries))
+
+	// Webhooks without a secret are not dispatched
+	config.WebhookURLs = []string{server.URL}
+	defer func() { config.WebhookURLs = nil }()
+	dispatchWebhooks(Event{Type: EventTicketAssigned})
+	deliveryList, err = ReadWebhookDeliveries()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deliveryList.Deliveries))
+
+	config.WebhookSecret = "secret"
+	defer func() { config.WebhookSecret = "" }()
+	dispatchWebhooks(Event{Type: EventTicketAssigned})
+	select {
+	case eventType := <-received:
+		assert.Equal(t, string(EventTicketAssigned), eventType)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook was not delivered")
+	}
+
+	// The background delivery has finished once its attempt is recorded
+	pendingWebhookDeliveries.Wait()
+	deliveryList, err = ReadWebhookDeliveries()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deliveryList.Deliveries))
+	assert.Equal(t, server.URL, deliveryList.Deliveries[0].URL)
+	assert.Equal(t, 1, deliveryList.Deliveries[0].Attempts)
+	assert.True(t, deliveryList.Deliveries[0].Delivered)
+}
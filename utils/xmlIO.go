@@ -16,52 +16,160 @@ import (
 )
 
 type Ticket struct {
-	XMLName     xml.Name  `xml:"Ticket"`
-	ID          int       `xml:"ID"`
-	Client      string    `xml:"ClientAddress"`
-	Reference   string    `xml:"Subject"`
-	Status      int       `xml:"Status"`
-	Editor      string    `xml:"Editor"`
-	MessageList []Message `xml:"MessageList>Message"`
+	XMLName      xml.Name     `xml:"Ticket" json:"-"`
+	ID           int          `xml:"ID" json:"id"`
+	Client       string       `xml:"ClientAddress" json:"client"`
+	Reference    string       `xml:"Subject" json:"subject"`
+	Status       int          `xml:"Status" json:"status"`
+	Editor       string       `xml:"Editor" json:"editor"`
+	MessageList  []Message    `xml:"MessageList>Message" json:"messages"`
+	Language     string       `xml:"Language,omitempty" json:"language,omitempty"` // Language of the mails to the client, empty for the default language
+	Priority     int          `xml:"Priority" json:"priority"`
+	Queue        int          `xml:"Queue" json:"queue"` // 0 if the ticket belongs to no queue
+	Tags         []string     `xml:"Tags>Tag" json:"tags"`
+	Fields       []FieldValue `xml:"Fields>Field" json:"fields"` // Values of the custom fields, tickets stored before the custom fields existed have none
+	Relations    []Relation   `xml:"Relations>Relation" json:"relations"`
+	MergedInto   int          `xml:"MergedInto,omitempty" json:"mergedInto,omitempty"`     // Target of a merged ticket, which is kept as a tombstone
+	Merged       []int        `xml:"Merged>ID" json:"merged,omitempty"`                    // Tickets which were merged into this one
+	ImportedFrom string       `xml:"ImportedFrom,omitempty" json:"importedFrom,omitempty"` // ID of the ticket in the help desk it was imported from
+	ImportSource string       `xml:"ImportSource,omitempty" json:"importSource,omitempty"` // Name of the help desk the ticket was imported from
+}
+
+// Returns a copy which shares none of its lists with the ticket, so the cached tickets are never changed in place
+func (ticket Ticket) copy() Ticket {
+	ticket.MessageList = append([]Message(nil), ticket.MessageList...)
+	ticket.Tags = append([]string(nil), ticket.Tags...)
+	ticket.Relations = append([]Relation(nil), ticket.Relations...)
+	ticket.Merged = append([]int(nil), ticket.Merged...)
+
+	fields := ticket.Fields
+	ticket.Fields = nil
+	for _, field := range fields {
+		field.Values = append([]string(nil), field.Values...)
+		ticket.Fields = append(ticket.Fields, field)
+	}
+	return ticket
 }
 
 type Message struct {
-	CreationDate time.Time `xml:"CreationDate"`
-	Actor        string    `xml:"Actor"`
-	Text         string    `xml:"Text"`
+	CreationDate time.Time   `xml:"CreationDate" json:"creationDate"`
+	Actor        string      `xml:"Actor" json:"actor"`
+	Text         string      `xml:"Text" json:"text"`
+	Type         MessageType `xml:"Type" json:"type"`
+	MailID       int         `xml:"MailID,omitempty" json:"mailId,omitempty"`
+	MergedFrom   int         `xml:"MergedFrom,omitempty" json:"mergedFrom,omitempty"` // Ticket the message was written in if it was merged into another one
 }
 
+type MessageType string
+
+const (
+	MessageTypeCustomer MessageType = "customer" // Inbound message of the customer
+	MessageTypeReply    MessageType = "reply"    // Reply of an editor which was sent to the customer
+	MessageTypeNote     MessageType = "note"     // Internal note which is only visible to editors
+	MessageTypeSystem   MessageType = "system"   // Event which was recorded by the ticket system itself
+)
+
+// Actor of the messages which are created by the ticket system itself
+const SystemActor = "system"
+
 const (
 	TicketStatusOpen = iota
 	TicketStatusInProcess
 	TicketStatusClosed
 )
 
+var ticketStatusNames = []string{"open", "in process", "closed"}
+
+// The normal priority is the zero value, so tickets which were stored without a priority keep working
+const (
+	TicketPriorityNormal = iota
+	TicketPriorityLow
+	TicketPriorityHigh
+	TicketPriorityUrgent
+)
+
+var ticketPriorityNames = []string{"normal", "low", "high", "urgent"}
+
 var ticketMap = make(map[int]Ticket)
 
+// Guards ticketMap, the scheduler and the notifications read tickets besides the handlers
+var mutexTicketMap = &sync.Mutex{}
+
 var mutexTicketID = &sync.Mutex{}
 
+var ticketLocks = make(map[int]*sync.Mutex)
+
+var mutexTicketLocks = &sync.Mutex{}
+
 type User struct {
-	Username    string `xml:"Username"`
-	Password    string `xml:"Password"`
-	SessionID   string `xml:"SessionID"`
-	HolidayMode bool   `xml:"HolidayMode"`
+	Username      string               `xml:"Username"`
+	Password      string               `xml:"Password"`
+	SessionID     string               `xml:"SessionID"`
+	HolidayMode   bool                 `xml:"HolidayMode"`
+	Email         string               `xml:"Email"`
+	Notifications NotificationSettings `xml:"Notifications"`
+	Capacity      int                  `xml:"Capacity"`     // Maximum number of unfinished tickets for the automatic assignment, 0 uses the default
+	Skills        []string             `xml:"Skills>Skill"` // Tags of the tickets the user is suited for
+	Absence       Absence              `xml:"Absence"`
 }
 
 type UserList struct {
 	User []User `xml:"users>user"`
 }
 
+// Returns the readable name of a ticket status
+func TicketStatusName(status int) string {
+	if status < 0 || status >= len(ticketStatusNames) {
+		return "unknown"
+	}
+	return ticketStatusNames[status]
+}
+
+// Returns the readable name of the ticket's status, tickets which were merged into another one are shown as merged
+func (ticket Ticket) StatusName() string {
+	if ticket.IsMerged() {
+		return "merged"
+	}
+	return TicketStatusName(ticket.Status)
+}
+
+// Returns the ticket status with the readable name
+func ParseTicketStatus(name string) (int, bool) {
+	return indexOfName(ticketStatusNames, name)
+}
+
+// Returns the readable name of a ticket priority
+func TicketPriorityName(priority int) string {
+	if priority < 0 || priority >= len(ticketPriorityNames) {
+		return "unknown"
+	}
+	return ticketPriorityNames[priority]
+}
+
+// Returns the readable name of the ticket's priority
+func (ticket Ticket) PriorityName() string {
+	return TicketPriorityName(ticket.Priority)
+}
+
+// Returns the ticket priority with the readable name
+func ParseTicketPriority(name string) (int, bool) {
+	return indexOfName(ticketPriorityNames, name)
+}
+
+func indexOfName(names []string, name string) (int, bool) {
+	for i, actName := range names {
+		if actName == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
 // Creates directory for the data storage if it does not exist
 func InitDataStorage() error {
-	_, err := os.Stat(config.TicketsPath())
+	err := os.MkdirAll(config.DataPath, 0777)
 	if err != nil {
-		if os.IsNotExist(err) {
-			tmpErr := os.MkdirAll(config.TicketsPath(), 0777)
-			if tmpErr != nil {
-				return tmpErr
-			}
-		}
+		return err
 	}
 
 	_, err = os.Stat(config.UsersFilePath())
@@ -82,22 +190,70 @@ func InitDataStorage() error {
 		}
 	}
 
-	_, err = os.Stat(config.DefinitionsFilePath())
+	err = openConfiguredTicketStore()
 	if err != nil {
-		if os.IsNotExist(err) {
-			f, err := os.Create(config.DefinitionsFilePath())
-			if err != nil {
-				return err
-			}
-			err = f.Close()
-			if err != nil {
-				return err
-			}
-			err = WriteToXML(0, config.DefinitionsFilePath())
-			if err != nil {
-				return err
-			}
-		}
+		return err
+	}
+	resetAuditIndex()
+
+	err = createXMLFileIfNotExists(config.WebhooksFilePath(), WebhookDeliveryList{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.NotificationsFilePath(), NotificationList{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.CannedResponsesFilePath(), CannedResponseList{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.MacrosFilePath(), MacroList{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.RulesFilePath(), RuleList{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.SchedulerFilePath(), SchedulerState{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.CustomersFilePath(), CustomerList{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.PortalLinksFilePath(), PortalLinkList{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.QueuesFilePath(), QueueList{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.FieldsFilePath(), FieldDefinitionList{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.ViewsFilePath(), SavedViewList{})
+	if err != nil {
+		return err
+	}
+
+	err = createXMLFileIfNotExists(config.AssignmentFilePath(), AssignmentState{})
+	if err != nil {
+		return err
 	}
 
 	_, err = os.Stat(config.MailFilePath())
@@ -118,6 +274,19 @@ func InitDataStorage() error {
 	return err
 }
 
+// Creates the xml file with the initial content if it does not exist yet
+func createXMLFileIfNotExists(path string, v interface{}) error {
+	_, err := os.Stat(path)
+	if err == nil {
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	return WriteToXML(v, path)
+}
+
 // Creates a ticket from the inputs
 func CreateTicket(client string, reference string, text string) (Ticket, error) {
 	// Synchronizing this method to prevent multiple tickets with the same ID
@@ -125,8 +294,8 @@ func CreateTicket(client string, reference string, text string) (Ticket, error)
 	defer mutexTicketID.Unlock()
 
 	IDCounter := getTicketIDCounter() + 1
-	newTicket := Ticket{ID: IDCounter, Client: client, Reference: reference, Status: TicketStatusOpen}
-	err := WriteToXML(IDCounter, config.DefinitionsFilePath())
+	newTicket := Ticket{ID: IDCounter, Client: client, Reference: reference, Status: TicketStatusOpen, Language: CustomerLanguage(client)}
+	err := ticketStore.SetLastTicketID(IDCounter)
 	if err != nil {
 		return Ticket{}, err
 	}
@@ -134,55 +303,92 @@ func CreateTicket(client string, reference string, text string) (Ticket, error)
 	return AddMessage(newTicket, client, text)
 }
 
-// Adds a message to a specified tickets
+// Adds a message to a specified tickets. Messages of the client are inbound customer messages, all others are internal notes
 func AddMessage(ticket Ticket, actor string, text string) (Ticket, error) {
-	newMessage := Message{CreationDate: time.Now(), Actor: actor, Text: text}
-	ticket.MessageList = append(ticket.MessageList, newMessage)
-	return ticket, StoreTicket(ticket)
+	return appendMessage(ticket, Message{Actor: actor, Text: text, Type: inferMessageType(ticket, actor)})
 }
 
-// Stores a ticket as a xml file
-func StoreTicket(ticket Ticket) error {
-	delete(ticketMap, ticket.ID)
-	return WriteToXML(ticket, config.TicketXMLPath(ticket.ID))
+// Sends the text with the reply template to the client and adds it as a public reply to the ticket
+func AddReply(ticket Ticket, editor string, text string) (Ticket, error) {
+	mail, err := sendTicketMail(replyTemplate, replyMailData(ticket, editor, text))
+	if err != nil {
+		return ticket, err
+	}
+
+	return appendMessage(ticket, Message{Actor: editor, Text: text, Type: MessageTypeReply, MailID: mail.ID})
 }
 
-// Returns the requested ticket from the cache or from the corresponding xml file
-func ReadTicket(id int) (Ticket, error) {
-	if ticketMap[id].ID != 0 {
-		return ticketMap[id], nil
+func replyMailData(ticket Ticket, editor string, text string) MailTemplateData {
+	// Replies of the ticket system itself are only signed with the signature
+	if editor == SystemActor {
+		editor = ""
 	}
+	return NewMailTemplateData(ticket, editor, text)
+}
 
-	file, err := ioutil.ReadFile(config.TicketXMLPath(id))
-	if err != nil {
-		return Ticket{}, err
+// Adds a message which was created by the ticket system itself
+func AddSystemMessage(ticket Ticket, text string) (Ticket, error) {
+	return appendMessage(ticket, Message{Actor: SystemActor, Text: text, Type: MessageTypeSystem})
+}
+
+func appendMessage(ticket Ticket, message Message) (Ticket, error) {
+	message.CreationDate = time.Now()
+	ticket.MessageList = append(ticket.MessageList, message)
+	return ticket, StoreTicket(ticket)
+}
+
+func inferMessageType(ticket Ticket, actor string) MessageType {
+	if actor == ticket.Client {
+		return MessageTypeCustomer
 	}
+	return MessageTypeNote
+}
+
+// Checks if the customer is allowed to see the message
+func (message Message) IsPublic() bool {
+	return message.Type == MessageTypeCustomer || message.Type == MessageTypeReply
+}
 
-	var ticket Ticket
-	err = xml.Unmarshal(file, &ticket)
+// Stores a ticket with the configured storage backend
+func StoreTicket(ticket Ticket) error {
+	return ticketStore.StoreTicket(ticket)
+}
+
+// Returns the requested ticket from the configured storage backend
+func ReadTicket(id int) (Ticket, error) {
+	ticket, err := ticketStore.ReadTicket(id)
 	if err != nil {
 		return Ticket{}, err
 	}
 
-	err = checkCache()
-	if err != nil {
-		return Ticket{}, err
+	// Messages which were stored before the message types were introduced
+	for i, message := range ticket.MessageList {
+		if message.Type == "" {
+			ticket.MessageList[i].Type = inferMessageType(ticket, message.Actor)
+		}
 	}
 
-	ticketMap[ticket.ID] = ticket
 	return ticket, nil
 }
 
-// Deletes a ticket by its ID
-func deleteTicket(id int) error {
-	delete(ticketMap, id)
-
-	err := os.Remove(config.TicketXMLPath(id))
-	if err != nil {
-		return err
+// Locks the ticket for operations which consist of several changes, e.g. macros, so they don't interleave.
+// Returns the function which unlocks the ticket again
+func lockTicket(id int) func() {
+	mutexTicketLocks.Lock()
+	lock, ok := ticketLocks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		ticketLocks[id] = lock
 	}
+	mutexTicketLocks.Unlock()
 
-	return nil
+	lock.Lock()
+	return lock.Unlock
+}
+
+// Deletes a ticket by its ID
+func deleteTicket(id int) error {
+	return ticketStore.DeleteTicket(id)
 }
 
 // Changes the editor of a ticket
@@ -207,12 +413,34 @@ func ChangeStatus(id int, status int) error {
 	return StoreTicket(ticket)
 }
 
-// Returns a list of tickets by a specified ticket status
+// Changes the priority of a ticket
+func ChangePriority(id int, priority int) error {
+	ticket, err := ReadTicket(id)
+	if err != nil {
+		return err
+	}
+
+	ticket.Priority = priority
+	return StoreTicket(ticket)
+}
+
+// Replaces the tags of a ticket
+func ChangeTags(id int, tags []string) error {
+	ticket, err := ReadTicket(id)
+	if err != nil {
+		return err
+	}
+
+	ticket.Tags = tags
+	return StoreTicket(ticket)
+}
+
+// Returns a list of tickets by a specified ticket status, tickets which were merged into another one are left out
 func GetTicketsByStatus(status int) []Ticket {
 	var tickets []Ticket
-	for actualID := 1; actualID <= getTicketIDCounter(); actualID++ {
+	for _, actualID := range ticketIDsByStatus(status) {
 		tmp, _ := ReadTicket(actualID)
-		if tmp.Status == status && tmp.ID != 0 {
+		if tmp.Status == status && tmp.ID != 0 && !tmp.IsMerged() {
 			tickets = append(tickets, tmp)
 		}
 	}
@@ -220,12 +448,12 @@ func GetTicketsByStatus(status int) []Ticket {
 	return tickets
 }
 
-// Returns a list of tickets owned by the specified editor
+// Returns a list of tickets owned by the specified editor, tickets which were merged into another one are left out
 func GetTicketsByEditor(editor string) []Ticket {
 	var tickets []Ticket
-	for actualID := 1; actualID <= getTicketIDCounter(); actualID++ {
+	for _, actualID := range ticketIDsByEditor(editor) {
 		tmp, _ := ReadTicket(actualID)
-		if tmp.Editor == editor && tmp.ID != 0 {
+		if tmp.Editor == editor && tmp.ID != 0 && !tmp.IsMerged() {
 			tickets = append(tickets, tmp)
 		}
 	}
@@ -233,10 +461,10 @@ func GetTicketsByEditor(editor string) []Ticket {
 	return tickets
 }
 
-// Returns a list of tickets owned by the specified client
+// Returns a list of tickets owned by the specified client including the ones which were merged into another ticket
 func GetTicketsByClient(client string) []Ticket {
 	var tickets []Ticket
-	for actualID := 1; actualID <= getTicketIDCounter(); actualID++ {
+	for _, actualID := range storedTicketIDs() {
 		tmp, _ := ReadTicket(actualID)
 		if tmp.Client == client && tmp.ID != 0 {
 			tickets = append(tickets, tmp)
@@ -248,51 +476,7 @@ func GetTicketsByClient(client string) []Ticket {
 
 // Returns the current ticket ID. Unexpected errors will return -1
 func getTicketIDCounter() int {
-	file, err := ioutil.ReadFile(config.DefinitionsFilePath())
-	if err != nil {
-		return -1
-	}
-
-	var IDCounter int
-	err = xml.Unmarshal(file, &IDCounter)
-	if err != nil {
-		return -1
-	}
-
-	return IDCounter
-}
-
-// Merges two tickets, store them as one ticket and delete the other one
-func MergeTickets(firstTicketID int, secondTicketID int) error {
-	firstTicket, err := ReadTicket(firstTicketID)
-	if err != nil {
-		return err
-	}
-
-	secondTicket, err := ReadTicket(secondTicketID)
-	if err != nil {
-		return err
-	}
-
-	if firstTicket.Editor != secondTicket.Editor {
-		return fmt.Errorf("the two tickets for the merging process do not have the same editors")
-	}
-
-	for _, msgList := range secondTicket.MessageList {
-		firstTicket.MessageList = append(firstTicket.MessageList, msgList)
-	}
-
-	err = ChangeStatus(firstTicketID, TicketStatusInProcess)
-	if err != nil {
-		return err
-	}
-
-	err = deleteTicket(secondTicketID)
-	if err != nil {
-		return err
-	}
-
-	return StoreTicket(firstTicket)
+	return ticketStore.LastTicketID()
 }
 
 // Writes an object to the specified xml file
@@ -303,6 +487,8 @@ func WriteToXML(v interface{}, path string) error {
 	}
 
 	content = []byte(xml.Header + string(content))
+	mutexStorage.RLock()
+	defer mutexStorage.RUnlock()
 	err = ioutil.WriteFile(path, content, 0644)
 	if err != nil {
 		return err
@@ -329,6 +515,16 @@ func checkCache() error {
 	return nil
 }
 
+// Checks if the user is configured as an administrator
+func (user User) IsAdmin() bool {
+	for _, admin := range config.Admins {
+		if admin == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
 // Creates a new user
 func CreateUser(name string, password string) (User, error) {
 	usersMap, err := ReadUsers()
@@ -471,6 +667,45 @@ func GetUserBySession(session string) (User, error) {
 
 // Sets the holiday mode of the specified user
 func SetUserHolidayMode(name string, holidayMode bool) error {
+	return updateUser(name, func(user *User) {
+		user.HolidayMode = holidayMode
+	})
+}
+
+// Sets the email address the user receives the notifications on
+func SetUserEmail(name string, email string) error {
+	return updateUser(name, func(user *User) {
+		user.Email = email
+	})
+}
+
+// Sets how the user wants to be notified about the different notification kinds
+func SetUserNotificationSettings(name string, settings NotificationSettings) error {
+	return updateUser(name, func(user *User) {
+		user.Notifications = settings
+	})
+}
+
+// Sets the maximum number of unfinished tickets the user receives by the automatic assignment
+func SetUserCapacity(name string, capacity int) error {
+	if capacity < 0 {
+		return fmt.Errorf("the capacity must not be negative")
+	}
+
+	return updateUser(name, func(user *User) {
+		user.Capacity = capacity
+	})
+}
+
+// Sets the skills which are matched against the tags of new tickets
+func SetUserSkills(name string, skills []string) error {
+	return updateUser(name, func(user *User) {
+		user.Skills = skills
+	})
+}
+
+// Applies the update to the specified user and stores all users
+func updateUser(name string, update func(user *User)) error {
 	tmpUsers, err := ReadUsers()
 	if err != nil {
 		return err
@@ -481,8 +716,7 @@ func SetUserHolidayMode(name string, holidayMode bool) error {
 		return fmt.Errorf("user does not exist")
 	}
 
-	user.HolidayMode = holidayMode
+	update(&user)
 	tmpUsers[name] = user
-	err = storeUsers(tmpUsers)
-	return err
+	return storeUsers(tmpUsers)
 }
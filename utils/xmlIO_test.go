@@ -4,15 +4,17 @@ package utils
 
 import (
 	"TicketSystem/config"
-	"encoding/xml"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"testing"
 )
 
 func setup() {
 	config.DataPath = "datatest"
+	config.MailTemplatePath = path.Join("..", "mailtemplates")
 	err := InitDataStorage()
 	if err != nil {
 		log.Println(err)
@@ -235,8 +237,8 @@ func TestMerging(t *testing.T) {
 
 	ticket, err := CreateTicket("client@dhbw.de", "New employee", "Hello, please create a new login account for our new employee Max Mustermann. Thanks.")
 	assert.Nil(t, err)
-	assert.NotNil(t, MergeTickets(ticket.ID, 1337))
-	assert.NotNil(t, MergeTickets(1337, ticket.ID))
+	assert.NotNil(t, MergeTickets(ticket.ID, 1337, "202"))
+	assert.NotNil(t, MergeTickets(1337, ticket.ID, "202"))
 
 	_, err = CreateTicket("client@dhbw.de", "New employee", "Hello, please create a new login account for our new employee Max Mustermann. Thanks.")
 	assert.Nil(t, err)
@@ -258,15 +260,22 @@ func TestMerging(t *testing.T) {
 	//merge two tickets and test the function
 	var msgList []Message
 	msgList = firstTicket.MessageList
-	for e := range secondTicket.MessageList {
-		msgList = append(msgList, secondTicket.MessageList[e])
+	for _, message := range secondTicket.MessageList {
+		message.MergedFrom = secondTicket.ID
+		msgList = append(msgList, message)
 	}
-	expectedTicket := Ticket{XMLName: xml.Name{Space: "", Local: ""}, ID: firstTicket.ID, Client: firstTicket.Client, Reference: firstTicket.Reference, Status: firstTicket.Status, Editor: firstTicket.Editor, MessageList: msgList}
 
-	assert.Nil(t, MergeTickets(firstTicket.ID, secondTicket.ID))
+	assert.Nil(t, MergeTickets(firstTicket.ID, secondTicket.ID, "202"))
 	actTicket, _ := ReadTicket(firstTicket.ID)
-	actTicket.XMLName.Local = ""
-	assert.Equal(t, expectedTicket, actTicket)
+	assert.Equal(t, firstTicket.Status, actTicket.Status)
+	assert.Equal(t, msgList, actTicket.MessageList[:len(msgList)])
+	assert.Equal(t, "Ticket 3 was merged into this ticket by 202", actTicket.MessageList[len(msgList)].Text)
+
+	// The merged ticket is kept and redirects to the first one
+	mergedTicket, err := ReadTicket(secondTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, firstTicket.ID, mergedTicket.MergedInto)
+	assert.NotNil(t, MergeTickets(firstTicket.ID, secondTicket.ID, "202"))
 
 	//merge tickets with two different editors
 	_, err = CreateTicket("client@dhbw.de", "New employee", "Hello, please create a new login account for our new employee Erika Musterfrau. Thank you.")
@@ -274,7 +283,7 @@ func TestMerging(t *testing.T) {
 	secondTicketID := getTicketIDCounter()
 	err = ChangeEditor(secondTicketID, "412")
 	assert.Nil(t, err)
-	assert.NotNil(t, MergeTickets(firstTicket.ID, secondTicketID))
+	assert.NotNil(t, MergeTickets(firstTicket.ID, secondTicketID, "202"))
 }
 
 func TestCheckCache(t *testing.T) {
@@ -298,6 +307,25 @@ func TestCheckCache(t *testing.T) {
 	assert.Equal(t, 10, len(ticketMap))
 }
 
+func TestReadTicketReturnsCopies(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := CreateTicket("client@dhbw.de", "PC problem", "PC does not start anymore. Any idea?")
+	assert.Nil(t, err)
+	assert.Nil(t, ChangeTags(1, []string{"hardware"}))
+
+	// Changes of a read ticket don't reach the cached one
+	ticket, err := ReadTicket(1)
+	assert.Nil(t, err)
+	ticket.MessageList[0].Text = "Changed"
+	ticket.Tags[0] = "changed"
+	cached, err := ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "PC does not start anymore. Any idea?", cached.MessageList[0].Text)
+	assert.Equal(t, []string{"hardware"}, cached.Tags)
+}
+
 func TestCreateUser(t *testing.T) {
 	setup()
 	defer teardown()
@@ -464,3 +492,110 @@ func TestSetUserHolidayMode(t *testing.T) {
 	tmpUsers, _ = ReadUsers()
 	assert.False(t, tmpUsers["testUser"].HolidayMode)
 }
+
+func TestTicketStatusName(t *testing.T) {
+	tests := []struct {
+		status   int
+		expected string
+	}{
+		{TicketStatusOpen, "open"},
+		{TicketStatusInProcess, "in process"},
+		{TicketStatusClosed, "closed"},
+		{-1, "unknown"},
+		{3, "unknown"},
+	}
+	for _, d := range tests {
+		assert.Equal(t, d.expected, TicketStatusName(d.status))
+	}
+}
+
+func TestParseTicketStatusAndPriority(t *testing.T) {
+	status, ok := ParseTicketStatus("in process")
+	assert.True(t, ok)
+	assert.Equal(t, TicketStatusInProcess, status)
+	_, ok = ParseTicketStatus("done")
+	assert.False(t, ok)
+
+	priority, ok := ParseTicketPriority("urgent")
+	assert.True(t, ok)
+	assert.Equal(t, TicketPriorityUrgent, priority)
+	_, ok = ParseTicketPriority("")
+	assert.False(t, ok)
+
+	assert.Equal(t, "normal", Ticket{}.PriorityName())
+	assert.Equal(t, "unknown", TicketPriorityName(4))
+}
+
+func TestChangePriority(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "Help")
+	assert.Nil(t, err)
+	assert.Equal(t, TicketPriorityNormal, ticket.Priority)
+
+	assert.Nil(t, ChangePriority(ticket.ID, TicketPriorityHigh))
+	ticket, err = ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TicketPriorityHigh, ticket.Priority)
+
+	assert.NotNil(t, ChangePriority(99, TicketPriorityHigh))
+}
+
+func TestIsAdmin(t *testing.T) {
+	config.Admins = []string{"Admin123"}
+	defer func() { config.Admins = nil }()
+
+	assert.True(t, User{Username: "Admin123"}.IsAdmin())
+	assert.False(t, User{Username: "Test123"}.IsAdmin())
+}
+
+func TestMessageTypes(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ticket, err := CreateTicket("client@dhbw.de", "PC problem", "PC does not start anymore. Any idea?")
+	assert.Nil(t, err)
+	ticket, err = AddMessage(ticket, "Test123", "Maybe the power cable?")
+	assert.Nil(t, err)
+	ticket, err = AddReply(ticket, "Test123", "Please check the power cable")
+	assert.Nil(t, err)
+	ticket, err = AddSystemMessage(ticket, "Ticket was reopened")
+	assert.Nil(t, err)
+
+	actTicket, err := ReadTicket(ticket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(actTicket.MessageList))
+	assert.Equal(t, MessageTypeCustomer, actTicket.MessageList[0].Type)
+	assert.Equal(t, MessageTypeNote, actTicket.MessageList[1].Type)
+	assert.Equal(t, MessageTypeReply, actTicket.MessageList[2].Type)
+	assert.Equal(t, MessageTypeSystem, actTicket.MessageList[3].Type)
+	assert.Equal(t, SystemActor, actTicket.MessageList[3].Actor)
+
+	assert.True(t, actTicket.MessageList[0].IsPublic())
+	assert.False(t, actTicket.MessageList[1].IsPublic())
+	assert.True(t, actTicket.MessageList[2].IsPublic())
+	assert.False(t, actTicket.MessageList[3].IsPublic())
+
+	// The reply is queued in the outbox and references the mail
+	mailList, err := ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Equal(t, mailList.MailList[0].ID, actTicket.MessageList[2].MailID)
+	assert.Equal(t, "client@dhbw.de", mailList.MailList[0].Mail)
+}
+
+func TestReadTicketWithoutMessageTypes(t *testing.T) {
+	setup()
+	defer teardown()
+
+	legacyTicket := `<Ticket><ID>1</ID><ClientAddress>client@dhbw.de</ClientAddress><Subject>PC problem</Subject><Status>0</Status>` +
+		`<Editor></Editor><MessageList><Message><Actor>client@dhbw.de</Actor><Text>Help</Text></Message>` +
+		`<Message><Actor>Test123</Actor><Text>Comment</Text></Message></MessageList></Ticket>`
+	assert.Nil(t, ioutil.WriteFile(config.TicketXMLPath(1), []byte(legacyTicket), 0644))
+
+	ticket, err := ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Equal(t, MessageTypeCustomer, ticket.MessageList[0].Type)
+	assert.Equal(t, MessageTypeNote, ticket.MessageList[1].Type)
+}
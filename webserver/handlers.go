@@ -6,9 +6,15 @@ import (
 	"TicketSystem/config"
 	"TicketSystem/utils"
 	"encoding/xml"
+	"fmt"
+	"html/template"
+	"log"
 	"net/http"
 	"path"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,11 +27,7 @@ func ServeTickets(w http.ResponseWriter, r *http.Request) {
 
 	ticketId, err := strconv.Atoi(path.Base(r.URL.Path))
 	if err != nil { // Show ticket overview
-		ticketsData := utils.GetTicketsByStatus(utils.TicketStatusOpen)
-		ticketsData = append(ticketsData, utils.GetTicketsByStatus(utils.TicketStatusInProcess)...)
-
-		ctx := templateContext{HeaderTitle: "Tickets Overview", ContentTemplate: "tickets.html", IsSignedIn: true, IsUserInHoliday: user.HolidayMode, Username: user.Username, TicketsData: ticketsData}
-		executeTemplate(w, r, "index.html", ctx)
+		serveTicketsOverview(w, r, user, takeBulkResults(user.Username, r.URL.Query().Get("bulk")))
 		return
 	}
 
@@ -34,6 +36,21 @@ func ServeTickets(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
 		return
 	}
+	if !utils.CanAccessTicket(user, ticket) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// Tickets which were merged into another one redirect to it
+	if ticket.IsMerged() {
+		target, err := utils.ResolveMergedTicket(ticket)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/tickets/"+strconv.Itoa(target.ID), http.StatusFound)
+		return
+	}
 
 	// Creating a user list without the signed in user to show the selection for ticket assignment
 	usersMap, err := utils.ReadUsers()
@@ -44,7 +61,10 @@ func ServeTickets(w http.ResponseWriter, r *http.Request) {
 	delete(usersMap, user.Username)
 	usersList := []utils.User{user} // it's important for the template that first element is the current user
 	for _, v := range usersMap {
-		usersList = append(usersList, v)
+		// Only members of the queue of the ticket can be assigned
+		if utils.CanAccessTicket(v, ticket) {
+			usersList = append(usersList, v)
+		}
 	}
 
 	// TicketsData is used to display all possible tickets that can be merged, hence the current ticket gets removed
@@ -56,10 +76,216 @@ func ServeTickets(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	ctx := templateContext{HeaderTitle: ticket.Reference, ContentTemplate: "ticketdetail.html", IsSignedIn: true, Username: user.Username, Users: usersList, TicketsData: ticketsData, CurrentTicket: ticket}
+	auditEntries, err := utils.GetTicketAuditLog(ticket.ID)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// The canned responses are inserted on the client side, hence their placeholders are expanded for the ticket in advance
+	cannedResponses, err := utils.GetCannedResponsesForUser(user)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	for i := range cannedResponses {
+		cannedResponses[i].Text = utils.ExpandPlaceholders(cannedResponses[i].Text, ticket, user.Username)
+	}
+
+	macros, err := utils.GetMacrosForUser(user)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// Tickets can be moved into every queue, also into the ones of other teams
+	queueList, err := utils.ReadQueues()
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// Unassigned tickets show the editors whose skills match the tags best
+	var editorMatches []utils.EditorMatch
+	if ticket.Status == utils.TicketStatusOpen {
+		editorMatches, err = utils.ProposeEditors(ticket)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+			return
+		}
+	}
+
+	definitions, err := utils.ReadFieldDefinitions()
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ctx := templateContext{HeaderTitle: ticket.Reference, ContentTemplate: "ticketdetail.html", IsSignedIn: true, IsAdmin: user.IsAdmin(), Username: user.Username, Users: usersList, TicketsData: ticketsData, CurrentTicket: ticket, AuditEntries: auditEntries, CannedResponses: cannedResponses, Macros: macros, Queues: queueList.Queues, EditorMatches: editorMatches, FieldDefinitions: definitions.Fields,
+		RelatedTickets: utils.GetRelatedTickets(ticket), OpenBlockers: utils.GetOpenBlockers(ticket), MergedTickets: utils.GetMergedTickets(ticket.ID)}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+// Shows the unfinished tickets of all queues the user can access or only the ones of the requested queue.
+// They can be filtered further by a tag and the value of a custom field, the results of a bulk operation are shown as well
+func serveTicketsOverview(w http.ResponseWriter, r *http.Request, user utils.User, results []utils.BulkResult) {
+	query := r.URL.Query()
+	filter := utils.TicketFilter{Tag: strings.ToLower(strings.TrimSpace(query.Get("tag"))), Value: strings.TrimSpace(query.Get("value"))}
+	if query.Get("field") != "" {
+		var err error
+		filter.Field, err = strconv.Atoi(query.Get("field"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+	}
+
+	queueFilter := -1
+	if r.URL.Query().Get("queue") != "" {
+		var err error
+		queueFilter, err = strconv.Atoi(r.URL.Query().Get("queue"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		if !utils.CanAccessQueue(user, queueFilter) {
+			http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+			return
+		}
+	}
+
+	queues, err := utils.GetQueuesForUser(user)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	var ticketsData []utils.Ticket
+	for _, ticket := range append(utils.GetTicketsByStatus(utils.TicketStatusOpen), utils.GetTicketsByStatus(utils.TicketStatusInProcess)...) {
+		if (queueFilter == -1 || ticket.Queue == queueFilter) && utils.CanAccessTicket(user, ticket) && filter.Matches(ticket) {
+			ticketsData = append(ticketsData, ticket)
+		}
+	}
+
+	// A saved view replaces the filters of the overview with its own ones
+	var currentView utils.SavedView
+	if query.Get("view") != "" {
+		id, err := strconv.Atoi(query.Get("view"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		currentView, err = utils.GetView(id)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		if !currentView.IsVisibleTo(user) {
+			http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		ticketsData = utils.GetViewTickets(currentView, user)
+	}
+
+	now := time.Now()
+	category := query.Get("dashboard")
+	if category != "" {
+		if !utils.IsDashboardCategory(category) {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		var categorized []utils.Ticket
+		for _, ticket := range ticketsData {
+			if utils.InDashboardCategory(category, ticket, user, now) {
+				categorized = append(categorized, ticket)
+			}
+		}
+		ticketsData = categorized
+	}
+
+	definitions, err := utils.ReadFieldDefinitions()
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ctx := templateContext{HeaderTitle: "Tickets Overview", ContentTemplate: "tickets.html", IsSignedIn: true, IsAdmin: user.IsAdmin(), IsUserInHoliday: user.HolidayMode, Username: user.Username, TicketsData: ticketsData, Queues: queues, QueueFilter: queueFilter,
+		FieldDefinitions: definitions.Fields, TicketFilter: filter, BulkResults: results, CurrentView: currentView, Dashboard: utils.GetDashboard(user, now), DashboardCategory: category}
 	executeTemplate(w, r, "index.html", ctx)
 }
 
+// Results of a bulk operation which were not shown to the user yet
+type pendingBulkResults struct {
+	username string
+	results  []utils.BulkResult
+	created  time.Time
+}
+
+var bulkResults = make(map[string]pendingBulkResults)
+
+var mutexBulkResults = &sync.Mutex{}
+
+// Runs the posted bulk operation on the selected tickets and redirects to the overview, which shows the result for every ticket
+func ServeBulkTickets(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	var ids []int
+	for _, value := range r.PostForm["ticket"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	results, err := utils.RunBulkOperation(r.PostFormValue("operation"), strings.TrimSpace(r.PostFormValue("value")), ids, user)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// The overview shows the results after the redirect, so reloading it doesn't run the operation again
+	http.Redirect(w, r, "/tickets/?bulk="+storeBulkResults(user.Username, results), http.StatusFound)
+}
+
+// Keeps the results of a bulk operation until the overview shows them and returns the token to fetch them
+func storeBulkResults(username string, results []utils.BulkResult) string {
+	mutexBulkResults.Lock()
+	defer mutexBulkResults.Unlock()
+
+	// Results which were never shown, e.g. because the redirect wasn't followed, are dropped after a while
+	for token, pending := range bulkResults {
+		if time.Since(pending.created) > time.Hour {
+			delete(bulkResults, token)
+		}
+	}
+
+	token := utils.CreateUUID(32)
+	bulkResults[token] = pendingBulkResults{username: username, results: results, created: time.Now()}
+	return token
+}
+
+// Returns the results of the bulk operation only once and only to the user who ran it
+func takeBulkResults(username string, token string) []utils.BulkResult {
+	mutexBulkResults.Lock()
+	defer mutexBulkResults.Unlock()
+
+	pending, ok := bulkResults[token]
+	if !ok || pending.username != username {
+		return nil
+	}
+
+	delete(bulkResults, token)
+	return pending.results
+}
+
 func ServeNewTicket(w http.ResponseWriter, r *http.Request) {
 	_, err := utils.GetUserFromCookie(r)
 	ctx := templateContext{HeaderTitle: "New Ticket", ContentTemplate: "newticket.html", IsSignedIn: err == nil}
@@ -84,12 +310,31 @@ func ServeTicketCreation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := utils.CreateTicket(email, subject, message)
+	ticket, err := utils.CreateTicket(email, subject, message)
 	if err != nil {
 		http.Redirect(w, r, utils.ErrorTicketCreation.ErrorPageURL(), http.StatusFound)
 		return
 	}
 
+	// The mails to the customer are sent in the language of the browser the ticket was created with
+	ticket, err = utils.SetTicketLanguage(ticket, utils.LanguageFromHeader(r.Header.Get("Accept-Language")))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	utils.PublishEvent(utils.Event{Type: utils.EventTicketCreated, Ticket: ticket, Actor: email, Source: utils.SourceWeb})
+
+	// The automation rules may have changed the ticket
+	ticket, err = utils.ReadTicket(ticket.ID)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	err = utils.SendAcknowledgement(ticket, utils.SourceWeb)
+	if err != nil {
+		log.Printf("Couldn't send the acknowledgement for ticket %d: %v\n", ticket.ID, err)
+	}
+
 	http.Redirect(w, r, "/", http.StatusMovedPermanently)
 }
 
@@ -113,6 +358,13 @@ func ServeUserRegistration(w http.ResponseWriter, r *http.Request) {
 
 	username := r.PostFormValue("username")
 	password := r.PostFormValue("password1")
+	email := r.PostFormValue("email")
+
+	// The email address is optional and only used for notifications
+	if email != "" && !utils.CheckMailFormal(email) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
 
 	// DebugMode removes annoying checks when testing
 	if !config.DebugMode && (!utils.CheckUsernameFormal(username) || !utils.CheckPasswordFormal(password)) {
@@ -125,6 +377,15 @@ func ServeUserRegistration(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, utils.ErrorUserCreation.ErrorPageURL(), http.StatusFound)
 		return
 	}
+	_ = utils.RecordAuditEntry(utils.AuditEntry{Actor: username, Source: utils.SourceWeb, Action: utils.AuditUserCreated, Username: username})
+
+	if email != "" {
+		err = utils.SetUserEmail(username, email)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+			return
+		}
+	}
 
 	http.Redirect(w, r, "/", http.StatusMovedPermanently)
 }
@@ -208,18 +469,28 @@ func ServeAddComment(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
 		return
 	}
+	if !utils.CanAccessTicket(user, ticket) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
 
+	before := ticket
 	if r.PostFormValue("sendoption") == "comments" {
-		_, err = utils.AddMessage(ticket, user.Username, r.PostFormValue("comment"))
+		ticket, err = utils.AddMessage(ticket, user.Username, r.PostFormValue("comment"))
 		if err != nil {
 			http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+			return
 		}
 	} else {
-		err = utils.SendMail(ticket.Client, "Reply to your ticket (ID: "+strconv.Itoa(ticket.ID)+")", r.PostFormValue("comment"))
+		ticket, err = utils.AddReply(ticket, user.Username, r.PostFormValue("comment"))
 		if err != nil {
 			http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+			return
 		}
 	}
+	countCannedResponseUsage(r.PostFormValue("cannedresponse"), user)
+	utils.PublishEvent(utils.Event{Type: utils.EventTicketCommented, Ticket: ticket, Actor: user.Username, Source: utils.SourceWeb,
+		Changes: utils.TicketChanges(before, ticket), Details: map[string]string{"sendoption": r.PostFormValue("sendoption")}})
 
 	http.Redirect(w, r, r.Referer(), http.StatusMovedPermanently)
 }
@@ -239,21 +510,31 @@ func ServeTicketAssignment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := utils.ReadTicket(ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if !utils.CanAccessTicket(user, before) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
 	// Check if the editor who is assigned to this ticket is an actual editor
 	usersMap, err := utils.ReadUsers()
 	if err != nil {
 		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
 		return
 	}
-	if _, ok := usersMap[r.PostFormValue("editor")]; !ok {
+	if assignee, ok := usersMap[r.PostFormValue("editor")]; !ok || !utils.CanAccessTicket(assignee, before) {
 		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
 		return
 	}
 
-	// Check if the assignee is in the holidays (exception: assigner == assignee)
+	// Check if the assignee is in the holidays or absent (exception: assigner == assignee)
 	assigner := user.Username
 	assignee := r.PostFormValue("editor")
-	if assigner != assignee && usersMap[assignee].HolidayMode {
+	if assigner != assignee && !usersMap[assignee].IsAvailable() {
 		http.Redirect(w, r, utils.ErrorAssigneeInHoliday.ErrorPageURL(), http.StatusFound)
 		return
 	}
@@ -270,6 +551,7 @@ func ServeTicketAssignment(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
 		return
 	}
+	publishTicketEvent(utils.EventTicketAssigned, before, user.Username)
 
 	// Resides on the ticket when assigned to oneself, else the user gets send to the tickets overview
 	if r.PostFormValue("editor") == user.Username {
@@ -317,12 +599,13 @@ func ServeTicketRelease(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
 		return
 	}
+	publishTicketEvent(utils.EventTicketReleased, ticket, user.Username)
 
 	http.Redirect(w, r, r.Referer(), http.StatusFound)
 }
 
 func ServeCloseTicket(w http.ResponseWriter, r *http.Request) {
-	_, err := utils.GetUserFromCookie(r)
+	user, err := utils.GetUserFromCookie(r)
 	if err != nil {
 		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
 		return
@@ -334,11 +617,31 @@ func ServeCloseTicket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := utils.ReadTicket(ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if !utils.CanAccessTicket(user, before) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if utils.CheckClosable(before) != nil {
+		http.Redirect(w, r, utils.ErrorTicketBlocked.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
 	err = utils.ChangeStatus(ticketId, utils.TicketStatusClosed)
 	if err != nil {
 		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
 		return
 	}
+	publishTicketEvent(utils.EventTicketClosed, before, user.Username)
+
+	err = utils.SendClosureNotice(before, user.Username)
+	if err != nil {
+		log.Printf("Couldn't send the closure notice for ticket %d: %v\n", ticketId, err)
+	}
 
 	http.Redirect(w, r, "/tickets/", http.StatusMovedPermanently)
 }
@@ -346,7 +649,7 @@ func ServeCloseTicket(w http.ResponseWriter, r *http.Request) {
 func ServeMergeTickets(w http.ResponseWriter, r *http.Request) {
 	parseForm(w, r)
 
-	_, err := utils.GetUserFromCookie(r)
+	user, err := utils.GetUserFromCookie(r)
 	if err != nil {
 		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
 		return
@@ -364,16 +667,32 @@ func ServeMergeTickets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = utils.MergeTickets(firstID, secondID)
+	before, err := utils.ReadTicket(firstID)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	second, err := utils.ReadTicket(secondID)
+	if err == nil && (!utils.CanAccessTicket(user, before) || !utils.CanAccessTicket(user, second)) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	err = utils.MergeTickets(firstID, secondID, user.Username)
 	if err != nil {
 		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
 		return
 	}
+	if ticket, err := utils.ReadTicket(firstID); err == nil {
+		utils.PublishEvent(utils.Event{Type: utils.EventTicketMerged, Ticket: ticket, Actor: user.Username, Source: utils.SourceWeb,
+			Changes: utils.TicketChanges(before, ticket), Details: map[string]string{"mergedTicketId": strconv.Itoa(secondID)}})
+	}
 
 	http.Redirect(w, r, r.Referer(), http.StatusMovedPermanently)
 }
 
-func ServeChangeHolidayMode(w http.ResponseWriter, r *http.Request) {
+// Undoes the merge of the posted ticket into the ticket of the referer
+func ServeUnmergeTicket(w http.ResponseWriter, r *http.Request) {
 	parseForm(w, r)
 
 	user, err := utils.GetUserFromCookie(r)
@@ -382,69 +701,995 @@ func ServeChangeHolidayMode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = utils.SetUserHolidayMode(user.Username, r.PostFormValue("holidayMode") == "on")
+	targetID, err := strconv.Atoi(path.Base(r.Referer()))
 	if err != nil {
-		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		http.Redirect(w, r, utils.ErrorURLParsing.ErrorPageURL(), http.StatusFound)
 		return
 	}
 
-	http.Redirect(w, r, r.Referer(), http.StatusMovedPermanently)
-}
+	mergedID, err := strconv.Atoi(r.PostFormValue("ticket"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
 
-func ServeMailsAPI(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		// returns the list of mails which are to be sent
-		getMails(w, r)
+	before, err := utils.ReadTicket(targetID)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	merged, err := utils.ReadTicket(mergedID)
+	if err != nil || merged.MergedInto != targetID {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if !utils.CanAccessTicket(user, before) || !utils.CanAccessTicket(user, merged) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
 		return
 	}
 
-	if r.Method == http.MethodPost {
-		// saves the posted mails to data storage
-		postMails(w, r)
+	err = utils.UnmergeTicket(mergedID, user.Username)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
 		return
 	}
+	if ticket, err := utils.ReadTicket(targetID); err == nil {
+		utils.PublishEvent(utils.Event{Type: utils.EventTicketUnmerged, Ticket: ticket, Actor: user.Username, Source: utils.SourceWeb,
+			Changes: utils.TicketChanges(before, ticket), Details: map[string]string{"mergedTicketId": strconv.Itoa(mergedID)}})
+	}
 
-	utils.RespondWithError(w, http.StatusMethodNotAllowed, "This REST API only responds to GET and POST requests!")
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
 }
 
-func getMails(w http.ResponseWriter, _ *http.Request) {
-	rawMails, err := utils.ReadMailsFile()
+func ServeChangeHolidayMode(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "We had issues fetching the E-Mails!")
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
 		return
 	}
 
-	var mails []utils.MailData
-	for _, mail := range rawMails.MailList {
-		if preventEMailPingPong(mail) {
-			continue
-		}
-
-		err := mail.IncrementReadAttemptsCounter()
-		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "We had internal issues fetching the data for you. Please try it again!")
-			return
-		} else {
-			mail := utils.MailData{EMailAddress: mail.Mail, Subject: mail.Subject, Message: mail.Message}
-			mails = append(mails, mail)
-		}
+	holidayMode := r.PostFormValue("holidayMode") == "on"
+	err = utils.SetUserHolidayMode(user.Username, holidayMode)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if holidayMode != user.HolidayMode {
+		_ = utils.RecordAuditEntry(utils.AuditEntry{Actor: user.Username, Source: utils.SourceWeb, Action: utils.AuditUserHolidayModeChanged,
+			Username: user.Username, Field: "holidayMode", Before: strconv.FormatBool(user.HolidayMode), After: strconv.FormatBool(holidayMode)})
 	}
 
-	utils.RespondWithXML(w, http.StatusOK, utils.Response{Meta: utils.MetaData{Code: http.StatusOK, Message: "OK"}, Data: mails})
+	http.Redirect(w, r, r.Referer(), http.StatusMovedPermanently)
 }
 
-// Checks depending on the FirstReadAttemptDate if the ReadAttemptCounter is tolerable to prevent email ping pong
-func preventEMailPingPong(mail utils.Mail) bool {
-	// There are no restraints for the first 3 read attempts
-	if mail.ReadAttemptCounter < 3 {
-		return false
-	}
+func ServeSettings(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
 
-	// The next 7 read attempts can be made in the first 30 minutes after the first read attempt
-	minsSinceFirstReadAttempt := time.Since(mail.FirstReadAttemptDate).Minutes()
-	allowedAttempts := (float64(7)/30)*minsSinceFirstReadAttempt + 3
-	if mail.ReadAttemptCounter < 10 {
-		return allowedAttempts < float64(mail.ReadAttemptCounter)
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		// The other users are the possible delegates during an absence
+		usersMap, err := utils.ReadUsers()
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		var delegates []utils.User
+		for _, v := range usersMap {
+			if v.Username != user.Username {
+				delegates = append(delegates, v)
+			}
+		}
+		sort.Slice(delegates, func(i, j int) bool {
+			return delegates[i].Username < delegates[j].Username
+		})
+
+		ctx := templateContext{HeaderTitle: "Settings", ContentTemplate: "settings.html", IsSignedIn: true, IsAdmin: user.IsAdmin(), Username: user.Username, CurrentUser: user, Users: delegates}
+		executeTemplate(w, r, "index.html", ctx)
+		return
+	}
+
+	email := r.PostFormValue("email")
+	settings := utils.NotificationSettings{
+		Assignment:    r.PostFormValue(utils.NotificationAssignment),
+		CustomerReply: r.PostFormValue(utils.NotificationCustomerReply),
+		SLAWarning:    r.PostFormValue(utils.NotificationSLAWarning),
+		Mention:       r.PostFormValue(utils.NotificationMention),
+	}
+	capacity := 0
+	if r.PostFormValue("capacity") != "" {
+		capacity, err = strconv.Atoi(r.PostFormValue("capacity"))
+		if err != nil || capacity < 0 {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+	}
+	absence, err := parseAbsence(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	skills := r.PostFormValue("skills")
+	if (email != "" && !utils.CheckMailFormal(email)) || (skills != "" && !utils.CheckEmptyXSSString(skills)) ||
+		!utils.IsNotificationMode(settings.Assignment) || !utils.IsNotificationMode(settings.CustomerReply) ||
+		!utils.IsNotificationMode(settings.SLAWarning) || !utils.IsNotificationMode(settings.Mention) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// The absence is validated while it is stored, so it is stored first to keep the other settings unchanged in case of an error
+	err = utils.SetUserAbsence(user.Username, absence)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	err = utils.SetUserEmail(user.Username, email)
+	if err == nil {
+		err = utils.SetUserNotificationSettings(user.Username, settings)
+	}
+	if err == nil {
+		err = utils.SetUserCapacity(user.Username, capacity)
+	}
+	if err == nil {
+		err = utils.SetUserSkills(user.Username, utils.ParseTags(skills))
+	}
+
+	// The settings which were stored before an error are audited as well
+	users, readErr := utils.ReadUsers()
+	if readErr == nil {
+		_ = utils.RecordUserChanges(user, users[user.Username], user.Username, utils.SourceWeb)
+	}
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusFound)
+}
+
+// Returns the absence of the settings form. Both dates are needed to schedule an absence, without them it is removed
+func parseAbsence(r *http.Request) (utils.Absence, error) {
+	from, to := r.PostFormValue("absencefrom"), r.PostFormValue("absenceto")
+	if from == "" && to == "" {
+		return utils.Absence{}, nil
+	}
+
+	absence := utils.Absence{Delegate: r.PostFormValue("delegate"), NotifyCustomers: r.PostFormValue("notifycustomers") == "on"}
+	var err error
+	absence.From, err = time.ParseInLocation(utils.AbsenceDateLayout, from, time.Local)
+	if err != nil {
+		return utils.Absence{}, err
+	}
+	absence.To, err = time.ParseInLocation(utils.AbsenceDateLayout, to, time.Local)
+	if err != nil {
+		return utils.Absence{}, err
+	}
+
+	return absence, nil
+}
+
+func ServeCannedResponses(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	cannedResponses, err := utils.GetCannedResponsesForUser(user)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ctx := templateContext{HeaderTitle: "Canned Responses", ContentTemplate: "cannedresponses.html", IsSignedIn: true, IsAdmin: user.IsAdmin(), Username: user.Username, CurrentUser: user, CannedResponses: cannedResponses}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+// Creates a new canned response or updates an existing one if an ID is posted
+func ServeCannedResponseSave(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	name := r.PostFormValue("name")
+	text := r.PostFormValue("text")
+	shared := r.PostFormValue("shared") == "on"
+	if !utils.CheckEmptyXSSString(name) || strings.TrimSpace(text) == "" {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	if r.PostFormValue("id") == "" {
+		_, err = utils.CreateCannedResponse(name, text, user.Username, shared)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/cannedResponses", http.StatusFound)
+		return
+	}
+
+	response, ok := editableCannedResponse(w, r, user)
+	if !ok {
+		return
+	}
+
+	_, err = utils.UpdateCannedResponse(response.ID, name, text, shared)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/cannedResponses", http.StatusFound)
+}
+
+func ServeCannedResponseDelete(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	response, ok := editableCannedResponse(w, r, user)
+	if !ok {
+		return
+	}
+
+	err = utils.DeleteCannedResponse(response.ID)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/cannedResponses", http.StatusFound)
+}
+
+// Returns the posted canned response if the user is allowed to change it, otherwise it redirects to the error page
+func editableCannedResponse(w http.ResponseWriter, r *http.Request, user utils.User) (utils.CannedResponse, bool) {
+	id, err := strconv.Atoi(r.PostFormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return utils.CannedResponse{}, false
+	}
+
+	response, err := utils.GetCannedResponse(id)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return utils.CannedResponse{}, false
+	}
+
+	if !response.IsEditableBy(user) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return utils.CannedResponse{}, false
+	}
+
+	return response, true
+}
+
+// Counts the usage of the canned response which was inserted into a comment. Unknown responses are ignored
+func countCannedResponseUsage(id string, user utils.User) {
+	responseID, err := strconv.Atoi(id)
+	if err != nil {
+		return
+	}
+
+	response, err := utils.GetCannedResponse(responseID)
+	if err != nil || !response.IsVisibleTo(user) {
+		return
+	}
+
+	_ = utils.IncrementCannedResponseUsage(responseID)
+}
+
+func ServeMacros(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	macros, err := utils.GetMacrosForUser(user)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ctx := templateContext{HeaderTitle: "Macros", ContentTemplate: "macros.html", IsSignedIn: true, IsAdmin: user.IsAdmin(), Username: user.Username, CurrentUser: user, Macros: macros}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+// Creates a new macro or updates an existing one if an ID is posted
+func ServeMacroSave(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	name := r.PostFormValue("name")
+	shared := r.PostFormValue("shared") == "on"
+	actions, err := utils.ParseMacroActions(r.PostFormValue("actions"))
+	if err != nil || !utils.CheckEmptyXSSString(name) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	if r.PostFormValue("id") == "" {
+		_, err = utils.CreateMacro(name, actions, user.Username, shared)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/macros", http.StatusFound)
+		return
+	}
+
+	macro, ok := postedMacro(w, r, user, utils.Macro.IsEditableBy)
+	if !ok {
+		return
+	}
+
+	_, err = utils.UpdateMacro(macro.ID, name, actions, shared)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/macros", http.StatusFound)
+}
+
+func ServeMacroDelete(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	macro, ok := postedMacro(w, r, user, utils.Macro.IsEditableBy)
+	if !ok {
+		return
+	}
+
+	err = utils.DeleteMacro(macro.ID)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/macros", http.StatusFound)
+}
+
+// Shows the saved views the user can use and the form for new ones or the one to edit
+func ServeViews(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	views, err := utils.GetViewsForUser(user)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	queues, err := utils.GetQueuesForUser(user)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	definitions, err := utils.ReadFieldDefinitions()
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// The form is filled with the view which is edited or with the defaults for a new one
+	currentView := utils.SavedView{Queue: -1, Sort: utils.ViewSortNewest}
+	if r.URL.Query().Get("edit") != "" {
+		id, err := strconv.Atoi(r.URL.Query().Get("edit"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		currentView, err = utils.GetView(id)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		if !currentView.IsEditableBy(user) {
+			http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+			return
+		}
+	}
+
+	ctx := templateContext{HeaderTitle: "Saved Views", ContentTemplate: "views.html", IsSignedIn: true, IsAdmin: user.IsAdmin(), Username: user.Username, CurrentUser: user, SavedViews: views,
+		Queues: queues, FieldDefinitions: definitions.Fields, CurrentView: currentView, ViewColumns: utils.ViewColumns()}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+// Creates a new view or updates an existing one if an ID is posted
+func ServeViewSave(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	view, err := postedViewSettings(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// The view can only list a queue and be shared with teams the user belongs to
+	for _, id := range append([]int{view.Queue}, view.Teams...) {
+		if id != -1 && !utils.CanAccessQueue(user, id) {
+			http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+			return
+		}
+	}
+
+	if r.PostFormValue("id") == "" {
+		view.Owner = user.Username
+		_, err = utils.CreateView(view)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/views", http.StatusFound)
+		return
+	}
+
+	existing, ok := postedView(w, r, user, utils.SavedView.IsEditableBy)
+	if !ok {
+		return
+	}
+
+	view.ID = existing.ID
+	_, err = utils.UpdateView(view)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/views", http.StatusFound)
+}
+
+func ServeViewDelete(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	view, ok := postedView(w, r, user, utils.SavedView.IsEditableBy)
+	if !ok {
+		return
+	}
+
+	err = utils.DeleteView(view.ID)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/views", http.StatusFound)
+}
+
+// Pins the posted view to the navbar of the user or removes it from there
+func ServeViewPin(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	view, ok := postedView(w, r, user, utils.SavedView.IsVisibleTo)
+	if !ok {
+		return
+	}
+
+	err = utils.SetViewPinned(view.ID, user.Username, r.PostFormValue("pinned") == "true")
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/views", http.StatusFound)
+}
+
+// Returns the posted view if the user has the permission for it, otherwise it redirects to the error page
+func postedView(w http.ResponseWriter, r *http.Request, user utils.User, permitted func(utils.SavedView, utils.User) bool) (utils.SavedView, bool) {
+	id, err := strconv.Atoi(r.PostFormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return utils.SavedView{}, false
+	}
+
+	view, err := utils.GetView(id)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return utils.SavedView{}, false
+	}
+
+	if !permitted(view, user) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return utils.SavedView{}, false
+	}
+
+	return view, true
+}
+
+// Reads the name, filters, sort order, columns and teams of a view from the posted form
+func postedViewSettings(r *http.Request) (utils.SavedView, error) {
+	view := utils.SavedView{Name: strings.TrimSpace(r.PostFormValue("name")), Status: r.PostFormValue("status"), Queue: -1,
+		Sort: r.PostFormValue("sort"), Columns: r.PostForm["column"],
+		Filter: utils.TicketFilter{Tag: strings.ToLower(strings.TrimSpace(r.PostFormValue("tag"))), Value: strings.TrimSpace(r.PostFormValue("value"))}}
+
+	var err error
+	if r.PostFormValue("queue") != "" {
+		view.Queue, err = strconv.Atoi(r.PostFormValue("queue"))
+		if err != nil {
+			return utils.SavedView{}, err
+		}
+	}
+	if r.PostFormValue("field") != "" {
+		view.Filter.Field, err = strconv.Atoi(r.PostFormValue("field"))
+		if err != nil {
+			return utils.SavedView{}, err
+		}
+	}
+	for _, value := range r.PostForm["team"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return utils.SavedView{}, err
+		}
+		view.Teams = append(view.Teams, id)
+	}
+
+	return view, nil
+}
+
+// Runs the posted macro on the ticket the request was sent from
+func ServeRunMacro(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticketId, err := strconv.Atoi(path.Base(r.Referer()))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorURLParsing.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	macro, ok := postedMacro(w, r, user, utils.Macro.IsVisibleTo)
+	if !ok {
+		return
+	}
+
+	ticket, err := utils.ReadTicket(ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if !utils.CanAccessTicket(user, ticket) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	_, err = utils.RunMacro(macro, ticketId, user, utils.SourceWeb)
+	if err != nil {
+		log.Printf("Couldn't run the macro %d on ticket %d: %v\n", macro.ID, ticketId, err)
+		http.Redirect(w, r, utils.ErrorMacroExecution.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+// Returns the posted macro if the user has the permission for it, otherwise it redirects to the error page
+func postedMacro(w http.ResponseWriter, r *http.Request, user utils.User, permitted func(utils.Macro, utils.User) bool) (utils.Macro, bool) {
+	id, err := strconv.Atoi(r.PostFormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return utils.Macro{}, false
+	}
+
+	macro, err := utils.GetMacro(id)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return utils.Macro{}, false
+	}
+
+	if !permitted(macro, user) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return utils.Macro{}, false
+	}
+
+	return macro, true
+}
+
+// Replaces the tags of the ticket of the referer with the posted comma separated tags
+func ServeTagTicket(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticketId, err := strconv.Atoi(path.Base(r.Referer()))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorURLParsing.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	tags := r.PostFormValue("tags")
+	if tags != "" && !utils.CheckEmptyXSSString(tags) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	before, err := utils.ReadTicket(ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if !utils.CanAccessTicket(user, before) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	err = utils.ChangeTags(ticketId, utils.ParseTags(tags))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	publishTicketEvent(utils.EventTicketUpdated, before, user.Username)
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+// Stores the posted values of the custom fields of the ticket of the referer. The values of a field are posted as field-<ID>
+func ServeTicketFields(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticketId, err := strconv.Atoi(path.Base(r.Referer()))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorURLParsing.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	before, err := utils.ReadTicket(ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if !utils.CanAccessTicket(user, before) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	definitions, err := utils.ReadFieldDefinitions()
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	values := make(map[int][]string)
+	for _, definition := range definitions.Fields {
+		values[definition.ID] = r.PostForm["field-"+strconv.Itoa(definition.ID)]
+	}
+
+	err = utils.SetTicketFields(ticketId, values)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	publishTicketEvent(utils.EventTicketUpdated, before, user.Username)
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+// Moves the ticket of the referer into the posted queue, 0 removes it from its queue
+func ServeMoveTicket(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticketId, err := strconv.Atoi(path.Base(r.Referer()))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorURLParsing.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	queueID, err := strconv.Atoi(r.PostFormValue("queue"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	before, err := utils.ReadTicket(ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if !utils.CanAccessTicket(user, before) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticket, err := utils.MoveTicket(before, queueID, user.Username)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if ticket.Queue != before.Queue {
+		publishTicketEvent(utils.EventTicketMoved, before, user.Username)
+	}
+
+	// The user may not be allowed to see the ticket in its new queue anymore
+	if !utils.CanAccessTicket(user, ticket) {
+		http.Redirect(w, r, "/tickets/", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+// Moves the posted messages of the ticket of the referer into a new ticket and tells the customer about it.
+// The messages are posted by their index in the message list
+func ServeSplitTicket(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticketId, err := strconv.Atoi(path.Base(r.Referer()))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorURLParsing.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	var indexes []int
+	for _, value := range r.PostForm["message"] {
+		index, err := strconv.Atoi(value)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		indexes = append(indexes, index)
+	}
+
+	before, err := utils.ReadTicket(ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if !utils.CanAccessTicket(user, before) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	newTicket, err := utils.SplitTicket(ticketId, indexes, strings.TrimSpace(r.PostFormValue("subject")), user.Username)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	utils.PublishEvent(utils.Event{Type: utils.EventTicketCreated, Ticket: newTicket, Actor: user.Username, Source: utils.SourceWeb,
+		Details: map[string]string{"splitFromTicketId": strconv.Itoa(ticketId)}})
+	if ticket, err := utils.ReadTicket(ticketId); err == nil {
+		utils.PublishEvent(utils.Event{Type: utils.EventTicketSplit, Ticket: ticket, Actor: user.Username, Source: utils.SourceWeb,
+			Changes: utils.TicketChanges(before, ticket), Details: map[string]string{"splitTicketId": strconv.Itoa(newTicket.ID)}})
+	}
+
+	err = utils.SendSplitNotice(newTicket, before, user.Username)
+	if err != nil {
+		log.Printf("Couldn't send the split notice for ticket %d: %v\n", newTicket.ID, err)
+	}
+
+	http.Redirect(w, r, "/tickets/"+strconv.Itoa(newTicket.ID), http.StatusFound)
+}
+
+// Links the ticket of the referer to the posted ticket. The customer of a duplicate is told which ticket handles their request
+func ServeLinkTicket(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticketId, err := strconv.Atoi(path.Base(r.Referer()))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorURLParsing.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	otherID, err := strconv.Atoi(r.PostFormValue("ticket"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	relationType := utils.RelationType(r.PostFormValue("type"))
+
+	before, err := utils.ReadTicket(ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	otherBefore, err := utils.ReadTicket(otherID)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if !utils.CanAccessTicket(user, before) || !utils.CanAccessTicket(user, otherBefore) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	err = utils.LinkTickets(ticketId, otherID, relationType, user.Username)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	publishTicketEvent(utils.EventTicketUpdated, before, user.Username)
+	publishTicketEvent(utils.EventTicketUpdated, otherBefore, user.Username)
+
+	duplicate, canonical := before, otherBefore
+	if relationType == utils.RelationDuplicatedBy {
+		duplicate, canonical = otherBefore, before
+	}
+	if relationType == utils.RelationDuplicateOf || relationType == utils.RelationDuplicatedBy {
+		err = utils.SendDuplicateNotice(duplicate, canonical, user.Username)
+		if err != nil {
+			log.Printf("Couldn't send the duplicate notice for ticket %d: %v\n", duplicate.ID, err)
+		}
+	}
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+// Removes the link between the ticket of the referer and the posted ticket
+func ServeUnlinkTicket(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticketId, err := strconv.Atoi(path.Base(r.Referer()))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorURLParsing.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	otherID, err := strconv.Atoi(r.PostFormValue("ticket"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	before, err := utils.ReadTicket(ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if !utils.CanAccessTicket(user, before) {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	otherBefore, otherErr := utils.ReadTicket(otherID)
+
+	err = utils.UnlinkTickets(ticketId, otherID, user.Username)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	publishTicketEvent(utils.EventTicketUpdated, before, user.Username)
+	if otherErr == nil {
+		publishTicketEvent(utils.EventTicketUpdated, otherBefore, user.Username)
+	}
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+func ServeMailsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		// returns the list of mails which are to be sent
+		getMails(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		// saves the posted mails to data storage
+		postMails(w, r)
+		return
+	}
+
+	utils.RespondWithError(w, http.StatusMethodNotAllowed, "This REST API only responds to GET and POST requests!")
+}
+
+func getMails(w http.ResponseWriter, _ *http.Request) {
+	rawMails, err := utils.ReadMailsFile()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "We had issues fetching the E-Mails!")
+		return
+	}
+
+	var mails []utils.MailData
+	for _, mail := range rawMails.MailList {
+		if preventEMailPingPong(mail) {
+			continue
+		}
+
+		err := mail.IncrementReadAttemptsCounter()
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "We had internal issues fetching the data for you. Please try it again!")
+			return
+		} else {
+			mail := utils.MailData{EMailAddress: mail.Mail, Subject: mail.Subject, Message: mail.Message}
+			mails = append(mails, mail)
+		}
+	}
+
+	utils.RespondWithXML(w, http.StatusOK, utils.Response{Meta: utils.MetaData{Code: http.StatusOK, Message: "OK"}, Data: mails})
+}
+
+// Checks depending on the FirstReadAttemptDate if the ReadAttemptCounter is tolerable to prevent email ping pong
+func preventEMailPingPong(mail utils.Mail) bool {
+	// There are no restraints for the first 3 read attempts
+	if mail.ReadAttemptCounter < 3 {
+		return false
+	}
+
+	// The next 7 read attempts can be made in the first 30 minutes after the first read attempt
+	minsSinceFirstReadAttempt := time.Since(mail.FirstReadAttemptDate).Minutes()
+	allowedAttempts := (float64(7)/30)*minsSinceFirstReadAttempt + 3
+	if mail.ReadAttemptCounter < 10 {
+		return allowedAttempts < float64(mail.ReadAttemptCounter)
 	}
 
 	// After that, every 30 minutes the mail can be read once more
@@ -452,47 +1697,413 @@ func preventEMailPingPong(mail utils.Mail) bool {
 	return allowedAttempts < float64(mail.ReadAttemptCounter)
 }
 
-func postMails(w http.ResponseWriter, r *http.Request) {
-	// Using MailData to ensure only accepting the address, subject and message
-	var request utils.Request
-	err := xml.NewDecoder(r.Body).Decode(&request)
+func postMails(w http.ResponseWriter, r *http.Request) {
+	// Using MailData to ensure only accepting the address, subject and message
+	var request utils.Request
+	err := xml.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	_, err = utils.ReceiveMail(utils.SourceMail, request.Mail.Recipient, request.Mail.EMailAddress, request.Mail.Subject, request.Mail.Message)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "We had issues storing your sent E-Mails!")
+		return
+	}
+
+	utils.RespondWithXML(w, http.StatusOK, utils.Response{Meta: utils.MetaData{Code: http.StatusOK, Message: "OK"}})
+}
+
+func ServeMailsSentNotification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "This REST API only responds to POST requests!")
+		return
+	}
+
+	var request utils.Request
+	err := xml.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	err = utils.DeleteMails(request.MailIDs)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "We ran into issues processing your request. Please try it again.")
+		return
+	}
+
+	utils.RespondWithXML(w, http.StatusOK, utils.Response{Meta: utils.MetaData{Code: http.StatusOK, Message: "OK"}})
+}
+
+// Shows the ticket volume, the response times and the workload of the editors for the requested days as charts
+func ServeReports(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	report, err := requestedReport(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// The charts are rendered by the server, hence they are trusted as HTML
+	var charts []template.HTML
+	for _, chart := range report.Charts() {
+		charts = append(charts, template.HTML(chart))
+	}
+
+	ctx := templateContext{HeaderTitle: "Reports", ContentTemplate: "reports.html", IsSignedIn: true, IsAdmin: true, Username: user.Username, Report: report, ReportCharts: charts}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+// Sends the requested section of the report as CSV file
+func ServeReportExport(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	report, err := requestedReport(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	section := r.URL.Query().Get("section")
+	var content strings.Builder
+	err = utils.WriteReportCSV(&content, report, section)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"report-"+section+"-"+report.From.Format("2006-01-02")+"-"+report.To.Format("2006-01-02")+".csv\"")
+	_, _ = w.Write([]byte(content.String()))
+}
+
+// Generates the report for the days of the query, the last 30 days are used by default
+func requestedReport(r *http.Request) (utils.Report, error) {
+	query := r.URL.Query()
+	to := time.Now()
+	from := to.AddDate(0, 0, -29)
+
+	var err error
+	if query.Get("from") != "" {
+		from, err = time.ParseInLocation("2006-01-02", query.Get("from"), time.Local)
+		if err != nil {
+			return utils.Report{}, err
+		}
+	}
+	if query.Get("to") != "" {
+		to, err = time.ParseInLocation("2006-01-02", query.Get("to"), time.Local)
+		if err != nil {
+			return utils.Report{}, err
+		}
+	}
+
+	return utils.GenerateReport(from, to)
+}
+
+// Maximum size of the files which can be imported
+const maxImportSize = 32 << 20
+
+// Shows the export of the tickets and users and the import of tickets from other help desks
+func ServeData(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	serveDataPage(w, r, user, nil, "")
+}
+
+func serveDataPage(w http.ResponseWriter, r *http.Request, user utils.User, mappings []utils.ImportMapping, errorMsg string) {
+	queueList, err := utils.ReadQueues()
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ctx := templateContext{HeaderTitle: "Data", ContentTemplate: "data.html", IsSignedIn: true, IsAdmin: true, Username: user.Username,
+		Queues: queueList.Queues, ImportMappings: mappings, ErrorMsg: errorMsg}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+// Sends the tickets which match the filters of the query as CSV or JSON file
+func ServeDataTickets(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	filter, err := requestedExportFilter(r)
+	if err != nil || !utils.IsExportFormat(format) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	var content strings.Builder
+	err = utils.WriteTickets(&content, utils.ExportTickets(filter), format)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	writeExport(w, "tickets", format, content.String())
+}
+
+// Sends all users without their passwords as CSV or JSON file
+func ServeDataUsers(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if !utils.IsExportFormat(format) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	users, err := utils.ExportUsers()
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	var content strings.Builder
+	err = utils.WriteUsers(&content, users, format)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	writeExport(w, "users", format, content.String())
+}
+
+func writeExport(w http.ResponseWriter, name string, format string, content string) {
+	if format == utils.ExportFormatJSON {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+name+"-"+time.Now().Format("2006-01-02")+"."+format+"\"")
+	_, _ = w.Write([]byte(content))
+}
+
+// Reads the filters of the ticket export, the days of the query are both included
+func requestedExportFilter(r *http.Request) (utils.TicketExportFilter, error) {
+	query := r.URL.Query()
+	filter := utils.TicketExportFilter{Status: -1, Queue: -1, Filter: utils.TicketFilter{Tag: strings.ToLower(strings.TrimSpace(query.Get("tag")))}}
+
+	var err error
+	if query.Get("status") != "" {
+		var ok bool
+		filter.Status, ok = utils.ParseTicketStatus(query.Get("status"))
+		if !ok {
+			return filter, fmt.Errorf("unknown status %q", query.Get("status"))
+		}
+	}
+	if query.Get("queue") != "" {
+		filter.Queue, err = strconv.Atoi(query.Get("queue"))
+		if err != nil {
+			return filter, err
+		}
+	}
+	if query.Get("from") != "" {
+		filter.From, err = time.ParseInLocation("2006-01-02", query.Get("from"), time.Local)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if query.Get("to") != "" {
+		filter.To, err = time.ParseInLocation("2006-01-02", query.Get("to"), time.Local)
+		if err != nil {
+			return filter, err
+		}
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+	return filter, nil
+}
+
+// Creates tickets from the uploaded export of another help desk and shows which tickets were created for them
+func ServeDataImport(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/data", http.StatusFound)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err = r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorFormParsing.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	defer file.Close()
+
+	// Problems with the content are shown on the page, so the file can be corrected
+	tickets, err := utils.ParseImport(file, r.PostFormValue("format"))
+	if err != nil {
+		serveDataPage(w, r, user, nil, "The file can't be read: "+err.Error())
+		return
+	}
+	mappings, err := utils.ImportTickets(tickets, r.PostFormValue("source"), user.Username)
+	if err != nil {
+		serveDataPage(w, r, user, mappings, "The tickets can't be imported: "+err.Error())
+		return
+	}
+
+	serveDataPage(w, r, user, mappings, "")
+}
+
+// Sends a consistent snapshot of the data folder as compressed archive, which can be restored with the command line.
+// The archive is streamed to the response, hence errors can't be shown anymore and only cut the archive off
+func ServeDataBackup(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"backup-"+time.Now().Format("20060102-150405")+".tar.gz\"")
+	_, err = utils.WriteBackup(w)
+	if err != nil {
+		log.Printf("Couldn't write the backup: %v\n", err)
+	}
+}
+
+func ServeAuditLog(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := utils.AuditFilter{Username: query.Get("username"), Actor: query.Get("actor"), Action: query.Get("action"), Source: query.Get("source")}
+	if query.Get("ticket") != "" {
+		filter.TicketID, err = strconv.Atoi(query.Get("ticket"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+	}
+	if query.Get("from") != "" {
+		filter.From, err = time.Parse("2006-01-02", query.Get("from"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+	}
+	if query.Get("to") != "" {
+		to, err := time.Parse("2006-01-02", query.Get("to"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		// Including the complete last day
+		filter.To = to.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	auditEntries, err := utils.QueryAuditLog(filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid payload")
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ctx := templateContext{HeaderTitle: "Audit Log", ContentTemplate: "audit.html", IsSignedIn: true, IsAdmin: true, Username: user.Username, AuditEntries: auditEntries, AuditFilter: filter}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+func ServeWebhooks(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
 		return
 	}
 
-	_, err = utils.CreateTicketFromMail(request.Mail.EMailAddress, request.Mail.Subject, request.Mail.Message)
+	deliveryList, err := utils.ReadWebhookDeliveries()
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "We had issues storing your sent E-Mails!")
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
 		return
 	}
 
-	utils.RespondWithXML(w, http.StatusOK, utils.Response{Meta: utils.MetaData{Code: http.StatusOK, Message: "OK"}})
+	// Showing the latest deliveries first
+	deliveries := deliveryList.Deliveries
+	for i, j := 0, len(deliveries)-1; i < j; i, j = i+1, j-1 {
+		deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+	}
+
+	ctx := templateContext{HeaderTitle: "Webhooks", ContentTemplate: "webhooks.html", IsSignedIn: true, IsAdmin: true, Username: user.Username, WebhookDeliveries: deliveries}
+	executeTemplate(w, r, "index.html", ctx)
 }
 
-func ServeMailsSentNotification(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		utils.RespondWithError(w, http.StatusMethodNotAllowed, "This REST API only responds to POST requests!")
+func ServeWebhookRedelivery(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
 		return
 	}
 
-	var request utils.Request
-	err := xml.NewDecoder(r.Body).Decode(&request)
+	deliveryID, err := strconv.Atoi(r.PostFormValue("delivery"))
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid payload")
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
 		return
 	}
 
-	err = utils.DeleteMails(request.MailIDs)
+	_, err = utils.GetWebhookDelivery(deliveryID)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "We ran into issues processing your request. Please try it again.")
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
 		return
 	}
 
-	utils.RespondWithXML(w, http.StatusOK, utils.Response{Meta: utils.MetaData{Code: http.StatusOK, Message: "OK"}})
+	// The result of the redelivery gets recorded in the delivery log, hence a failed attempt is no error here
+	_, _ = utils.RedeliverWebhook(deliveryID)
+
+	http.Redirect(w, r, "/webhooks", http.StatusFound)
+}
+
+// Publishes an event for the current state of a ticket which was changed through the web interface
+func publishTicketEvent(eventType utils.EventType, before utils.Ticket, actor string) {
+	ticket, err := utils.ReadTicket(before.ID)
+	if err != nil {
+		return
+	}
+
+	utils.PublishEvent(utils.Event{Type: eventType, Ticket: ticket, Actor: actor, Source: utils.SourceWeb, Changes: utils.TicketChanges(before, ticket)})
 }
 
 func executeTemplate(w http.ResponseWriter, r *http.Request, name string, ctx templateContext) {
+	// The pinned views of the editor are part of the navbar of every page
+	if ctx.IsSignedIn {
+		if user, err := utils.GetUserFromCookie(r); err == nil {
+			ctx.PinnedViews, _ = utils.GetPinnedViews(user)
+		}
+	}
+
 	err := templates.ExecuteTemplate(w, name, ctx)
 	if err != nil {
 		http.Redirect(w, r, utils.ErrorTemplateExecution.ErrorPageURL(), http.StatusFound)
@@ -505,3 +2116,291 @@ func parseForm(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, utils.ErrorFormParsing.ErrorPageURL(), http.StatusFound)
 	}
 }
+
+// Shows the automation rules and evaluates them for an existing ticket if one is requested
+func ServeRules(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ruleList, err := utils.ReadRules()
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ctx := templateContext{HeaderTitle: "Automation Rules", ContentTemplate: "rules.html", IsSignedIn: true, IsAdmin: true, Username: user.Username, Rules: ruleList.Rules,
+		NewRule: utils.Rule{Enabled: true, OnCreate: true}}
+
+	query := r.URL.Query()
+	if query.Get("ticket") != "" {
+		ticketId, err := strconv.Atoi(query.Get("ticket"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+
+		ctx.CurrentTicket, err = utils.ReadTicket(ticketId)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+			return
+		}
+
+		trigger := utils.RuleTriggerCreate
+		if query.Get("trigger") == utils.RuleTriggerCustomerReply {
+			trigger = utils.RuleTriggerCustomerReply
+		}
+
+		ctx.RuleMatches, err = utils.DryRunRules(ctx.CurrentTicket, trigger)
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+			return
+		}
+	}
+
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+// Creates a new rule or updates an existing one if an ID is posted
+func ServeRuleSave(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	actions, err := utils.ParseMacroActions(r.PostFormValue("actions"))
+	if err != nil || !utils.CheckEmptyXSSString(r.PostFormValue("name")) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	rule := utils.Rule{
+		Name:            r.PostFormValue("name"),
+		Enabled:         r.PostFormValue("enabled") == "on",
+		OnCreate:        r.PostFormValue("oncreate") == "on",
+		OnCustomerReply: r.PostFormValue("oncustomerreply") == "on",
+		Conditions: utils.RuleConditions{
+			SenderDomain:   strings.TrimSpace(r.PostFormValue("senderdomain")),
+			SubjectPattern: r.PostFormValue("subjectpattern"),
+			BodyPattern:    r.PostFormValue("bodypattern"),
+			FromTime:       r.PostFormValue("fromtime"),
+			ToTime:         r.PostFormValue("totime"),
+			Channel:        r.PostFormValue("channel"),
+		},
+		Actions:        actions,
+		StopProcessing: r.PostFormValue("stop") == "on",
+	}
+	if utils.ValidateRule(rule) != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	if r.PostFormValue("id") == "" {
+		_, err = utils.CreateRule(rule)
+	} else {
+		rule.ID, err = strconv.Atoi(r.PostFormValue("id"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		_, err = utils.UpdateRule(rule)
+	}
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/rules", http.StatusFound)
+}
+
+func ServeRuleDelete(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostFormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	err = utils.DeleteRule(id)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/rules", http.StatusFound)
+}
+
+func ServeQueues(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	queueList, err := utils.ReadQueues()
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ctx := templateContext{HeaderTitle: "Queues", ContentTemplate: "queues.html", IsSignedIn: true, IsAdmin: true, Username: user.Username, Queues: queueList.Queues}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+// Creates a new queue or updates an existing one if an ID is posted
+func ServeQueueSave(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	if !utils.CheckEmptyXSSString(r.PostFormValue("name")) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	queue := utils.Queue{
+		Name:    r.PostFormValue("name"),
+		Address: strings.TrimSpace(r.PostFormValue("address")),
+		Members: utils.ParseQueueMembers(r.PostFormValue("members")),
+	}
+
+	if r.PostFormValue("id") == "" {
+		_, err = utils.CreateQueue(queue)
+	} else {
+		queue.ID, err = strconv.Atoi(r.PostFormValue("id"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		_, err = utils.UpdateQueue(queue)
+	}
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/queues", http.StatusFound)
+}
+
+func ServeQueueDelete(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostFormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// Queues which still contain tickets can't be deleted
+	err = utils.DeleteQueue(id)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/queues", http.StatusFound)
+}
+
+func ServeFields(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	definitions, err := utils.ReadFieldDefinitions()
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataFetching.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ctx := templateContext{HeaderTitle: "Custom Fields", ContentTemplate: "fields.html", IsSignedIn: true, IsAdmin: true, Username: user.Username, FieldDefinitions: definitions.Fields,
+		NewField: utils.FieldDefinition{Type: utils.FieldTypeText}}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+// Creates a new custom field or updates an existing one if an ID is posted
+func ServeFieldSave(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	if !utils.CheckEmptyXSSString(r.PostFormValue("name")) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	field := utils.FieldDefinition{
+		Name:     r.PostFormValue("name"),
+		Type:     r.PostFormValue("type"),
+		Options:  utils.ParseFieldOptions(r.PostFormValue("options")),
+		Required: r.PostFormValue("required") == "on",
+	}
+
+	if r.PostFormValue("id") == "" {
+		_, err = utils.CreateFieldDefinition(field)
+	} else {
+		field.ID, err = strconv.Atoi(r.PostFormValue("id"))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		_, err = utils.UpdateFieldDefinition(field)
+	}
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/fields", http.StatusFound)
+}
+
+func ServeFieldDelete(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	user, err := utils.GetUserFromCookie(r)
+	if err != nil || !user.IsAdmin() {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostFormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	err = utils.DeleteFieldDefinition(id)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/fields", http.StatusFound)
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/xml"
 	"github.com/stretchr/testify/assert"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -23,6 +24,7 @@ import (
 func setup() {
 	config.DataPath = "datatest"
 	config.TemplatePath = path.Join("..", "templates")
+	config.MailTemplatePath = path.Join("..", "mailtemplates")
 	config.ServerKeyPath = path.Join("..", "etc", "server.key")
 	config.ServerCertPath = path.Join("..", "etc", "server.crt")
 	Setup()
@@ -390,6 +392,36 @@ func TestServeTicketCreationSuccess(t *testing.T) {
 	assert.Equal(t, "/", resultURL.Path)
 }
 
+func TestServeTicketCreationAcknowledgement(t *testing.T) {
+	setup()
+	defer teardown()
+
+	form := url.Values{}
+	form.Add("email", "mustermann@gmail.com")
+	form.Add("subject", "PC Issue")
+	form.Add("message", "I have issues with my pc...")
+
+	req := httptest.NewRequest(http.MethodPost, "/tickets/new", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	req.Form = form
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServeTicketCreation)
+	handler.ServeHTTP(rr, req)
+
+	mailList, err := utils.ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Equal(t, "mustermann@gmail.com", mailList.MailList[0].Mail)
+	assert.Equal(t, "[Ticket #1] Wir haben Ihre Anfrage erhalten: PC Issue", mailList.MailList[0].Subject)
+
+	// Later mails to the customer use the same language
+	ticket, err := utils.ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "de", ticket.Language)
+}
+
 func TestServeAddCommentUnauthorized(t *testing.T) {
 	setup()
 	defer teardown()
@@ -592,6 +624,13 @@ func TestServeAddCommentSuccessEmail(t *testing.T) {
 	resultURL, err := rr.Result().Location()
 	assert.Nil(t, err)
 	assert.Equal(t, req.Referer(), resultURL.Path)
+
+	// The reply is part of the ticket history and references the queued mail
+	ticket, err := utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ticket.MessageList))
+	assert.Equal(t, utils.MessageTypeReply, ticket.MessageList[1].Type)
+	assert.Equal(t, 1, ticket.MessageList[1].MailID)
 }
 
 func createDummyTicket() (utils.Ticket, error) {
@@ -1172,6 +1211,52 @@ func TestServeCloseTicketSuccess(t *testing.T) {
 	resultURL, err := rr.Result().Location()
 	assert.Nil(t, err)
 	assert.Equal(t, "/tickets/", resultURL.Path)
+
+	// The customer gets a closure notice
+	mailList, err := utils.ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Equal(t, testTicket.Client, mailList.MailList[0].Mail)
+}
+
+func TestServeCloseTicketBlocked(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+	blocker, err := createDummyTicket()
+	assert.Nil(t, err)
+	assert.Nil(t, utils.LinkTickets(testTicket.ID, blocker.ID, utils.RelationBlockedBy, "Test123"))
+
+	req := httptest.NewRequest(http.MethodPost, "/closeTicket", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Header.Set("Referer", "/ticket/"+strconv.Itoa(testTicket.ID))
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeCloseTicket)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusFound)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorTicketBlocked.ErrorPageURL(), resultURL.Path)
+
+	ticket, err := utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.TicketStatusOpen, ticket.Status)
 }
 
 func TestServeMergeTicketsUnauthorized(t *testing.T) {
@@ -1520,6 +1605,39 @@ func TestPostMailsSuccess(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 	_, err = utils.ReadTicket(1)
 	assert.Nil(t, err) // ticket exists
+
+	// Mails posted by the mail service are received through the mail channel
+	entries, err := utils.GetTicketAuditLog(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, utils.SourceMail, entries[0].Source)
+}
+
+func TestPostMailsRunsMailRules(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := utils.CreateRule(utils.Rule{Name: "Mail", Enabled: true, OnCreate: true, Conditions: utils.RuleConditions{Channel: utils.SourceMail},
+		Actions: []utils.MacroAction{{Type: utils.MacroActionPriority, Value: "high"}}})
+	assert.Nil(t, err)
+
+	mailReq := utils.Request{Mail: utils.MailData{EMailAddress: "Test@gmail.com", Subject: "Test Subject", Message: "Test Message"}}
+	payload, err := xml.Marshal(mailReq)
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/mails", bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/xml")
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(postMails)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	ticket, err := utils.ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.TicketPriorityHigh, ticket.Priority)
+	rules, err := utils.ReadRules()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, rules.Rules[0].FireCount)
 }
 
 func TestServeMailsAPIInvalidHTTPMethod(t *testing.T) {
@@ -1637,3 +1755,2391 @@ func TestServeMailsSentNotificationSuccess(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(maillist.MailList))
 }
+
+func TestServeWebhooksUnauthorized(t *testing.T) {
+	setup()
+	defer teardown()
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServeWebhooks)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusFound)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorUnauthorized.ErrorPageURL(), resultURL.Path)
+}
+
+func TestServeWebhooksNoAdmin(t *testing.T) {
+	setup()
+	defer teardown()
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	// The payloads contain internal notes and tickets of all queues, so only administrators may see them
+	handler := http.HandlerFunc(ServeWebhooks)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusFound)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorUnauthorized.ErrorPageURL(), resultURL.Path)
+}
+
+func TestServeWebhooksSuccess(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+	handler := http.HandlerFunc(ServeWebhooks)
+
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestServeWebhookRedeliveryInvalidDelivery(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	form := url.Values{}
+	form.Add("delivery", "1337")
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/redeliver", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Form = form
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeWebhookRedelivery)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusFound)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorInvalidInputs.ErrorPageURL(), resultURL.Path)
+}
+
+func TestServeWebhookRedeliverySuccess(t *testing.T) {
+	setup()
+	defer teardown()
+
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer server.Close()
+
+	config.Admins = []string{"Test123"}
+	config.WebhookURLs = []string{server.URL}
+	config.WebhookSecret = "secret"
+	config.WebhookMaxAttempts = 0 // Only creating the delivery without the background attempts
+	defer func() {
+		config.Admins = nil
+		config.WebhookURLs = nil
+		config.WebhookSecret = ""
+		config.WebhookMaxAttempts = 3
+	}()
+	_, err := utils.CreateTicketFromMail("test@mail", "testCaption", "testMsg")
+	assert.Nil(t, err)
+
+	form := url.Values{}
+	form.Add("delivery", "1")
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/redeliver", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Form = form
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeWebhookRedelivery)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusFound)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, "/webhooks", resultURL.Path)
+	assert.Equal(t, 1, received)
+
+	delivery, err := utils.GetWebhookDelivery(1)
+	assert.Nil(t, err)
+	assert.True(t, delivery.Delivered)
+}
+
+func TestServeReports(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		admin        bool
+		query        string
+		expectedCode int
+		expectedURL  string
+	}{
+		{false, "", http.StatusFound, utils.ErrorUnauthorized.ErrorPageURL()},
+		{true, "?from=yesterday", http.StatusFound, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{true, "?from=2021-03-02&to=2021-03-01", http.StatusFound, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{true, "", http.StatusOK, ""},
+	}
+	for _, d := range tests {
+		if d.admin {
+			config.Admins = []string{"Test123"}
+		}
+		req := httptest.NewRequest(http.MethodGet, "/reports"+d.query, nil)
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeReports)
+		handler.ServeHTTP(rr, req)
+		config.Admins = nil
+
+		assert.Equal(t, d.expectedCode, rr.Code)
+		if d.expectedCode == http.StatusFound {
+			resultURL, err := rr.Result().Location()
+			assert.Nil(t, err)
+			assert.Equal(t, d.expectedURL, resultURL.Path)
+		} else {
+			assert.Equal(t, 5, strings.Count(rr.Body.String(), "<svg"))
+			assert.Contains(t, rr.Body.String(), "First response: 0 tickets")
+		}
+	}
+}
+
+func TestServeReportExport(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	_, err := createDummyTicket()
+	assert.Nil(t, err)
+	today := time.Now().Format("2006-01-02")
+
+	tests := []struct {
+		query        string
+		expectedCode int
+		expected     string
+	}{
+		{"?section=customers", http.StatusFound, ""},
+		{"?section=daily&to=2021-02-30", http.StatusFound, ""},
+		{"?section=daily&from=" + today + "&to=" + today, http.StatusOK, "date,created,closed,backlog\n" + today + ",1,0,1\n"},
+		{"?section=workload&from=" + today + "&to=" + today, http.StatusOK, "editor,assigned,replies,closed\nTest123,0,0,0\n"},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/reports/export"+d.query, nil)
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeReportExport)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, d.expectedCode, rr.Code)
+		if d.expectedCode == http.StatusOK {
+			assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+			assert.Contains(t, rr.Header().Get("Content-Disposition"), "report-")
+			assert.Equal(t, d.expected, rr.Body.String())
+		}
+	}
+}
+
+func TestServeDataTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	_, err := createDummyTicket()
+	assert.Nil(t, err)
+	today := time.Now().Format("2006-01-02")
+
+	tests := []struct {
+		query        string
+		expectedCode int
+		expected     string
+	}{
+		{"?format=xml", http.StatusFound, ""},
+		{"?format=csv&status=waiting", http.StatusFound, ""},
+		{"?format=csv&from=" + today + "&to=" + today, http.StatusOK, "1,Subject Dummy,test@gmail.com,open,,normal,,,"},
+		{"?format=csv&status=closed", http.StatusOK, ""},
+		{"?format=json&queue=0", http.StatusOK, "\"subject\": \"Subject Dummy\""},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/data/tickets"+d.query, nil)
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeDataTickets)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, d.expectedCode, rr.Code)
+		if d.expectedCode == http.StatusOK {
+			assert.Contains(t, rr.Header().Get("Content-Disposition"), "tickets-")
+			assert.Contains(t, rr.Body.String(), d.expected)
+			assert.Equal(t, d.expected == "", strings.Count(rr.Body.String(), "\n") <= 1)
+		}
+	}
+}
+
+func TestServeDataUsers(t *testing.T) {
+	setup()
+	defer teardown()
+
+	req := httptest.NewRequest(http.MethodGet, "/data/users?format=json", nil)
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	// Only administrators can export the users
+	handler := http.HandlerFunc(ServeDataUsers)
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, utils.ErrorUnauthorized.ErrorPageURL(), rr.Header().Get("Location"))
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "\"username\": \"Test123\"")
+	assert.NotContains(t, rr.Body.String(), "Password")
+	assert.NotContains(t, rr.Body.String(), uuid)
+}
+
+func TestServeDataImport(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	tests := []struct {
+		format       string
+		content      string
+		expectedCode int
+		expected     string
+	}{
+		{"xml", "<tickets/>", http.StatusOK, "The file can&#39;t be read"},
+		{"csv", "ticket_id,subject,client,message_date,message_text\n7,Outage,nobody,2021-03-01,Help\n", http.StatusOK, "The tickets can&#39;t be imported"},
+		{"csv", "ticket_id,subject,client,message_date,message_text\n7,Outage,test@gmail.com,2021-03-01,Help\n", http.StatusOK, "7 &rarr; <a href=/tickets/1>#1</a>"},
+		{"csv", "ticket_id,subject,client,message_date,message_text\n7,Outage,test@gmail.com,2021-03-01,Help\n", http.StatusOK, "imported before"},
+	}
+	for _, d := range tests {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		assert.Nil(t, writer.WriteField("format", d.format))
+		assert.Nil(t, writer.WriteField("source", "OTRS"))
+		part, err := writer.CreateFormFile("file", "export."+d.format)
+		assert.Nil(t, err)
+		_, err = part.Write([]byte(d.content))
+		assert.Nil(t, err)
+		assert.Nil(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/data/import", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeDataImport)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, d.expectedCode, rr.Code)
+		assert.Contains(t, rr.Body.String(), d.expected)
+	}
+
+	ticket, err := utils.ReadTicket(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "7", ticket.ImportedFrom)
+	assert.True(t, time.Date(2021, 3, 1, 0, 0, 0, 0, time.Local).Equal(ticket.MessageList[0].CreationDate))
+}
+
+func TestServeDataBackup(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	_, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/data/backup", nil)
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeDataBackup)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/gzip", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), ".tar.gz")
+	_, files, err := utils.ReadBackup(rr.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(files["tickets/ticket1.xml"]), "Subject Dummy")
+}
+
+func TestServeAuditLogUnauthorized(t *testing.T) {
+	setup()
+	defer teardown()
+
+	req := httptest.NewRequest(http.MethodGet, "/audit", nil)
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	// Signed in users without administrator rights are not allowed to query the audit log
+	handler := http.HandlerFunc(ServeAuditLog)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusFound)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorUnauthorized.ErrorPageURL(), resultURL.Path)
+}
+
+func TestServeAuditLogInvalidInputs(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	for _, query := range []string{"?ticket=abc", "?from=yesterday", "?to=2019-13-01"} {
+		req := httptest.NewRequest(http.MethodGet, "/audit"+query, nil)
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeAuditLog)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, utils.ErrorInvalidInputs.ErrorPageURL(), resultURL.Path)
+	}
+}
+
+func TestServeAuditLogSuccess(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	assert.Nil(t, utils.RecordAuditEntry(utils.AuditEntry{Actor: "Test123", Source: utils.SourceWeb, Action: utils.AuditUserCreated, Username: "Test123"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/audit?actor=Test123&from=2019-01-01&to=2100-01-01", nil)
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeAuditLog)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), utils.AuditUserCreated)
+}
+
+func TestServeCloseTicketRecordsAuditEntry(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/closeTicket", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Header.Set("Referer", "/ticket/"+strconv.Itoa(testTicket.ID))
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeCloseTicket)
+	handler.ServeHTTP(rr, req)
+
+	entries, err := utils.GetTicketAuditLog(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "Test123", entries[0].Actor)
+	assert.Equal(t, utils.SourceWeb, entries[0].Source)
+	assert.Equal(t, string(utils.EventTicketClosed), entries[0].Action)
+	assert.Equal(t, "open", entries[0].Before)
+	assert.Equal(t, "closed", entries[0].After)
+}
+
+func TestServeUserRegistrationWithEmail(t *testing.T) {
+	setup()
+	defer teardown()
+
+	form := url.Values{}
+	form.Add("username", "Test123")
+	form.Add("email", "test123@dhbw.de")
+	form.Add("password1", "Aa!123456")
+	form.Add("password2", "Aa!123456")
+
+	req := httptest.NewRequest(http.MethodPost, "/signUp", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Form = form
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServeUserRegistration)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusMovedPermanently)
+	users, err := utils.ReadUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, "test123@dhbw.de", users["Test123"].Email)
+}
+
+func TestServeUserRegistrationInvalidEmail(t *testing.T) {
+	setup()
+	defer teardown()
+
+	form := url.Values{}
+	form.Add("username", "Test123")
+	form.Add("email", "no mail")
+	form.Add("password1", "Aa!123456")
+	form.Add("password2", "Aa!123456")
+
+	req := httptest.NewRequest(http.MethodPost, "/signUp", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Form = form
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServeUserRegistration)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusFound)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorInvalidInputs.ErrorPageURL(), resultURL.Path)
+}
+
+func TestServeSettingsShowTemplate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	req := httptest.NewRequest(http.MethodGet, "/settings", nil)
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+	assert.Nil(t, utils.SetUserNotificationSettings("Test123", utils.NotificationSettings{Mention: utils.NotificationDigest}))
+
+	handler := http.HandlerFunc(ServeSettings)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Contains(t, rr.Body.String(), `<option value="digest" selected>`)
+}
+
+func TestServeSettingsInvalidInputs(t *testing.T) {
+	setup()
+	defer teardown()
+
+	tests := []url.Values{
+		{"email": {"no mail"}, "assignment": {"immediate"}, "customerReply": {"immediate"}, "slaWarning": {"immediate"}, "mention": {"immediate"}},
+		{"email": {""}, "assignment": {"weekly"}, "customerReply": {"immediate"}, "slaWarning": {"immediate"}, "mention": {"immediate"}},
+		{"email": {""}, "assignment": {"immediate"}, "customerReply": {"immediate"}, "slaWarning": {"immediate"}, "mention": {"immediate"}, "capacity": {"-1"}},
+		{"email": {""}, "assignment": {"immediate"}, "customerReply": {"immediate"}, "slaWarning": {"immediate"}, "mention": {"immediate"}, "skills": {"<script>"}},
+		{"email": {""}, "assignment": {"immediate"}, "customerReply": {"immediate"}, "slaWarning": {"immediate"}, "mention": {"immediate"}, "absencefrom": {"2020-05-02"}, "absenceto": {"2020-05-01"}},
+		{"email": {""}, "assignment": {"immediate"}, "customerReply": {"immediate"}, "slaWarning": {"immediate"}, "mention": {"immediate"}, "absencefrom": {"2020-05-01"}, "absenceto": {"tomorrow"}},
+		{"email": {""}, "assignment": {"immediate"}, "customerReply": {"immediate"}, "slaWarning": {"immediate"}, "mention": {"immediate"}, "absencefrom": {"2020-05-01"}, "absenceto": {"2020-05-02"}, "delegate": {"Unknown"}},
+	}
+	for _, form := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/settings", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Form = form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeSettings)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, utils.ErrorInvalidInputs.ErrorPageURL(), resultURL.Path)
+	}
+}
+
+func TestServeSettingsSuccess(t *testing.T) {
+	setup()
+	defer teardown()
+
+	form := url.Values{}
+	form.Add("email", "test123@dhbw.de")
+	form.Add("assignment", utils.NotificationDigest)
+	form.Add("customerReply", utils.NotificationImmediate)
+	form.Add("slaWarning", utils.NotificationOff)
+	form.Add("mention", utils.NotificationImmediate)
+	form.Add("capacity", "5")
+	form.Add("skills", "Network, billing")
+	form.Add("absencefrom", "2020-05-01")
+	form.Add("absenceto", "2020-05-08")
+	form.Add("delegate", "Test124")
+	form.Add("notifycustomers", "on")
+
+	req := httptest.NewRequest(http.MethodPost, "/settings", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Form = form
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	createUser("Test124", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeSettings)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusFound)
+	users, err := utils.ReadUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, "test123@dhbw.de", users["Test123"].Email)
+	assert.Equal(t, utils.NotificationSettings{Assignment: utils.NotificationDigest, CustomerReply: utils.NotificationImmediate,
+		SLAWarning: utils.NotificationOff, Mention: utils.NotificationImmediate}, users["Test123"].Notifications)
+	assert.Equal(t, 5, users["Test123"].Capacity)
+	assert.Equal(t, []string{"billing", "network"}, users["Test123"].Skills)
+	absence := users["Test123"].Absence
+	assert.True(t, time.Date(2020, 5, 1, 0, 0, 0, 0, time.Local).Equal(absence.From))
+	assert.True(t, time.Date(2020, 5, 8, 0, 0, 0, 0, time.Local).Equal(absence.To))
+	assert.Equal(t, "Test124", absence.Delegate)
+	assert.True(t, absence.NotifyCustomers)
+
+	// Every changed setting is audited with its previous and its new value
+	entries, err := utils.QueryAuditLog(utils.AuditFilter{Action: utils.AuditUserSettingsChanged, Username: "Test123"})
+	assert.Nil(t, err)
+	var fields []string
+	for _, entry := range entries {
+		fields = append(fields, entry.Field)
+	}
+	assert.Equal(t, []string{"email", "notifications", "capacity", "skills", "absence"}, fields)
+	assert.Equal(t, "0", entries[2].Before)
+	assert.Equal(t, "5", entries[2].After)
+	assert.Equal(t, "2020-05-01 to 2020-05-08, delegate Test124, customers are notified", entries[4].After)
+
+	// Unchanged settings are not audited again
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	entries, err = utils.QueryAuditLog(utils.AuditFilter{Action: utils.AuditUserSettingsChanged, Username: "Test123"})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(entries))
+}
+
+func TestServeCannedResponses(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := utils.CreateCannedResponse("Greeting", "Hello {customer}", "Test123", false)
+	assert.Nil(t, err)
+	_, err = utils.CreateCannedResponse("Secret", "Hidden", "Other", false)
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/cannedResponses", nil)
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeCannedResponses)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Contains(t, rr.Body.String(), "Greeting")
+	assert.NotContains(t, rr.Body.String(), "Secret")
+}
+
+func TestServeCannedResponseSave(t *testing.T) {
+	setup()
+	defer teardown()
+
+	otherResponse, err := utils.CreateCannedResponse("Other", "Text", "Other", true)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		form        url.Values
+		expectedURL string
+	}{
+		{url.Values{"name": {"Greeting"}, "text": {"Hello {customer}"}, "shared": {"on"}}, "/cannedResponses"},
+		{url.Values{"id": {"2"}, "name": {"Welcome"}, "text": {"Welcome {customer}"}}, "/cannedResponses"},
+		{url.Values{"name": {"<script>"}, "text": {"Text"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"name": {"Name"}, "text": {" "}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"id": {"9"}, "name": {"Name"}, "text": {"Text"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"id": {strconv.Itoa(otherResponse.ID)}, "name": {"Name"}, "text": {"Text"}}, utils.ErrorUnauthorized.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/cannedResponses/save", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Form = d.form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeCannedResponseSave)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	response, err := utils.GetCannedResponse(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Welcome", response.Name)
+	assert.Equal(t, "Test123", response.Owner)
+	assert.False(t, response.Shared)
+}
+
+func TestServeCannedResponseDelete(t *testing.T) {
+	setup()
+	defer teardown()
+
+	response, err := utils.CreateCannedResponse("Greeting", "Hello", "Test123", false)
+	assert.Nil(t, err)
+
+	form := url.Values{}
+	form.Add("id", strconv.Itoa(response.ID))
+
+	req := httptest.NewRequest(http.MethodPost, "/cannedResponses/delete", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Form = form
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeCannedResponseDelete)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusFound)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, "/cannedResponses", resultURL.Path)
+
+	_, err = utils.GetCannedResponse(response.ID)
+	assert.NotNil(t, err)
+}
+
+func TestServeTicketDetailCannedResponses(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+	_, err = utils.CreateCannedResponse("Greeting", "Hello {customer}, this is {editor}", "Test123", false)
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/tickets/"+strconv.Itoa(testTicket.ID), nil)
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeTickets)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Contains(t, rr.Body.String(), `data-text="Hello test@gmail.com, this is Test123"`)
+}
+
+func TestServeAddCommentCountsCannedResponseUsage(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+	response, err := utils.CreateCannedResponse("Greeting", "Hello", "Test123", false)
+	assert.Nil(t, err)
+
+	form := url.Values{}
+	form.Add("comment", "Hello")
+	form.Add("sendoption", "comments")
+	form.Add("cannedresponse", strconv.Itoa(response.ID))
+
+	req := httptest.NewRequest(http.MethodPost, "/addComment", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Header.Set("Referer", "/ticket/"+strconv.Itoa(testTicket.ID))
+	req.Form = form
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeAddComment)
+	handler.ServeHTTP(rr, req)
+
+	response, err = utils.GetCannedResponse(response.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, response.UsageCount)
+}
+
+func TestServeMacroSave(t *testing.T) {
+	setup()
+	defer teardown()
+
+	otherMacro, err := utils.CreateMacro("Other", []utils.MacroAction{{Type: utils.MacroActionStatus, Value: "closed"}}, "Other", true)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		form        url.Values
+		expectedURL string
+	}{
+		{url.Values{"name": {"Close"}, "actions": {"note Closed by {editor}\nstatus closed"}}, "/macros"},
+		{url.Values{"id": {"2"}, "name": {"Close quietly"}, "actions": {"status closed"}, "shared": {"on"}}, "/macros"},
+		{url.Values{"name": {"Invalid"}, "actions": {"delete everything"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"name": {""}, "actions": {"status closed"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"id": {strconv.Itoa(otherMacro.ID)}, "name": {"Mine"}, "actions": {"status closed"}}, utils.ErrorUnauthorized.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/macros/save", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Form = d.form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeMacroSave)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	macro, err := utils.GetMacro(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Close quietly", macro.Name)
+	assert.Equal(t, 1, len(macro.Actions))
+	assert.True(t, macro.Shared)
+}
+
+func TestServeRunMacro(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+	macro, err := utils.CreateMacro("Solve", []utils.MacroAction{
+		{Type: utils.MacroActionAssign},
+		{Type: utils.MacroActionReply, Value: "Solved"},
+		{Type: utils.MacroActionStatus, Value: "closed"},
+	}, "Test123", false)
+	assert.Nil(t, err)
+	brokenMacro, err := utils.CreateMacro("Broken", []utils.MacroAction{{Type: utils.MacroActionRelease}}, "Test123", false)
+	assert.Nil(t, err)
+	otherMacro, err := utils.CreateMacro("Other", []utils.MacroAction{{Type: utils.MacroActionStatus, Value: "closed"}}, "Other", false)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		macroID     int
+		expectedURL string
+	}{
+		{otherMacro.ID, utils.ErrorUnauthorized.ErrorPageURL()},
+		{brokenMacro.ID, utils.ErrorMacroExecution.ErrorPageURL()},
+		{99, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{macro.ID, "/ticket/" + strconv.Itoa(testTicket.ID)},
+	}
+	for _, d := range tests {
+		form := url.Values{}
+		form.Add("id", strconv.Itoa(d.macroID))
+
+		req := httptest.NewRequest(http.MethodPost, "/runMacro", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Header.Set("Referer", "/ticket/"+strconv.Itoa(testTicket.ID))
+		req.Form = form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeRunMacro)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	ticket, err := utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.TicketStatusClosed, ticket.Status)
+	assert.Equal(t, "Test123", ticket.Editor)
+	assert.Equal(t, 2, len(ticket.MessageList))
+}
+
+func TestServeRuleSave(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	tests := []struct {
+		form        url.Values
+		expectedURL string
+	}{
+		{url.Values{"name": {"Spam"}, "senderdomain": {"spam.com"}, "actions": {"spam"}, "enabled": {"on"}, "oncreate": {"on"}, "stop": {"on"}}, "/rules"},
+		{url.Values{"id": {"1"}, "name": {"Night"}, "fromtime": {"22:00"}, "totime": {"06:00"}, "actions": {"priority low"}, "oncreate": {"on"}}, "/rules"},
+		{url.Values{"name": {"Invalid"}, "actions": {"delete everything"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"name": {"Pattern"}, "subjectpattern": {"("}, "actions": {"spam"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"name": {"Assign"}, "actions": {"assign"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"id": {"99"}, "name": {"Unknown"}, "actions": {"spam"}}, utils.ErrorDataStoring.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/rules/save", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Form = d.form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeRuleSave)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	rule, err := utils.GetRule(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "Night", rule.Name)
+	assert.False(t, rule.Enabled)
+	assert.Equal(t, "22:00", rule.Conditions.FromTime)
+	assert.Equal(t, "", rule.Conditions.SenderDomain)
+}
+
+func TestServeRulesUnauthorized(t *testing.T) {
+	setup()
+	defer teardown()
+
+	for _, handlerFunc := range []http.HandlerFunc{ServeRules, ServeRuleSave, ServeRuleDelete} {
+		req := httptest.NewRequest(http.MethodPost, "/rules", nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		// Only administrators are allowed to manage the automation rules
+		handlerFunc.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, utils.ErrorUnauthorized.ErrorPageURL(), resultURL.Path)
+	}
+}
+
+func TestServeRulesDryRun(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	_, err := utils.CreateRule(utils.Rule{Name: "Dummies", Enabled: true, OnCreate: true,
+		Conditions: utils.RuleConditions{SubjectPattern: "dummy"}, Actions: []utils.MacroAction{{Type: utils.MacroActionPriority, Value: "high"}}})
+	assert.Nil(t, err)
+	_, err = utils.CreateRule(utils.Rule{Name: "Spam", Enabled: true, OnCreate: true,
+		Conditions: utils.RuleConditions{SenderDomain: "spam.com"}, Actions: []utils.MacroAction{{Type: utils.MacroActionSpam}}})
+	assert.Nil(t, err)
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		query        string
+		expectedCode int
+		expectedURL  string
+	}{
+		{"?ticket=" + strconv.Itoa(testTicket.ID), http.StatusOK, ""},
+		{"?ticket=abc", http.StatusFound, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{"?ticket=99", http.StatusFound, utils.ErrorInvalidTicketID.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/rules"+d.query, nil)
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeRules)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, d.expectedCode, rr.Code)
+		if d.expectedCode == http.StatusOK {
+			assert.Contains(t, rr.Body.String(), "Fires")
+			assert.Contains(t, rr.Body.String(), "the sender domain does not match")
+			continue
+		}
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	// The dry run doesn't change the ticket
+	ticket, err := utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.TicketPriorityNormal, ticket.Priority)
+}
+
+func TestServeRuleDelete(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	rule, err := utils.CreateRule(utils.Rule{Name: "Spam", Actions: []utils.MacroAction{{Type: utils.MacroActionSpam}}})
+	assert.Nil(t, err)
+
+	for _, d := range []struct {
+		id          string
+		expectedURL string
+	}{
+		{strconv.Itoa(rule.ID), "/rules"},
+		{strconv.Itoa(rule.ID), utils.ErrorDataStoring.ErrorPageURL()},
+		{"abc", utils.ErrorInvalidInputs.ErrorPageURL()},
+	} {
+		form := url.Values{"id": {d.id}}
+		req := httptest.NewRequest(http.MethodPost, "/rules/delete", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Form = form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeRuleDelete)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+}
+
+func TestServeQueueSave(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	tests := []struct {
+		form        url.Values
+		expectedURL string
+	}{
+		{url.Values{"name": {"Billing"}, "address": {"billing@dhbw.de"}, "members": {"Anna, Bert"}}, "/queues"},
+		{url.Values{"id": {"1"}, "name": {"Billing"}, "address": {"billing@dhbw.de"}, "members": {"Anna"}}, "/queues"},
+		{url.Values{"name": {"billing"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"name": {"Sales"}, "address": {"sales"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"name": {""}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"id": {"99"}, "name": {"Unknown"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/queues/save", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Form = d.form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeQueueSave)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	queue, err := utils.GetQueue(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Anna"}, queue.Members)
+}
+
+func TestServeQueuesUnauthorized(t *testing.T) {
+	setup()
+	defer teardown()
+
+	for _, handlerFunc := range []http.HandlerFunc{ServeQueues, ServeQueueSave, ServeQueueDelete} {
+		req := httptest.NewRequest(http.MethodPost, "/queues", nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		// Only administrators are allowed to manage the queues
+		handlerFunc.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, utils.ErrorUnauthorized.ErrorPageURL(), resultURL.Path)
+	}
+}
+
+func TestServeQueueDelete(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	queue, err := utils.CreateQueue(utils.Queue{Name: "Billing"})
+	assert.Nil(t, err)
+	full, err := utils.CreateQueue(utils.Queue{Name: "Sales"})
+	assert.Nil(t, err)
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+	_, err = utils.MoveTicket(testTicket, full.ID, "Test123")
+	assert.Nil(t, err)
+
+	for _, d := range []struct {
+		id          string
+		expectedURL string
+	}{
+		{strconv.Itoa(queue.ID), "/queues"},
+		{strconv.Itoa(queue.ID), utils.ErrorInvalidInputs.ErrorPageURL()},
+		{strconv.Itoa(full.ID), utils.ErrorInvalidInputs.ErrorPageURL()},
+		{"abc", utils.ErrorInvalidInputs.ErrorPageURL()},
+	} {
+		form := url.Values{"id": {d.id}}
+		req := httptest.NewRequest(http.MethodPost, "/queues/delete", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Form = form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeQueueDelete)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+}
+
+func TestServeMoveTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	queue, err := utils.CreateQueue(utils.Queue{Name: "Billing", Members: []string{"Test123"}})
+	assert.Nil(t, err)
+	other, err := utils.CreateQueue(utils.Queue{Name: "Sales"})
+	assert.Nil(t, err)
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	var received []utils.Event
+	utils.SubscribeEvents(func(event utils.Event) {
+		if event.Type == utils.EventTicketMoved && event.TicketID == testTicket.ID {
+			received = append(received, event)
+		}
+	})
+
+	tests := []struct {
+		queue       string
+		expectedURL string
+	}{
+		{strconv.Itoa(queue.ID), "/tickets/" + strconv.Itoa(testTicket.ID)},
+		{"99", utils.ErrorInvalidInputs.ErrorPageURL()},
+		{"abc", utils.ErrorInvalidInputs.ErrorPageURL()},
+		// The user is no member of the new queue and can't see the ticket afterwards
+		{strconv.Itoa(other.ID), "/tickets/"},
+		{strconv.Itoa(queue.ID), utils.ErrorUnauthorized.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		form := url.Values{"queue": {d.queue}}
+		req := httptest.NewRequest(http.MethodPost, "/moveTicket", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Header.Set("Referer", "/tickets/"+strconv.Itoa(testTicket.ID))
+		req.Form = form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeMoveTicket)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	ticket, err := utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, other.ID, ticket.Queue)
+	assert.Equal(t, 2, len(received))
+}
+
+func TestServeTicketsQueueAccess(t *testing.T) {
+	setup()
+	defer teardown()
+
+	queue, err := utils.CreateQueue(utils.Queue{Name: "Billing", Members: []string{"Other"}})
+	assert.Nil(t, err)
+	hidden, err := utils.CreateTicket("test@gmail.com", "Hidden invoice", "Message dummy")
+	assert.Nil(t, err)
+	_, err = utils.MoveTicket(hidden, queue.ID, "Other")
+	assert.Nil(t, err)
+	visible, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		path         string
+		expectedCode int
+		expectedURL  string
+	}{
+		{"/tickets/", http.StatusOK, ""},
+		{"/tickets/" + strconv.Itoa(visible.ID), http.StatusOK, ""},
+		{"/tickets/" + strconv.Itoa(hidden.ID), http.StatusFound, utils.ErrorUnauthorized.ErrorPageURL()},
+		{"/tickets/?queue=" + strconv.Itoa(queue.ID), http.StatusFound, utils.ErrorUnauthorized.ErrorPageURL()},
+		{"/tickets/?queue=abc", http.StatusFound, utils.ErrorInvalidInputs.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodGet, d.path, nil)
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeTickets)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, d.expectedCode, rr.Code)
+		if d.expectedCode == http.StatusOK {
+			// Tickets of queues the user is no member of are not listed
+			assert.NotContains(t, rr.Body.String(), "Hidden invoice")
+			continue
+		}
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+}
+
+func TestServeTagTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		tags        string
+		referer     string
+		expectedURL string
+	}{
+		{"Billing, network", "/tickets/" + strconv.Itoa(testTicket.ID), "/tickets/" + strconv.Itoa(testTicket.ID)},
+		{"<b>", "/tickets/" + strconv.Itoa(testTicket.ID), utils.ErrorInvalidInputs.ErrorPageURL()},
+		{"billing", "/tickets/1337", utils.ErrorInvalidTicketID.ErrorPageURL()},
+		{"billing", "/tickets/abc", utils.ErrorURLParsing.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		form := url.Values{"tags": {d.tags}}
+		req := httptest.NewRequest(http.MethodPost, "/tagTicket", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Header.Set("Referer", d.referer)
+		req.Form = form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeTagTicket)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	ticket, err := utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"billing", "network"}, ticket.Tags)
+}
+
+func TestServeTicketsEditorSuggestions(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createUser("Anna123", "Aa!123456")
+	assert.Nil(t, utils.SetUserSkills("Anna123", []string{"billing"}))
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+	assert.Nil(t, utils.ChangeTags(testTicket.ID, []string{"billing"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/tickets/"+strconv.Itoa(testTicket.ID), nil)
+
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	createUser("Test123", "Aa!123456")
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeTickets)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Suggested Editors")
+	assert.Contains(t, rr.Body.String(), "<strong>Anna123</strong> - skills billing match 1 of 1 tags")
+}
+
+func TestServeFieldSave(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	tests := []struct {
+		form        url.Values
+		expectedURL string
+	}{
+		{url.Values{"name": {"Product"}, "type": {"select"}, "options": {"Laptop, Printer"}}, "/fields"},
+		{url.Values{"id": {"1"}, "name": {"Product"}, "type": {"multiselect"}, "options": {"Laptop, Printer, Phone"}, "required": {"on"}}, "/fields"},
+		{url.Values{"name": {"product"}, "type": {"text"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"name": {"Category"}, "type": {"select"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"name": {"Color"}, "type": {"color"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"id": {"99"}, "name": {"Unknown"}, "type": {"text"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/fields/save", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Form = d.form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeFieldSave)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	field, err := utils.GetFieldDefinition(1)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.FieldTypeMultiSelect, field.Type)
+	assert.Equal(t, []string{"Laptop", "Printer", "Phone"}, field.Options)
+	assert.True(t, field.Required)
+}
+
+func TestServeFieldsUnauthorized(t *testing.T) {
+	setup()
+	defer teardown()
+
+	for _, handlerFunc := range []http.HandlerFunc{ServeFields, ServeFieldSave, ServeFieldDelete} {
+		req := httptest.NewRequest(http.MethodPost, "/fields", nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		// Only administrators are allowed to define the custom fields
+		handlerFunc.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, utils.ErrorUnauthorized.ErrorPageURL(), resultURL.Path)
+	}
+}
+
+func TestServeFieldDelete(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config.Admins = []string{"Test123"}
+	defer func() { config.Admins = nil }()
+
+	field, err := utils.CreateFieldDefinition(utils.FieldDefinition{Name: "Order number", Type: utils.FieldTypeText})
+	assert.Nil(t, err)
+
+	for _, d := range []struct {
+		id          string
+		expectedURL string
+	}{
+		{strconv.Itoa(field.ID), "/fields"},
+		{strconv.Itoa(field.ID), utils.ErrorDataStoring.ErrorPageURL()},
+		{"abc", utils.ErrorInvalidInputs.ErrorPageURL()},
+	} {
+		form := url.Values{"id": {d.id}}
+		req := httptest.NewRequest(http.MethodPost, "/fields/delete", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Form = form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeFieldDelete)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+}
+
+func TestServeTicketFields(t *testing.T) {
+	setup()
+	defer teardown()
+
+	product, err := utils.CreateFieldDefinition(utils.FieldDefinition{Name: "Product", Type: utils.FieldTypeMultiSelect, Options: []string{"Laptop", "Printer"}})
+	assert.Nil(t, err)
+	delivery, err := utils.CreateFieldDefinition(utils.FieldDefinition{Name: "Delivery", Type: utils.FieldTypeDate})
+	assert.Nil(t, err)
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	productKey := "field-" + strconv.Itoa(product.ID)
+	deliveryKey := "field-" + strconv.Itoa(delivery.ID)
+	tests := []struct {
+		form        url.Values
+		expectedURL string
+	}{
+		{url.Values{productKey: {"Laptop", "Printer"}, deliveryKey: {"2020-05-01"}}, "/tickets/" + strconv.Itoa(testTicket.ID)},
+		{url.Values{productKey: {"Phone"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{deliveryKey: {"tomorrow"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/ticketFields", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Header.Set("Referer", "/tickets/"+strconv.Itoa(testTicket.ID))
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeTicketFields)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	ticket, err := utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Laptop, Printer", ticket.FieldText(product.ID))
+	assert.Equal(t, "2020-05-01", ticket.FieldText(delivery.ID))
+}
+
+func TestServeTicketsFilter(t *testing.T) {
+	setup()
+	defer teardown()
+
+	product, err := utils.CreateFieldDefinition(utils.FieldDefinition{Name: "Product", Type: utils.FieldTypeSelect, Options: []string{"Laptop", "Printer"}})
+	assert.Nil(t, err)
+	laptop, err := utils.CreateTicket("test@gmail.com", "Laptop broken", "Message dummy")
+	assert.Nil(t, err)
+	assert.Nil(t, utils.SetTicketFields(laptop.ID, map[int][]string{product.ID: {"Laptop"}}))
+	assert.Nil(t, utils.ChangeTags(laptop.ID, []string{"hardware"}))
+	printer, err := utils.CreateTicket("test@gmail.com", "Printer broken", "Message dummy")
+	assert.Nil(t, err)
+	assert.Nil(t, utils.SetTicketFields(printer.ID, map[int][]string{product.ID: {"Printer"}}))
+
+	tests := []struct {
+		query    string
+		expected []string
+		hidden   []string
+	}{
+		{"", []string{"Laptop broken", "Printer broken"}, nil},
+		{"?tag=Hardware", []string{"Laptop broken"}, []string{"Printer broken"}},
+		{"?field=" + strconv.Itoa(product.ID) + "&value=printer", []string{"Printer broken"}, []string{"Laptop broken"}},
+		{"?tag=hardware&field=" + strconv.Itoa(product.ID) + "&value=Printer", []string{"matching the filter"}, []string{"Laptop broken", "Printer broken"}},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/tickets/"+d.query, nil)
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeTickets)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		for _, text := range d.expected {
+			assert.Contains(t, rr.Body.String(), text)
+		}
+		for _, text := range d.hidden {
+			assert.NotContains(t, rr.Body.String(), text)
+		}
+	}
+}
+
+func TestServeBulkTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	first, err := createDummyTicket()
+	assert.Nil(t, err)
+	second, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		form         url.Values
+		expectedCode int
+		expectedURL  string
+		expected     []string
+	}{
+		{url.Values{"operation": {"close"}, "ticket": {"abc"}}, http.StatusFound, utils.ErrorInvalidInputs.ErrorPageURL(), nil},
+		{url.Values{"operation": {"delete"}, "ticket": {"1"}}, http.StatusFound, utils.ErrorInvalidInputs.ErrorPageURL(), nil},
+		{url.Values{"operation": {"priority"}, "value": {"highest"}, "ticket": {"1"}}, http.StatusFound, utils.ErrorInvalidInputs.ErrorPageURL(), nil},
+		{url.Values{"operation": {"tag"}, "value": {"vip"}}, http.StatusFound, utils.ErrorInvalidInputs.ErrorPageURL(), nil},
+		{url.Values{"operation": {"tag"}, "value": {"vip"}, "ticket": {"1", "2", "99"}}, http.StatusFound, "/tickets/", []string{"Bulk Operation Results", "Ticket 1: done", "Ticket 2: done", "Ticket 99: "}},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/tickets/bulk", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeBulkTickets)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, d.expectedCode, rr.Code)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+		if d.expected == nil {
+			continue
+		}
+
+		// The overview shows the results once after the redirect
+		for i := 0; i < 2; i++ {
+			req = httptest.NewRequest(http.MethodGet, resultURL.String(), nil)
+			req.AddCookie(&http.Cookie{Name: "session-id", Value: uuid, Path: "/", HttpOnly: true, MaxAge: 60 * 60})
+			rr = httptest.NewRecorder()
+			http.HandlerFunc(ServeTickets).ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			for _, text := range d.expected {
+				if i == 0 {
+					assert.Contains(t, rr.Body.String(), text)
+				} else {
+					assert.NotContains(t, rr.Body.String(), text)
+				}
+			}
+		}
+	}
+
+	for _, id := range []int{first.ID, second.ID} {
+		ticket, err := utils.ReadTicket(id)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"vip"}, ticket.Tags)
+	}
+}
+
+func TestServeViewSave(t *testing.T) {
+	setup()
+	defer teardown()
+
+	queue, err := utils.CreateQueue(utils.Queue{Name: "Billing", Members: []string{"Other"}})
+	assert.Nil(t, err)
+	view, err := utils.CreateView(utils.SavedView{Name: "Foreign", Owner: "Other", Queue: -1, Sort: utils.ViewSortNewest})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		form        url.Values
+		expectedURL string
+	}{
+		{url.Values{"name": {"Mine"}, "sort": {"newest"}, "queue": {"abc"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"name": {""}, "sort": {"newest"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"name": {"Mine"}, "sort": {"newest"}, "team": {strconv.Itoa(queue.ID)}}, utils.ErrorUnauthorized.ErrorPageURL()},
+		{url.Values{"id": {strconv.Itoa(view.ID)}, "name": {"Mine"}, "sort": {"newest"}}, utils.ErrorUnauthorized.ErrorPageURL()},
+		{url.Values{"name": {"Mine"}, "sort": {"priority"}, "status": {"all"}, "tag": {"VIP"}, "column": {"client", "priority"}}, "/views"},
+		{url.Values{"id": {"2"}, "name": {"Renamed"}, "sort": {"oldest"}}, "/views"},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/views/save", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeViewSave)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusFound, rr.Code)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	saved, err := utils.GetView(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Renamed", saved.Name)
+	assert.Equal(t, "Test123", saved.Owner)
+	assert.Equal(t, utils.ViewSortOldest, saved.Sort)
+	assert.Equal(t, -1, saved.Queue)
+}
+
+func TestServeViewPin(t *testing.T) {
+	setup()
+	defer teardown()
+
+	foreign, err := utils.CreateView(utils.SavedView{Name: "Foreign", Owner: "Other", Queue: -1, Sort: utils.ViewSortNewest})
+	assert.Nil(t, err)
+	mine, err := utils.CreateView(utils.SavedView{Name: "Urgent tickets", Owner: "Test123", Queue: -1, Sort: utils.ViewSortPriority})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		form        url.Values
+		expectedURL string
+	}{
+		{url.Values{"id": {"abc"}, "pinned": {"true"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"id": {strconv.Itoa(foreign.ID)}, "pinned": {"true"}}, utils.ErrorUnauthorized.ErrorPageURL()},
+		{url.Values{"id": {strconv.Itoa(mine.ID)}, "pinned": {"true"}}, "/views"},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/views/pin", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeViewPin)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusFound, rr.Code)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	// The pinned view is part of the navbar
+	req := httptest.NewRequest(http.MethodGet, "/views", nil)
+	uuid := utils.CreateUUID(64)
+	req.AddCookie(&http.Cookie{
+		Name:     "session-id",
+		Value:    uuid,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   60 * 60,
+	})
+
+	rr := httptest.NewRecorder()
+	assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+	handler := http.HandlerFunc(ServeViews)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `href="/tickets/?view=`+strconv.Itoa(mine.ID)+`">Urgent tickets</a>`)
+	assert.Contains(t, rr.Body.String(), "Unpin")
+}
+
+func TestServeTicketsViewAndDashboard(t *testing.T) {
+	setup()
+	defer teardown()
+
+	laptop, err := utils.CreateTicket("test@gmail.com", "Laptop broken", "Message dummy")
+	assert.Nil(t, err)
+	assert.Nil(t, utils.ChangeEditor(laptop.ID, "Test123"))
+	assert.Nil(t, utils.ChangeStatus(laptop.ID, utils.TicketStatusInProcess))
+	_, err = utils.CreateTicket("test@gmail.com", "Printer broken", "Message dummy")
+	assert.Nil(t, err)
+
+	foreign, err := utils.CreateView(utils.SavedView{Name: "Foreign", Owner: "Other", Queue: -1, Sort: utils.ViewSortNewest})
+	assert.Nil(t, err)
+	view, err := utils.CreateView(utils.SavedView{Name: "By priority", Owner: "Test123", Queue: -1, Sort: utils.ViewSortPriority,
+		Columns: []string{utils.ViewColumnEditor}})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		query        string
+		expectedCode int
+		expectedURL  string
+		expected     []string
+		hidden       []string
+	}{
+		{"?view=abc", http.StatusFound, utils.ErrorInvalidInputs.ErrorPageURL(), nil, nil},
+		{"?view=" + strconv.Itoa(foreign.ID), http.StatusFound, utils.ErrorUnauthorized.ErrorPageURL(), nil, nil},
+		{"?dashboard=closed", http.StatusFound, utils.ErrorInvalidInputs.ErrorPageURL(), nil, nil},
+		{"?view=" + strconv.Itoa(view.ID), http.StatusOK, "", []string{"By priority", "<th class=\"text-capitalize\">editor</th>", "<td>Test123</td>", "Printer broken"}, nil},
+		{"?dashboard=assigned", http.StatusOK, "", []string{"Laptop broken"}, []string{"Printer broken"}},
+		{"?dashboard=unassigned", http.StatusOK, "", []string{"Printer broken"}, []string{"Laptop broken"}},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/tickets/"+d.query, nil)
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeTickets)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, d.expectedCode, rr.Code)
+		if d.expectedCode == http.StatusFound {
+			resultURL, err := rr.Result().Location()
+			assert.Nil(t, err)
+			assert.Equal(t, d.expectedURL, resultURL.Path)
+		}
+		for _, text := range d.expected {
+			assert.Contains(t, rr.Body.String(), text)
+		}
+		for _, text := range d.hidden {
+			assert.NotContains(t, rr.Body.String(), text)
+		}
+	}
+}
+
+func TestServeLinkTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	queue, err := utils.CreateQueue(utils.Queue{Name: "Billing", Members: []string{"Other"}})
+	assert.Nil(t, err)
+	canonical, err := createDummyTicket()
+	assert.Nil(t, err)
+	duplicate, err := utils.CreateTicket("other@gmail.com", "Subject again", "Message dummy")
+	assert.Nil(t, err)
+	hidden, err := createDummyTicket()
+	assert.Nil(t, err)
+	_, err = utils.MoveTicket(hidden, queue.ID, "Other")
+	assert.Nil(t, err)
+
+	mails, err := utils.ReadMailsFile()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		form        url.Values
+		expectedURL string
+	}{
+		{url.Values{"type": {"duplicated-by"}, "ticket": {strconv.Itoa(duplicate.ID)}}, "/tickets/" + strconv.Itoa(canonical.ID)},
+		{url.Values{"type": {"related"}, "ticket": {strconv.Itoa(duplicate.ID)}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"type": {"sibling"}, "ticket": {strconv.Itoa(duplicate.ID)}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"type": {"related"}, "ticket": {"abc"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"type": {"related"}, "ticket": {"99"}}, utils.ErrorInvalidTicketID.ErrorPageURL()},
+		// Tickets of queues the user is no member of can't be linked
+		{url.Values{"type": {"related"}, "ticket": {strconv.Itoa(hidden.ID)}}, utils.ErrorUnauthorized.ErrorPageURL()},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/linkTicket", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Header.Set("Referer", "/tickets/"+strconv.Itoa(canonical.ID))
+		req.Form = d.form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeLinkTicket)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	ticket, err := utils.ReadTicket(duplicate.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []utils.Relation{{Type: utils.RelationDuplicateOf, Ticket: canonical.ID}}, ticket.Relations)
+
+	// Only the customer of the duplicate is informed
+	after, err := utils.ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, len(mails.MailList)+1, len(after.MailList))
+	assert.Equal(t, "other@gmail.com", after.MailList[len(after.MailList)-1].Mail)
+}
+
+func TestServeUnlinkTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	parent, err := createDummyTicket()
+	assert.Nil(t, err)
+	child, err := createDummyTicket()
+	assert.Nil(t, err)
+	assert.Nil(t, utils.LinkTickets(parent.ID, child.ID, utils.RelationParentOf, "Test123"))
+
+	for _, d := range []struct {
+		ticket      string
+		expectedURL string
+	}{
+		{strconv.Itoa(child.ID), "/tickets/" + strconv.Itoa(parent.ID)},
+		{strconv.Itoa(child.ID), utils.ErrorInvalidInputs.ErrorPageURL()},
+		{"abc", utils.ErrorInvalidInputs.ErrorPageURL()},
+	} {
+		form := url.Values{"ticket": {d.ticket}}
+		req := httptest.NewRequest(http.MethodPost, "/unlinkTicket", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Header.Set("Referer", "/tickets/"+strconv.Itoa(parent.ID))
+		req.Form = form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeUnlinkTicket)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	ticket, err := utils.ReadTicket(child.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, ticket.Relations)
+}
+
+func TestServeTicketsMergedRedirect(t *testing.T) {
+	setup()
+	defer teardown()
+
+	target, err := createDummyTicket()
+	assert.Nil(t, err)
+	merged, err := createDummyTicket()
+	assert.Nil(t, err)
+	assert.Nil(t, utils.MergeTickets(target.ID, merged.ID, "Test123"))
+
+	for _, d := range []struct {
+		id          int
+		expectedURL string
+	}{
+		{merged.ID, "/tickets/" + strconv.Itoa(target.ID)},
+		{target.ID, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/tickets/"+strconv.Itoa(d.id), nil)
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeTickets)
+		handler.ServeHTTP(rr, req)
+
+		if d.expectedURL == "" {
+			// The remaining ticket offers to undo the merge
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Contains(t, rr.Body.String(), "Undo merge")
+			continue
+		}
+		assert.Equal(t, http.StatusFound, rr.Code)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+}
+
+func TestServeUnmergeTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	target, err := createDummyTicket()
+	assert.Nil(t, err)
+	merged, err := createDummyTicket()
+	assert.Nil(t, err)
+	other, err := createDummyTicket()
+	assert.Nil(t, err)
+	assert.Nil(t, utils.MergeTickets(target.ID, merged.ID, "Test123"))
+
+	var received []utils.Event
+	utils.SubscribeEvents(func(event utils.Event) {
+		if event.Type == utils.EventTicketUnmerged && event.TicketID == target.ID {
+			received = append(received, event)
+		}
+	})
+
+	for _, d := range []struct {
+		ticket      string
+		expectedURL string
+	}{
+		{strconv.Itoa(other.ID), utils.ErrorInvalidInputs.ErrorPageURL()},
+		{"abc", utils.ErrorInvalidInputs.ErrorPageURL()},
+		{strconv.Itoa(merged.ID), "/tickets/" + strconv.Itoa(target.ID)},
+		{strconv.Itoa(merged.ID), utils.ErrorInvalidInputs.ErrorPageURL()},
+	} {
+		form := url.Values{"ticket": {d.ticket}}
+		req := httptest.NewRequest(http.MethodPost, "/unmergeTicket", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Header.Set("Referer", "/tickets/"+strconv.Itoa(target.ID))
+		req.Form = form
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeUnmergeTicket)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	ticket, err := utils.ReadTicket(merged.ID)
+	assert.Nil(t, err)
+	assert.False(t, ticket.IsMerged())
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, strconv.Itoa(merged.ID), received[0].Details["mergedTicketId"])
+}
+
+func TestServeSplitTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+	_, err = utils.AddMessage(testTicket, "test@gmail.com", "Another problem")
+	assert.Nil(t, err)
+
+	var created []utils.Event
+	utils.SubscribeEvents(func(event utils.Event) {
+		if event.Type == utils.EventTicketCreated || event.Type == utils.EventTicketSplit {
+			created = append(created, event)
+		}
+	})
+
+	tests := []struct {
+		form        url.Values
+		expectedURL string
+	}{
+		{url.Values{"subject": {"Other problem"}, "message": {"abc"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"subject": {"Other problem"}, "message": {"0"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"subject": {""}, "message": {"1"}}, utils.ErrorInvalidInputs.ErrorPageURL()},
+		{url.Values{"subject": {"Other problem"}, "message": {"1"}}, "/tickets/2"},
+	}
+	for _, d := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/splitTicket", strings.NewReader(d.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Header.Set("Referer", "/tickets/"+strconv.Itoa(testTicket.ID))
+
+		uuid := utils.CreateUUID(64)
+		req.AddCookie(&http.Cookie{
+			Name:     "session-id",
+			Value:    uuid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   60 * 60,
+		})
+
+		rr := httptest.NewRecorder()
+		createUser("Test123", "Aa!123456")
+		assert.Nil(t, loginUser(rr, "Test123", "Aa!123456", uuid))
+
+		handler := http.HandlerFunc(ServeSplitTicket)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusFound)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, d.expectedURL, resultURL.Path)
+	}
+
+	newTicket, err := utils.ReadTicket(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Another problem", newTicket.MessageList[0].Text)
+	assert.Equal(t, 2, len(created))
+	assert.Equal(t, utils.EventTicketCreated, created[0].Type)
+	assert.Equal(t, utils.EventTicketSplit, created[1].Type)
+	assert.Equal(t, "2", created[1].Details["splitTicketId"])
+}
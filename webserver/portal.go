@@ -0,0 +1,194 @@
+package webserver
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"TicketSystem/utils"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+func ServePortal(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	// Check if it has to show the template or if its a request for an access link already
+	email := r.PostFormValue("email")
+	if email == "" {
+		ctx := templateContext{HeaderTitle: "My Tickets", ContentTemplate: "portal.html"}
+		executeTemplate(w, r, "index.html", ctx)
+		return
+	}
+
+	if !utils.CheckMailFormal(email) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	err := utils.SendPortalLink(email)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	// The response is the same for unknown addresses to not reveal which addresses have tickets
+	ctx := templateContext{HeaderTitle: "My Tickets", ContentTemplate: "portal.html",
+		InfoMsg: "If there are tickets for " + email + ", we have sent you an email with a link to access them."}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+func ServePortalLogin(w http.ResponseWriter, r *http.Request) {
+	client, err := utils.RedeemPortalLink(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidPortalLink.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	createPortalSessionCookie(w, utils.CreatePortalToken(client, utils.PortalTokenSession, config.PortalSessionValidity))
+	http.Redirect(w, r, "/portal/tickets/", http.StatusFound)
+}
+
+func ServePortalSignOut(w http.ResponseWriter, r *http.Request) {
+	destroyPortalSession(w)
+	http.Redirect(w, r, "/portal", http.StatusFound)
+}
+
+func ServePortalTickets(w http.ResponseWriter, r *http.Request) {
+	client, err := getClientFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticketId, err := strconv.Atoi(path.Base(r.URL.Path))
+	if err != nil { // Show the tickets of the client
+		ctx := templateContext{HeaderTitle: "My Tickets", ContentTemplate: "portaltickets.html", CustomerEmail: client, TicketsData: utils.GetTicketsByClient(client)}
+		executeTemplate(w, r, "index.html", ctx)
+		return
+	}
+
+	ticket, err := utils.ReadClientTicket(client, ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ctx := templateContext{HeaderTitle: ticket.Reference, ContentTemplate: "portalticket.html", CustomerEmail: client, CurrentTicket: utils.PublicTicket(ticket)}
+	executeTemplate(w, r, "index.html", ctx)
+}
+
+func ServePortalReply(w http.ResponseWriter, r *http.Request) {
+	parseForm(w, r)
+
+	client, err := getClientFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	message := r.PostFormValue("message")
+	if !utils.CheckEmptyXSSString(message) {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticketId, err := strconv.Atoi(path.Base(r.Referer()))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorURLParsing.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	before, err := utils.ReadClientTicket(client, ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	// Merged tickets are handled in the ticket they were merged into, which the client may not be allowed to see
+	if before.IsMerged() {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticket, err := utils.AddMessage(before, client, message)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	utils.PublishEvent(utils.Event{Type: utils.EventTicketCommented, Ticket: ticket, Actor: client, Source: utils.SourceWeb, Changes: utils.TicketChanges(before, ticket)})
+
+	// Replies to closed tickets reopen them, just like replies by mail
+	if ticket.Status == utils.TicketStatusClosed {
+		err = utils.ChangeStatus(ticket.ID, utils.ReopenedStatus(ticket))
+		if err != nil {
+			http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+			return
+		}
+		publishTicketEvent(utils.EventTicketReopened, ticket, client)
+	}
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+func ServePortalCloseTicket(w http.ResponseWriter, r *http.Request) {
+	changeClientTicketStatus(w, r, utils.EventTicketClosed)
+}
+
+func ServePortalReopenTicket(w http.ResponseWriter, r *http.Request) {
+	changeClientTicketStatus(w, r, utils.EventTicketReopened)
+}
+
+// Closes or reopens the ticket of the signed in client
+func changeClientTicketStatus(w http.ResponseWriter, r *http.Request, eventType utils.EventType) {
+	client, err := getClientFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorUnauthorized.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticketId, err := strconv.Atoi(path.Base(r.Referer()))
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorURLParsing.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	ticket, err := utils.ReadClientTicket(client, ticketId)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorInvalidTicketID.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	if ticket.IsMerged() {
+		http.Redirect(w, r, utils.ErrorInvalidInputs.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	status := utils.TicketStatusClosed
+	if eventType == utils.EventTicketReopened {
+		status = utils.ReopenedStatus(ticket)
+	} else if utils.CheckClosable(ticket) != nil {
+		http.Redirect(w, r, utils.ErrorTicketBlocked.ErrorPageURL(), http.StatusFound)
+		return
+	}
+
+	err = utils.ChangeStatus(ticketId, status)
+	if err != nil {
+		http.Redirect(w, r, utils.ErrorDataStoring.ErrorPageURL(), http.StatusFound)
+		return
+	}
+	publishTicketEvent(eventType, ticket, client)
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+// Wrapper to check for a valid portal session cookie
+func authenticateClient(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, err := getClientFromCookie(r)
+		if err != nil {
+			http.Redirect(w, r, "/portal", http.StatusFound)
+			return
+		}
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,327 @@
+package webserver
+
+// Matrikelnummern: 6813128, 1665910, 7612558
+
+import (
+	"TicketSystem/config"
+	"TicketSystem/utils"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func addPortalSessionCookie(req *http.Request, client string) {
+	req.AddCookie(&http.Cookie{
+		Name:  "portal-session",
+		Value: utils.CreatePortalToken(client, utils.PortalTokenSession, config.PortalSessionValidity),
+		Path:  "/portal",
+	})
+}
+
+func TestServePortalShowTemplate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	req := httptest.NewRequest(http.MethodGet, "/portal", nil)
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServePortal)
+
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestServePortalInvalidEmail(t *testing.T) {
+	setup()
+	defer teardown()
+
+	form := url.Values{}
+	form.Add("email", "noEmail")
+
+	req := httptest.NewRequest(http.MethodPost, "/portal", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Form = form
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServePortal)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorInvalidInputs.ErrorPageURL(), resultURL.Path)
+}
+
+func TestServePortalSendsLink(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	form := url.Values{}
+	form.Add("email", "test@gmail.com")
+
+	config.BaseURL = "https://tickets.dhbw.de/"
+	defer func() { config.BaseURL = "" }()
+
+	req := httptest.NewRequest(http.MethodPost, "/portal", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Host = "attacker.example"
+	req.Form = form
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServePortal)
+	handler.ServeHTTP(rr, req)
+
+	// The link points to the configured server and not to the host of the request
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mailList, err := utils.ReadMailsFile()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mailList.MailList))
+	assert.Contains(t, mailList.MailList[0].Message, "https://tickets.dhbw.de/portal/login?token=")
+	assert.NotContains(t, mailList.MailList[0].Message, "attacker.example")
+}
+
+func TestServePortalLogin(t *testing.T) {
+	setup()
+	defer teardown()
+
+	req := httptest.NewRequest(http.MethodGet, "/portal/login?token=invalid", nil)
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServePortalLogin)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorInvalidPortalLink.ErrorPageURL(), resultURL.Path)
+
+	token := utils.CreatePortalToken("test@gmail.com", utils.PortalTokenLink, config.PortalLinkValidity)
+	req = httptest.NewRequest(http.MethodGet, "/portal/login?token="+url.QueryEscape(token), nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	resultURL, err = rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, "/portal/tickets/", resultURL.Path)
+	cookies := rr.Result().Cookies()
+	assert.Equal(t, 1, len(cookies))
+	assert.Equal(t, "portal-session", cookies[0].Name)
+	assert.True(t, cookies[0].Secure)
+	client, err := utils.VerifyPortalToken(cookies[0].Value, utils.PortalTokenSession)
+	assert.Nil(t, err)
+	assert.Equal(t, "test@gmail.com", client)
+
+	// Links can only be used once
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	resultURL, err = rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorInvalidPortalLink.ErrorPageURL(), resultURL.Path)
+}
+
+func TestServePortalTicketsUnauthorized(t *testing.T) {
+	setup()
+	defer teardown()
+
+	req := httptest.NewRequest(http.MethodGet, "/portal/tickets/", nil)
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(authenticateClient(ServePortalTickets))
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, "/portal", resultURL.Path)
+}
+
+func TestServePortalTicketsSuccess(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+	_, err = utils.AddMessage(testTicket, "Test123", "Secret internal note")
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/portal/tickets/", nil)
+	addPortalSessionCookie(req, "test@gmail.com")
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServePortalTickets)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), testTicket.Reference)
+
+	req = httptest.NewRequest(http.MethodGet, "/portal/tickets/"+strconv.Itoa(testTicket.ID), nil)
+	addPortalSessionCookie(req, "test@gmail.com")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Message dummy")
+	assert.NotContains(t, rr.Body.String(), "Secret internal note")
+}
+
+func TestServePortalTicketsForeignTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/portal/tickets/"+strconv.Itoa(testTicket.ID), nil)
+	addPortalSessionCookie(req, "other@gmail.com")
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServePortalTickets)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorInvalidTicketID.ErrorPageURL(), resultURL.Path)
+}
+
+func TestServePortalReply(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+	assert.Nil(t, utils.ChangeStatus(testTicket.ID, utils.TicketStatusClosed))
+
+	form := url.Values{}
+	form.Add("message", "It is still broken")
+
+	req := httptest.NewRequest(http.MethodPost, "/portal/reply", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	req.Header.Set("Referer", "/portal/tickets/"+strconv.Itoa(testTicket.ID))
+	req.Form = form
+	addPortalSessionCookie(req, "test@gmail.com")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ServePortalReply)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, req.Referer(), resultURL.Path)
+
+	ticket, err := utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ticket.MessageList))
+	assert.Equal(t, utils.MessageTypeCustomer, ticket.MessageList[1].Type)
+	assert.Equal(t, utils.TicketStatusOpen, ticket.Status)
+}
+
+func TestServePortalCloseAndReopenTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/portal/closeTicket", nil)
+	req.Header.Set("Referer", "/portal/tickets/"+strconv.Itoa(testTicket.ID))
+	addPortalSessionCookie(req, "test@gmail.com")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(ServePortalCloseTicket).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	ticket, err := utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.TicketStatusClosed, ticket.Status)
+
+	req = httptest.NewRequest(http.MethodGet, "/portal/reopenTicket", nil)
+	req.Header.Set("Referer", "/portal/tickets/"+strconv.Itoa(testTicket.ID))
+	addPortalSessionCookie(req, "test@gmail.com")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(ServePortalReopenTicket).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	ticket, err = utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.TicketStatusOpen, ticket.Status)
+
+	// Clients cannot change the tickets of others
+	req = httptest.NewRequest(http.MethodGet, "/portal/closeTicket", nil)
+	req.Header.Set("Referer", "/portal/tickets/"+strconv.Itoa(testTicket.ID))
+	addPortalSessionCookie(req, "other@gmail.com")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(ServePortalCloseTicket).ServeHTTP(rr, req)
+
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorInvalidTicketID.ErrorPageURL(), resultURL.Path)
+	ticket, err = utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.TicketStatusOpen, ticket.Status)
+}
+
+func TestServePortalCloseBlockedTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	testTicket, err := createDummyTicket()
+	assert.Nil(t, err)
+	blocker, err := createDummyTicket()
+	assert.Nil(t, err)
+	assert.Nil(t, utils.LinkTickets(testTicket.ID, blocker.ID, utils.RelationBlockedBy, "Test123"))
+
+	req := httptest.NewRequest(http.MethodGet, "/portal/closeTicket", nil)
+	req.Header.Set("Referer", "/portal/tickets/"+strconv.Itoa(testTicket.ID))
+	addPortalSessionCookie(req, "test@gmail.com")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(ServePortalCloseTicket).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	resultURL, err := rr.Result().Location()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.ErrorTicketBlocked.ErrorPageURL(), resultURL.Path)
+	ticket, err := utils.ReadTicket(testTicket.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.TicketStatusOpen, ticket.Status)
+}
+
+func TestServePortalMergedTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	target, err := createDummyTicket()
+	assert.Nil(t, err)
+	merged, err := createDummyTicket()
+	assert.Nil(t, err)
+	assert.Nil(t, utils.MergeTickets(target.ID, merged.ID, "Test123"))
+
+	// The customer still sees the merged ticket, but can't change it anymore
+	req := httptest.NewRequest(http.MethodGet, "/portal/tickets/"+strconv.Itoa(merged.ID), nil)
+	addPortalSessionCookie(req, "test@gmail.com")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(ServePortalTickets).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "handled together with ticket "+strconv.Itoa(target.ID))
+	assert.NotContains(t, rr.Body.String(), "/portal/reply")
+
+	for _, handlerFunc := range []http.HandlerFunc{ServePortalReply, ServePortalCloseTicket} {
+		form := url.Values{"message": {"Any news?"}}
+		req := httptest.NewRequest(http.MethodPost, "/portal/reply", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		req.Header.Set("Referer", "/portal/tickets/"+strconv.Itoa(merged.ID))
+		req.Form = form
+		addPortalSessionCookie(req, "test@gmail.com")
+
+		rr := httptest.NewRecorder()
+		handlerFunc.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusFound, rr.Code)
+		resultURL, err := rr.Result().Location()
+		assert.Nil(t, err)
+		assert.Equal(t, utils.ErrorInvalidInputs.ErrorPageURL(), resultURL.Path)
+	}
+}
@@ -3,6 +3,7 @@ package webserver
 // Matrikelnummern: 6813128, 1665910, 7612558
 
 import (
+	"TicketSystem/config"
 	"TicketSystem/utils"
 	"net/http"
 )
@@ -20,3 +21,35 @@ func createSessionCookie(w http.ResponseWriter, id string) {
 func destroySession(w http.ResponseWriter) {
 	utils.RemoveCookie(w, "session-id")
 }
+
+func createPortalSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "portal-session",
+		Value:    token,
+		Path:     "/portal",
+		HttpOnly: true,
+		Secure:   true,
+		MaxAge:   int(config.PortalSessionValidity.Seconds()),
+	})
+}
+
+func destroyPortalSession(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "portal-session",
+		Value:    "",
+		Path:     "/portal",
+		HttpOnly: true,
+		Secure:   true,
+		MaxAge:   -1,
+	})
+}
+
+// Returns the client of the portal session
+func getClientFromCookie(r *http.Request) (string, error) {
+	cookie, err := r.Cookie("portal-session")
+	if err != nil {
+		return "", err
+	}
+
+	return utils.VerifyPortalToken(cookie.Value, utils.PortalTokenSession)
+}
@@ -14,15 +14,46 @@ import (
 )
 
 type templateContext struct {
-	HeaderTitle     string
-	ContentTemplate string
-	IsSignedIn      bool
-	IsUserInHoliday bool
-	ErrorMsg        string
-	Username        string
-	Users           []utils.User
-	TicketsData     []utils.Ticket
-	CurrentTicket   utils.Ticket
+	HeaderTitle       string
+	ContentTemplate   string
+	IsSignedIn        bool
+	IsAdmin           bool
+	IsUserInHoliday   bool
+	ErrorMsg          string
+	InfoMsg           string
+	CustomerEmail     string
+	Username          string
+	Users             []utils.User
+	TicketsData       []utils.Ticket
+	CurrentTicket     utils.Ticket
+	WebhookDeliveries []utils.WebhookDelivery
+	AuditEntries      []utils.AuditEntry
+	AuditFilter       utils.AuditFilter
+	CurrentUser       utils.User
+	CannedResponses   []utils.CannedResponse
+	Macros            []utils.Macro
+	Rules             []utils.Rule
+	NewRule           utils.Rule // Defaults of the form for new rules
+	RuleMatches       []utils.RuleMatch
+	Queues            []utils.Queue
+	QueueFilter       int // ID of the queue shown in the overview, -1 shows all accessible queues
+	EditorMatches     []utils.EditorMatch
+	FieldDefinitions  []utils.FieldDefinition
+	NewField          utils.FieldDefinition // Defaults of the form for new custom fields
+	TicketFilter      utils.TicketFilter
+	BulkResults       []utils.BulkResult // Outcome of the bulk operation which was run on the overview
+	SavedViews        []utils.SavedView
+	CurrentView       utils.SavedView // View shown in the overview or defaults of the form for new views
+	PinnedViews       []utils.SavedView
+	ViewColumns       []string
+	Dashboard         utils.Dashboard
+	DashboardCategory string // Dashboard category the overview is restricted to, empty shows every category
+	Report            utils.Report
+	ReportCharts      []template.HTML // SVG charts of the report
+	ImportMappings    []utils.ImportMapping
+	RelatedTickets    []utils.RelatedTicket
+	OpenBlockers      []utils.Ticket // Unfinished tickets which block the current ticket
+	MergedTickets     []utils.Ticket // Tickets which were merged into the current ticket and can be restored
 }
 
 var templates *template.Template
@@ -32,12 +63,24 @@ func Setup() {
 	if err != nil {
 		log.Fatal("Cannot start the ticket system due to problems initializing the data storage...")
 	}
+	utils.RegisterWebhookDispatcher()
+	utils.RegisterAuditLog()
+	utils.RegisterNotifications()
+	utils.RegisterAutomation()
+	utils.RegisterAutoAssignment()
+	utils.RegisterTicketRelations()
 	templates = template.Must(template.ParseGlob(path.Join(config.TemplatePath, "*")))
 }
 
 func StartServer(done <-chan bool, shutdown chan<- bool) {
 	Setup()
 
+	// The lock file keeps the commands for the data folder from running beside the server
+	err := utils.LockDataFolder()
+	if err != nil {
+		log.Fatalf("Cannot start the ticket system: %v", err)
+	}
+
 	// Using http.NewServeMux() to prevent panics for multiple registrations when testing the cli tools
 	handler := http.NewServeMux()
 	handler.HandleFunc("/", ServeIndex)
@@ -46,6 +89,7 @@ func StartServer(done <-chan bool, shutdown chan<- bool) {
 	handler.HandleFunc("/signOut", ServeSignOut)
 	handler.HandleFunc("/tickets/", authenticate(ServeTickets))
 	handler.HandleFunc("/tickets/new", ServeNewTicket)
+	handler.HandleFunc("/tickets/bulk", authenticate(ServeBulkTickets))
 	handler.HandleFunc("/createTicket", ServeTicketCreation)
 	handler.HandleFunc("/error/", ServeErrorPage)
 	handler.HandleFunc("/addComment", authenticate(ServeAddComment))
@@ -53,9 +97,59 @@ func StartServer(done <-chan bool, shutdown chan<- bool) {
 	handler.HandleFunc("/releaseTicket", authenticate(ServeTicketRelease))
 	handler.HandleFunc("/closeTicket", authenticate(ServeCloseTicket))
 	handler.HandleFunc("/mergeTickets", authenticate(ServeMergeTickets))
+	handler.HandleFunc("/unmergeTicket", authenticate(ServeUnmergeTicket))
 	handler.HandleFunc("/changeHolidayMode", authenticate(ServeChangeHolidayMode))
+	handler.HandleFunc("/settings", authenticate(ServeSettings))
+	handler.HandleFunc("/cannedResponses", authenticate(ServeCannedResponses))
+	handler.HandleFunc("/cannedResponses/save", authenticate(ServeCannedResponseSave))
+	handler.HandleFunc("/cannedResponses/delete", authenticate(ServeCannedResponseDelete))
+	handler.HandleFunc("/macros", authenticate(ServeMacros))
+	handler.HandleFunc("/macros/save", authenticate(ServeMacroSave))
+	handler.HandleFunc("/macros/delete", authenticate(ServeMacroDelete))
+	handler.HandleFunc("/runMacro", authenticate(ServeRunMacro))
+	handler.HandleFunc("/views", authenticate(ServeViews))
+	handler.HandleFunc("/views/save", authenticate(ServeViewSave))
+	handler.HandleFunc("/views/delete", authenticate(ServeViewDelete))
+	handler.HandleFunc("/views/pin", authenticate(ServeViewPin))
+	handler.HandleFunc("/moveTicket", authenticate(ServeMoveTicket))
+	handler.HandleFunc("/tagTicket", authenticate(ServeTagTicket))
+	handler.HandleFunc("/ticketFields", authenticate(ServeTicketFields))
+	handler.HandleFunc("/splitTicket", authenticate(ServeSplitTicket))
+	handler.HandleFunc("/linkTicket", authenticate(ServeLinkTicket))
+	handler.HandleFunc("/unlinkTicket", authenticate(ServeUnlinkTicket))
 	handler.HandleFunc("/mails", ServeMailsAPI)
 	handler.HandleFunc("/mails/notify", ServeMailsSentNotification)
+	handler.HandleFunc("/portal", ServePortal)
+	handler.HandleFunc("/portal/login", ServePortalLogin)
+	handler.HandleFunc("/portal/signOut", ServePortalSignOut)
+	handler.HandleFunc("/portal/tickets/", authenticateClient(ServePortalTickets))
+	handler.HandleFunc("/portal/reply", authenticateClient(ServePortalReply))
+	handler.HandleFunc("/portal/closeTicket", authenticateClient(ServePortalCloseTicket))
+	handler.HandleFunc("/portal/reopenTicket", authenticateClient(ServePortalReopenTicket))
+	handler.HandleFunc("/audit", authenticate(ServeAuditLog))
+	handler.HandleFunc("/reports", authenticate(ServeReports))
+	handler.HandleFunc("/reports/export", authenticate(ServeReportExport))
+	handler.HandleFunc("/data", authenticate(ServeData))
+	handler.HandleFunc("/data/tickets", authenticate(ServeDataTickets))
+	handler.HandleFunc("/data/users", authenticate(ServeDataUsers))
+	handler.HandleFunc("/data/import", authenticate(ServeDataImport))
+	handler.HandleFunc("/data/backup", authenticate(ServeDataBackup))
+	handler.HandleFunc("/rules", authenticate(ServeRules))
+	handler.HandleFunc("/rules/save", authenticate(ServeRuleSave))
+	handler.HandleFunc("/rules/delete", authenticate(ServeRuleDelete))
+	handler.HandleFunc("/queues", authenticate(ServeQueues))
+	handler.HandleFunc("/queues/save", authenticate(ServeQueueSave))
+	handler.HandleFunc("/queues/delete", authenticate(ServeQueueDelete))
+	handler.HandleFunc("/fields", authenticate(ServeFields))
+	handler.HandleFunc("/fields/save", authenticate(ServeFieldSave))
+	handler.HandleFunc("/fields/delete", authenticate(ServeFieldDelete))
+	handler.HandleFunc("/webhooks", authenticate(ServeWebhooks))
+	handler.HandleFunc("/webhooks/redeliver", authenticate(ServeWebhookRedelivery))
+
+	stopNotifications := make(chan bool)
+	utils.StartNotificationProcessing(stopNotifications)
+	stopScheduler := make(chan bool)
+	utils.StartScheduler(stopScheduler)
 
 	server := &http.Server{Addr: "localhost:" + strconv.Itoa(config.Port), Handler: handler}
 
@@ -71,10 +165,16 @@ func StartServer(done <-chan bool, shutdown chan<- bool) {
 	<-done
 
 	log.Println("Shutting down the server...")
-	err := server.Shutdown(context.Background())
+	close(stopNotifications)
+	close(stopScheduler)
+	err = server.Shutdown(context.Background())
 	if err != nil {
 		log.Printf("Error shutting down the server: %v\n", err)
 	}
+	err = utils.UnlockDataFolder()
+	if err != nil {
+		log.Printf("Error removing the lock file of the data folder: %v\n", err)
+	}
 	log.Println("The shut down gracefully :)")
 
 	// Sending a signal back to let the server shut down gracefully and not get interrupted by the main function existing
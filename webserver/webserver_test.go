@@ -3,6 +3,7 @@ package webserver
 // Matrikelnummern: 6813128, 1665910, 7612558
 
 import (
+	"TicketSystem/config"
 	"TicketSystem/utils"
 	"bytes"
 	"github.com/stretchr/testify/assert"
@@ -30,6 +31,10 @@ func TestStartServer(t *testing.T) {
 	output := buf.String()
 	assert.Contains(t, output, "Shutting down the server...")
 	assert.Contains(t, output, "The shut down gracefully :)")
+
+	// The data folder is released again
+	_, err := os.Stat(config.LockFilePath())
+	assert.True(t, os.IsNotExist(err))
 }
 
 func TestAuthenticateWithoutCookie(t *testing.T) {